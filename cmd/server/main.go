@@ -1,13 +1,18 @@
 package main
 
 import (
+	"activity-tracker/pkg/auth"
 	"activity-tracker/pkg/config"
 	"activity-tracker/pkg/handler"
+	"activity-tracker/pkg/migrations"
 	repository "activity-tracker/pkg/respository"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	_ "time/tzdata" // users' time zones must load even without a system time zone database
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
@@ -15,45 +20,146 @@ import (
 )
 
 func main() {
-	db := ConnectToDatabase()
+	// Load configuration
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db := ConnectToDatabase(&cfg.DB)
 	defer db.Close()
 
+	migrator, err := migrations.NewMigrator(db, cfg.DB.Driver)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Handle "migrate up|down|status" instead of starting the server
+	if len(os.Args) > 1 {
+		if err := runCommand(migrator, os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Apply pending migrations before serving any requests
+	applied, err := migrator.Up()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, migration := range applied {
+		log.Printf("Applied migration %d_%s", migration.Version, migration.Name)
+	}
+
 	// Initialize repositories
 	repo := repository.NewRepository(db)
+	if cfg.DB.Driver == config.DriverSQLite {
+		repo = repository.NewSQLiteRepository(db)
+	}
+	repo.SetOverlapPolicy(repository.OverlapPolicy(cfg.UserActivities.OverlapPolicy))
+	tokens := auth.NewTokenManager(cfg.Auth.Secret, cfg.Auth.TokenTTL)
 
 	// Initialize handlers
+	authHandler := handler.NewAuthHandler(repo, tokens)
 	userHandler := handler.NewUserHandler(repo)
 	activityHandler := handler.NewActivityHandler(repo)
-	userActivityHandler := handler.NewUserActivityHandler(repo)
+	categoryHandler := handler.NewCategoryHandler(repo)
+	userActivityHandler := handler.NewUserActivityHandler(repo, repo, repo)
+	timerHandler := handler.NewTimerHandler(repo, repo)
+	statsHandler := handler.NewStatsHandler(repo, repo)
+	goalHandler := handler.NewGoalHandler(repo, repo, repo)
+	symptomHandler := handler.NewSymptomHandler(repo, repo)
+	tagHandler := handler.NewTagHandler(repo)
 
 	// Initialize router
 	router := chi.NewRouter()
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
 
-	// Register routes
-	userHandler.RegisterRoutes(router)
-	activityHandler.RegisterRoutes(router)
-	userActivityHandler.RegisterRoutes(router)
+	// Register public routes
+	authHandler.RegisterRoutes(router)
+	userHandler.RegisterPublicRoutes(router)
+
+	// Register routes that require a valid session token
+	router.Group(func(router chi.Router) {
+		router.Use(auth.Middleware(tokens, repo))
+		userHandler.RegisterRoutes(router)
+		activityHandler.RegisterRoutes(router)
+		categoryHandler.RegisterRoutes(router)
+		userActivityHandler.RegisterRoutes(router)
+		timerHandler.RegisterRoutes(router)
+		statsHandler.RegisterRoutes(router)
+		goalHandler.RegisterRoutes(router)
+		symptomHandler.RegisterRoutes(router)
+		tagHandler.RegisterRoutes(router)
+	})
 
 	// Start the HTTP server
 	log.Println("Server is running on port 8089")
 	log.Fatal(http.ListenAndServe(":8089", router))
 }
 
-func ConnectToDatabase() *sql.DB {
-	// Load configuration
-	config, err := config.LoadConfig()
-	if err != nil {
-		log.Fatal(err)
+func ConnectToDatabase(cfg *config.Config) *sql.DB {
+	if cfg.Driver == config.DriverSQLite {
+		// SQLite only enforces foreign keys when asked to, per connection.
+		// Immediate transactions take the write lock up front, so concurrent
+		// writers wait for each other instead of failing to upgrade.
+		connStr := fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate", cfg.Path)
+		db, err := sql.Open(repository.SQLiteDriver, connStr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return db
 	}
 
 	// Connect to the database
 	connStr := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
-		config.User, config.Password, config.Host, config.Port, config.DBName)
+		cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
 	db, err := sql.Open("postgres", connStr)
 	if err != nil {
 		log.Fatal(err)
 	}
 	return db
 }
+
+// runCommand executes a command-line subcommand such as "migrate up".
+func runCommand(migrator *migrations.Migrator, args []string) error {
+	if args[0] != "migrate" || len(args) != 2 {
+		return errors.New("usage: server [migrate up|down|status]")
+	}
+
+	switch args[1] {
+	case "up":
+		applied, err := migrator.Up()
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("No pending migrations")
+		}
+		for _, migration := range applied {
+			fmt.Printf("Applied %d_%s\n", migration.Version, migration.Name)
+		}
+	case "down":
+		migration, err := migrator.Down()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rolled back %d_%s\n", migration.Version, migration.Name)
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%d_%s\t%s\n", status.Version, status.Name, state)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", args[1])
+	}
+	return nil
+}
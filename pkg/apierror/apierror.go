@@ -0,0 +1,46 @@
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Machine-readable error codes. Clients should branch on these rather than on
+// the HTTP status or the message.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeInvalidReference = "invalid_reference"
+	CodeValidation       = "validation_failed"
+	CodeInternal         = "internal_error"
+)
+
+// FieldError describes a problem with a single request field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is the body of every error response.
+type Error struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Details []FieldError `json:"details,omitempty"`
+}
+
+// Response is the JSON envelope wrapping an Error.
+type Response struct {
+	Error Error `json:"error"`
+}
+
+// Write sends a JSON error response with the given status, code and message,
+// and optional per-field details.
+func Write(w http.ResponseWriter, status int, code, message string, details ...FieldError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Response{Error: Error{Code: code, Message: message, Details: details}})
+}
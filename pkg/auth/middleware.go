@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"activity-tracker/pkg/apierror"
+	"activity-tracker/pkg/model"
+	repository "activity-tracker/pkg/respository"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+type contextKey struct{}
+
+// userContextKey is the request context key holding the authenticated *model.User.
+var userContextKey = contextKey{}
+
+// WithUser returns a copy of ctx carrying the authenticated user.
+func WithUser(ctx context.Context, user *model.User) context.Context {
+	return context.WithValue(ctx, userContextKey, user)
+}
+
+// UserFromContext returns the authenticated user stored on the request context.
+func UserFromContext(ctx context.Context) (*model.User, bool) {
+	user, ok := ctx.Value(userContextKey).(*model.User)
+	return user, ok
+}
+
+// Middleware resolves the "Authorization: Bearer <token>" header into the
+// authenticated user and stores it on the request context. Requests without a
+// valid token for an existing user are rejected with 401 Unauthorized.
+func Middleware(tokens *TokenManager, users repository.UserStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !found || token == "" {
+				unauthorized(w)
+				return
+			}
+
+			userID, err := tokens.Verify(token)
+			if err != nil {
+				unauthorized(w)
+				return
+			}
+
+			user, err := users.GetUser(userID)
+			if errors.Is(err, repository.ErrUserNotFound) {
+				unauthorized(w)
+				return
+			} else if err != nil {
+				log.Printf("Error retrieving authenticated user: %v", err)
+				apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to authenticate")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+		})
+	}
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="activity-tracker"`)
+	apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "A valid session token is required")
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidToken is returned when a session token is malformed, expired or
+// was not signed by this service.
+var ErrInvalidToken = errors.New("invalid session token")
+
+// TokenManager issues and verifies HMAC-signed JWT session tokens.
+type TokenManager struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewTokenManager creates a new TokenManager that signs tokens with secret
+// and makes them valid for ttl.
+func NewTokenManager(secret string, ttl time.Duration) *TokenManager {
+	return &TokenManager{secret: []byte(secret), ttl: ttl, now: time.Now}
+}
+
+// Issue returns a signed token identifying the user and when it expires.
+func (m *TokenManager) Issue(userID int64) (string, time.Time, error) {
+	issuedAt := m.now()
+	expiresAt := issuedAt.Add(m.ttl)
+	claims := jwt.RegisteredClaims{
+		Subject:   strconv.FormatInt(userID, 10),
+		IssuedAt:  jwt.NewNumericDate(issuedAt),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(m.secret)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("could not sign token: %w", err)
+	}
+	return token, expiresAt, nil
+}
+
+// Verify checks the token's signature and expiry and returns the user ID it identifies.
+func (m *TokenManager) Verify(token string) (int64, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return m.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithTimeFunc(m.now), jwt.WithExpirationRequired())
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid subject", ErrInvalidToken)
+	}
+	return userID, nil
+}
@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIssueAndVerify(t *testing.T) {
+	tokens := NewTokenManager("secret", time.Hour)
+
+	token, expiresAt, err := tokens.Issue(42)
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, time.Minute)
+
+	userID, err := tokens.Verify(token)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), userID)
+
+	// A token signed with another secret is rejected
+	_, err = NewTokenManager("other secret", time.Hour).Verify(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// So is an expired one
+	tokens.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, err = tokens.Verify(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -14,10 +15,20 @@ import (
 var configFile embed.FS
 
 type RootConfig struct {
-	DB Config `yaml:"db"`
+	DB             Config             `yaml:"db"`
+	Auth           AuthConfig         `yaml:"auth"`
+	UserActivities UserActivityConfig `yaml:"user_activities"`
 }
 
+// Supported values for the db.driver setting.
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
 type Config struct {
+	Driver   string `yaml:"driver"`
+	Path     string `yaml:"path"` // SQLite database file, only used by the sqlite driver
 	Host     string `yaml:"host"`
 	Port     int    `yaml:"port"`
 	User     string `yaml:"user"`
@@ -25,7 +36,23 @@ type Config struct {
 	DBName   string `yaml:"dbname"`
 }
 
-func LoadConfig() (*Config, error) {
+type AuthConfig struct {
+	Secret   string        `yaml:"secret"` // HMAC key used to sign session tokens
+	TokenTTL time.Duration `yaml:"token_ttl"`
+}
+
+// Supported values for the user_activities.overlap_policy setting.
+const (
+	OverlapReject = "reject"
+	OverlapWarn   = "warn"
+	OverlapTrim   = "trim"
+)
+
+type UserActivityConfig struct {
+	OverlapPolicy string `yaml:"overlap_policy"` // What to do when a user's activities overlap
+}
+
+func LoadConfig() (*RootConfig, error) {
 	var rootConfig RootConfig
 
 	// Load configuration from file
@@ -40,6 +67,12 @@ func LoadConfig() (*Config, error) {
 	}
 
 	// Override with environment variables if available
+	if driver, exists := os.LookupEnv("DB_DRIVER"); exists {
+		rootConfig.DB.Driver = driver
+	}
+	if path, exists := os.LookupEnv("DB_PATH"); exists {
+		rootConfig.DB.Path = path
+	}
 	if host, exists := os.LookupEnv("DB_HOST"); exists {
 		rootConfig.DB.Host = host
 	}
@@ -59,10 +92,52 @@ func LoadConfig() (*Config, error) {
 		rootConfig.DB.DBName = dbname
 	}
 
-	// Check if the user is unconfigured
-	if rootConfig.DB.User == "TBD" {
-		return nil, errors.New("Please configure the database credentials in the config.yaml file")
+	if secret, exists := os.LookupEnv("AUTH_SECRET"); exists {
+		rootConfig.Auth.Secret = secret
+	}
+	if ttl, exists := os.LookupEnv("AUTH_TOKEN_TTL"); exists {
+		rootConfig.Auth.TokenTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AUTH_TOKEN_TTL: %v", err)
+		}
+	}
+
+	if policy, exists := os.LookupEnv("OVERLAP_POLICY"); exists {
+		rootConfig.UserActivities.OverlapPolicy = policy
+	}
+
+	switch rootConfig.DB.Driver {
+	case "", DriverPostgres:
+		rootConfig.DB.Driver = DriverPostgres
+
+		// Check if the user is unconfigured
+		if rootConfig.DB.User == "TBD" {
+			return nil, errors.New("Please configure the database credentials in the config.yaml file")
+		}
+	case DriverSQLite:
+		if rootConfig.DB.Path == "" {
+			return nil, errors.New("Please configure db.path for the sqlite driver")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported db.driver %q, expected %q or %q", rootConfig.DB.Driver, DriverPostgres, DriverSQLite)
+	}
+
+	// Check if the token signing secret is unconfigured
+	if rootConfig.Auth.Secret == "TBD" || rootConfig.Auth.Secret == "" {
+		return nil, errors.New("Please configure auth.secret in the config.yaml file")
+	}
+	if rootConfig.Auth.TokenTTL <= 0 {
+		return nil, errors.New("auth.token_ttl must be a positive duration")
+	}
+
+	switch rootConfig.UserActivities.OverlapPolicy {
+	case "":
+		rootConfig.UserActivities.OverlapPolicy = OverlapReject
+	case OverlapReject, OverlapWarn, OverlapTrim:
+	default:
+		return nil, fmt.Errorf("unsupported user_activities.overlap_policy %q, expected %q, %q or %q",
+			rootConfig.UserActivities.OverlapPolicy, OverlapReject, OverlapWarn, OverlapTrim)
 	}
 
-	return &rootConfig.DB, nil
+	return &rootConfig, nil
 }
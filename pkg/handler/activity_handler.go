@@ -3,8 +3,8 @@ package handler
 import (
 	"activity-tracker/pkg/model"
 	repository "activity-tracker/pkg/respository"
+	"activity-tracker/pkg/validation"
 	"encoding/json"
-	"errors"
 	"net/http"
 	"strconv"
 
@@ -13,33 +13,52 @@ import (
 
 // ActivityHandler handles HTTP requests related to activities.
 type ActivityHandler struct {
-	activityRepo *repository.Repository
+	activityRepo repository.ActivityStore
+}
+
+// activityPage is one page of the activity catalog. NextOffset is set when
+// there may be more activities after this page.
+type activityPage struct {
+	Items      []activityResponse `json:"items"`
+	NextOffset *int               `json:"next_offset,omitempty"`
 }
 
 // NewActivityHandler creates a new ActivityHandler instance.
-func NewActivityHandler(activityRepo *repository.Repository) *ActivityHandler {
+func NewActivityHandler(activityRepo repository.ActivityStore) *ActivityHandler {
 	return &ActivityHandler{activityRepo: activityRepo}
 }
 
-// RegisterRoutes registers the activity routes.
+// RegisterRoutes registers the activity routes. Users see the global
+// activities, which only admins may change, and their own private activities.
 func (h *ActivityHandler) RegisterRoutes(router chi.Router) {
 	router.Post("/activities", h.CreateActivity)
+	router.Get("/activities", h.ListActivities)
 	router.Get("/activities/{activityID}", h.GetActivity)
+	router.Get("/activities/{activityID}/schema", h.GetActivitySchema)
 	router.Put("/activities/{activityID}", h.UpdateActivity)
 	router.Delete("/activities/{activityID}", h.DeleteActivity)
 }
 
-// CreateActivity handles the creation of a new activity.
+// CreateActivity handles the creation of a new activity, private to the
+// authenticated user unless an admin asks for a global one.
 func (h *ActivityHandler) CreateActivity(w http.ResponseWriter, r *http.Request) {
-	var activity model.Activity
-	if err := json.NewDecoder(r.Body).Decode(&activity); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var request activityRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeBadRequest(w, "Invalid request body")
+		return
+	}
+	if err := request.validate(); err != nil {
+		writeValidationError(w, err)
 		return
 	}
+	if request.global() && !authorizeAdmin(w, r, "Only admins may manage global activities") {
+		return
+	}
+	activity := request.toModel(0, authenticatedUserID(r))
 
 	activityID, err := h.activityRepo.CreateActivity(&activity)
 	if err != nil {
-		http.Error(w, "Failed to create activity", http.StatusInternalServerError)
+		writeRepositoryError(w, err, "Failed to create activity")
 		return
 	}
 
@@ -50,42 +69,105 @@ func (h *ActivityHandler) CreateActivity(w http.ResponseWriter, r *http.Request)
 
 // GetActivity handles retrieving an activity by ID.
 func (h *ActivityHandler) GetActivity(w http.ResponseWriter, r *http.Request) {
-	activityID, err := strconv.ParseInt(chi.URLParam(r, "activityID"), 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid activity ID", http.StatusBadRequest)
+	activity, ok := h.loadActivity(w, r, "Failed to retrieve activity")
+	if !ok {
 		return
 	}
 
-	activity, err := h.activityRepo.GetActivity(activityID)
-	if errors.Is(err, repository.ErrActivityNotFound) {
-		http.Error(w, "Activity not found", http.StatusNotFound)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newActivityResponse(activity))
+}
+
+// GetActivitySchema handles retrieving the attribute schema of an activity,
+// from which clients can build the form for a user activity's attributes.
+func (h *ActivityHandler) GetActivitySchema(w http.ResponseWriter, r *http.Request) {
+	activity, ok := h.loadActivity(w, r, "Failed to retrieve activity schema")
+	if !ok {
 		return
-	} else if err != nil {
-		http.Error(w, "Failed to retrieve activity", http.StatusInternalServerError)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newActivitySchemaResponse(activity))
+}
+
+// ListActivities handles searching the activities visible to the
+// authenticated user by name. It accepts the query parameters q, match
+// (prefix or contains), scope (global or private), limit and offset.
+func (h *ActivityHandler) ListActivities(w http.ResponseWriter, r *http.Request) {
+	filter := repository.ActivityFilter{
+		UserID: authenticatedUserID(r),
+		Query:  r.URL.Query().Get("q"),
+		Match:  r.URL.Query().Get("match"),
+		Scope:  r.URL.Query().Get("scope"),
+	}
+	if filter.Match != "" && filter.Match != repository.MatchPrefix && filter.Match != repository.MatchContains {
+		writeBadRequest(w, "Invalid match: must be prefix or contains")
+		return
+	}
+	if filter.Scope != "" && filter.Scope != repository.ScopeGlobal && filter.Scope != repository.ScopePrivate {
+		writeBadRequest(w, "Invalid scope: must be global or private")
 		return
 	}
 
+	var err error
+	if filter.Limit, err = queryLimit(r); err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	offset, err := queryInt(r, "offset")
+	if err != nil || (offset != nil && *offset < 0) {
+		writeBadRequest(w, "Invalid offset: must be a non-negative integer")
+		return
+	}
+	if offset != nil {
+		filter.Offset = *offset
+	}
+
+	activities, err := h.activityRepo.ListActivities(filter)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to list activities")
+		return
+	}
+
+	response := activityPage{Items: newActivityResponses(activities)}
+	if len(activities) == filter.Limit {
+		nextOffset := filter.Offset + filter.Limit
+		response.NextOffset = &nextOffset
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(activity)
+	json.NewEncoder(w).Encode(response)
 }
 
-// UpdateActivity handles updating an activity by ID.
+// UpdateActivity handles updating an activity by ID. Its scope cannot be
+// changed.
 func (h *ActivityHandler) UpdateActivity(w http.ResponseWriter, r *http.Request) {
-	activityID, err := strconv.ParseInt(chi.URLParam(r, "activityID"), 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid activity ID", http.StatusBadRequest)
+	existing, ok := h.loadActivityForChange(w, r)
+	if !ok {
 		return
 	}
 
-	var activity model.Activity
-	if err := json.NewDecoder(r.Body).Decode(&activity); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var request activityRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeBadRequest(w, "Invalid request body")
 		return
 	}
-	activity.ID = activityID
+	scope := activityScope(existing)
+	if request.Scope == "" {
+		request.Scope = scope
+	}
+	if err := request.validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if request.Scope != scope {
+		writeValidationError(w, validation.Validate(validation.Field("scope", validation.That(false, "cannot be changed"))))
+		return
+	}
+	activity := request.toModel(existing.ID, authenticatedUserID(r))
 
-	if err := h.activityRepo.UpdateActivity(&activity); err != nil {
-		http.Error(w, "Failed to update activity", http.StatusInternalServerError)
+	err := h.activityRepo.UpdateActivity(&activity)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to update activity")
 		return
 	}
 
@@ -94,16 +176,47 @@ func (h *ActivityHandler) UpdateActivity(w http.ResponseWriter, r *http.Request)
 
 // DeleteActivity handles deleting an activity by ID.
 func (h *ActivityHandler) DeleteActivity(w http.ResponseWriter, r *http.Request) {
-	activityID, err := strconv.ParseInt(chi.URLParam(r, "activityID"), 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid activity ID", http.StatusBadRequest)
+	activity, ok := h.loadActivityForChange(w, r)
+	if !ok {
 		return
 	}
 
-	if err := h.activityRepo.DeleteActivity(activityID); err != nil {
-		http.Error(w, "Failed to delete activity", http.StatusInternalServerError)
+	if err := h.activityRepo.DeleteActivity(activity.ID); err != nil {
+		writeRepositoryError(w, err, "Failed to delete activity")
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// loadActivity parses the activity ID in the path and retrieves the activity
+// if it is visible to the authenticated user, writing an error response with
+// message if it cannot.
+func (h *ActivityHandler) loadActivity(w http.ResponseWriter, r *http.Request, message string) (*model.Activity, bool) {
+	activityID, err := strconv.ParseInt(chi.URLParam(r, "activityID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid activity ID")
+		return nil, false
+	}
+
+	activity, err := h.activityRepo.GetActivity(authenticatedUserID(r), activityID)
+	if err != nil {
+		writeRepositoryError(w, err, message)
+		return nil, false
+	}
+	return activity, true
+}
+
+// loadActivityForChange retrieves the activity in the path as loadActivity
+// does, and writes a 403 response unless the authenticated user may change
+// it: global activities are changed by admins only.
+func (h *ActivityHandler) loadActivityForChange(w http.ResponseWriter, r *http.Request) (*model.Activity, bool) {
+	activity, ok := h.loadActivity(w, r, "Failed to retrieve activity")
+	if !ok {
+		return nil, false
+	}
+	if activity.OwnerID == nil && !authorizeAdmin(w, r, "Only admins may manage global activities") {
+		return nil, false
+	}
+	return activity, true
+}
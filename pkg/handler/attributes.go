@@ -0,0 +1,221 @@
+package handler
+
+import (
+	"activity-tracker/pkg/model"
+	"activity-tracker/pkg/validation"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxAttributeFields     = 50
+	maxAttributeNameLength = 50
+	maxAttributeUnitLength = 20
+	maxAttributeTextLength = 500
+)
+
+// attributeField is one field of an activity's attribute schema as sent and
+// returned by the API.
+type attributeField struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Unit     string   `json:"unit,omitempty"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+	Values   []string `json:"values,omitempty"`
+	Required bool     `json:"required"`
+}
+
+// attributeSchema is an activity's attribute schema as sent and returned by
+// the API. An empty schema accepts free-form attributes.
+type attributeSchema struct {
+	Fields []attributeField `json:"fields"`
+}
+
+// rules returns the validation rules for a schema sent by a client.
+func (schema attributeSchema) rules() []validation.Rule {
+	rules := []validation.Rule{
+		validation.Field("attribute_schema.fields",
+			validation.That(len(schema.Fields) <= maxAttributeFields, fmt.Sprintf("must have at most %d fields", maxAttributeFields))),
+	}
+	seen := make(map[string]bool)
+	for i, field := range schema.Fields {
+		prefix := fmt.Sprintf("attribute_schema.fields[%d].", i)
+		rules = append(rules,
+			validation.Field(prefix+"name",
+				validation.NotBlank(field.Name),
+				validation.MaxLength(field.Name, maxAttributeNameLength),
+				validation.That(model.ValidAttributeName(field.Name), "must only contain letters, digits and underscores"),
+				validation.That(!seen[field.Name], "must be unique")),
+			validation.Field(prefix+"type", validation.That(knownAttributeType(field.Type), "must be number, enum, text or boolean")),
+			validation.Field(prefix+"unit", validation.MaxLength(field.Unit, maxAttributeUnitLength)),
+			validation.Field(prefix+"min", validation.That(field.Min == nil || field.Type == string(model.AttributeNumber), "is only allowed for number fields")),
+			validation.Field(prefix+"max",
+				validation.That(field.Max == nil || field.Type == string(model.AttributeNumber), "is only allowed for number fields"),
+				validation.That(field.Min == nil || field.Max == nil || *field.Min <= *field.Max, "must not be less than min")),
+			validation.Field(prefix+"values", enumValuesChecks(field)...),
+		)
+		seen[field.Name] = true
+	}
+	return rules
+}
+
+// knownAttributeType reports whether value names an attribute type.
+func knownAttributeType(value string) bool {
+	switch model.AttributeType(value) {
+	case model.AttributeNumber, model.AttributeEnum, model.AttributeText, model.AttributeBoolean:
+		return true
+	}
+	return false
+}
+
+// enumValuesChecks returns the checks for the values of a schema field, which
+// enum fields must list and other fields must leave out.
+func enumValuesChecks(field attributeField) []validation.Check {
+	if field.Type != string(model.AttributeEnum) {
+		return []validation.Check{validation.That(len(field.Values) == 0, "is only allowed for enum fields")}
+	}
+	blank, duplicate := false, false
+	seen := make(map[string]bool)
+	for _, value := range field.Values {
+		blank = blank || strings.TrimSpace(value) == ""
+		duplicate = duplicate || seen[value]
+		seen[value] = true
+	}
+	return []validation.Check{
+		validation.That(len(field.Values) > 0, "must not be empty for enum fields"),
+		validation.That(!blank, "must not contain blank values"),
+		validation.That(!duplicate, "must not contain duplicates"),
+	}
+}
+
+// toModel converts a valid schema into its model representation.
+func (schema attributeSchema) toModel() model.AttributeSchema {
+	fields := make([]model.AttributeField, 0, len(schema.Fields))
+	for _, field := range schema.Fields {
+		fields = append(fields, model.AttributeField{
+			Name:     field.Name,
+			Type:     model.AttributeType(field.Type),
+			Unit:     field.Unit,
+			Min:      field.Min,
+			Max:      field.Max,
+			Values:   field.Values,
+			Required: field.Required,
+		})
+	}
+	return model.AttributeSchema{Fields: fields}
+}
+
+// newAttributeSchema converts an attribute schema into its API representation.
+func newAttributeSchema(schema model.AttributeSchema) attributeSchema {
+	fields := make([]attributeField, 0, len(schema.Fields))
+	for _, field := range schema.Fields {
+		fields = append(fields, attributeField{
+			Name:     field.Name,
+			Type:     string(field.Type),
+			Unit:     field.Unit,
+			Min:      field.Min,
+			Max:      field.Max,
+			Values:   field.Values,
+			Required: field.Required,
+		})
+	}
+	return attributeSchema{Fields: fields}
+}
+
+// attributeRules returns the validation rules for the additional attributes
+// of a user activity of an activity with the given schema. Every attribute
+// must be declared by the schema and match its field, and required fields
+// must be given. If the schema has no fields, any attribute is accepted as
+// long as its value is a number, string or boolean.
+func attributeRules(schema model.AttributeSchema, attributes map[string]interface{}) []validation.Rule {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var rules []validation.Rule
+	for _, name := range names {
+		value := attributes[name]
+		if len(schema.Fields) == 0 {
+			rules = append(rules, validation.Field("additional_attributes."+name, validation.That(value == nil || isScalar(value), "must be a number, string or boolean")))
+		} else if _, ok := schema.Field(name); !ok {
+			rules = append(rules, validation.Field("additional_attributes."+name, validation.That(false, "is not an attribute of the activity")))
+		}
+	}
+	for _, field := range schema.Fields {
+		rules = append(rules, validation.Field("additional_attributes."+field.Name, attributeChecks(field, attributes[field.Name])...))
+	}
+	return rules
+}
+
+// attributeChecks returns the checks for the value of a schema field, which
+// is nil if it was not given.
+func attributeChecks(field model.AttributeField, value interface{}) []validation.Check {
+	if value == nil {
+		return []validation.Check{validation.That(!field.Required, "is required")}
+	}
+
+	switch field.Type {
+	case model.AttributeNumber:
+		number, ok := value.(float64)
+		return []validation.Check{
+			validation.That(ok, "must be a number"),
+			validation.That(field.Min == nil || number >= *field.Min, "must be at least "+formatNumber(field.Min)),
+			validation.That(field.Max == nil || number <= *field.Max, "must be at most "+formatNumber(field.Max)),
+		}
+	case model.AttributeEnum:
+		text, ok := value.(string)
+		allowed := false
+		for _, option := range field.Values {
+			allowed = allowed || option == text
+		}
+		return []validation.Check{
+			validation.That(ok, "must be a string"),
+			validation.That(allowed, "must be one of "+strings.Join(field.Values, ", ")),
+		}
+	case model.AttributeText:
+		text, ok := value.(string)
+		return []validation.Check{
+			validation.That(ok, "must be a string"),
+			validation.That(utf8.RuneCountInString(text) <= maxAttributeTextLength, fmt.Sprintf("must be at most %d characters", maxAttributeTextLength)),
+		}
+	case model.AttributeBoolean:
+		_, ok := value.(bool)
+		return []validation.Check{validation.That(ok, "must be a boolean")}
+	}
+	return nil
+}
+
+// isScalar reports whether a decoded JSON value is a number, string or boolean.
+func isScalar(value interface{}) bool {
+	switch value.(type) {
+	case float64, string, bool:
+		return true
+	}
+	return false
+}
+
+// formatNumber formats an optional range limit for a message.
+func formatNumber(value *float64) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*value, 'f', -1, 64)
+}
+
+// withoutNulls returns the attributes that have a value, since a null
+// attribute is treated as not given.
+func withoutNulls(attributes map[string]interface{}) model.AdditionalAttributes {
+	result := make(model.AdditionalAttributes, len(attributes))
+	for name, value := range attributes {
+		if value != nil {
+			result[name] = value
+		}
+	}
+	return result
+}
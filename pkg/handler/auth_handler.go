@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"activity-tracker/pkg/apierror"
+	"activity-tracker/pkg/auth"
+	repository "activity-tracker/pkg/respository"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// AuthHandler handles HTTP requests related to authentication.
+type AuthHandler struct {
+	userRepo repository.UserStore
+	tokens   *auth.TokenManager
+}
+
+// loginRequest is the body accepted by the login endpoint.
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// loginResponse carries the session token issued on a successful login.
+type loginResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UserID    int64     `json:"user_id"`
+}
+
+// NewAuthHandler creates a new AuthHandler instance.
+func NewAuthHandler(userRepo repository.UserStore, tokens *auth.TokenManager) *AuthHandler {
+	return &AuthHandler{userRepo: userRepo, tokens: tokens}
+}
+
+// RegisterRoutes registers the authentication routes. They must not be
+// behind the auth middleware.
+func (h *AuthHandler) RegisterRoutes(router chi.Router) {
+	router.Post("/auth/login", h.Login)
+}
+
+// Login handles checking a username and password and issuing a session token.
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var request loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeBadRequest(w, "Invalid request body")
+		return
+	}
+
+	user, err := h.userRepo.VerifyCredentials(request.Username, request.Password)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to log in")
+		return
+	}
+
+	token, expiresAt, err := h.tokens.Issue(user.ID)
+	if err != nil {
+		writeInternalError(w, err, "Failed to log in")
+		return
+	}
+
+	response := loginResponse{Token: token, ExpiresAt: expiresAt, UserID: user.ID}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// authenticatedUserID returns the ID of the user the auth middleware resolved
+// for the request.
+func authenticatedUserID(r *http.Request) int64 {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		// Only reachable if a route is registered outside the auth middleware
+		panic("handler: no authenticated user on the request context")
+	}
+	return user.ID
+}
+
+// authorizeAdmin reports whether the authenticated user is an admin, writing a
+// 403 response if not.
+func authorizeAdmin(w http.ResponseWriter, r *http.Request, message string) bool {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok || !user.IsAdmin {
+		writeError(w, http.StatusForbidden, apierror.CodeForbidden, message)
+		return false
+	}
+	return true
+}
+
+// authorizeUser reports whether the authenticated user may access the
+// resources of userID, writing a 403 response if not.
+func authorizeUser(w http.ResponseWriter, r *http.Request, userID int64) bool {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok || user.ID != userID {
+		writeError(w, http.StatusForbidden, apierror.CodeForbidden, "You may only access your own resources")
+		return false
+	}
+	return true
+}
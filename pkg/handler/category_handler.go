@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"activity-tracker/pkg/model"
+	repository "activity-tracker/pkg/respository"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+// CategoryHandler handles HTTP requests related to the tree of categories
+// that activities are filed under.
+type CategoryHandler struct {
+	categoryRepo repository.CategoryStore
+}
+
+// NewCategoryHandler creates a new CategoryHandler instance.
+func NewCategoryHandler(categoryRepo repository.CategoryStore) *CategoryHandler {
+	return &CategoryHandler{categoryRepo: categoryRepo}
+}
+
+// RegisterRoutes registers the category routes. Categories are shared by
+// every user, so only admins may change them.
+func (h *CategoryHandler) RegisterRoutes(router chi.Router) {
+	router.Post("/categories", h.CreateCategory)
+	router.Get("/categories", h.ListCategories)
+	router.Get("/categories/tree", h.GetCategoryTree)
+	router.Get("/categories/{categoryID}", h.GetCategory)
+	router.Get("/categories/{categoryID}/tree", h.GetCategorySubtree)
+	router.Put("/categories/{categoryID}", h.UpdateCategory)
+	router.Delete("/categories/{categoryID}", h.DeleteCategory)
+}
+
+// CreateCategory handles the creation of a new category.
+func (h *CategoryHandler) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAdmin(w, r, "Only admins may manage categories") {
+		return
+	}
+	request, ok := decodeCategoryRequest(w, r)
+	if !ok {
+		return
+	}
+	category := request.toModel(0)
+
+	categoryID, err := h.categoryRepo.CreateCategory(&category)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to create category")
+		return
+	}
+
+	response := map[string]int64{"category_id": categoryID}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListCategories handles listing every category, ordered by name.
+func (h *CategoryHandler) ListCategories(w http.ResponseWriter, r *http.Request) {
+	categories, err := h.categoryRepo.ListCategories()
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to list categories")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newCategoryResponses(categories))
+}
+
+// GetCategoryTree handles retrieving the top-level categories, each with its
+// subcategories nested under it.
+func (h *CategoryHandler) GetCategoryTree(w http.ResponseWriter, r *http.Request) {
+	categories, err := h.categoryRepo.ListCategories()
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to retrieve category tree")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newCategoryTree(categories, nil))
+}
+
+// GetCategory handles retrieving a category by ID.
+func (h *CategoryHandler) GetCategory(w http.ResponseWriter, r *http.Request) {
+	category, ok := h.loadCategory(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newCategoryResponse(category))
+}
+
+// GetCategorySubtree handles retrieving a category with its subcategories
+// nested under it.
+func (h *CategoryHandler) GetCategorySubtree(w http.ResponseWriter, r *http.Request) {
+	category, ok := h.loadCategory(w, r)
+	if !ok {
+		return
+	}
+	categories, err := h.categoryRepo.ListCategories()
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to retrieve category tree")
+		return
+	}
+
+	response := categoryTreeResponse{
+		categoryResponse: newCategoryResponse(category),
+		Children:         newCategoryTree(categories, &category.ID),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// UpdateCategory handles renaming a category or moving it under another
+// parent, along with its subcategories.
+func (h *CategoryHandler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := strconv.ParseInt(chi.URLParam(r, "categoryID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid category ID")
+		return
+	}
+	if !authorizeAdmin(w, r, "Only admins may manage categories") {
+		return
+	}
+
+	request, ok := decodeCategoryRequest(w, r)
+	if !ok {
+		return
+	}
+	category := request.toModel(categoryID)
+
+	if err := h.categoryRepo.UpdateCategory(&category); err != nil {
+		writeRepositoryError(w, err, "Failed to update category")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteCategory handles deleting a category by ID. Categories with
+// subcategories or activities cannot be deleted.
+func (h *CategoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := strconv.ParseInt(chi.URLParam(r, "categoryID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid category ID")
+		return
+	}
+	if !authorizeAdmin(w, r, "Only admins may manage categories") {
+		return
+	}
+
+	if err := h.categoryRepo.DeleteCategory(categoryID); err != nil {
+		writeRepositoryError(w, err, "Failed to delete category")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeCategoryRequest reads and validates the category in the request
+// body, writing an error response if it is not valid.
+func decodeCategoryRequest(w http.ResponseWriter, r *http.Request) (categoryRequest, bool) {
+	var request categoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeBadRequest(w, "Invalid request body")
+		return request, false
+	}
+	if err := request.validate(); err != nil {
+		writeValidationError(w, err)
+		return request, false
+	}
+	return request, true
+}
+
+// loadCategory parses the category ID in the path and retrieves the category,
+// writing an error response if it cannot.
+func (h *CategoryHandler) loadCategory(w http.ResponseWriter, r *http.Request) (*model.Category, bool) {
+	categoryID, err := strconv.ParseInt(chi.URLParam(r, "categoryID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid category ID")
+		return nil, false
+	}
+
+	category, err := h.categoryRepo.GetCategory(categoryID)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to retrieve category")
+		return nil, false
+	}
+	return category, true
+}
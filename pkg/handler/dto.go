@@ -0,0 +1,1093 @@
+package handler
+
+import (
+	"activity-tracker/pkg/model"
+	repository "activity-tracker/pkg/respository"
+	"activity-tracker/pkg/validation"
+	"math"
+	"strings"
+	"time"
+)
+
+// The types in this file are the JSON API contract. They are kept separate
+// from the model structs, and converted explicitly, so that the wire format
+// can evolve without changing how records are stored. Field names are
+// snake_case, timestamps are RFC 3339 and durations are whole seconds.
+// Request types have a validate method listing the rules for each field.
+
+const (
+	maxUsernameLength     = 50
+	minPasswordLength     = 8
+	maxPasswordBytes      = 72 // bcrypt ignores anything longer
+	maxActivityNameLength = 100
+	maxBodyAreaLength     = 50
+	maxSymptomNotesLength = 2000
+	maxTagNameLength      = 50
+	maxCategoryNameLength = 100
+)
+
+// userRequest is the body accepted when creating or updating a user.
+type userRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	TimeZone string `json:"time_zone"`
+}
+
+// validate checks the request. The password may only be left out when
+// updating, in which case it is not changed. Leaving out the time zone keeps
+// the user's, which is UTC for new users.
+func (request userRequest) validate(creating bool) error {
+	rules := []validation.Rule{
+		validation.Field("username", validation.NotBlank(request.Username), validation.MaxLength(request.Username, maxUsernameLength)),
+	}
+	if creating || request.Password != "" {
+		rules = append(rules, validation.Field("password",
+			validation.MinLength(request.Password, minPasswordLength),
+			validation.MaxBytes(request.Password, maxPasswordBytes)))
+	}
+	if request.TimeZone != "" {
+		_, err := model.LoadTimeZone(request.TimeZone)
+		rules = append(rules, validation.Field("time_zone", validation.That(err == nil, "must be an IANA time zone such as Europe/Berlin")))
+	}
+	return validation.Validate(rules...)
+}
+
+// toModel converts the request into a user with the given ID.
+func (request userRequest) toModel(userID int64) model.User {
+	return model.User{ID: userID, Username: request.Username, Password: request.Password, TimeZone: request.TimeZone}
+}
+
+// userResponse is a user as returned by the API. It never includes the password.
+type userResponse struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	TimeZone  string    `json:"time_zone"`
+	IsAdmin   bool      `json:"is_admin"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// newUserResponse converts a user into its API representation.
+func newUserResponse(user *model.User) userResponse {
+	timeZone := user.TimeZone
+	if timeZone == "" {
+		timeZone = model.DefaultTimeZone
+	}
+	return userResponse{ID: user.ID, Username: user.Username, TimeZone: timeZone, IsAdmin: user.IsAdmin, CreatedAt: user.CreatedAt}
+}
+
+// adminRequest is the body accepted when granting or revoking admin rights.
+type adminRequest struct {
+	IsAdmin bool `json:"is_admin"`
+}
+
+// activityRequest is the body accepted when creating or updating an activity.
+// Leaving out attribute_schema gives the activity an empty schema, and leaving
+// out category_id leaves it uncategorized. The scope is global or private,
+// which is the default; it is chosen when the activity is created.
+type activityRequest struct {
+	Name            string          `json:"name"`
+	AttributeSchema attributeSchema `json:"attribute_schema"`
+	CategoryID      *int64          `json:"category_id"`
+	Scope           string          `json:"scope"`
+}
+
+// validate checks the request.
+func (request activityRequest) validate() error {
+	rules := []validation.Rule{
+		validation.Field("name", validation.NotBlank(request.Name), validation.MaxLength(request.Name, maxActivityNameLength)),
+		validation.Field("scope", validation.That(request.Scope == "" || request.Scope == repository.ScopeGlobal ||
+			request.Scope == repository.ScopePrivate, "must be global or private")),
+	}
+	if request.CategoryID != nil {
+		rules = append(rules, validation.Field("category_id", validation.Positive(*request.CategoryID)))
+	}
+	return validation.Validate(append(rules, request.AttributeSchema.rules()...)...)
+}
+
+// global reports whether the request is for a global activity.
+func (request activityRequest) global() bool {
+	return request.Scope == repository.ScopeGlobal
+}
+
+// toModel converts the request into an activity with the given ID, owned by
+// userID unless it is global.
+func (request activityRequest) toModel(activityID, userID int64) model.Activity {
+	activity := model.Activity{
+		ID:              activityID,
+		Name:            request.Name,
+		AttributeSchema: request.AttributeSchema.toModel(),
+		CategoryID:      request.CategoryID,
+	}
+	if !request.global() {
+		activity.OwnerID = &userID
+	}
+	return activity
+}
+
+// activityResponse is an activity as returned by the API.
+type activityResponse struct {
+	ID              int64           `json:"id"`
+	Name            string          `json:"name"`
+	AttributeSchema attributeSchema `json:"attribute_schema"`
+	CategoryID      *int64          `json:"category_id"`
+	Scope           string          `json:"scope"`
+}
+
+// newActivityResponse converts an activity into its API representation.
+func newActivityResponse(activity *model.Activity) activityResponse {
+	return activityResponse{
+		ID:              activity.ID,
+		Name:            activity.Name,
+		AttributeSchema: newAttributeSchema(activity.AttributeSchema),
+		CategoryID:      activity.CategoryID,
+		Scope:           activityScope(activity),
+	}
+}
+
+// activityScope returns whether an activity is global or private.
+func activityScope(activity *model.Activity) string {
+	if activity.OwnerID == nil {
+		return repository.ScopeGlobal
+	}
+	return repository.ScopePrivate
+}
+
+// newActivityResponses converts a list of activities into their API representation.
+func newActivityResponses(activities []model.Activity) []activityResponse {
+	responses := make([]activityResponse, 0, len(activities))
+	for i := range activities {
+		responses = append(responses, newActivityResponse(&activities[i]))
+	}
+	return responses
+}
+
+// activitySchemaResponse is the attribute schema of an activity, which
+// clients use to build the form for its additional attributes.
+type activitySchemaResponse struct {
+	ActivityID int64            `json:"activity_id"`
+	Fields     []attributeField `json:"fields"`
+}
+
+// newActivitySchemaResponse returns the attribute schema of an activity.
+func newActivitySchemaResponse(activity *model.Activity) activitySchemaResponse {
+	return activitySchemaResponse{ActivityID: activity.ID, Fields: newAttributeSchema(activity.AttributeSchema).Fields}
+}
+
+// userActivityRequest is the body accepted when creating or updating a user
+// activity. The owner is always the authenticated user, so it has no user_id.
+// Either end_time or duration_seconds must be given, and the other is derived
+// from it; if both are given they must agree. Additional attributes must match
+// the attribute schema of the activity. tag_ids lists the user's tags to
+// attach, replacing any attached before.
+type userActivityRequest struct {
+	ActivityID           int64                  `json:"activity_id"`
+	StartTime            time.Time              `json:"start_time"`
+	EndTime              *time.Time             `json:"end_time,omitempty"`
+	DurationSeconds      *int64                 `json:"duration_seconds,omitempty"`
+	Mood                 int                    `json:"mood"`
+	AdditionalAttributes map[string]interface{} `json:"additional_attributes"`
+	TagIDs               []int64                `json:"tag_ids"`
+}
+
+// validate checks the request. activity is the activity that activity_id
+// refers to, or nil if there is none in the catalog, and tags are the IDs of
+// the user's tags. The owner is the authenticated user, who is known to exist.
+func (request userActivityRequest) validate(activity *model.Activity, tags map[int64]bool) error {
+	endTimeChecks := []validation.Check{
+		validation.That(request.EndTime != nil || request.DurationSeconds != nil, "is required unless duration_seconds is given"),
+	}
+	var durationChecks []validation.Check
+	if request.EndTime != nil {
+		endTimeChecks = append(endTimeChecks, validation.NotBefore(*request.EndTime, request.StartTime, "start_time"))
+	}
+	if request.DurationSeconds != nil {
+		durationChecks = append(durationChecks, validation.That(*request.DurationSeconds >= 0, "must not be negative"))
+		if request.EndTime != nil && !request.StartTime.IsZero() && !request.EndTime.Before(request.StartTime) {
+			elapsed := model.DurationBetween(request.StartTime, *request.EndTime)
+			durationChecks = append(durationChecks, validation.That(time.Duration(*request.DurationSeconds)*time.Second == elapsed,
+				"must equal the number of seconds between start_time and end_time"))
+		}
+	}
+
+	rules := []validation.Rule{
+		validation.Field("activity_id",
+			validation.Positive(request.ActivityID),
+			validation.That(activity != nil, "does not refer to an existing activity")),
+		validation.Field("start_time", validation.NotZeroTime(request.StartTime)),
+		validation.Field("end_time", endTimeChecks...),
+		validation.Field("duration_seconds", durationChecks...),
+		validation.Field("mood", validation.Between(request.Mood, model.MinMood, model.MaxMood)),
+		validation.Field("tag_ids", validation.That(ownsTags(tags, request.TagIDs), "must only refer to your tags")),
+	}
+	// Without the activity there is no schema to check the attributes against
+	if activity != nil {
+		rules = append(rules, attributeRules(activity.AttributeSchema, request.AdditionalAttributes)...)
+	}
+	return validation.Validate(rules...)
+}
+
+// toModel converts a valid request into a user activity with the given ID and
+// owner, deriving whichever of the end time and duration was left out.
+func (request userActivityRequest) toModel(userActivityID, userID int64) model.UserActivity {
+	var endTime time.Time
+	if request.EndTime != nil {
+		endTime = *request.EndTime
+	} else {
+		endTime = request.StartTime.Add(time.Duration(*request.DurationSeconds) * time.Second)
+	}
+
+	return model.UserActivity{
+		ID:                   userActivityID,
+		UserID:               userID,
+		ActivityID:           request.ActivityID,
+		StartTime:            request.StartTime,
+		EndTime:              endTime,
+		Duration:             model.DurationBetween(request.StartTime, endTime),
+		Mood:                 request.Mood,
+		AdditionalAttributes: withoutNulls(request.AdditionalAttributes),
+		TagIDs:               request.TagIDs,
+	}
+}
+
+// ownsTags reports whether every one of tagIDs is among the user's tags.
+func ownsTags(tags map[int64]bool, tagIDs []int64) bool {
+	for _, tagID := range tagIDs {
+		if !tags[tagID] {
+			return false
+		}
+	}
+	return true
+}
+
+// userActivityWriteResponse is returned when a user activity is recorded.
+// Warning is set if it overlapped other activities of the user and the
+// deployment's overlap policy allowed that.
+type userActivityWriteResponse struct {
+	UserActivityID int64           `json:"user_activity_id"`
+	Warning        *overlapWarning `json:"warning,omitempty"`
+}
+
+// Codes of overlap warnings.
+const (
+	warningOverlap = "overlap"
+	warningTrimmed = "trimmed"
+)
+
+// overlapWarning describes the other user activities a write overlapped.
+type overlapWarning struct {
+	Code            string  `json:"code"`
+	Message         string  `json:"message"`
+	UserActivityIDs []int64 `json:"user_activity_ids"`
+}
+
+// newUserActivityWriteResponse describes a recorded user activity and the
+// overlap reported by the store, if any.
+func newUserActivityWriteResponse(userActivityID int64, overlap *repository.Overlap) userActivityWriteResponse {
+	return userActivityWriteResponse{UserActivityID: userActivityID, Warning: newOverlapWarning(overlap)}
+}
+
+// newOverlapWarning describes the overlap reported by the store, or returns
+// nil if there was none.
+func newOverlapWarning(overlap *repository.Overlap) *overlapWarning {
+	if overlap == nil {
+		return nil
+	}
+	warning := &overlapWarning{
+		Code:            warningOverlap,
+		Message:         "The user activity overlaps other activities of the user",
+		UserActivityIDs: overlap.UserActivityIDs,
+	}
+	if overlap.Trimmed {
+		warning.Code = warningTrimmed
+		warning.Message = "The user activity was shortened so it does not overlap other activities of the user"
+	}
+	return warning
+}
+
+// userActivityResponse is a user activity as returned by the API.
+type userActivityResponse struct {
+	ID                   int64                  `json:"id"`
+	UserID               int64                  `json:"user_id"`
+	ActivityID           int64                  `json:"activity_id"`
+	StartTime            time.Time              `json:"start_time"`
+	EndTime              time.Time              `json:"end_time"`
+	DurationSeconds      int64                  `json:"duration_seconds"`
+	Mood                 int                    `json:"mood"`
+	AdditionalAttributes map[string]interface{} `json:"additional_attributes"`
+	TagIDs               []int64                `json:"tag_ids"`
+	RecordedAt           time.Time              `json:"recorded_at"`
+}
+
+// newUserActivityResponse converts a user activity into its API representation.
+func newUserActivityResponse(userActivity *model.UserActivity) userActivityResponse {
+	return userActivityResponse{
+		ID:                   userActivity.ID,
+		UserID:               userActivity.UserID,
+		ActivityID:           userActivity.ActivityID,
+		StartTime:            userActivity.StartTime,
+		EndTime:              userActivity.EndTime,
+		DurationSeconds:      int64(userActivity.Duration / time.Second),
+		Mood:                 userActivity.Mood,
+		AdditionalAttributes: userActivity.AdditionalAttributes,
+		TagIDs:               userActivity.TagIDs,
+		RecordedAt:           userActivity.RecordedAt,
+	}
+}
+
+// newUserActivityResponses converts a list of user activities into their API
+// representation.
+func newUserActivityResponses(userActivities []model.UserActivity) []userActivityResponse {
+	responses := make([]userActivityResponse, 0, len(userActivities))
+	for i := range userActivities {
+		responses = append(responses, newUserActivityResponse(&userActivities[i]))
+	}
+	return responses
+}
+
+// startTimerRequest is the body accepted when starting a timer.
+type startTimerRequest struct {
+	ActivityID int64 `json:"activity_id"`
+}
+
+// validate checks the request. activityExists reports whether activity_id
+// refers to an activity in the catalog.
+func (request startTimerRequest) validate(activityExists bool) error {
+	return validation.Validate(
+		validation.Field("activity_id",
+			validation.Positive(request.ActivityID),
+			validation.That(activityExists, "does not refer to an existing activity")),
+	)
+}
+
+// stopTimerRequest is the body accepted when stopping a timer. It holds the
+// details of the user activity that the timer is turned into.
+type stopTimerRequest struct {
+	Mood                 int                    `json:"mood"`
+	AdditionalAttributes map[string]interface{} `json:"additional_attributes"`
+}
+
+// validate checks the request. schema is the attribute schema of the timer's
+// activity.
+func (request stopTimerRequest) validate(schema model.AttributeSchema) error {
+	rules := []validation.Rule{
+		validation.Field("mood", validation.Between(request.Mood, model.MinMood, model.MaxMood)),
+	}
+	return validation.Validate(append(rules, attributeRules(schema, request.AdditionalAttributes)...)...)
+}
+
+// toModel completes a user activity recorded by a stopped timer with the
+// details from the request.
+func (request stopTimerRequest) toModel(userActivity model.UserActivity) model.UserActivity {
+	userActivity.Mood = request.Mood
+	userActivity.AdditionalAttributes = withoutNulls(request.AdditionalAttributes)
+	return userActivity
+}
+
+// stopTimerResponse is returned when a timer is stopped. It lists the user
+// activities recorded for its runs, oldest first. Warning is set as for
+// userActivityWriteResponse if any of them overlapped other activities.
+type stopTimerResponse struct {
+	UserActivityIDs []int64         `json:"user_activity_ids"`
+	Warning         *overlapWarning `json:"warning,omitempty"`
+}
+
+// timerResponse is a timer as returned by the API. ElapsedSeconds is the
+// active time so far, excluding pauses.
+type timerResponse struct {
+	ID             int64     `json:"id"`
+	UserID         int64     `json:"user_id"`
+	ActivityID     int64     `json:"activity_id"`
+	StartedAt      time.Time `json:"started_at"`
+	Running        bool      `json:"running"`
+	ElapsedSeconds int64     `json:"elapsed_seconds"`
+}
+
+// newTimerResponse converts a timer into its API representation as of now.
+func newTimerResponse(timer *model.Timer, now time.Time) timerResponse {
+	return timerResponse{
+		ID:             timer.ID,
+		UserID:         timer.UserID,
+		ActivityID:     timer.ActivityID,
+		StartedAt:      timer.StartedAt,
+		Running:        timer.Running(),
+		ElapsedSeconds: int64(timer.ActiveTime(now) / time.Second),
+	}
+}
+
+// newTimerResponses converts a list of timers into their API representation as of now.
+func newTimerResponses(timers []model.Timer, now time.Time) []timerResponse {
+	responses := make([]timerResponse, 0, len(timers))
+	for i := range timers {
+		responses = append(responses, newTimerResponse(&timers[i], now))
+	}
+	return responses
+}
+
+// statsSummary is the summary of a group of user activities. The averages
+// are null if there are none, and the average mood also if none has a mood.
+type statsSummary struct {
+	Count                  int64    `json:"count"`
+	TotalDurationSeconds   int64    `json:"total_duration_seconds"`
+	AverageDurationSeconds *float64 `json:"average_duration_seconds"`
+	AverageMood            *float64 `json:"average_mood"`
+}
+
+// newStatsSummary converts a stats bucket into its summary.
+func newStatsSummary(bucket repository.StatsBucket) statsSummary {
+	summary := statsSummary{Count: bucket.Count, TotalDurationSeconds: int64(bucket.TotalDuration / time.Second)}
+	if bucket.Count > 0 {
+		averageDuration := bucket.AverageDuration().Seconds()
+		summary.AverageDurationSeconds = &averageDuration
+	}
+	if bucket.Mood.Count > 0 {
+		averageMood := bucket.AverageMood()
+		summary.AverageMood = &averageMood
+	}
+	return summary
+}
+
+// statsBucketResponse summarizes the user activities of one period and, when
+// grouped by activity, tag or category, one activity, tag or category.
+type statsBucketResponse struct {
+	PeriodStart time.Time `json:"period_start"`
+	ActivityID  *int64    `json:"activity_id,omitempty"`
+	TagID       *int64    `json:"tag_id,omitempty"`
+	CategoryID  *int64    `json:"category_id,omitempty"`
+	statsSummary
+}
+
+// statsResponse holds the statistics of a user's activities that started
+// from From up to, but excluding, To. Periods start at midnight in TimeZone.
+type statsResponse struct {
+	From     time.Time             `json:"from"`
+	To       time.Time             `json:"to"`
+	Period   string                `json:"period"`
+	TimeZone string                `json:"time_zone"`
+	Totals   statsSummary          `json:"totals"`
+	Buckets  []statsBucketResponse `json:"buckets"`
+}
+
+// newStatsResponse converts the stats buckets computed for filter, and the
+// totals over all of the user activities, into their API representation.
+func newStatsResponse(filter repository.StatsFilter, buckets []repository.StatsBucket, totals repository.StatsBucket) statsResponse {
+	response := statsResponse{
+		From:     filter.From,
+		To:       filter.To,
+		Period:   string(filter.Period),
+		TimeZone: filter.Location.String(),
+		Totals:   newStatsSummary(totals),
+		Buckets:  make([]statsBucketResponse, 0, len(buckets)),
+	}
+	for _, bucket := range buckets {
+		bucketResponse := statsBucketResponse{PeriodStart: bucket.PeriodStart, statsSummary: newStatsSummary(bucket)}
+		if filter.ByActivity {
+			activityID := bucket.ActivityID
+			bucketResponse.ActivityID = &activityID
+		}
+		if filter.ByTag {
+			tagID := bucket.TagID
+			bucketResponse.TagID = &tagID
+		}
+		if filter.ByCategory {
+			categoryID := bucket.CategoryID
+			bucketResponse.CategoryID = &categoryID
+		}
+		response.Buckets = append(response.Buckets, bucketResponse)
+	}
+	return response
+}
+
+// streakResponse is a streak as returned by the API. Start and End are the
+// starts of its first and last achieved day or week.
+type streakResponse struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Length int64     `json:"length"`
+}
+
+// newStreakResponse converts a streak into its API representation, or nil if
+// there is none.
+func newStreakResponse(streak *repository.Streak) *streakResponse {
+	if streak == nil {
+		return nil
+	}
+	return &streakResponse{Start: streak.Start, End: streak.End, Length: streak.Length}
+}
+
+// streakSummaryResponse holds the current and longest streak of an activity,
+// or of any activity if ActivityID is nil.
+type streakSummaryResponse struct {
+	ActivityID *int64          `json:"activity_id,omitempty"`
+	Current    *streakResponse `json:"current"`
+	Longest    *streakResponse `json:"longest"`
+}
+
+// streaksResponse holds a user's streaks and the rules they were computed by.
+type streaksResponse struct {
+	Cadence      string                  `json:"cadence"`
+	TimesPerWeek *int                    `json:"times_per_week,omitempty"`
+	Tolerance    int                     `json:"tolerance"`
+	TimeZone     string                  `json:"time_zone"`
+	Overall      streakSummaryResponse   `json:"overall"`
+	Activities   []streakSummaryResponse `json:"activities"`
+}
+
+// newStreaksResponse converts the streak summaries computed for filter into
+// their API representation.
+func newStreaksResponse(filter repository.StreakFilter, summaries []repository.StreakSummary) streaksResponse {
+	response := streaksResponse{
+		Cadence:    string(filter.Cadence),
+		Tolerance:  filter.Tolerance,
+		TimeZone:   filter.Location.String(),
+		Activities: []streakSummaryResponse{},
+	}
+	if filter.Cadence == repository.CadenceWeekly {
+		timesPerWeek := filter.TimesPerWeek
+		response.TimesPerWeek = &timesPerWeek
+	}
+	for _, summary := range summaries {
+		summaryResponse := streakSummaryResponse{Current: newStreakResponse(summary.Current), Longest: newStreakResponse(summary.Longest)}
+		if summary.ActivityID == 0 {
+			response.Overall = summaryResponse
+			continue
+		}
+		activityID := summary.ActivityID
+		summaryResponse.ActivityID = &activityID
+		response.Activities = append(response.Activities, summaryResponse)
+	}
+	return response
+}
+
+// goalRequest is the body accepted when creating or updating a goal. Leaving
+// out activity_id makes every activity count towards the goal.
+type goalRequest struct {
+	ActivityID *int64  `json:"activity_id"`
+	Metric     string  `json:"metric"`
+	Attribute  string  `json:"attribute"`
+	Period     string  `json:"period"`
+	Target     float64 `json:"target"`
+}
+
+// validate checks the request. activity is the activity that activity_id
+// refers to, or nil if there is none in the catalog or none was given.
+func (request goalRequest) validate(activity *model.Activity) error {
+	var activityChecks []validation.Check
+	if request.ActivityID != nil {
+		activityChecks = append(activityChecks,
+			validation.Positive(*request.ActivityID),
+			validation.That(activity != nil, "does not refer to an existing activity"))
+	}
+
+	metric := model.GoalMetric(request.Metric)
+	var attributeChecks []validation.Check
+	if metric == model.MetricAttributeSum {
+		attributeChecks = append(attributeChecks,
+			validation.NotBlank(request.Attribute),
+			validation.That(model.ValidAttributeName(request.Attribute), "may only contain letters, digits and underscores"))
+		// An activity with a schema says which of its attributes are numbers
+		if activity != nil && len(activity.AttributeSchema.Fields) > 0 {
+			field, ok := activity.AttributeSchema.Field(request.Attribute)
+			attributeChecks = append(attributeChecks,
+				validation.That(ok && field.Type == model.AttributeNumber, "must be a number attribute of the activity"))
+		}
+	} else {
+		attributeChecks = append(attributeChecks, validation.That(request.Attribute == "", "is only allowed with the attribute_sum metric"))
+	}
+
+	period := model.GoalPeriod(request.Period)
+	return validation.Validate(
+		validation.Field("activity_id", activityChecks...),
+		validation.Field("metric", validation.That(metric == model.MetricCount || metric == model.MetricDuration || metric == model.MetricAttributeSum,
+			"must be count, duration or attribute_sum")),
+		validation.Field("attribute", attributeChecks...),
+		validation.Field("period", validation.That(period == model.GoalDaily || period == model.GoalWeekly || period == model.GoalMonthly,
+			"must be day, week or month")),
+		validation.Field("target", validation.That(request.Target > 0, "must be greater than zero")),
+	)
+}
+
+// toModel converts a valid request into a goal of the user with the given ID.
+func (request goalRequest) toModel(goalID, userID int64) model.Goal {
+	return model.Goal{
+		ID:         goalID,
+		UserID:     userID,
+		ActivityID: request.ActivityID,
+		Metric:     model.GoalMetric(request.Metric),
+		Attribute:  request.Attribute,
+		Period:     model.GoalPeriod(request.Period),
+		Target:     request.Target,
+	}
+}
+
+// goalResponse is a goal as returned by the API. The target is a number of
+// user activities, a number of seconds or an amount of the attribute,
+// depending on the metric.
+type goalResponse struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"user_id"`
+	ActivityID *int64    `json:"activity_id"`
+	Metric     string    `json:"metric"`
+	Attribute  string    `json:"attribute,omitempty"`
+	Period     string    `json:"period"`
+	Target     float64   `json:"target"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// newGoalResponse converts a goal into its API representation.
+func newGoalResponse(goal *model.Goal) goalResponse {
+	return goalResponse{
+		ID:         goal.ID,
+		UserID:     goal.UserID,
+		ActivityID: goal.ActivityID,
+		Metric:     string(goal.Metric),
+		Attribute:  goal.Attribute,
+		Period:     string(goal.Period),
+		Target:     goal.Target,
+		CreatedAt:  goal.CreatedAt,
+	}
+}
+
+// newGoalResponses converts a list of goals into their API representation.
+func newGoalResponses(goals []model.Goal) []goalResponse {
+	responses := make([]goalResponse, 0, len(goals))
+	for i := range goals {
+		responses = append(responses, newGoalResponse(&goals[i]))
+	}
+	return responses
+}
+
+// goalPeriodResponse is the progress of a goal in one period. Completion is
+// the fraction of the target reached, which exceeds 1 once it is surpassed.
+type goalPeriodResponse struct {
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	Value       float64   `json:"value"`
+	Remaining   float64   `json:"remaining"`
+	Completion  float64   `json:"completion"`
+	Achieved    bool      `json:"achieved"`
+}
+
+// goalProgressResponse holds the progress of a goal in the current period
+// and in the past periods since it was created, oldest first.
+type goalProgressResponse struct {
+	Goal     goalResponse         `json:"goal"`
+	TimeZone string               `json:"time_zone"`
+	Current  goalPeriodResponse   `json:"current"`
+	History  []goalPeriodResponse `json:"history"`
+}
+
+// newGoalProgressResponse converts the progress of a goal, ending with the
+// current period, into its API representation.
+func newGoalProgressResponse(goal *model.Goal, location *time.Location, progress []repository.GoalProgress) goalProgressResponse {
+	periods := make([]goalPeriodResponse, 0, len(progress))
+	for _, period := range progress {
+		periods = append(periods, goalPeriodResponse{
+			PeriodStart: period.PeriodStart,
+			PeriodEnd:   period.PeriodEnd,
+			Value:       period.Value,
+			Remaining:   math.Max(goal.Target-period.Value, 0),
+			Completion:  goal.Completion(period.Value),
+			Achieved:    period.Value >= goal.Target,
+		})
+	}
+	return goalProgressResponse{
+		Goal:     newGoalResponse(goal),
+		TimeZone: location.String(),
+		Current:  periods[len(periods)-1],
+		History:  periods[:len(periods)-1],
+	}
+}
+
+// scaleResponse is the range that moods or severities are rated in.
+type scaleResponse struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// moodSummary is the mood of a group of user activities. The average is null
+// if there are none.
+type moodSummary struct {
+	Count       int64    `json:"count"`
+	AverageMood *float64 `json:"average_mood"`
+}
+
+// newMoodSummary converts a repository mood summary into its API representation.
+func newMoodSummary(summary repository.MoodSummary) moodSummary {
+	response := moodSummary{Count: summary.Count}
+	if summary.Count > 0 {
+		averageMood := summary.Average()
+		response.AverageMood = &averageMood
+	}
+	return response
+}
+
+// moodTrendResponse is the mood of the user activities of one period.
+type moodTrendResponse struct {
+	PeriodStart time.Time `json:"period_start"`
+	moodSummary
+}
+
+// moodDaysResponse is the mood of every user activity on a set of days.
+type moodDaysResponse struct {
+	Days int64 `json:"days"`
+	moodSummary
+}
+
+// newMoodDaysResponse converts mood days into their API representation.
+func newMoodDaysResponse(days repository.MoodDays) moodDaysResponse {
+	return moodDaysResponse{Days: days.Days, moodSummary: newMoodSummary(days.MoodSummary)}
+}
+
+// activityMoodResponse is the mood recorded with one activity, the number of
+// times each mood was recorded, and the mood of all user activities on days
+// with and without the activity.
+type activityMoodResponse struct {
+	ActivityID   int64            `json:"activity_id"`
+	Distribution map[int]int64    `json:"distribution"`
+	DaysWith     moodDaysResponse `json:"days_with"`
+	DaysWithout  moodDaysResponse `json:"days_without"`
+	moodSummary
+}
+
+// durationMoodResponse is the mood of the user activities lasting from
+// min_seconds up to, but excluding, max_seconds, which is null for the
+// longest ones.
+type durationMoodResponse struct {
+	MinSeconds int64  `json:"min_seconds"`
+	MaxSeconds *int64 `json:"max_seconds"`
+	moodSummary
+}
+
+// moodResponse holds the mood analysis of a user's activities that started
+// from From up to, but excluding, To. Only moods on the scale count.
+type moodResponse struct {
+	From       time.Time              `json:"from"`
+	To         time.Time              `json:"to"`
+	Period     string                 `json:"period"`
+	TimeZone   string                 `json:"time_zone"`
+	Scale      scaleResponse          `json:"scale"`
+	Overall    moodSummary            `json:"overall"`
+	Trend      []moodTrendResponse    `json:"trend"`
+	Activities []activityMoodResponse `json:"activities"`
+	Durations  []durationMoodResponse `json:"durations"`
+}
+
+// newMoodResponse converts the mood statistics computed for filter into their
+// API representation, adding the overall mood.
+func newMoodResponse(filter repository.MoodFilter, stats *repository.MoodStats) moodResponse {
+	response := moodResponse{
+		From:       filter.From,
+		To:         filter.To,
+		Period:     string(filter.Period),
+		TimeZone:   filter.Location.String(),
+		Scale:      scaleResponse{Min: model.MinMood, Max: model.MaxMood},
+		Trend:      make([]moodTrendResponse, 0, len(stats.Trend)),
+		Activities: make([]activityMoodResponse, 0, len(stats.Activities)),
+		Durations:  make([]durationMoodResponse, 0, len(stats.Durations)),
+	}
+	var overall repository.MoodSummary
+	for _, bucket := range stats.Trend {
+		overall.Count += bucket.Count
+		overall.TotalMood += bucket.TotalMood
+		response.Trend = append(response.Trend, moodTrendResponse{PeriodStart: bucket.PeriodStart, moodSummary: newMoodSummary(bucket.MoodSummary)})
+	}
+	response.Overall = newMoodSummary(overall)
+	for _, activity := range stats.Activities {
+		response.Activities = append(response.Activities, activityMoodResponse{
+			ActivityID:   activity.ActivityID,
+			Distribution: activity.Distribution,
+			DaysWith:     newMoodDaysResponse(activity.DaysWith),
+			DaysWithout:  newMoodDaysResponse(activity.DaysWithout),
+			moodSummary:  newMoodSummary(activity.MoodSummary),
+		})
+	}
+	for _, bucket := range stats.Durations {
+		durationResponse := durationMoodResponse{MinSeconds: int64(bucket.MinDuration / time.Second), moodSummary: newMoodSummary(bucket.MoodSummary)}
+		if bucket.MaxDuration > 0 {
+			maxSeconds := int64(bucket.MaxDuration / time.Second)
+			durationResponse.MaxSeconds = &maxSeconds
+		}
+		response.Durations = append(response.Durations, durationResponse)
+	}
+	return response
+}
+
+// symptomRequest is the body accepted when creating or updating a symptom.
+// The body area is stored in lower case.
+type symptomRequest struct {
+	UserActivityID *int64    `json:"user_activity_id"`
+	BodyArea       string    `json:"body_area"`
+	Severity       int       `json:"severity"`
+	Notes          string    `json:"notes"`
+	OccurredAt     time.Time `json:"occurred_at"`
+}
+
+// validate checks the request. userActivity is the user activity that
+// user_activity_id refers to, or nil if it is not one of the user's or none
+// was given.
+func (request symptomRequest) validate(userActivity *model.UserActivity) error {
+	var userActivityChecks []validation.Check
+	if request.UserActivityID != nil {
+		userActivityChecks = append(userActivityChecks,
+			validation.Positive(*request.UserActivityID),
+			validation.That(userActivity != nil, "does not refer to one of your user activities"))
+	}
+	return validation.Validate(
+		validation.Field("user_activity_id", userActivityChecks...),
+		validation.Field("body_area", validation.NotBlank(request.BodyArea), validation.MaxLength(request.BodyArea, maxBodyAreaLength)),
+		validation.Field("severity", validation.Between(request.Severity, model.MinSeverity, model.MaxSeverity)),
+		validation.Field("notes", validation.MaxLength(request.Notes, maxSymptomNotesLength)),
+		validation.Field("occurred_at", validation.NotZeroTime(request.OccurredAt)),
+	)
+}
+
+// toModel converts a valid request into a symptom of the user with the given ID.
+func (request symptomRequest) toModel(symptomID, userID int64) model.Symptom {
+	return model.Symptom{
+		ID:             symptomID,
+		UserID:         userID,
+		UserActivityID: request.UserActivityID,
+		BodyArea:       normalizeBodyArea(request.BodyArea),
+		Severity:       request.Severity,
+		Notes:          request.Notes,
+		OccurredAt:     request.OccurredAt,
+	}
+}
+
+// normalizeBodyArea returns the form body areas are stored and filtered in.
+func normalizeBodyArea(bodyArea string) string {
+	return strings.ToLower(strings.TrimSpace(bodyArea))
+}
+
+// symptomResponse is a symptom as returned by the API.
+type symptomResponse struct {
+	ID             int64     `json:"id"`
+	UserID         int64     `json:"user_id"`
+	UserActivityID *int64    `json:"user_activity_id"`
+	BodyArea       string    `json:"body_area"`
+	Severity       int       `json:"severity"`
+	Notes          string    `json:"notes"`
+	OccurredAt     time.Time `json:"occurred_at"`
+	RecordedAt     time.Time `json:"recorded_at"`
+}
+
+// newSymptomResponse converts a symptom into its API representation.
+func newSymptomResponse(symptom *model.Symptom) symptomResponse {
+	return symptomResponse{
+		ID:             symptom.ID,
+		UserID:         symptom.UserID,
+		UserActivityID: symptom.UserActivityID,
+		BodyArea:       symptom.BodyArea,
+		Severity:       symptom.Severity,
+		Notes:          symptom.Notes,
+		OccurredAt:     symptom.OccurredAt,
+		RecordedAt:     symptom.RecordedAt,
+	}
+}
+
+// newSymptomResponses converts a list of symptoms into their API representation.
+func newSymptomResponses(symptoms []model.Symptom) []symptomResponse {
+	responses := make([]symptomResponse, 0, len(symptoms))
+	for i := range symptoms {
+		responses = append(responses, newSymptomResponse(&symptoms[i]))
+	}
+	return responses
+}
+
+// symptomSeverityResponse summarizes the severity of a set of symptoms. The
+// average and maximum are null if there are none.
+type symptomSeverityResponse struct {
+	Count           int64    `json:"count"`
+	AverageSeverity *float64 `json:"average_severity"`
+	MaxSeverity     *int     `json:"max_severity"`
+}
+
+// newSymptomSeverityResponse converts a severity summary into its API representation.
+func newSymptomSeverityResponse(severity repository.SymptomSeverity) symptomSeverityResponse {
+	response := symptomSeverityResponse{Count: severity.Count}
+	if severity.Count > 0 {
+		averageSeverity := severity.Average()
+		maxSeverity := severity.MaxSeverity
+		response.AverageSeverity = &averageSeverity
+		response.MaxSeverity = &maxSeverity
+	}
+	return response
+}
+
+// activitySymptomsResponse is how often an activity was followed by symptoms,
+// and how severe they were.
+type activitySymptomsResponse struct {
+	ActivityID           int64 `json:"activity_id"`
+	Sessions             int64 `json:"sessions"`
+	SessionsWithSymptoms int64 `json:"sessions_with_symptoms"`
+	symptomSeverityResponse
+}
+
+// symptomAnalysisResponse attributes symptoms to the activities that started
+// from From up to, but excluding, To and that they followed within the window.
+// Overall covers every symptom that occurred in the range.
+type symptomAnalysisResponse struct {
+	From             time.Time                  `json:"from"`
+	To               time.Time                  `json:"to"`
+	BodyArea         string                     `json:"body_area,omitempty"`
+	WindowStartHours float64                    `json:"window_start_hours"`
+	WindowEndHours   float64                    `json:"window_end_hours"`
+	Scale            scaleResponse              `json:"scale"`
+	Overall          symptomSeverityResponse    `json:"overall"`
+	Activities       []activitySymptomsResponse `json:"activities"`
+}
+
+// newSymptomAnalysisResponse converts the symptom analysis computed for filter
+// into its API representation.
+func newSymptomAnalysisResponse(filter repository.SymptomAnalysisFilter, analysis *repository.SymptomAnalysis) symptomAnalysisResponse {
+	response := symptomAnalysisResponse{
+		From:             filter.From,
+		To:               filter.To,
+		BodyArea:         filter.BodyArea,
+		WindowStartHours: filter.WindowStart.Hours(),
+		WindowEndHours:   filter.WindowEnd.Hours(),
+		Scale:            scaleResponse{Min: model.MinSeverity, Max: model.MaxSeverity},
+		Overall:          newSymptomSeverityResponse(analysis.Overall),
+		Activities:       make([]activitySymptomsResponse, 0, len(analysis.Activities)),
+	}
+	for _, activity := range analysis.Activities {
+		response.Activities = append(response.Activities, activitySymptomsResponse{
+			ActivityID:              activity.ActivityID,
+			Sessions:                activity.Sessions,
+			SessionsWithSymptoms:    activity.SessionsWithSymptoms,
+			symptomSeverityResponse: newSymptomSeverityResponse(activity.SymptomSeverity),
+		})
+	}
+	return response
+}
+
+// tagRequest is the body accepted when creating or renaming a tag. The name
+// is stored in lower case.
+type tagRequest struct {
+	Name string `json:"name"`
+}
+
+// validate checks the request.
+func (request tagRequest) validate() error {
+	name := normalizeTagName(request.Name)
+	return validation.Validate(
+		validation.Field("name",
+			validation.NotBlank(name),
+			validation.MaxLength(name, maxTagNameLength),
+			validation.That(model.ValidTagName(name), "may only contain letters, digits, hyphens and underscores")),
+	)
+}
+
+// toModel converts a valid request into a tag of the user with the given ID.
+func (request tagRequest) toModel(tagID, userID int64) model.Tag {
+	return model.Tag{ID: tagID, UserID: userID, Name: normalizeTagName(request.Name)}
+}
+
+// normalizeTagName returns the form tag names are stored in.
+func normalizeTagName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// tagResponse is a tag as returned by the API.
+type tagResponse struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// newTagResponse converts a tag into its API representation.
+func newTagResponse(tag *model.Tag) tagResponse {
+	return tagResponse{ID: tag.ID, UserID: tag.UserID, Name: tag.Name, CreatedAt: tag.CreatedAt}
+}
+
+// newTagResponses converts a list of tags into their API representation.
+func newTagResponses(tags []model.Tag) []tagResponse {
+	responses := make([]tagResponse, 0, len(tags))
+	for i := range tags {
+		responses = append(responses, newTagResponse(&tags[i]))
+	}
+	return responses
+}
+
+// categoryRequest is the body accepted when creating or updating a category.
+// Leaving out parent_id makes it a top-level category.
+type categoryRequest struct {
+	Name     string `json:"name"`
+	ParentID *int64 `json:"parent_id"`
+}
+
+// validate checks the request.
+func (request categoryRequest) validate() error {
+	rules := []validation.Rule{
+		validation.Field("name", validation.NotBlank(request.Name), validation.MaxLength(request.Name, maxCategoryNameLength)),
+	}
+	if request.ParentID != nil {
+		rules = append(rules, validation.Field("parent_id", validation.Positive(*request.ParentID)))
+	}
+	return validation.Validate(rules...)
+}
+
+// toModel converts the request into a category with the given ID.
+func (request categoryRequest) toModel(categoryID int64) model.Category {
+	return model.Category{ID: categoryID, Name: request.Name, ParentID: request.ParentID}
+}
+
+// categoryResponse is a category as returned by the API.
+type categoryResponse struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	ParentID *int64 `json:"parent_id"`
+}
+
+// newCategoryResponse converts a category into its API representation.
+func newCategoryResponse(category *model.Category) categoryResponse {
+	return categoryResponse{ID: category.ID, Name: category.Name, ParentID: category.ParentID}
+}
+
+// newCategoryResponses converts a list of categories into their API representation.
+func newCategoryResponses(categories []model.Category) []categoryResponse {
+	responses := make([]categoryResponse, 0, len(categories))
+	for i := range categories {
+		responses = append(responses, newCategoryResponse(&categories[i]))
+	}
+	return responses
+}
+
+// categoryTreeResponse is a category with its subcategories, recursively.
+type categoryTreeResponse struct {
+	categoryResponse
+	Children []categoryTreeResponse `json:"children"`
+}
+
+// newCategoryTree arranges categories into trees: the children of parentID,
+// or the top-level categories if it is nil, each with their descendants.
+// Siblings keep the order of categories.
+func newCategoryTree(categories []model.Category, parentID *int64) []categoryTreeResponse {
+	children := make(map[int64][]model.Category)
+	var roots []model.Category
+	for _, category := range categories {
+		switch {
+		case category.ParentID == nil && parentID == nil:
+			roots = append(roots, category)
+		case category.ParentID != nil:
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		}
+	}
+	if parentID != nil {
+		roots = children[*parentID]
+	}
+
+	var build func(categories []model.Category) []categoryTreeResponse
+	build = func(categories []model.Category) []categoryTreeResponse {
+		responses := make([]categoryTreeResponse, 0, len(categories))
+		for i := range categories {
+			responses = append(responses, categoryTreeResponse{
+				categoryResponse: newCategoryResponse(&categories[i]),
+				Children:         build(children[categories[i].ID]),
+			})
+		}
+		return responses
+	}
+	return build(roots)
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"activity-tracker/pkg/apierror"
+	"activity-tracker/pkg/model"
+	repository "activity-tracker/pkg/respository"
+	"activity-tracker/pkg/validation"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// repositoryErrors maps the errors returned by the stores, and by the state
+// changes of model types, to HTTP responses.
+// More specific errors must come before the general ones they overlap with.
+var repositoryErrors = []struct {
+	target error
+	status int
+	code   string
+}{
+	{repository.ErrInvalidCredentials, http.StatusUnauthorized, apierror.CodeUnauthorized},
+	{repository.ErrUserNotFound, http.StatusNotFound, apierror.CodeNotFound},
+	{repository.ErrActivityNotFound, http.StatusNotFound, apierror.CodeNotFound},
+	{repository.ErrUserActivityNotFound, http.StatusNotFound, apierror.CodeNotFound},
+	{repository.ErrTimerNotFound, http.StatusNotFound, apierror.CodeNotFound},
+	{repository.ErrGoalNotFound, http.StatusNotFound, apierror.CodeNotFound},
+	{repository.ErrSymptomNotFound, http.StatusNotFound, apierror.CodeNotFound},
+	{repository.ErrTagNotFound, http.StatusNotFound, apierror.CodeNotFound},
+	{repository.ErrCategoryNotFound, http.StatusNotFound, apierror.CodeNotFound},
+	{repository.ErrUsernameTaken, http.StatusConflict, apierror.CodeConflict},
+	{repository.ErrLastAdmin, http.StatusConflict, apierror.CodeConflict},
+	{repository.ErrActivityNameTaken, http.StatusConflict, apierror.CodeConflict},
+	{repository.ErrActivityInUse, http.StatusConflict, apierror.CodeConflict},
+	{repository.ErrTagNameTaken, http.StatusConflict, apierror.CodeConflict},
+	{repository.ErrCategoryNameTaken, http.StatusConflict, apierror.CodeConflict},
+	{repository.ErrCategoryInUse, http.StatusConflict, apierror.CodeConflict},
+	{repository.ErrCategoryCycle, http.StatusConflict, apierror.CodeConflict},
+	{repository.ErrTimerAlreadyRunning, http.StatusConflict, apierror.CodeConflict},
+	{repository.ErrTimerChanged, http.StatusConflict, apierror.CodeConflict},
+	{repository.ErrUserActivityOverlaps, http.StatusConflict, apierror.CodeConflict},
+	{model.ErrTimerNotRunning, http.StatusConflict, apierror.CodeConflict},
+	{model.ErrTimerNotPaused, http.StatusConflict, apierror.CodeConflict},
+	{repository.ErrConflict, http.StatusConflict, apierror.CodeConflict},
+	{repository.ErrInvalidReference, http.StatusBadRequest, apierror.CodeInvalidReference},
+	{repository.ErrInvalidCursor, http.StatusBadRequest, apierror.CodeBadRequest},
+	{repository.ErrInvalidAttributeFilter, http.StatusBadRequest, apierror.CodeBadRequest},
+}
+
+// writeError sends a JSON error response.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	apierror.Write(w, status, code, message)
+}
+
+// writeBadRequest sends a 400 response for a malformed request.
+func writeBadRequest(w http.ResponseWriter, message string) {
+	apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, message)
+}
+
+// writeValidationError sends a 422 response listing every invalid field.
+func writeValidationError(w http.ResponseWriter, err error) {
+	var errs validation.Errors
+	if !errors.As(err, &errs) {
+		writeInternalError(w, err, "Failed to validate request")
+		return
+	}
+	details := make([]apierror.FieldError, 0, len(errs))
+	for _, fieldError := range errs {
+		details = append(details, apierror.FieldError{Field: fieldError.Field, Message: fieldError.Message})
+	}
+	apierror.Write(w, http.StatusUnprocessableEntity, apierror.CodeValidation, "The request has invalid fields", details...)
+}
+
+// writeRepositoryError sends the response matching an error returned by a
+// store. Unexpected errors are logged and reported as a 500 with failMessage,
+// so that database details never reach the client.
+func writeRepositoryError(w http.ResponseWriter, err error, failMessage string) {
+	for _, mapping := range repositoryErrors {
+		if errors.Is(err, mapping.target) {
+			apierror.Write(w, mapping.status, mapping.code, mapping.target.Error())
+			return
+		}
+	}
+	writeInternalError(w, err, failMessage)
+}
+
+// writeInternalError logs err and sends a 500 response with failMessage.
+func writeInternalError(w http.ResponseWriter, err error, failMessage string) {
+	log.Printf("%s: %v", failMessage, err)
+	apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, failMessage)
+}
@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"activity-tracker/pkg/model"
+	repository "activity-tracker/pkg/respository"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// Numbers of past periods that goal progress includes.
+const (
+	defaultGoalHistory = 12
+	maxGoalHistory     = 366
+)
+
+// GoalHandler handles HTTP requests related to goals, the targets users set
+// for every day, week or month, and their progress.
+type GoalHandler struct {
+	goalRepo     repository.GoalStore
+	activityRepo repository.ActivityStore
+	userRepo     repository.UserStore
+	now          func() time.Time
+}
+
+// NewGoalHandler creates a new GoalHandler instance.
+func NewGoalHandler(goalRepo repository.GoalStore, activityRepo repository.ActivityStore,
+	userRepo repository.UserStore) *GoalHandler {
+	return &GoalHandler{goalRepo: goalRepo, activityRepo: activityRepo, userRepo: userRepo, now: time.Now}
+}
+
+// RegisterRoutes registers the goal routes. Users may only access their own goals.
+func (h *GoalHandler) RegisterRoutes(router chi.Router) {
+	router.Post("/users/{userID}/goals", h.CreateGoal)
+	router.Get("/users/{userID}/goals", h.ListGoals)
+	router.Get("/users/{userID}/goals/{goalID}", h.GetGoal)
+	router.Put("/users/{userID}/goals/{goalID}", h.UpdateGoal)
+	router.Delete("/users/{userID}/goals/{goalID}", h.DeleteGoal)
+	router.Get("/users/{userID}/goals/{goalID}/progress", h.GetGoalProgress)
+}
+
+// CreateGoal handles the creation of a new goal.
+func (h *GoalHandler) CreateGoal(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid user ID")
+		return
+	}
+	if !authorizeUser(w, r, userID) {
+		return
+	}
+
+	request, ok := h.decodeGoalRequest(w, r)
+	if !ok {
+		return
+	}
+	goal := request.toModel(0, userID)
+	goal.CreatedAt = h.now()
+
+	goalID, err := h.goalRepo.CreateGoal(&goal)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to create goal")
+		return
+	}
+
+	response := map[string]int64{"goal_id": goalID}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListGoals handles listing a user's goals.
+func (h *GoalHandler) ListGoals(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid user ID")
+		return
+	}
+	if !authorizeUser(w, r, userID) {
+		return
+	}
+
+	goals, err := h.goalRepo.ListGoals(userID)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to list goals")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newGoalResponses(goals))
+}
+
+// GetGoal handles retrieving a goal by ID.
+func (h *GoalHandler) GetGoal(w http.ResponseWriter, r *http.Request) {
+	goal, ok := h.loadGoal(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newGoalResponse(goal))
+}
+
+// UpdateGoal handles updating a goal by ID. Its progress so far is computed
+// anew under the updated rules.
+func (h *GoalHandler) UpdateGoal(w http.ResponseWriter, r *http.Request) {
+	goal, ok := h.loadGoal(w, r)
+	if !ok {
+		return
+	}
+
+	request, ok := h.decodeGoalRequest(w, r)
+	if !ok {
+		return
+	}
+	updated := request.toModel(goal.ID, goal.UserID)
+
+	if err := h.goalRepo.UpdateGoal(&updated); err != nil {
+		writeRepositoryError(w, err, "Failed to update goal")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteGoal handles deleting a goal by ID.
+func (h *GoalHandler) DeleteGoal(w http.ResponseWriter, r *http.Request) {
+	goal, ok := h.loadGoal(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.goalRepo.DeleteGoal(goal.UserID, goal.ID); err != nil {
+		writeRepositoryError(w, err, "Failed to delete goal")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetGoalProgress handles computing how far a goal is reached in the current
+// period, and was in up to history past periods since it was created. Periods
+// are in the user's time zone unless tz gives another.
+func (h *GoalHandler) GetGoalProgress(w http.ResponseWriter, r *http.Request) {
+	goal, ok := h.loadGoal(w, r)
+	if !ok {
+		return
+	}
+
+	history, err := queryInt(r, "history")
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	filter := repository.GoalProgressFilter{Goal: *goal, Now: h.now(), History: defaultGoalHistory}
+	if history != nil {
+		if *history < 0 || *history > maxGoalHistory {
+			writeBadRequest(w, fmt.Sprintf("invalid history: must be between 0 and %d", maxGoalHistory))
+			return
+		}
+		filter.History = *history
+	}
+	if filter.Location, ok = requestLocation(w, r, h.userRepo, goal.UserID); !ok {
+		return
+	}
+
+	progress, err := h.goalRepo.GoalProgress(filter)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to compute goal progress")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newGoalProgressResponse(goal, filter.Location, progress))
+}
+
+// decodeGoalRequest reads and validates the goal in the request body, writing
+// an error response if it is not valid.
+func (h *GoalHandler) decodeGoalRequest(w http.ResponseWriter, r *http.Request) (goalRequest, bool) {
+	var request goalRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeBadRequest(w, "Invalid request body")
+		return request, false
+	}
+	var activity *model.Activity
+	if request.ActivityID != nil {
+		var err error
+		if activity, err = findActivity(h.activityRepo, authenticatedUserID(r), *request.ActivityID); err != nil {
+			writeInternalError(w, err, "Failed to validate goal")
+			return request, false
+		}
+	}
+	if err := request.validate(activity); err != nil {
+		writeValidationError(w, err)
+		return request, false
+	}
+	return request, true
+}
+
+// loadGoal parses the user and goal IDs in the path and retrieves the goal,
+// writing an error response if it cannot.
+func (h *GoalHandler) loadGoal(w http.ResponseWriter, r *http.Request) (*model.Goal, bool) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid user ID")
+		return nil, false
+	}
+	if !authorizeUser(w, r, userID) {
+		return nil, false
+	}
+	goalID, err := strconv.ParseInt(chi.URLParam(r, "goalID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid goal ID")
+		return nil, false
+	}
+
+	goal, err := h.goalRepo.GetGoal(userID, goalID)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to retrieve goal")
+		return nil, false
+	}
+	return goal, true
+}
@@ -0,0 +1,1536 @@
+package handler
+
+import (
+	"activity-tracker/pkg/apierror"
+	"activity-tracker/pkg/auth"
+	"activity-tracker/pkg/model"
+	repository "activity-tracker/pkg/respository"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+)
+
+// testServer serves every route, wired the same way as cmd/server, on top of
+// a fresh in-memory repository.
+type testServer struct {
+	*httptest.Server
+	repo  *repository.MemoryRepository
+	clock *testClock
+}
+
+// testClock is a clock that only moves when told to.
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestServer(t *testing.T) *testServer {
+	repo := repository.NewMemoryRepository()
+	tokens := auth.NewTokenManager("test secret", time.Hour)
+	userHandler := NewUserHandler(repo)
+	clock := &testClock{now: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)}
+	timerHandler := NewTimerHandler(repo, repo)
+	timerHandler.now = clock.Now
+	statsHandler := NewStatsHandler(repo, repo)
+	statsHandler.now = clock.Now
+	goalHandler := NewGoalHandler(repo, repo, repo)
+	goalHandler.now = clock.Now
+	symptomHandler := NewSymptomHandler(repo, repo)
+	symptomHandler.now = clock.Now
+
+	router := chi.NewRouter()
+	NewAuthHandler(repo, tokens).RegisterRoutes(router)
+	userHandler.RegisterPublicRoutes(router)
+	router.Group(func(router chi.Router) {
+		router.Use(auth.Middleware(tokens, repo))
+		userHandler.RegisterRoutes(router)
+		NewActivityHandler(repo).RegisterRoutes(router)
+		NewCategoryHandler(repo).RegisterRoutes(router)
+		NewUserActivityHandler(repo, repo, repo).RegisterRoutes(router)
+		timerHandler.RegisterRoutes(router)
+		statsHandler.RegisterRoutes(router)
+		goalHandler.RegisterRoutes(router)
+		symptomHandler.RegisterRoutes(router)
+		NewTagHandler(repo).RegisterRoutes(router)
+	})
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return &testServer{Server: server, repo: repo, clock: clock}
+}
+
+// testClient sends JSON requests to a testServer, authenticated if it has a token.
+type testClient struct {
+	t       *testing.T
+	baseURL string
+	token   string
+}
+
+// anonymous returns a client without a session token.
+func (s *testServer) anonymous(t *testing.T) *testClient {
+	return &testClient{t: t, baseURL: s.URL}
+}
+
+// signUp creates a user, logs them in and returns a client acting as them.
+func (s *testServer) signUp(t *testing.T, username string) (*testClient, int64) {
+	client := s.anonymous(t)
+	credentials := userRequest{Username: username, Password: "password for " + username}
+
+	var created map[string]int64
+	if status := client.do(http.MethodPost, "/users", credentials, &created); status != http.StatusOK {
+		t.Fatalf("Failed to sign up %q: status %d", username, status)
+	}
+
+	var login loginResponse
+	if status := client.do(http.MethodPost, "/auth/login", credentials, &login); status != http.StatusOK {
+		t.Fatalf("Failed to log in %q: status %d", username, status)
+	}
+	client.token = login.Token
+	return client, created["user_id"]
+}
+
+// do sends body as JSON and decodes the JSON response into out, if given.
+func (c *testClient) do(method, path string, body interface{}, out interface{}) int {
+	resp := c.send(method, path, body)
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			c.t.Fatalf("Failed to decode response body: %v", err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// doError sends a request that is expected to fail and decodes the JSON error
+// envelope into out.
+func (c *testClient) doError(method, path string, body interface{}, out *apierror.Response) int {
+	resp := c.send(method, path, body)
+	defer resp.Body.Close()
+
+	*out = apierror.Response{}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		c.t.Fatalf("Failed to decode error response body: %v", err)
+	}
+	return resp.StatusCode
+}
+
+// send sends body as JSON, with the client's token if it has one.
+func (c *testClient) send(method, path string, body interface{}) *http.Response {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			c.t.Fatalf("Failed to encode request body: %v", err)
+		}
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, &payload)
+	if err != nil {
+		c.t.Fatalf("Failed to build request: %v", err)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatalf("Failed to send request: %v", err)
+	}
+	return resp
+}
+
+func timePtr(value time.Time) *time.Time {
+	return &value
+}
+
+func int64Ptr(value int64) *int64 {
+	return &value
+}
+
+func TestAuthentication(t *testing.T) {
+	server := newTestServer(t)
+	_, userID := server.signUp(t, "carol")
+	anonymous := server.anonymous(t)
+
+	status := anonymous.do(http.MethodGet, fmt.Sprintf("/users/%d", userID), nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	status = anonymous.do(http.MethodPost, "/auth/login", loginRequest{Username: "carol", Password: "wrong"}, nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	forged := &testClient{t: t, baseURL: server.URL, token: "not.a.token"}
+	status = forged.do(http.MethodGet, fmt.Sprintf("/users/%d", userID), nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestUserEndpoints(t *testing.T) {
+	server := newTestServer(t)
+	alice, aliceID := server.signUp(t, "alice")
+	_, bobID := server.signUp(t, "bob")
+	userPath := fmt.Sprintf("/users/%d", aliceID)
+
+	var user map[string]interface{}
+	status := alice.do(http.MethodGet, userPath, nil, &user)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "alice", user["username"])
+	assert.Equal(t, float64(aliceID), user["id"])
+	assert.NotContains(t, user, "password")
+
+	status = alice.do(http.MethodPut, userPath, userRequest{Username: "alice2"}, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	alice.do(http.MethodGet, userPath, nil, &user)
+	assert.Equal(t, "alice2", user["username"])
+	assert.Equal(t, "UTC", user["time_zone"])
+
+	status = alice.do(http.MethodPut, userPath, userRequest{Username: "alice2", TimeZone: "Europe/Berlin"}, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	alice.do(http.MethodGet, userPath, nil, &user)
+	assert.Equal(t, "Europe/Berlin", user["time_zone"])
+
+	var errorResponse apierror.Response
+	status = alice.doError(http.MethodPut, userPath, userRequest{Username: "alice2", TimeZone: "Mars/Olympus_Mons"}, &errorResponse)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, []apierror.FieldError{
+		{Field: "time_zone", Message: "must be an IANA time zone such as Europe/Berlin"},
+	}, errorResponse.Error.Details)
+
+	// Users cannot touch each other's records
+	status = alice.do(http.MethodGet, fmt.Sprintf("/users/%d", bobID), nil, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+	status = alice.do(http.MethodDelete, fmt.Sprintf("/users/%d", bobID), nil, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	status = alice.do(http.MethodGet, "/users/abc", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status = alice.do(http.MethodDelete, userPath, nil, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+
+	// A deleted user's token no longer authenticates
+	status = alice.do(http.MethodGet, userPath, nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestActivityEndpoints(t *testing.T) {
+	server := newTestServer(t)
+	client, _ := server.signUp(t, "dave")
+
+	var created map[string]int64
+	status := client.do(http.MethodPost, "/activities", activityRequest{Name: "Running"}, &created)
+	assert.Equal(t, http.StatusOK, status)
+	activityPath := fmt.Sprintf("/activities/%d", created["activity_id"])
+
+	status = client.do(http.MethodPut, activityPath, activityRequest{Name: "Trail running"}, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+
+	var activity activityResponse
+	status = client.do(http.MethodGet, activityPath, nil, &activity)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Trail running", activity.Name)
+
+	status = client.do(http.MethodDelete, activityPath, nil, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	status = client.do(http.MethodGet, activityPath, nil, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestUserActivityEndpoints(t *testing.T) {
+	server := newTestServer(t)
+	client, userID := server.signUp(t, "erin")
+	other, _ := server.signUp(t, "frank")
+
+	var createdActivity map[string]int64
+	client.do(http.MethodPost, "/activities", activityRequest{Name: "Yoga"}, &createdActivity)
+
+	start := time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC)
+	userActivity := userActivityRequest{
+		ActivityID:           createdActivity["activity_id"],
+		StartTime:            start,
+		EndTime:              timePtr(start.Add(45 * time.Minute)),
+		Mood:                 4,
+		AdditionalAttributes: map[string]interface{}{"knee_feeling": "fine"},
+	}
+
+	var created map[string]int64
+	status := client.do(http.MethodPost, "/user-activities", userActivity, &created)
+	assert.Equal(t, http.StatusOK, status)
+	userActivityPath := fmt.Sprintf("/user-activities/%d", created["user_activity_id"])
+
+	var retrieved userActivityResponse
+	status = client.do(http.MethodGet, userActivityPath, nil, &retrieved)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, userID, retrieved.UserID)
+	assert.True(t, start.Equal(retrieved.StartTime))
+	assert.Equal(t, int64(45*60), retrieved.DurationSeconds, "derived from the start and end times")
+	assert.Equal(t, "fine", retrieved.AdditionalAttributes["knee_feeling"])
+
+	// The wire format is snake_case with RFC 3339 timestamps and durations in seconds
+	var raw map[string]interface{}
+	client.do(http.MethodGet, userActivityPath, nil, &raw)
+	assert.Equal(t, "2024-03-01T07:00:00Z", raw["start_time"])
+	assert.Equal(t, float64(45*60), raw["duration_seconds"])
+	assert.Equal(t, map[string]interface{}{"knee_feeling": "fine"}, raw["additional_attributes"])
+
+	// Other users cannot see or change it
+	status = other.do(http.MethodGet, userActivityPath, nil, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+	status = other.do(http.MethodPut, userActivityPath, userActivity, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+	status = other.do(http.MethodDelete, userActivityPath, nil, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	userActivity.Mood = 2
+	status = client.do(http.MethodPut, userActivityPath, userActivity, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	client.do(http.MethodGet, userActivityPath, nil, &retrieved)
+	assert.Equal(t, 2, retrieved.Mood)
+
+	status = client.do(http.MethodDelete, userActivityPath, nil, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	status = client.do(http.MethodGet, userActivityPath, nil, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+
+}
+
+func TestValidation(t *testing.T) {
+	server := newTestServer(t)
+	client, _ := server.signUp(t, "kate")
+
+	var errorResponse apierror.Response
+	status := server.anonymous(t).doError(http.MethodPost, "/users", userRequest{Username: " ", Password: "short"}, &errorResponse)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, apierror.CodeValidation, errorResponse.Error.Code)
+	assert.Equal(t, []apierror.FieldError{
+		{Field: "username", Message: "must not be blank"},
+		{Field: "password", Message: "must be at least 8 characters"},
+	}, errorResponse.Error.Details)
+
+	status = client.doError(http.MethodPost, "/activities", activityRequest{}, &errorResponse)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, []apierror.FieldError{{Field: "name", Message: "must not be blank"}}, errorResponse.Error.Details)
+
+	start := time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC)
+	status = client.doError(http.MethodPost, "/user-activities", userActivityRequest{
+		ActivityID: 999,
+		StartTime:  start,
+		EndTime:    timePtr(start.Add(-time.Hour)),
+		Mood:       9,
+	}, &errorResponse)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, []apierror.FieldError{
+		{Field: "activity_id", Message: "does not refer to an existing activity"},
+		{Field: "end_time", Message: "must not be before start_time"},
+		{Field: "mood", Message: "must be between 1 and 5"},
+	}, errorResponse.Error.Details)
+
+	var created map[string]int64
+	client.do(http.MethodPost, "/activities", activityRequest{Name: "Hiking"}, &created)
+	status = client.doError(http.MethodPost, "/user-activities", userActivityRequest{
+		ActivityID:      created["activity_id"],
+		StartTime:       start,
+		EndTime:         timePtr(start.Add(time.Hour)),
+		DurationSeconds: int64Ptr(60),
+		Mood:            3,
+	}, &errorResponse)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, []apierror.FieldError{
+		{Field: "duration_seconds", Message: "must equal the number of seconds between start_time and end_time"},
+	}, errorResponse.Error.Details)
+}
+
+func TestActivityAttributeSchemas(t *testing.T) {
+	server := newTestServer(t)
+	client, _ := server.signUp(t, "nina")
+
+	min, max := 0.0, 10.0
+	schema := attributeSchema{Fields: []attributeField{
+		{Name: "pain", Type: "number", Unit: "points", Min: &min, Max: &max, Required: true},
+		{Name: "surface", Type: "enum", Values: []string{"road", "trail"}},
+		{Name: "notes", Type: "text"},
+		{Name: "with_dog", Type: "boolean"},
+	}}
+	var createdActivity map[string]int64
+	status := client.do(http.MethodPost, "/activities", activityRequest{Name: "Running", AttributeSchema: schema}, &createdActivity)
+	assert.Equal(t, http.StatusOK, status)
+	activityID := createdActivity["activity_id"]
+
+	var retrieved activitySchemaResponse
+	status = client.do(http.MethodGet, fmt.Sprintf("/activities/%d/schema", activityID), nil, &retrieved)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, activitySchemaResponse{ActivityID: activityID, Fields: schema.Fields}, retrieved)
+
+	var errorResponse apierror.Response
+	status = client.doError(http.MethodGet, "/activities/999/schema", nil, &errorResponse)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// Invalid schemas are rejected field by field
+	status = client.doError(http.MethodPost, "/activities", activityRequest{Name: "Cycling", AttributeSchema: attributeSchema{
+		Fields: []attributeField{
+			{Name: "knee feeling", Type: "text"},
+			{Name: "gear", Type: "enum"},
+			{Name: "speed", Type: "number", Min: &max, Max: &min},
+			{Name: "speed", Type: "colour"},
+		},
+	}}, &errorResponse)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, []apierror.FieldError{
+		{Field: "attribute_schema.fields[0].name", Message: "must only contain letters, digits and underscores"},
+		{Field: "attribute_schema.fields[1].values", Message: "must not be empty for enum fields"},
+		{Field: "attribute_schema.fields[2].max", Message: "must not be less than min"},
+		{Field: "attribute_schema.fields[3].name", Message: "must be unique"},
+		{Field: "attribute_schema.fields[3].type", Message: "must be number, enum, text or boolean"},
+	}, errorResponse.Error.Details)
+
+	// Attributes are checked against the schema
+	start := time.Date(2024, 4, 1, 7, 0, 0, 0, time.UTC)
+	request := userActivityRequest{
+		ActivityID: activityID, StartTime: start, DurationSeconds: int64Ptr(1800), Mood: 3,
+		AdditionalAttributes: map[string]interface{}{"surface": "sand", "notes": 5, "with_dog": "yes", "distance": 5},
+	}
+	status = client.doError(http.MethodPost, "/user-activities", request, &errorResponse)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, []apierror.FieldError{
+		{Field: "additional_attributes.distance", Message: "is not an attribute of the activity"},
+		{Field: "additional_attributes.pain", Message: "is required"},
+		{Field: "additional_attributes.surface", Message: "must be one of road, trail"},
+		{Field: "additional_attributes.notes", Message: "must be a string"},
+		{Field: "additional_attributes.with_dog", Message: "must be a boolean"},
+	}, errorResponse.Error.Details)
+
+	request.AdditionalAttributes = map[string]interface{}{"pain": 11}
+	status = client.doError(http.MethodPost, "/user-activities", request, &errorResponse)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, []apierror.FieldError{{Field: "additional_attributes.pain", Message: "must be at most 10"}}, errorResponse.Error.Details)
+
+	request.AdditionalAttributes = map[string]interface{}{"pain": 2.5, "surface": "trail", "with_dog": true, "notes": nil}
+	var created map[string]int64
+	status = client.do(http.MethodPost, "/user-activities", request, &created)
+	assert.Equal(t, http.StatusOK, status)
+	var userActivity userActivityResponse
+	client.do(http.MethodGet, fmt.Sprintf("/user-activities/%d", created["user_activity_id"]), nil, &userActivity)
+	assert.Equal(t, map[string]interface{}{"pain": 2.5, "surface": "trail", "with_dog": true}, userActivity.AdditionalAttributes,
+		"null attributes are dropped")
+
+	// Stopping a timer checks the attributes too
+	var timer map[string]int64
+	client.do(http.MethodPost, fmt.Sprintf("/users/%d/timers", userActivity.UserID), startTimerRequest{ActivityID: activityID}, &timer)
+	server.clock.Advance(10 * time.Minute)
+	stopPath := fmt.Sprintf("/users/%d/timers/%d/stop", userActivity.UserID, timer["timer_id"])
+	status = client.doError(http.MethodPost, stopPath, stopTimerRequest{Mood: 4}, &errorResponse)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, []apierror.FieldError{{Field: "additional_attributes.pain", Message: "is required"}}, errorResponse.Error.Details)
+	status = client.do(http.MethodPost, stopPath, stopTimerRequest{Mood: 4, AdditionalAttributes: map[string]interface{}{"pain": 1}}, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	// Activities without a schema accept free-form scalar attributes
+	var freeForm map[string]int64
+	client.do(http.MethodPost, "/activities", activityRequest{Name: "Stretching"}, &freeForm)
+	request = userActivityRequest{
+		ActivityID: freeForm["activity_id"], StartTime: start.Add(time.Hour), DurationSeconds: int64Ptr(600), Mood: 3,
+		AdditionalAttributes: map[string]interface{}{"knee_feeling": "fine", "reps": []int{1, 2}},
+	}
+	status = client.doError(http.MethodPost, "/user-activities", request, &errorResponse)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, []apierror.FieldError{{Field: "additional_attributes.reps", Message: "must be a number, string or boolean"}}, errorResponse.Error.Details)
+	delete(request.AdditionalAttributes, "reps")
+	status = client.do(http.MethodPost, "/user-activities", request, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	// Updates cannot move a record to another activity, which would leave its
+	// attributes unchecked against the schema it is stored under
+	updatePath := fmt.Sprintf("/user-activities/%d", created["user_activity_id"])
+	status = client.doError(http.MethodPut, updatePath, request, &errorResponse)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, []apierror.FieldError{{Field: "activity_id", Message: "cannot be changed"}}, errorResponse.Error.Details)
+	request.ActivityID = 0
+	status = client.doError(http.MethodPut, updatePath, request, &errorResponse)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, []apierror.FieldError{
+		{Field: "additional_attributes.knee_feeling", Message: "is not an attribute of the activity"},
+		{Field: "additional_attributes.pain", Message: "is required"},
+	}, errorResponse.Error.Details, "attributes are checked against the stored activity")
+	client.do(http.MethodGet, updatePath, nil, &userActivity)
+	assert.Equal(t, activityID, userActivity.ActivityID)
+	assert.Equal(t, map[string]interface{}{"pain": 2.5, "surface": "trail", "with_dog": true}, userActivity.AdditionalAttributes)
+}
+
+func TestUserActivityTimingIsDerived(t *testing.T) {
+	server := newTestServer(t)
+	client, _ := server.signUp(t, "liam")
+
+	var createdActivity map[string]int64
+	client.do(http.MethodPost, "/activities", activityRequest{Name: "Walking"}, &createdActivity)
+	start := time.Date(2024, 6, 1, 7, 0, 0, 0, time.UTC)
+
+	// The end time is derived from the duration...
+	var created map[string]int64
+	status := client.do(http.MethodPost, "/user-activities", userActivityRequest{
+		ActivityID: createdActivity["activity_id"], StartTime: start, DurationSeconds: int64Ptr(1200), Mood: 3,
+	}, &created)
+	assert.Equal(t, http.StatusOK, status)
+	userActivityPath := fmt.Sprintf("/user-activities/%d", created["user_activity_id"])
+
+	var retrieved userActivityResponse
+	client.do(http.MethodGet, userActivityPath, nil, &retrieved)
+	assert.True(t, start.Add(20*time.Minute).Equal(retrieved.EndTime))
+	assert.Equal(t, int64(1200), retrieved.DurationSeconds)
+
+	// ...and the duration from the end time, in whole seconds
+	status = client.do(http.MethodPut, userActivityPath, userActivityRequest{
+		ActivityID: createdActivity["activity_id"], StartTime: start, EndTime: timePtr(start.Add(90*time.Second + 500*time.Millisecond)), Mood: 3,
+	}, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	client.do(http.MethodGet, userActivityPath, nil, &retrieved)
+	assert.Equal(t, int64(90), retrieved.DurationSeconds)
+
+	// Consistent triples are accepted, and one of end or duration is required
+	status = client.do(http.MethodPut, userActivityPath, userActivityRequest{
+		ActivityID: createdActivity["activity_id"], StartTime: start, EndTime: timePtr(start.Add(time.Minute)), DurationSeconds: int64Ptr(60), Mood: 3,
+	}, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	var errorResponse apierror.Response
+	status = client.doError(http.MethodPut, userActivityPath, userActivityRequest{
+		ActivityID: createdActivity["activity_id"], StartTime: start, Mood: 3,
+	}, &errorResponse)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, []apierror.FieldError{
+		{Field: "end_time", Message: "is required unless duration_seconds is given"},
+	}, errorResponse.Error.Details)
+}
+
+func TestTimerEndpoints(t *testing.T) {
+	server := newTestServer(t)
+	client, userID := server.signUp(t, "mia")
+	other, _ := server.signUp(t, "noah")
+	timersPath := fmt.Sprintf("/users/%d/timers", userID)
+
+	var createdActivity map[string]int64
+	client.do(http.MethodPost, "/activities", activityRequest{Name: "Climbing"}, &createdActivity)
+	startedAt := server.clock.Now()
+
+	var started map[string]int64
+	status := client.do(http.MethodPost, timersPath, startTimerRequest{ActivityID: createdActivity["activity_id"]}, &started)
+	assert.Equal(t, http.StatusOK, status)
+	timerPath := fmt.Sprintf("%s/%d", timersPath, started["timer_id"])
+
+	// Only one timer may run at a time
+	status = client.do(http.MethodPost, timersPath, startTimerRequest{ActivityID: createdActivity["activity_id"]}, nil)
+	assert.Equal(t, http.StatusConflict, status)
+
+	// Run for 10 minutes, pause for an hour, then run for 5 more
+	server.clock.Advance(10 * time.Minute)
+	assert.Equal(t, http.StatusNoContent, client.do(http.MethodPost, timerPath+"/pause", nil, nil))
+	assert.Equal(t, http.StatusConflict, client.do(http.MethodPost, timerPath+"/pause", nil, nil))
+	server.clock.Advance(time.Hour)
+
+	var timer timerResponse
+	status = client.do(http.MethodGet, timerPath, nil, &timer)
+	assert.Equal(t, http.StatusOK, status)
+	assert.False(t, timer.Running)
+	assert.Equal(t, int64(10*60), timer.ElapsedSeconds)
+
+	assert.Equal(t, http.StatusNoContent, client.do(http.MethodPost, timerPath+"/resume", nil, nil))
+	server.clock.Advance(5 * time.Minute)
+
+	var timers []timerResponse
+	status = client.do(http.MethodGet, timersPath, nil, &timers)
+	assert.Equal(t, http.StatusOK, status)
+	if assert.Len(t, timers, 1) {
+		assert.True(t, timers[0].Running)
+		assert.Equal(t, int64(15*60), timers[0].ElapsedSeconds)
+	}
+
+	// Other users cannot see or control the timer
+	assert.Equal(t, http.StatusForbidden, other.do(http.MethodGet, timerPath, nil, nil))
+	assert.Equal(t, http.StatusForbidden, other.do(http.MethodPost, timerPath+"/stop", stopTimerRequest{Mood: 3}, nil))
+
+	// Stopping records each run as a user activity and removes the timer
+	var stopped stopTimerResponse
+	status = client.do(http.MethodPost, timerPath+"/stop", stopTimerRequest{Mood: 4}, &stopped)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Nil(t, stopped.Warning)
+
+	var runs []userActivityResponse
+	for _, userActivityID := range stopped.UserActivityIDs {
+		var userActivity userActivityResponse
+		client.do(http.MethodGet, fmt.Sprintf("/user-activities/%d", userActivityID), nil, &userActivity)
+		runs = append(runs, userActivity)
+	}
+	if assert.Len(t, runs, 2) {
+		assert.Equal(t, createdActivity["activity_id"], runs[0].ActivityID)
+		assert.True(t, startedAt.Equal(runs[0].StartTime))
+		assert.True(t, startedAt.Add(10*time.Minute).Equal(runs[0].EndTime))
+		assert.Equal(t, int64(10*60), runs[0].DurationSeconds)
+		assert.True(t, startedAt.Add(70*time.Minute).Equal(runs[1].StartTime))
+		assert.Equal(t, int64(5*60), runs[1].DurationSeconds)
+		assert.Equal(t, 4, runs[1].Mood)
+	}
+
+	assert.Equal(t, http.StatusNotFound, client.do(http.MethodGet, timerPath, nil, nil))
+	var stoppedAgain apierror.Response
+	status = client.doError(http.MethodPost, timerPath+"/stop", stopTimerRequest{Mood: 4}, &stoppedAgain)
+	assert.Equal(t, http.StatusNotFound, status, "a timer is only recorded once")
+	status = client.do(http.MethodPost, timersPath, startTimerRequest{ActivityID: createdActivity["activity_id"]}, nil)
+	assert.Equal(t, http.StatusOK, status, "a new timer can be started once the last one stopped")
+}
+
+func TestStopTimerAfterOverlappingPause(t *testing.T) {
+	server := newTestServer(t)
+	client, userID := server.signUp(t, "pia")
+	timersPath := fmt.Sprintf("/users/%d/timers", userID)
+
+	var createdActivity map[string]int64
+	client.do(http.MethodPost, "/activities", activityRequest{Name: "Painting"}, &createdActivity)
+	startedAt := server.clock.Now()
+
+	var started map[string]int64
+	client.do(http.MethodPost, timersPath, startTimerRequest{ActivityID: createdActivity["activity_id"]}, &started)
+	timerPath := fmt.Sprintf("%s/%d", timersPath, started["timer_id"])
+
+	// Run for 10 minutes, then log something else during an hour's pause
+	server.clock.Advance(10 * time.Minute)
+	assert.Equal(t, http.StatusNoContent, client.do(http.MethodPost, timerPath+"/pause", nil, nil))
+	var during userActivityWriteResponse
+	status := client.do(http.MethodPost, "/user-activities", userActivityRequest{
+		ActivityID: createdActivity["activity_id"], StartTime: startedAt.Add(20 * time.Minute), DurationSeconds: int64Ptr(30 * 60), Mood: 3,
+	}, &during)
+	assert.Equal(t, http.StatusOK, status)
+	server.clock.Advance(time.Hour)
+	assert.Equal(t, http.StatusNoContent, client.do(http.MethodPost, timerPath+"/resume", nil, nil))
+	server.clock.Advance(20 * time.Minute)
+
+	// Only the time the timer ran is recorded, so nothing overlaps
+	var stopped stopTimerResponse
+	status = client.do(http.MethodPost, timerPath+"/stop", stopTimerRequest{Mood: 4}, &stopped)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Nil(t, stopped.Warning)
+	assert.Len(t, stopped.UserActivityIDs, 2)
+	assert.Equal(t, http.StatusNotFound, client.do(http.MethodGet, timerPath, nil, nil))
+
+	// A run that does overlap another entry is rejected, and the timer kept
+	client.do(http.MethodPost, timersPath, startTimerRequest{ActivityID: createdActivity["activity_id"]}, &started)
+	timerPath = fmt.Sprintf("%s/%d", timersPath, started["timer_id"])
+	status = client.do(http.MethodPost, "/user-activities", userActivityRequest{
+		ActivityID: createdActivity["activity_id"], StartTime: server.clock.Now().Add(5 * time.Minute), DurationSeconds: int64Ptr(60), Mood: 3,
+	}, nil)
+	assert.Equal(t, http.StatusOK, status)
+	server.clock.Advance(10 * time.Minute)
+	assert.Equal(t, http.StatusConflict, client.do(http.MethodPost, timerPath+"/stop", stopTimerRequest{Mood: 4}, nil))
+	assert.Equal(t, http.StatusOK, client.do(http.MethodGet, timerPath, nil, nil))
+}
+
+func TestUserActivityOverlaps(t *testing.T) {
+	server := newTestServer(t)
+	client, _ := server.signUp(t, "olga")
+
+	var createdActivity map[string]int64
+	client.do(http.MethodPost, "/activities", activityRequest{Name: "Tennis"}, &createdActivity)
+	start := time.Date(2024, 8, 1, 17, 0, 0, 0, time.UTC)
+	entry := func(offset time.Duration) userActivityRequest {
+		return userActivityRequest{
+			ActivityID: createdActivity["activity_id"], StartTime: start.Add(offset), DurationSeconds: int64Ptr(3600), Mood: 3,
+		}
+	}
+
+	var first userActivityWriteResponse
+	status := client.do(http.MethodPost, "/user-activities", entry(0), &first)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Nil(t, first.Warning)
+
+	var errorResponse apierror.Response
+	status = client.doError(http.MethodPost, "/user-activities", entry(30*time.Minute), &errorResponse)
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Equal(t, apierror.CodeConflict, errorResponse.Error.Code)
+
+	server.repo.SetOverlapPolicy(repository.OverlapWarn)
+	var warned userActivityWriteResponse
+	status = client.do(http.MethodPost, "/user-activities", entry(30*time.Minute), &warned)
+	assert.Equal(t, http.StatusOK, status)
+	if assert.NotNil(t, warned.Warning) {
+		assert.Equal(t, warningOverlap, warned.Warning.Code)
+		assert.Equal(t, []int64{first.UserActivityID}, warned.Warning.UserActivityIDs)
+	}
+
+	// Updates only have a body when there is a warning
+	userActivityPath := fmt.Sprintf("/user-activities/%d", first.UserActivityID)
+	var updated userActivityWriteResponse
+	status = client.do(http.MethodPut, userActivityPath, entry(15*time.Minute), &updated)
+	assert.Equal(t, http.StatusOK, status)
+	if assert.NotNil(t, updated.Warning) {
+		assert.Equal(t, []int64{warned.UserActivityID}, updated.Warning.UserActivityIDs)
+	}
+	status = client.do(http.MethodPut, userActivityPath, entry(-2*time.Hour), nil)
+	assert.Equal(t, http.StatusNoContent, status)
+}
+
+func TestErrorResponses(t *testing.T) {
+	server := newTestServer(t)
+	client, _ := server.signUp(t, "jack")
+
+	var errorResponse apierror.Response
+	status := client.doError(http.MethodGet, "/activities/42", nil, &errorResponse)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, apierror.CodeNotFound, errorResponse.Error.Code)
+	assert.NotEmpty(t, errorResponse.Error.Message)
+
+	status = client.doError(http.MethodPost, "/users", userRequest{Username: "jack", Password: "another password"}, &errorResponse)
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Equal(t, apierror.CodeConflict, errorResponse.Error.Code)
+
+	var created map[string]int64
+	client.do(http.MethodPost, "/activities", activityRequest{Name: "Swimming"}, &created)
+	start := time.Date(2024, 4, 1, 7, 0, 0, 0, time.UTC)
+	client.do(http.MethodPost, "/user-activities", userActivityRequest{
+		ActivityID: created["activity_id"], StartTime: start, DurationSeconds: int64Ptr(3600), Mood: 3,
+	}, nil)
+	status = client.doError(http.MethodDelete, fmt.Sprintf("/activities/%d", created["activity_id"]), nil, &errorResponse)
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Equal(t, apierror.CodeConflict, errorResponse.Error.Code)
+
+	status = server.anonymous(t).doError(http.MethodGet, "/activities", nil, &errorResponse)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, apierror.CodeUnauthorized, errorResponse.Error.Code)
+}
+
+func TestListUserActivitiesEndpoint(t *testing.T) {
+	server := newTestServer(t)
+	client, userID := server.signUp(t, "gina")
+	other, _ := server.signUp(t, "hank")
+
+	var createdActivity map[string]int64
+	client.do(http.MethodPost, "/activities", activityRequest{Name: "Cycling"}, &createdActivity)
+
+	start := time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC)
+	attributes := []map[string]interface{}{{"knee_feeling": "sore", "pain": 6}, {"knee_feeling": "fine", "pain": 2}, {}}
+	for i := 0; i < 3; i++ {
+		entryStart := start.Add(time.Duration(i) * 24 * time.Hour)
+		status := client.do(http.MethodPost, "/user-activities", userActivityRequest{
+			ActivityID: createdActivity["activity_id"], StartTime: entryStart, DurationSeconds: int64Ptr(3600), Mood: 3,
+			AdditionalAttributes: attributes[i],
+		}, nil)
+		assert.Equal(t, http.StatusOK, status)
+	}
+
+	listPath := fmt.Sprintf("/users/%d/activities", userID)
+	var page userActivityPage
+	status := client.do(http.MethodGet, listPath+"?limit=2", nil, &page)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, page.Items, 2)
+	assert.True(t, page.Items[0].StartTime.After(page.Items[1].StartTime), "newest first by default")
+	assert.NotEmpty(t, page.NextCursor)
+
+	var last userActivityPage
+	status = client.do(http.MethodGet, listPath+"?limit=2&cursor="+page.NextCursor, nil, &last)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, last.Items, 1)
+	assert.Empty(t, last.NextCursor)
+
+	// Attribute filters; query values match numbers as well as strings
+	var filtered userActivityPage
+	client.do(http.MethodGet, listPath+"?attr.knee_feeling=sore", nil, &filtered)
+	assert.Len(t, filtered.Items, 1)
+	client.do(http.MethodGet, listPath+"?attr.pain=2", nil, &filtered)
+	assert.Len(t, filtered.Items, 1)
+	client.do(http.MethodGet, listPath+"?attr.pain.min=1&attr.pain.max=10", nil, &filtered)
+	assert.Len(t, filtered.Items, 2)
+	client.do(http.MethodGet, listPath+"?attr.knee_feeling.exists=false", nil, &filtered)
+	assert.Len(t, filtered.Items, 1)
+	for _, query := range []string{"attr.pain.min=lots", "attr.pain.between=1", "attr.knee%20feeling=sore", "attr.pain.exists=maybe"} {
+		status = client.do(http.MethodGet, listPath+"?"+query, nil, nil)
+		assert.Equal(t, http.StatusBadRequest, status, query)
+	}
+
+	status = client.do(http.MethodGet, listPath+"?cursor=garbage", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status = client.do(http.MethodGet, listPath+"?start_from=yesterday", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status = other.do(http.MethodGet, listPath, nil, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestListActivitiesEndpoint(t *testing.T) {
+	server := newTestServer(t)
+	client, _ := server.signUp(t, "ivy")
+
+	for _, name := range []string{"Running", "Rowing", "Yoga"} {
+		status := client.do(http.MethodPost, "/activities", activityRequest{Name: name}, nil)
+		assert.Equal(t, http.StatusOK, status)
+	}
+	status := client.do(http.MethodPost, "/activities", activityRequest{Name: "running"}, nil)
+	assert.Equal(t, http.StatusConflict, status)
+
+	var page activityPage
+	status = client.do(http.MethodGet, "/activities?q=r&limit=1", nil, &page)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, page.Items, 1)
+	assert.Equal(t, "Rowing", page.Items[0].Name)
+	if assert.NotNil(t, page.NextOffset) {
+		assert.Equal(t, 1, *page.NextOffset)
+	}
+
+	status = client.do(http.MethodGet, "/activities?match=fuzzy", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestStatsEndpoint(t *testing.T) {
+	server := newTestServer(t)
+	client, userID := server.signUp(t, "olga")
+	other, _ := server.signUp(t, "pete")
+
+	var running, yoga map[string]int64
+	client.do(http.MethodPost, "/activities", activityRequest{Name: "Running"}, &running)
+	client.do(http.MethodPost, "/activities", activityRequest{Name: "Yoga"}, &yoga)
+
+	// The test clock is at 1 January 2024, so these fall in the default 30 days
+	entries := []struct {
+		activityID int64
+		start      time.Time
+		minutes    int64
+		mood       int
+	}{
+		{running["activity_id"], time.Date(2023, 12, 20, 7, 0, 0, 0, time.UTC), 30, 4},
+		{yoga["activity_id"], time.Date(2023, 12, 20, 18, 0, 0, 0, time.UTC), 60, 5},
+		{running["activity_id"], time.Date(2023, 12, 27, 7, 0, 0, 0, time.UTC), 45, 3},
+	}
+	for _, entry := range entries {
+		status := client.do(http.MethodPost, "/user-activities", userActivityRequest{
+			ActivityID: entry.activityID, StartTime: entry.start, DurationSeconds: int64Ptr(entry.minutes * 60), Mood: entry.mood,
+		}, nil)
+		assert.Equal(t, http.StatusOK, status)
+	}
+
+	statsPath := fmt.Sprintf("/users/%d/stats", userID)
+	var stats statsResponse
+	status := client.do(http.MethodGet, statsPath, nil, &stats)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "day", stats.Period)
+	assert.Equal(t, int64(3), stats.Totals.Count)
+	assert.Equal(t, int64(135*60), stats.Totals.TotalDurationSeconds)
+	assert.Equal(t, 45.0*60, *stats.Totals.AverageDurationSeconds)
+	assert.Equal(t, 4.0, *stats.Totals.AverageMood)
+	assert.Len(t, stats.Buckets, 2)
+	assert.Equal(t, int64(2), stats.Buckets[0].Count)
+	assert.Nil(t, stats.Buckets[0].ActivityID)
+
+	status = client.do(http.MethodGet, statsPath+"?period=month&by=activity", nil, &stats)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, stats.Buckets, 2)
+	assert.Equal(t, running["activity_id"], *stats.Buckets[0].ActivityID)
+	assert.Equal(t, int64(2), stats.Buckets[0].Count)
+	assert.True(t, time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC).Equal(stats.Buckets[0].PeriodStart))
+
+	// An empty range has no averages
+	var raw struct {
+		Totals map[string]interface{} `json:"totals"`
+	}
+	client.do(http.MethodGet, statsPath+"?from=2023-01-01T00:00:00Z&to=2023-02-01T00:00:00Z", nil, &raw)
+	assert.Equal(t, float64(0), raw.Totals["count"])
+	assert.Contains(t, raw.Totals, "average_mood")
+	assert.Nil(t, raw.Totals["average_mood"])
+
+	// Neither is the mood of records without one, from before it was required
+	unrated := time.Date(2023, 11, 5, 7, 0, 0, 0, time.UTC)
+	_, _, err := server.repo.CreateUserActivity(&model.UserActivity{
+		UserID: userID, ActivityID: running["activity_id"], StartTime: unrated, EndTime: unrated.Add(time.Hour), Duration: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user activity: %v", err)
+	}
+	client.do(http.MethodGet, statsPath+"?from=2023-11-01T00:00:00Z&to=2023-12-01T00:00:00Z", nil, &raw)
+	assert.Equal(t, float64(1), raw.Totals["count"])
+	assert.Equal(t, float64(3600), raw.Totals["average_duration_seconds"])
+	assert.Nil(t, raw.Totals["average_mood"])
+
+	// 18:00 UTC on 20 December is already the 21st in Tokyo, whether it is
+	// the user's time zone or asked for
+	status = client.do(http.MethodGet, statsPath+"?tz=Asia/Tokyo", nil, &stats)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Asia/Tokyo", stats.TimeZone)
+	assert.Len(t, stats.Buckets, 3)
+	status = client.do(http.MethodPut, fmt.Sprintf("/users/%d", userID), userRequest{Username: "olga", TimeZone: "Asia/Tokyo"}, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	status = client.do(http.MethodGet, statsPath, nil, &stats)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Asia/Tokyo", stats.TimeZone)
+	assert.Len(t, stats.Buckets, 3)
+	assert.Equal(t, "2023-12-21T00:00:00+09:00", stats.Buckets[1].PeriodStart.Format(time.RFC3339))
+	status = client.do(http.MethodGet, statsPath+"?tz=UTC", nil, &stats)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, stats.Buckets, 2)
+
+	for _, query := range []string{"period=year", "by=mood", "from=2024-01-01T00:00:00Z&to=2023-01-01T00:00:00Z", "to=soon", "tz=Nowhere", "tz=Local"} {
+		status = client.do(http.MethodGet, statsPath+"?"+query, nil, nil)
+		assert.Equal(t, http.StatusBadRequest, status, query)
+	}
+	status = other.do(http.MethodGet, statsPath, nil, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestStreaksEndpoint(t *testing.T) {
+	server := newTestServer(t)
+	client, userID := server.signUp(t, "quinn")
+	other, _ := server.signUp(t, "rosa")
+
+	var running, yoga map[string]int64
+	client.do(http.MethodPost, "/activities", activityRequest{Name: "Running"}, &running)
+	client.do(http.MethodPost, "/activities", activityRequest{Name: "Yoga"}, &yoga)
+
+	// The test clock is at 1 January 2024, a Monday, which is not over yet
+	for _, entry := range []struct {
+		activityID int64
+		day, hour  int
+	}{
+		{running["activity_id"], 20, 7}, {running["activity_id"], 29, 7}, {running["activity_id"], 30, 7},
+		{running["activity_id"], 31, 7}, {yoga["activity_id"], 31, 8},
+	} {
+		status := client.do(http.MethodPost, "/user-activities", userActivityRequest{
+			ActivityID: entry.activityID, StartTime: time.Date(2023, 12, entry.day, entry.hour, 0, 0, 0, time.UTC), DurationSeconds: int64Ptr(1800), Mood: 3,
+		}, nil)
+		assert.Equal(t, http.StatusOK, status)
+	}
+
+	streaksPath := fmt.Sprintf("/users/%d/streaks", userID)
+	var streaks streaksResponse
+	status := client.do(http.MethodGet, streaksPath, nil, &streaks)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "daily", streaks.Cadence)
+	assert.Nil(t, streaks.TimesPerWeek)
+	assert.Equal(t, "UTC", streaks.TimeZone)
+	assert.Equal(t, int64(3), streaks.Overall.Current.Length)
+	assert.True(t, time.Date(2023, 12, 29, 0, 0, 0, 0, time.UTC).Equal(streaks.Overall.Current.Start))
+	assert.Equal(t, int64(3), streaks.Overall.Longest.Length)
+	assert.Len(t, streaks.Activities, 2)
+	assert.Equal(t, yoga["activity_id"], *streaks.Activities[1].ActivityID)
+	assert.Equal(t, int64(1), streaks.Activities[1].Current.Length)
+
+	var weekly streaksResponse
+	status = client.do(http.MethodGet, streaksPath+"?cadence=weekly&times=2&tolerance=1", nil, &weekly)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 2, *weekly.TimesPerWeek)
+	assert.Equal(t, int64(1), weekly.Overall.Current.Length)
+	// Yoga was only done once a week, so it has no weekly streaks
+	assert.Len(t, weekly.Activities, 1)
+
+	// In Honolulu the run on the 20th is on the 19th, and the rest are a day
+	// earlier too, so no day has been missed since
+	status = client.do(http.MethodGet, streaksPath+"?tz=Pacific/Honolulu", nil, &streaks)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Pacific/Honolulu", streaks.TimeZone)
+	assert.Equal(t, int64(3), streaks.Overall.Current.Length)
+	assert.Equal(t, "2023-12-28T00:00:00-10:00", streaks.Overall.Current.Start.Format(time.RFC3339))
+
+	for _, query := range []string{"cadence=monthly", "times=2", "cadence=weekly&times=8", "tolerance=-1", "tolerance=many", "tz=Nowhere"} {
+		status = client.do(http.MethodGet, streaksPath+"?"+query, nil, nil)
+		assert.Equal(t, http.StatusBadRequest, status, query)
+	}
+	status = other.do(http.MethodGet, streaksPath, nil, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestMoodEndpoint(t *testing.T) {
+	server := newTestServer(t)
+	client, userID := server.signUp(t, "uma")
+	other, _ := server.signUp(t, "victor")
+
+	var running, yoga map[string]int64
+	client.do(http.MethodPost, "/activities", activityRequest{Name: "Running"}, &running)
+	client.do(http.MethodPost, "/activities", activityRequest{Name: "Yoga"}, &yoga)
+
+	for _, entry := range []struct {
+		activityID int64
+		start      time.Time
+		minutes    int64
+		mood       int
+	}{
+		{running["activity_id"], time.Date(2023, 12, 20, 7, 0, 0, 0, time.UTC), 30, 4},
+		{yoga["activity_id"], time.Date(2023, 12, 20, 18, 0, 0, 0, time.UTC), 60, 5},
+		{running["activity_id"], time.Date(2023, 12, 27, 7, 0, 0, 0, time.UTC), 45, 2},
+	} {
+		status := client.do(http.MethodPost, "/user-activities", userActivityRequest{
+			ActivityID: entry.activityID, StartTime: entry.start, DurationSeconds: int64Ptr(entry.minutes * 60), Mood: entry.mood,
+		}, nil)
+		assert.Equal(t, http.StatusOK, status)
+	}
+
+	moodPath := fmt.Sprintf("/users/%d/mood", userID)
+	var mood moodResponse
+	status := client.do(http.MethodGet, moodPath, nil, &mood)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, scaleResponse{Min: 1, Max: 5}, mood.Scale)
+	assert.Equal(t, "day", mood.Period)
+	assert.Equal(t, int64(3), mood.Overall.Count)
+	assert.InDelta(t, 11.0/3, *mood.Overall.AverageMood, 1e-9)
+	assert.Len(t, mood.Trend, 2)
+	assert.Equal(t, 4.5, *mood.Trend[0].AverageMood)
+
+	assert.Len(t, mood.Activities, 2)
+	runningMood := mood.Activities[0]
+	assert.Equal(t, running["activity_id"], runningMood.ActivityID)
+	assert.Equal(t, 3.0, *runningMood.AverageMood)
+	assert.Equal(t, map[int]int64{1: 0, 2: 1, 3: 0, 4: 1, 5: 0}, runningMood.Distribution)
+	assert.Equal(t, int64(2), runningMood.DaysWith.Days)
+	assert.Equal(t, int64(0), runningMood.DaysWithout.Days)
+	assert.Nil(t, runningMood.DaysWithout.AverageMood)
+	// Yoga was done on the 20th, a better day than the 27th
+	yogaMood := mood.Activities[1]
+	assert.Equal(t, 4.5, *yogaMood.DaysWith.AverageMood)
+	assert.Equal(t, 2.0, *yogaMood.DaysWithout.AverageMood)
+
+	assert.Len(t, mood.Durations, 5)
+	assert.Equal(t, int64(1800), mood.Durations[2].MinSeconds)
+	assert.Equal(t, int64(3600), *mood.Durations[2].MaxSeconds)
+	assert.Equal(t, int64(2), mood.Durations[2].Count)
+	assert.Equal(t, 5.0, *mood.Durations[3].AverageMood)
+	assert.Nil(t, mood.Durations[4].MaxSeconds)
+	assert.Nil(t, mood.Durations[4].AverageMood)
+
+	status = client.do(http.MethodGet, moodPath+"?period=month&tz=Asia/Tokyo", nil, &mood)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Asia/Tokyo", mood.TimeZone)
+	assert.Len(t, mood.Trend, 1)
+
+	for _, query := range []string{"period=year", "from=2024-01-01T00:00:00Z&to=2023-01-01T00:00:00Z", "tz=Nowhere"} {
+		status = client.do(http.MethodGet, moodPath+"?"+query, nil, nil)
+		assert.Equal(t, http.StatusBadRequest, status, query)
+	}
+	status = other.do(http.MethodGet, moodPath, nil, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestGoalEndpoints(t *testing.T) {
+	server := newTestServer(t)
+	client, userID := server.signUp(t, "sam")
+	other, _ := server.signUp(t, "tara")
+	goalsPath := fmt.Sprintf("/users/%d/goals", userID)
+
+	var running map[string]int64
+	client.do(http.MethodPost, "/activities", activityRequest{
+		Name:            "Running",
+		AttributeSchema: attributeSchema{Fields: []attributeField{{Name: "distance_km", Type: "number"}, {Name: "route", Type: "text"}}},
+	}, &running)
+	runningID := running["activity_id"]
+
+	var created map[string]int64
+	status := client.do(http.MethodPost, goalsPath, goalRequest{ActivityID: &runningID, Metric: "duration", Period: "week", Target: 3600}, &created)
+	assert.Equal(t, http.StatusOK, status)
+	goalPath := fmt.Sprintf("%s/%d", goalsPath, created["goal_id"])
+
+	var goal goalResponse
+	status = client.do(http.MethodGet, goalPath, nil, &goal)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "duration", goal.Metric)
+	assert.Equal(t, 3600.0, goal.Target)
+	assert.True(t, server.clock.Now().Equal(goal.CreatedAt))
+
+	// The test clock is at 09:00 on Monday 1 January 2024
+	status = client.do(http.MethodPost, "/user-activities", userActivityRequest{
+		ActivityID: runningID, StartTime: time.Date(2024, 1, 1, 7, 0, 0, 0, time.UTC), DurationSeconds: int64Ptr(1800), Mood: 4,
+		AdditionalAttributes: map[string]interface{}{"distance_km": 5.5},
+	}, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	var progress goalProgressResponse
+	status = client.do(http.MethodGet, goalPath+"/progress", nil, &progress)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "UTC", progress.TimeZone)
+	assert.Equal(t, 1800.0, progress.Current.Value)
+	assert.Equal(t, 1800.0, progress.Current.Remaining)
+	assert.Equal(t, 0.5, progress.Current.Completion)
+	assert.False(t, progress.Current.Achieved)
+	assert.True(t, time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC).Equal(progress.Current.PeriodEnd))
+	assert.Empty(t, progress.History)
+
+	// A week later the first week is history
+	server.clock.Advance(7 * 24 * time.Hour)
+	status = client.do(http.MethodPost, "/user-activities", userActivityRequest{
+		ActivityID: runningID, StartTime: time.Date(2024, 1, 8, 7, 0, 0, 0, time.UTC), DurationSeconds: int64Ptr(3900), Mood: 4,
+	}, nil)
+	assert.Equal(t, http.StatusOK, status)
+	client.do(http.MethodGet, goalPath+"/progress", nil, &progress)
+	assert.True(t, progress.Current.Achieved)
+	assert.Equal(t, 0.0, progress.Current.Remaining)
+	if assert.Len(t, progress.History, 1) {
+		assert.Equal(t, 1800.0, progress.History[0].Value)
+	}
+	client.do(http.MethodGet, goalPath+"/progress?history=0", nil, &progress)
+	assert.Empty(t, progress.History)
+
+	status = client.do(http.MethodPut, goalPath, goalRequest{ActivityID: &runningID, Metric: "attribute_sum", Attribute: "distance_km", Period: "month", Target: 50}, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	client.do(http.MethodGet, goalPath+"/progress", nil, &progress)
+	assert.Equal(t, "attribute_sum", progress.Goal.Metric)
+	assert.Equal(t, 5.5, progress.Current.Value)
+	assert.Equal(t, 0.11, progress.Current.Completion)
+
+	var goals []goalResponse
+	status = client.do(http.MethodGet, goalsPath, nil, &goals)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, goals, 1)
+
+	var errorResponse apierror.Response
+	missing := int64(999)
+	status = client.doError(http.MethodPost, goalsPath, goalRequest{ActivityID: &missing, Metric: "calories", Attribute: "x", Period: "year"}, &errorResponse)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, []apierror.FieldError{
+		{Field: "activity_id", Message: "does not refer to an existing activity"},
+		{Field: "metric", Message: "must be count, duration or attribute_sum"},
+		{Field: "attribute", Message: "is only allowed with the attribute_sum metric"},
+		{Field: "period", Message: "must be day, week or month"},
+		{Field: "target", Message: "must be greater than zero"},
+	}, errorResponse.Error.Details)
+	status = client.doError(http.MethodPost, goalsPath, goalRequest{ActivityID: &runningID, Metric: "attribute_sum", Attribute: "route", Period: "day", Target: 1}, &errorResponse)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, []apierror.FieldError{{Field: "attribute", Message: "must be a number attribute of the activity"}}, errorResponse.Error.Details)
+
+	for _, query := range []string{"history=-1", "history=lots", "tz=Nowhere"} {
+		status = client.do(http.MethodGet, goalPath+"/progress?"+query, nil, nil)
+		assert.Equal(t, http.StatusBadRequest, status, query)
+	}
+	status = other.do(http.MethodGet, goalPath, nil, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+	status = client.do(http.MethodGet, goalsPath+"/999", nil, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status = client.do(http.MethodDelete, goalPath, nil, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	status = client.do(http.MethodGet, goalPath, nil, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestSymptomEndpoints(t *testing.T) {
+	server := newTestServer(t)
+	client, userID := server.signUp(t, "wendy")
+	other, otherID := server.signUp(t, "xavier")
+	symptomsPath := fmt.Sprintf("/users/%d/symptoms", userID)
+
+	var running, created map[string]int64
+	client.do(http.MethodPost, "/activities", activityRequest{Name: "Running"}, &running)
+	// The test clock is at 1 January 2024, so the run falls in the default 30 days
+	status := client.do(http.MethodPost, "/user-activities", userActivityRequest{
+		ActivityID: running["activity_id"], StartTime: time.Date(2023, 12, 20, 7, 0, 0, 0, time.UTC), DurationSeconds: int64Ptr(3600), Mood: 4,
+	}, &created)
+	assert.Equal(t, http.StatusOK, status)
+	runID := created["user_activity_id"]
+
+	status = client.do(http.MethodPost, symptomsPath, symptomRequest{
+		UserActivityID: &runID, BodyArea: " Left Knee ", Severity: 6, Notes: "Stairs hurt", OccurredAt: time.Date(2023, 12, 21, 12, 0, 0, 0, time.UTC),
+	}, &created)
+	assert.Equal(t, http.StatusOK, status)
+	symptomPath := fmt.Sprintf("%s/%d", symptomsPath, created["symptom_id"])
+
+	var symptom symptomResponse
+	status = client.do(http.MethodGet, symptomPath, nil, &symptom)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "left knee", symptom.BodyArea)
+	assert.Equal(t, runID, *symptom.UserActivityID)
+	assert.Equal(t, "Stairs hurt", symptom.Notes)
+
+	status = client.do(http.MethodPut, symptomPath, symptomRequest{BodyArea: "left knee", Severity: 8, OccurredAt: symptom.OccurredAt}, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	status = client.do(http.MethodPost, symptomsPath, symptomRequest{BodyArea: "back", Severity: 2, OccurredAt: time.Date(2023, 12, 30, 8, 0, 0, 0, time.UTC)}, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	var symptoms []symptomResponse
+	status = client.do(http.MethodGet, symptomsPath, nil, &symptoms)
+	assert.Equal(t, http.StatusOK, status)
+	if assert.Len(t, symptoms, 2) {
+		assert.Equal(t, 8, symptoms[0].Severity)
+		assert.Nil(t, symptoms[0].UserActivityID)
+	}
+	client.do(http.MethodGet, symptomsPath+"?body_area=Back", nil, &symptoms)
+	assert.Len(t, symptoms, 1)
+	client.do(http.MethodGet, symptomsPath+"?from=2023-12-25T00:00:00Z", nil, &symptoms)
+	assert.Len(t, symptoms, 1)
+
+	// The knee hurt 29 hours after the run, the back much later
+	var analysis symptomAnalysisResponse
+	status = client.do(http.MethodGet, symptomsPath+"/analysis", nil, &analysis)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 24.0, analysis.WindowStartHours)
+	assert.Equal(t, 72.0, analysis.WindowEndHours)
+	assert.Equal(t, scaleResponse{Min: 1, Max: 10}, analysis.Scale)
+	assert.Equal(t, int64(2), analysis.Overall.Count)
+	assert.Equal(t, 5.0, *analysis.Overall.AverageSeverity)
+	if assert.Len(t, analysis.Activities, 1) {
+		assert.Equal(t, running["activity_id"], analysis.Activities[0].ActivityID)
+		assert.Equal(t, int64(1), analysis.Activities[0].SessionsWithSymptoms)
+		assert.Equal(t, 8.0, *analysis.Activities[0].AverageSeverity)
+	}
+	client.do(http.MethodGet, symptomsPath+"/analysis?body_area=back", nil, &analysis)
+	assert.Equal(t, "back", analysis.BodyArea)
+	if assert.Len(t, analysis.Activities, 1) {
+		assert.Equal(t, int64(0), analysis.Activities[0].Count)
+		assert.Nil(t, analysis.Activities[0].AverageSeverity)
+	}
+
+	// The range is capped, as it is for the stats
+	var errorResponse apierror.Response
+	status = client.doError(http.MethodGet, symptomsPath+"/analysis?from=2000-01-01T00:00:00Z", nil, &errorResponse)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "invalid from: must be at most 366 days before to", errorResponse.Error.Message)
+	status = client.doError(http.MethodGet, fmt.Sprintf("/users/%d/stats?from=2000-01-01T00:00:00Z", userID), nil, &errorResponse)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status = client.do(http.MethodGet, symptomsPath+"/analysis?from=2023-01-01T00:00:00Z&to=2024-01-01T00:00:00Z", nil, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	status = client.doError(http.MethodPost, symptomsPath, symptomRequest{BodyArea: " ", Severity: 11}, &errorResponse)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, []apierror.FieldError{
+		{Field: "body_area", Message: "must not be blank"},
+		{Field: "severity", Message: "must be between 1 and 10"},
+		{Field: "occurred_at", Message: "is required"},
+	}, errorResponse.Error.Details)
+	// Symptoms can only be linked to the user's own activities
+	var otherRun map[string]int64
+	other.do(http.MethodPost, "/user-activities", userActivityRequest{
+		ActivityID: running["activity_id"], StartTime: time.Date(2023, 12, 20, 7, 0, 0, 0, time.UTC), DurationSeconds: int64Ptr(3600), Mood: 4,
+	}, &otherRun)
+	otherRunID := otherRun["user_activity_id"]
+	status = client.doError(http.MethodPost, symptomsPath, symptomRequest{UserActivityID: &otherRunID, BodyArea: "back", Severity: 1, OccurredAt: symptom.OccurredAt}, &errorResponse)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, "user_activity_id", errorResponse.Error.Details[0].Field)
+
+	for _, query := range []string{"from=2024-01-01T00:00:00Z&to=2023-01-01T00:00:00Z", "to=soon"} {
+		status = client.do(http.MethodGet, symptomsPath+"/analysis?"+query, nil, nil)
+		assert.Equal(t, http.StatusBadRequest, status, query)
+	}
+	status = other.do(http.MethodGet, symptomPath, nil, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+	status = other.do(http.MethodGet, fmt.Sprintf("/users/%d/symptoms/%d", otherID, created["symptom_id"]), nil, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status = client.do(http.MethodDelete, symptomPath, nil, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	status = client.do(http.MethodGet, symptomPath, nil, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestTagEndpoints(t *testing.T) {
+	server := newTestServer(t)
+	client, userID := server.signUp(t, "yvonne")
+	other, otherID := server.signUp(t, "zack")
+	tagsPath := fmt.Sprintf("/users/%d/tags", userID)
+
+	var created map[string]int64
+	status := client.do(http.MethodPost, tagsPath, tagRequest{Name: " Race "}, &created)
+	assert.Equal(t, http.StatusOK, status)
+	raceID := created["tag_id"]
+	client.do(http.MethodPost, tagsPath, tagRequest{Name: "morning"}, &created)
+	morningID := created["tag_id"]
+	tagPath := fmt.Sprintf("%s/%d", tagsPath, raceID)
+
+	var tag tagResponse
+	status = client.do(http.MethodGet, tagPath, nil, &tag)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "race", tag.Name)
+	var tags []tagResponse
+	client.do(http.MethodGet, tagsPath, nil, &tags)
+	if assert.Len(t, tags, 2) {
+		assert.Equal(t, "morning", tags[0].Name)
+	}
+
+	status = client.do(http.MethodPost, tagsPath, tagRequest{Name: "RACE"}, nil)
+	assert.Equal(t, http.StatusConflict, status)
+	var errorResponse apierror.Response
+	status = client.doError(http.MethodPost, tagsPath, tagRequest{Name: "long run"}, &errorResponse)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, "name", errorResponse.Error.Details[0].Field)
+
+	// Tags are attached on create and replaced on update
+	var running map[string]int64
+	client.do(http.MethodPost, "/activities", activityRequest{Name: "Running"}, &running)
+	start := time.Date(2023, 12, 20, 7, 0, 0, 0, time.UTC)
+	status = client.do(http.MethodPost, "/user-activities", userActivityRequest{
+		ActivityID: running["activity_id"], StartTime: start, DurationSeconds: int64Ptr(3600), Mood: 4, TagIDs: []int64{raceID, morningID},
+	}, &created)
+	assert.Equal(t, http.StatusOK, status)
+	raceRunPath := fmt.Sprintf("/user-activities/%d", created["user_activity_id"])
+	status = client.do(http.MethodPost, "/user-activities", userActivityRequest{
+		ActivityID: running["activity_id"], StartTime: start.AddDate(0, 0, 1), DurationSeconds: int64Ptr(1800), Mood: 3, TagIDs: []int64{raceID},
+	}, &created)
+	assert.Equal(t, http.StatusOK, status)
+	morningRunPath := fmt.Sprintf("/user-activities/%d", created["user_activity_id"])
+	status = client.do(http.MethodPut, morningRunPath, userActivityRequest{
+		ActivityID: running["activity_id"], StartTime: start.AddDate(0, 0, 1), DurationSeconds: int64Ptr(1800), Mood: 3, TagIDs: []int64{morningID},
+	}, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+
+	var userActivity userActivityResponse
+	client.do(http.MethodGet, raceRunPath, nil, &userActivity)
+	assert.Equal(t, []int64{min(raceID, morningID), max(raceID, morningID)}, userActivity.TagIDs)
+	client.do(http.MethodGet, morningRunPath, nil, &userActivity)
+	assert.Equal(t, []int64{morningID}, userActivity.TagIDs)
+
+	listPath := fmt.Sprintf("/users/%d/activities", userID)
+	var page userActivityPage
+	client.do(http.MethodGet, fmt.Sprintf("%s?tag_id=%d&tag_id=%d", listPath, raceID, morningID), nil, &page)
+	assert.Len(t, page.Items, 2)
+	client.do(http.MethodGet, fmt.Sprintf("%s?tag_id=%d&tag_id=%d&tag_match=all", listPath, raceID, morningID), nil, &page)
+	assert.Len(t, page.Items, 1)
+	for _, query := range []string{"tag_id=race", "tag_id=0", "tag_match=some"} {
+		status = client.do(http.MethodGet, listPath+"?"+query, nil, nil)
+		assert.Equal(t, http.StatusBadRequest, status, query)
+	}
+
+	// Grouped by tag, the race run counts towards both tags but once in the totals
+	var stats statsResponse
+	status = client.do(http.MethodGet, fmt.Sprintf("/users/%d/stats?period=month&by=tag", userID), nil, &stats)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, int64(2), stats.Totals.Count)
+	if assert.Len(t, stats.Buckets, 2) {
+		counts := map[int64]int64{}
+		for _, bucket := range stats.Buckets {
+			counts[*bucket.TagID] = bucket.Count
+			assert.Nil(t, bucket.ActivityID)
+		}
+		assert.Equal(t, map[int64]int64{raceID: 1, morningID: 2}, counts)
+	}
+
+	// Only the user's own tags can be attached
+	var otherTag map[string]int64
+	other.do(http.MethodPost, fmt.Sprintf("/users/%d/tags", otherID), tagRequest{Name: "race"}, &otherTag)
+	status = client.doError(http.MethodPost, "/user-activities", userActivityRequest{
+		ActivityID: running["activity_id"], StartTime: start.AddDate(0, 0, 2), DurationSeconds: int64Ptr(600), Mood: 3, TagIDs: []int64{otherTag["tag_id"]},
+	}, &errorResponse)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, []apierror.FieldError{{Field: "tag_ids", Message: "must only refer to your tags"}}, errorResponse.Error.Details)
+	status = other.do(http.MethodGet, tagPath, nil, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+	status = other.do(http.MethodGet, fmt.Sprintf("/users/%d/tags/%d", otherID, raceID), nil, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status = client.do(http.MethodPut, tagPath, tagRequest{Name: "races"}, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	status = client.do(http.MethodDelete, tagPath, nil, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	status = client.do(http.MethodGet, tagPath, nil, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+	client.do(http.MethodGet, raceRunPath, nil, &userActivity)
+	assert.Equal(t, []int64{morningID}, userActivity.TagIDs)
+}
+
+func TestCategoryEndpoints(t *testing.T) {
+	server := newTestServer(t)
+	client, userID := server.signUp(t, "amber")
+	other, _ := server.signUp(t, "basil")
+	if err := server.repo.SetUserAdmin(userID, true); err != nil {
+		t.Fatalf("Failed to grant admin rights: %v", err)
+	}
+
+	// Only admins may manage the shared tree
+	var created map[string]int64
+	status := other.do(http.MethodPost, "/categories", categoryRequest{Name: "Cardio"}, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+	status = client.do(http.MethodPost, "/categories", categoryRequest{Name: "Cardio"}, &created)
+	assert.Equal(t, http.StatusOK, status)
+	cardioID := created["category_id"]
+	cardioPath := fmt.Sprintf("/categories/%d", cardioID)
+	assert.Equal(t, http.StatusForbidden, other.do(http.MethodPut, cardioPath, categoryRequest{Name: "Endurance"}, nil))
+	assert.Equal(t, http.StatusForbidden, other.do(http.MethodDelete, cardioPath, nil, nil))
+	assert.Equal(t, http.StatusOK, other.do(http.MethodGet, cardioPath, nil, nil))
+	client.do(http.MethodPost, "/categories", categoryRequest{Name: "Running", ParentID: &cardioID}, &created)
+	runningID := created["category_id"]
+	client.do(http.MethodPost, "/categories", categoryRequest{Name: "Trail running", ParentID: &runningID}, &created)
+	trailID := created["category_id"]
+	client.do(http.MethodPost, "/categories", categoryRequest{Name: "Strength"}, &created)
+	strengthID := created["category_id"]
+
+	status = client.do(http.MethodPost, "/categories", categoryRequest{Name: "cardio"}, nil)
+	assert.Equal(t, http.StatusConflict, status)
+	missingID := int64(999)
+	status = client.do(http.MethodPost, "/categories", categoryRequest{Name: "Swimming", ParentID: &missingID}, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+	var errorResponse apierror.Response
+	status = client.doError(http.MethodPost, "/categories", categoryRequest{Name: " ", ParentID: int64Ptr(0)}, &errorResponse)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, []apierror.FieldError{
+		{Field: "name", Message: "must not be blank"},
+		{Field: "parent_id", Message: "must be a positive integer"},
+	}, errorResponse.Error.Details)
+
+	var tree []categoryTreeResponse
+	status = client.do(http.MethodGet, "/categories/tree", nil, &tree)
+	assert.Equal(t, http.StatusOK, status)
+	if assert.Len(t, tree, 2) {
+		assert.Equal(t, "Cardio", tree[0].Name)
+		if assert.Len(t, tree[0].Children, 1) && assert.Len(t, tree[0].Children[0].Children, 1) {
+			assert.Equal(t, trailID, tree[0].Children[0].Children[0].ID)
+			assert.Empty(t, tree[0].Children[0].Children[0].Children)
+		}
+		assert.Equal(t, strengthID, tree[1].ID)
+	}
+	var subtree categoryTreeResponse
+	status = client.do(http.MethodGet, fmt.Sprintf("/categories/%d/tree", runningID), nil, &subtree)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, cardioID, *subtree.ParentID)
+	if assert.Len(t, subtree.Children, 1) {
+		assert.Equal(t, "Trail running", subtree.Children[0].Name)
+	}
+
+	// Moving a category under its own descendant is refused
+	status = client.do(http.MethodPut, fmt.Sprintf("/categories/%d", cardioID), categoryRequest{Name: "Cardio", ParentID: &trailID}, nil)
+	assert.Equal(t, http.StatusConflict, status)
+
+	// Stats roll up to the top-level categories, or to the children of category_id
+	record := func(name string, categoryID int64, day, minutes int) int64 {
+		t.Helper()
+		var activity map[string]int64
+		client.do(http.MethodPost, "/activities", activityRequest{Name: name, CategoryID: &categoryID}, &activity)
+		status := client.do(http.MethodPost, "/user-activities", userActivityRequest{
+			ActivityID: activity["activity_id"], StartTime: time.Date(2023, 12, day, 7, 0, 0, 0, time.UTC), DurationSeconds: int64Ptr(int64(minutes * 60)), Mood: 3,
+		}, nil)
+		assert.Equal(t, http.StatusOK, status)
+		return activity["activity_id"]
+	}
+	record("Road run", runningID, 10, 30)
+	trailRunID := record("Trail run", trailID, 11, 60)
+	record("Deadlifts", strengthID, 12, 45)
+	var activity activityResponse
+	status = client.do(http.MethodGet, fmt.Sprintf("/activities/%d", trailRunID), nil, &activity)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, trailID, *activity.CategoryID)
+	status = client.do(http.MethodPost, "/activities", activityRequest{Name: "Swim", CategoryID: &missingID}, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status = other.do(http.MethodPost, "/activities", activityRequest{Name: "Hill repeats", CategoryID: &runningID}, nil)
+	assert.Equal(t, http.StatusOK, status, "private activities may be filed under any category")
+
+	statsPath := fmt.Sprintf("/users/%d/stats?period=month", userID)
+	var stats statsResponse
+	status = client.do(http.MethodGet, statsPath+"&by=category", nil, &stats)
+	assert.Equal(t, http.StatusOK, status)
+	if assert.Len(t, stats.Buckets, 2) {
+		assert.Equal(t, cardioID, *stats.Buckets[0].CategoryID)
+		assert.Equal(t, int64(90*60), stats.Buckets[0].TotalDurationSeconds)
+		assert.Equal(t, strengthID, *stats.Buckets[1].CategoryID)
+	}
+	status = client.do(http.MethodGet, fmt.Sprintf("%s&by=category&category_id=%d", statsPath, runningID), nil, &stats)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, int64(2), stats.Totals.Count)
+	if assert.Len(t, stats.Buckets, 2) {
+		assert.Equal(t, runningID, *stats.Buckets[0].CategoryID)
+		assert.Equal(t, trailID, *stats.Buckets[1].CategoryID)
+	}
+	status = client.do(http.MethodGet, statsPath+"&category_id=soon", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// Categories with subcategories or activities cannot be deleted
+	status = client.do(http.MethodDelete, fmt.Sprintf("/categories/%d", runningID), nil, nil)
+	assert.Equal(t, http.StatusConflict, status)
+	status = client.do(http.MethodPut, fmt.Sprintf("/categories/%d", strengthID), categoryRequest{Name: "Weights"}, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	var category categoryResponse
+	client.do(http.MethodGet, fmt.Sprintf("/categories/%d", strengthID), nil, &category)
+	assert.Equal(t, "Weights", category.Name)
+	status = client.do(http.MethodPost, "/categories", categoryRequest{Name: "Olympic lifts", ParentID: &strengthID}, &created)
+	assert.Equal(t, http.StatusOK, status)
+	status = client.do(http.MethodDelete, fmt.Sprintf("/categories/%d", created["category_id"]), nil, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	status = client.do(http.MethodGet, fmt.Sprintf("/categories/%d", created["category_id"]), nil, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestActivityScopeEndpoints(t *testing.T) {
+	server := newTestServer(t)
+	admin, adminID := server.signUp(t, "bella")
+	client, userID := server.signUp(t, "carl")
+	other, _ := server.signUp(t, "dora")
+	if err := server.repo.SetUserAdmin(adminID, true); err != nil {
+		t.Fatalf("Failed to grant admin rights: %v", err)
+	}
+
+	// Only admins may manage the global catalog
+	var created map[string]int64
+	status := client.do(http.MethodPost, "/activities", activityRequest{Name: "Running", Scope: "global"}, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+	status = admin.do(http.MethodPost, "/activities", activityRequest{Name: "Running", Scope: "global"}, &created)
+	assert.Equal(t, http.StatusOK, status)
+	globalPath := fmt.Sprintf("/activities/%d", created["activity_id"])
+	status = client.do(http.MethodPut, globalPath, activityRequest{Name: "Jogging"}, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+	status = client.do(http.MethodDelete, globalPath, nil, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+	status = admin.do(http.MethodPut, globalPath, activityRequest{Name: "Running"}, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+
+	// Activities are private by default and invisible to other users
+	status = client.do(http.MethodPost, "/activities", activityRequest{Name: "Rehab drills"}, &created)
+	assert.Equal(t, http.StatusOK, status)
+	privateID := created["activity_id"]
+	privatePath := fmt.Sprintf("/activities/%d", privateID)
+	var activity activityResponse
+	client.do(http.MethodGet, privatePath, nil, &activity)
+	assert.Equal(t, "private", activity.Scope)
+	status = other.do(http.MethodGet, privatePath, nil, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+	status = other.do(http.MethodPut, privatePath, activityRequest{Name: "Mine now"}, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+	status = admin.do(http.MethodDelete, privatePath, nil, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	var errorResponse apierror.Response
+	status = client.doError(http.MethodPut, privatePath, activityRequest{Name: "Rehab drills", Scope: "global"}, &errorResponse)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, []apierror.FieldError{{Field: "scope", Message: "cannot be changed"}}, errorResponse.Error.Details)
+	status = client.doError(http.MethodPost, "/activities", activityRequest{Name: "Yoga", Scope: "team"}, &errorResponse)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, "scope", errorResponse.Error.Details[0].Field)
+
+	var page activityPage
+	client.do(http.MethodGet, "/activities", nil, &page)
+	assert.Len(t, page.Items, 2)
+	client.do(http.MethodGet, "/activities?scope=private", nil, &page)
+	if assert.Len(t, page.Items, 1) {
+		assert.Equal(t, privateID, page.Items[0].ID)
+	}
+	other.do(http.MethodGet, "/activities", nil, &page)
+	if assert.Len(t, page.Items, 1) {
+		assert.Equal(t, "global", page.Items[0].Scope)
+	}
+	status = client.do(http.MethodGet, "/activities?scope=team", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// Nobody else can record a private activity
+	run := userActivityRequest{ActivityID: privateID, StartTime: time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC), DurationSeconds: int64Ptr(600), Mood: 3}
+	status = other.doError(http.MethodPost, "/user-activities", run, &errorResponse)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, "activity_id", errorResponse.Error.Details[0].Field)
+	status = client.do(http.MethodPost, "/user-activities", run, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	// Admins grant admin rights
+	status = client.do(http.MethodPut, fmt.Sprintf("/users/%d/admin", userID), adminRequest{IsAdmin: true}, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+	status = admin.do(http.MethodPut, fmt.Sprintf("/users/%d/admin", userID), adminRequest{IsAdmin: true}, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	var user userResponse
+	client.do(http.MethodGet, fmt.Sprintf("/users/%d", userID), nil, &user)
+	assert.True(t, user.IsAdmin)
+
+	// and revoke them, as long as another admin is left
+	status = client.do(http.MethodPut, fmt.Sprintf("/users/%d/admin", adminID), adminRequest{IsAdmin: false}, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	status = client.doError(http.MethodPut, fmt.Sprintf("/users/%d/admin", userID), adminRequest{IsAdmin: false}, &errorResponse)
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Equal(t, apierror.CodeConflict, errorResponse.Error.Code)
+	client.do(http.MethodGet, fmt.Sprintf("/users/%d", userID), nil, &user)
+	assert.True(t, user.IsAdmin)
+}
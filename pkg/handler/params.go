@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"activity-tracker/pkg/model"
+	repository "activity-tracker/pkg/respository"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// queryInt parses an optional integer query parameter. It returns nil if the
+// parameter is absent.
+func queryInt(r *http.Request, name string) (*int, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: must be an integer", name)
+	}
+	return &value, nil
+}
+
+// queryInt64 parses an optional 64-bit integer query parameter, returning 0
+// if it is absent.
+func queryInt64(r *http.Request, name string) (int64, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: must be an integer", name)
+	}
+	return value, nil
+}
+
+// queryTime parses an optional RFC 3339 timestamp query parameter. It returns
+// nil if the parameter is absent.
+func queryTime(r *http.Request, name string) (*time.Time, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: must be an RFC 3339 timestamp", name)
+	}
+	return &value, nil
+}
+
+// queryRange parses the optional "from" and "to" query parameters of a range
+// of statistics. to defaults to now and from to defaultStatsRange before to,
+// and the range may be at most maxStatsRange long.
+func queryRange(r *http.Request, now time.Time) (from, to time.Time, err error) {
+	toParam, err := queryTime(r, "to")
+	if err != nil {
+		return from, to, err
+	}
+	to = now
+	if toParam != nil {
+		to = *toParam
+	}
+	fromParam, err := queryTime(r, "from")
+	if err != nil {
+		return from, to, err
+	}
+	from = to.Add(-defaultStatsRange)
+	if fromParam != nil {
+		from = *fromParam
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("invalid from: must be before to")
+	}
+	if to.Sub(from) > maxStatsRange {
+		return from, to, fmt.Errorf("invalid from: must be at most %d days before to", maxStatsRange/(24*time.Hour))
+	}
+	return from, to, nil
+}
+
+// queryTimeZone parses the optional "tz" query parameter, an IANA time zone
+// name. It returns nil if the parameter is absent.
+func queryTimeZone(r *http.Request) (*time.Location, error) {
+	raw := r.URL.Query().Get("tz")
+	if raw == "" {
+		return nil, nil
+	}
+	location, err := model.LoadTimeZone(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tz: must be an IANA time zone such as Europe/Berlin")
+	}
+	return location, nil
+}
+
+// queryOrder parses the optional "order" query parameter, which is either
+// "asc" or "desc", and reports whether the order is descending.
+func queryOrder(r *http.Request, defaultDescending bool) (bool, error) {
+	switch r.URL.Query().Get("order") {
+	case "":
+		return defaultDescending, nil
+	case "asc":
+		return false, nil
+	case "desc":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid order: must be asc or desc")
+	}
+}
+
+// queryLimit parses the optional "limit" page size query parameter, returning
+// the default page size if it is absent.
+func queryLimit(r *http.Request) (int, error) {
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		return 0, err
+	}
+	if limit == nil {
+		return repository.DefaultListLimit, nil
+	}
+	if *limit < 1 || *limit > repository.MaxListLimit {
+		return 0, fmt.Errorf("invalid limit: must be between 1 and %d", repository.MaxListLimit)
+	}
+	return *limit, nil
+}
+
+// attributeParamPrefix starts the names of query parameters that filter by
+// additional attributes.
+const attributeParamPrefix = "attr."
+
+// queryAttributeFilters parses the attribute filters in the query string.
+// attr.<name>=<value> selects activities whose attribute equals the value and
+// may be repeated to accept any of several values; attr.<name>.min and
+// attr.<name>.max give an inclusive numeric range and attr.<name>.exists=true
+// or false selects activities with or without the attribute.
+func queryAttributeFilters(r *http.Request) ([]repository.AttributeFilter, error) {
+	byName := make(map[string]*repository.AttributeFilter)
+	for key, values := range r.URL.Query() {
+		if !strings.HasPrefix(key, attributeParamPrefix) {
+			continue
+		}
+		name, condition, _ := strings.Cut(strings.TrimPrefix(key, attributeParamPrefix), ".")
+		if !model.ValidAttributeName(name) {
+			return nil, fmt.Errorf("invalid %s: attribute names may only contain letters, digits and underscores", key)
+		}
+		filter, ok := byName[name]
+		if !ok {
+			filter = &repository.AttributeFilter{Name: name}
+			byName[name] = filter
+		}
+
+		switch condition {
+		case "":
+			for _, value := range values {
+				filter.Equals = append(filter.Equals, attributeValues(value)...)
+			}
+		case "min", "max":
+			limit, err := strconv.ParseFloat(values[0], 64)
+			if err != nil || math.IsNaN(limit) || math.IsInf(limit, 0) {
+				return nil, fmt.Errorf("invalid %s: must be a number", key)
+			}
+			if condition == "min" {
+				filter.Min = &limit
+			} else {
+				filter.Max = &limit
+			}
+		case "exists":
+			exists, err := strconv.ParseBool(values[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: must be true or false", key)
+			}
+			filter.Exists = &exists
+		default:
+			return nil, fmt.Errorf("invalid %s: attribute filters are attr.<name>, attr.<name>.min, attr.<name>.max and attr.<name>.exists", key)
+		}
+	}
+
+	filters := make([]repository.AttributeFilter, 0, len(byName))
+	for _, filter := range byName {
+		filters = append(filters, *filter)
+	}
+	sort.Slice(filters, func(i, j int) bool { return filters[i].Name < filters[j].Name })
+	return filters, nil
+}
+
+// attributeValues returns the attribute values that a query string value can
+// stand for. It always stands for the string itself, and also for a number or
+// boolean if it can be read as one, since the query string carries no types.
+func attributeValues(raw string) []interface{} {
+	values := []interface{}{raw}
+	if number, err := strconv.ParseFloat(raw, 64); err == nil && !math.IsNaN(number) && !math.IsInf(number, 0) {
+		values = append(values, number)
+	}
+	if raw == "true" || raw == "false" {
+		values = append(values, raw == "true")
+	}
+	return values
+}
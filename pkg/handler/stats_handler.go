@@ -0,0 +1,277 @@
+package handler
+
+import (
+	repository "activity-tracker/pkg/respository"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// Ranges of statistics. defaultStatsRange is how far back statistics go when
+// no range is given, and maxStatsRange bounds how many activities a request
+// can make the store go through.
+const (
+	defaultStatsRange = 30 * 24 * time.Hour
+	maxStatsRange     = 366 * 24 * time.Hour
+)
+
+// StatsHandler handles HTTP requests for statistics computed from a user's
+// activities.
+type StatsHandler struct {
+	statsRepo repository.StatsStore
+	userRepo  repository.UserStore
+	now       func() time.Time
+}
+
+// NewStatsHandler creates a new StatsHandler instance.
+func NewStatsHandler(statsRepo repository.StatsStore, userRepo repository.UserStore) *StatsHandler {
+	return &StatsHandler{statsRepo: statsRepo, userRepo: userRepo, now: time.Now}
+}
+
+// RegisterRoutes registers the statistics routes. Users may only see their
+// own statistics.
+func (h *StatsHandler) RegisterRoutes(router chi.Router) {
+	router.Get("/users/{userID}/stats", h.GetUserStats)
+	router.Get("/users/{userID}/streaks", h.GetUserStreaks)
+	router.Get("/users/{userID}/mood", h.GetUserMood)
+}
+
+// GetUserStats handles computing the count, total and average duration and
+// average mood of a user's activities, grouped by period and optionally by
+// activity, tag or category. Categories roll up to the children of
+// category_id, or to the top-level categories without it.
+func (h *StatsHandler) GetUserStats(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid user ID")
+		return
+	}
+	if !authorizeUser(w, r, userID) {
+		return
+	}
+
+	filter, err := h.parseStatsFilter(r)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	filter.UserID = userID
+	var ok bool
+	if filter.Location, ok = requestLocation(w, r, h.userRepo, userID); !ok {
+		return
+	}
+
+	buckets, err := h.statsRepo.UserActivityStats(filter)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to compute stats")
+		return
+	}
+	totals := repository.SumStats(buckets)
+	if filter.ByTag {
+		// An activity with several tags is in several buckets, so the totals
+		// are computed over the activities themselves.
+		totalsFilter := filter
+		totalsFilter.ByTag = false
+		all, err := h.statsRepo.UserActivityStats(totalsFilter)
+		if err != nil {
+			writeRepositoryError(w, err, "Failed to compute stats")
+			return
+		}
+		totals = repository.SumStats(all)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newStatsResponse(filter, buckets, totals))
+}
+
+// GetUserStreaks handles computing the current and longest streaks of a
+// user, of any activity and of each activity.
+func (h *StatsHandler) GetUserStreaks(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid user ID")
+		return
+	}
+	if !authorizeUser(w, r, userID) {
+		return
+	}
+
+	filter, err := parseStreakFilter(r)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	filter.UserID = userID
+	var ok bool
+	if filter.Location, ok = requestLocation(w, r, h.userRepo, userID); !ok {
+		return
+	}
+
+	streaks, err := h.statsRepo.UserStreaks(filter)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to compute streaks")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newStreaksResponse(filter, repository.SummarizeStreaks(filter, streaks, h.now())))
+}
+
+// GetUserMood handles analyzing the moods of a user's activities: their
+// trend by period, their distribution per activity, the mood on days with
+// and without each activity, and the mood by duration.
+func (h *StatsHandler) GetUserMood(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid user ID")
+		return
+	}
+	if !authorizeUser(w, r, userID) {
+		return
+	}
+
+	filter := repository.MoodFilter{UserID: userID}
+	if filter.From, filter.To, filter.Period, err = h.parseStatsRange(r); err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	var ok bool
+	if filter.Location, ok = requestLocation(w, r, h.userRepo, userID); !ok {
+		return
+	}
+
+	stats, err := h.statsRepo.UserMoodStats(filter)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to compute mood stats")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newMoodResponse(filter, stats))
+}
+
+// requestLocation returns the time zone that periods are computed in: the one
+// given as the tz query parameter, or else the user's. It writes an error
+// response and reports false if there is none.
+func requestLocation(w http.ResponseWriter, r *http.Request, userRepo repository.UserStore, userID int64) (*time.Location, bool) {
+	location, err := queryTimeZone(r)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return nil, false
+	}
+	if location != nil {
+		return location, true
+	}
+
+	user, err := userRepo.GetUser(userID)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to retrieve user")
+		return nil, false
+	}
+	if location, err = user.Location(); err != nil {
+		writeInternalError(w, err, "Failed to load the user's time zone")
+		return nil, false
+	}
+	return location, true
+}
+
+// parseStatsFilter reads the statistics parameters from the query string:
+// the range and period read by parseStatsRange, category_id and by, which may
+// be activity, tag or category.
+func (h *StatsHandler) parseStatsFilter(r *http.Request) (repository.StatsFilter, error) {
+	var filter repository.StatsFilter
+	var err error
+	if filter.From, filter.To, filter.Period, err = h.parseStatsRange(r); err != nil {
+		return filter, err
+	}
+	categoryID, err := queryInt64(r, "category_id")
+	if err != nil {
+		return filter, err
+	}
+	if categoryID != 0 {
+		filter.CategoryID = &categoryID
+	}
+
+	switch r.URL.Query().Get("by") {
+	case "":
+	case "activity":
+		filter.ByActivity = true
+	case "tag":
+		filter.ByTag = true
+	case "category":
+		filter.ByCategory = true
+	default:
+		return filter, fmt.Errorf("invalid by: must be activity, tag or category")
+	}
+	return filter, nil
+}
+
+// parseStatsRange reads the range and grouping of statistics from the query
+// string: the range read by queryRange and period (day, week or month,
+// defaulting to day).
+func (h *StatsHandler) parseStatsRange(r *http.Request) (from, to time.Time, period repository.StatsPeriod, err error) {
+	if from, to, err = queryRange(r, h.now()); err != nil {
+		return from, to, period, err
+	}
+
+	switch period = repository.StatsPeriod(r.URL.Query().Get("period")); period {
+	case "":
+		period = repository.PeriodDay
+	case repository.PeriodDay, repository.PeriodWeek, repository.PeriodMonth:
+	default:
+		return from, to, period, fmt.Errorf("invalid period: must be day, week or month")
+	}
+	return from, to, period, nil
+}
+
+// maxStreakTolerance is the most periods in a row that a streak may skip.
+const maxStreakTolerance = 30
+
+// parseStreakFilter reads the streak rules from the query string: cadence
+// (daily or weekly, defaulting to daily), times, the number of days a week
+// needs activities on with the weekly cadence (defaulting to 1), and
+// tolerance, the number of days or weeks in a row that may be missed
+// (defaulting to 0).
+func parseStreakFilter(r *http.Request) (repository.StreakFilter, error) {
+	filter := repository.StreakFilter{Cadence: repository.CadenceDaily}
+
+	switch cadence := repository.StreakCadence(r.URL.Query().Get("cadence")); cadence {
+	case "":
+	case repository.CadenceDaily, repository.CadenceWeekly:
+		filter.Cadence = cadence
+	default:
+		return filter, fmt.Errorf("invalid cadence: must be daily or weekly")
+	}
+
+	times, err := queryInt(r, "times")
+	if err != nil {
+		return filter, err
+	}
+	if times != nil {
+		if filter.Cadence != repository.CadenceWeekly {
+			return filter, fmt.Errorf("invalid times: only applies to the weekly cadence")
+		}
+		if *times < 1 || *times > 7 {
+			return filter, fmt.Errorf("invalid times: must be between 1 and 7")
+		}
+		filter.TimesPerWeek = *times
+	} else if filter.Cadence == repository.CadenceWeekly {
+		filter.TimesPerWeek = 1
+	}
+
+	tolerance, err := queryInt(r, "tolerance")
+	if err != nil {
+		return filter, err
+	}
+	if tolerance != nil {
+		if *tolerance < 0 || *tolerance > maxStreakTolerance {
+			return filter, fmt.Errorf("invalid tolerance: must be between 0 and %d", maxStreakTolerance)
+		}
+		filter.Tolerance = *tolerance
+	}
+	return filter, nil
+}
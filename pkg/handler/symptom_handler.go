@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"activity-tracker/pkg/model"
+	repository "activity-tracker/pkg/respository"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// SymptomHandler handles HTTP requests related to the symptom journal, and
+// the analysis of which activities symptoms follow.
+type SymptomHandler struct {
+	symptomRepo      repository.SymptomStore
+	userActivityRepo repository.UserActivityStore
+	now              func() time.Time
+}
+
+// NewSymptomHandler creates a new SymptomHandler instance. The user activity
+// store is used to check that linked user activities are the user's own.
+func NewSymptomHandler(symptomRepo repository.SymptomStore, userActivityRepo repository.UserActivityStore) *SymptomHandler {
+	return &SymptomHandler{symptomRepo: symptomRepo, userActivityRepo: userActivityRepo, now: time.Now}
+}
+
+// RegisterRoutes registers the symptom routes. Users may only access their
+// own symptoms.
+func (h *SymptomHandler) RegisterRoutes(router chi.Router) {
+	router.Post("/users/{userID}/symptoms", h.CreateSymptom)
+	router.Get("/users/{userID}/symptoms", h.ListSymptoms)
+	router.Get("/users/{userID}/symptoms/analysis", h.AnalyzeSymptoms)
+	router.Get("/users/{userID}/symptoms/{symptomID}", h.GetSymptom)
+	router.Put("/users/{userID}/symptoms/{symptomID}", h.UpdateSymptom)
+	router.Delete("/users/{userID}/symptoms/{symptomID}", h.DeleteSymptom)
+}
+
+// CreateSymptom handles recording a new symptom.
+func (h *SymptomHandler) CreateSymptom(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid user ID")
+		return
+	}
+	if !authorizeUser(w, r, userID) {
+		return
+	}
+
+	request, ok := h.decodeSymptomRequest(w, r, userID)
+	if !ok {
+		return
+	}
+	symptom := request.toModel(0, userID)
+
+	symptomID, err := h.symptomRepo.CreateSymptom(&symptom)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to create symptom")
+		return
+	}
+
+	response := map[string]int64{"symptom_id": symptomID}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListSymptoms handles listing a user's symptoms in the order they occurred,
+// optionally only those of body_area, linked to user_activity_id, or that
+// occurred from from up to, but excluding, to.
+func (h *SymptomHandler) ListSymptoms(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid user ID")
+		return
+	}
+	if !authorizeUser(w, r, userID) {
+		return
+	}
+
+	filter := repository.SymptomFilter{UserID: userID, BodyArea: normalizeBodyArea(r.URL.Query().Get("body_area"))}
+	if filter.OccurredFrom, err = queryTime(r, "from"); err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	if filter.OccurredTo, err = queryTime(r, "to"); err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	if filter.UserActivityID, err = queryInt64(r, "user_activity_id"); err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	symptoms, err := h.symptomRepo.ListSymptoms(filter)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to list symptoms")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newSymptomResponses(symptoms))
+}
+
+// GetSymptom handles retrieving a symptom by ID.
+func (h *SymptomHandler) GetSymptom(w http.ResponseWriter, r *http.Request) {
+	symptom, ok := h.loadSymptom(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newSymptomResponse(symptom))
+}
+
+// UpdateSymptom handles updating a symptom by ID.
+func (h *SymptomHandler) UpdateSymptom(w http.ResponseWriter, r *http.Request) {
+	symptom, ok := h.loadSymptom(w, r)
+	if !ok {
+		return
+	}
+
+	request, ok := h.decodeSymptomRequest(w, r, symptom.UserID)
+	if !ok {
+		return
+	}
+	updated := request.toModel(symptom.ID, symptom.UserID)
+
+	if err := h.symptomRepo.UpdateSymptom(&updated); err != nil {
+		writeRepositoryError(w, err, "Failed to update symptom")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteSymptom handles deleting a symptom by ID.
+func (h *SymptomHandler) DeleteSymptom(w http.ResponseWriter, r *http.Request) {
+	symptom, ok := h.loadSymptom(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.symptomRepo.DeleteSymptom(symptom.UserID, symptom.ID); err != nil {
+		writeRepositoryError(w, err, "Failed to delete symptom")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AnalyzeSymptoms handles attributing a user's symptoms to the activities
+// that started from from up to, but excluding, to (defaulting to the last 30
+// days), when they occurred 24 to 72 hours after the activity ended. It can
+// be narrowed down to the symptoms of body_area.
+func (h *SymptomHandler) AnalyzeSymptoms(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid user ID")
+		return
+	}
+	if !authorizeUser(w, r, userID) {
+		return
+	}
+
+	filter, err := h.parseSymptomAnalysisFilter(r)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	filter.UserID = userID
+
+	analysis, err := h.symptomRepo.AnalyzeSymptoms(filter)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to analyze symptoms")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newSymptomAnalysisResponse(filter, analysis))
+}
+
+// parseSymptomAnalysisFilter reads the range of activities and the body area
+// to analyze from the query string.
+func (h *SymptomHandler) parseSymptomAnalysisFilter(r *http.Request) (repository.SymptomAnalysisFilter, error) {
+	filter := repository.SymptomAnalysisFilter{
+		BodyArea:    normalizeBodyArea(r.URL.Query().Get("body_area")),
+		WindowStart: repository.DefaultSymptomWindowStart,
+		WindowEnd:   repository.DefaultSymptomWindowEnd,
+	}
+
+	var err error
+	filter.From, filter.To, err = queryRange(r, h.now())
+	return filter, err
+}
+
+// decodeSymptomRequest reads and validates the symptom of userID in the
+// request body, writing an error response if it is not valid.
+func (h *SymptomHandler) decodeSymptomRequest(w http.ResponseWriter, r *http.Request, userID int64) (symptomRequest, bool) {
+	var request symptomRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeBadRequest(w, "Invalid request body")
+		return request, false
+	}
+	var userActivity *model.UserActivity
+	if request.UserActivityID != nil && *request.UserActivityID > 0 {
+		var err error
+		userActivity, err = h.userActivityRepo.GetUserActivity(userID, *request.UserActivityID)
+		if err != nil && !errors.Is(err, repository.ErrUserActivityNotFound) {
+			writeInternalError(w, err, "Failed to validate symptom")
+			return request, false
+		}
+	}
+	if err := request.validate(userActivity); err != nil {
+		writeValidationError(w, err)
+		return request, false
+	}
+	return request, true
+}
+
+// loadSymptom parses the user and symptom IDs in the path and retrieves the
+// symptom, writing an error response if it cannot.
+func (h *SymptomHandler) loadSymptom(w http.ResponseWriter, r *http.Request) (*model.Symptom, bool) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid user ID")
+		return nil, false
+	}
+	if !authorizeUser(w, r, userID) {
+		return nil, false
+	}
+	symptomID, err := strconv.ParseInt(chi.URLParam(r, "symptomID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid symptom ID")
+		return nil, false
+	}
+
+	symptom, err := h.symptomRepo.GetSymptom(userID, symptomID)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to retrieve symptom")
+		return nil, false
+	}
+	return symptom, true
+}
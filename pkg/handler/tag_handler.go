@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"activity-tracker/pkg/model"
+	repository "activity-tracker/pkg/respository"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+// TagHandler handles HTTP requests related to the tags users attach to their
+// activities.
+type TagHandler struct {
+	tagRepo repository.TagStore
+}
+
+// NewTagHandler creates a new TagHandler instance.
+func NewTagHandler(tagRepo repository.TagStore) *TagHandler {
+	return &TagHandler{tagRepo: tagRepo}
+}
+
+// RegisterRoutes registers the tag routes. Users may only access their own
+// tags.
+func (h *TagHandler) RegisterRoutes(router chi.Router) {
+	router.Post("/users/{userID}/tags", h.CreateTag)
+	router.Get("/users/{userID}/tags", h.ListTags)
+	router.Get("/users/{userID}/tags/{tagID}", h.GetTag)
+	router.Put("/users/{userID}/tags/{tagID}", h.UpdateTag)
+	router.Delete("/users/{userID}/tags/{tagID}", h.DeleteTag)
+}
+
+// CreateTag handles creating a new tag.
+func (h *TagHandler) CreateTag(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid user ID")
+		return
+	}
+	if !authorizeUser(w, r, userID) {
+		return
+	}
+
+	request, ok := decodeTagRequest(w, r)
+	if !ok {
+		return
+	}
+	tag := request.toModel(0, userID)
+
+	tagID, err := h.tagRepo.CreateTag(&tag)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to create tag")
+		return
+	}
+
+	response := map[string]int64{"tag_id": tagID}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListTags handles listing a user's tags ordered by name.
+func (h *TagHandler) ListTags(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid user ID")
+		return
+	}
+	if !authorizeUser(w, r, userID) {
+		return
+	}
+
+	tags, err := h.tagRepo.ListTags(userID)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to list tags")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newTagResponses(tags))
+}
+
+// GetTag handles retrieving a tag by ID.
+func (h *TagHandler) GetTag(w http.ResponseWriter, r *http.Request) {
+	tag, ok := h.loadTag(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newTagResponse(tag))
+}
+
+// UpdateTag handles renaming a tag by ID. The user activities it is attached
+// to keep it.
+func (h *TagHandler) UpdateTag(w http.ResponseWriter, r *http.Request) {
+	tag, ok := h.loadTag(w, r)
+	if !ok {
+		return
+	}
+
+	request, ok := decodeTagRequest(w, r)
+	if !ok {
+		return
+	}
+	updated := request.toModel(tag.ID, tag.UserID)
+
+	if err := h.tagRepo.UpdateTag(&updated); err != nil {
+		writeRepositoryError(w, err, "Failed to update tag")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteTag handles deleting a tag by ID, detaching it from the user's
+// activities.
+func (h *TagHandler) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	tag, ok := h.loadTag(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.tagRepo.DeleteTag(tag.UserID, tag.ID); err != nil {
+		writeRepositoryError(w, err, "Failed to delete tag")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeTagRequest reads and validates the tag in the request body, writing an
+// error response if it is not valid.
+func decodeTagRequest(w http.ResponseWriter, r *http.Request) (tagRequest, bool) {
+	var request tagRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeBadRequest(w, "Invalid request body")
+		return request, false
+	}
+	if err := request.validate(); err != nil {
+		writeValidationError(w, err)
+		return request, false
+	}
+	return request, true
+}
+
+// loadTag parses the user and tag IDs in the path and retrieves the tag,
+// writing an error response if it cannot.
+func (h *TagHandler) loadTag(w http.ResponseWriter, r *http.Request) (*model.Tag, bool) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid user ID")
+		return nil, false
+	}
+	if !authorizeUser(w, r, userID) {
+		return nil, false
+	}
+	tagID, err := strconv.ParseInt(chi.URLParam(r, "tagID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid tag ID")
+		return nil, false
+	}
+
+	tag, err := h.tagRepo.GetTag(userID, tagID)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to retrieve tag")
+		return nil, false
+	}
+	return tag, true
+}
@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"activity-tracker/pkg/model"
+	repository "activity-tracker/pkg/respository"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// TimerHandler handles HTTP requests related to timers, which record a user
+// activity while it happens. Stopping a timer turns it into a user activity.
+type TimerHandler struct {
+	timerRepo    repository.TimerStore
+	activityRepo repository.ActivityStore
+	now          func() time.Time
+}
+
+// NewTimerHandler creates a new TimerHandler instance.
+func NewTimerHandler(timerRepo repository.TimerStore, activityRepo repository.ActivityStore) *TimerHandler {
+	return &TimerHandler{timerRepo: timerRepo, activityRepo: activityRepo, now: time.Now}
+}
+
+// RegisterRoutes registers the timer routes. Users may only access their own timers.
+func (h *TimerHandler) RegisterRoutes(router chi.Router) {
+	router.Post("/users/{userID}/timers", h.StartTimer)
+	router.Get("/users/{userID}/timers", h.ListTimers)
+	router.Get("/users/{userID}/timers/{timerID}", h.GetTimer)
+	router.Post("/users/{userID}/timers/{timerID}/pause", h.PauseTimer)
+	router.Post("/users/{userID}/timers/{timerID}/resume", h.ResumeTimer)
+	router.Post("/users/{userID}/timers/{timerID}/stop", h.StopTimer)
+	router.Delete("/users/{userID}/timers/{timerID}", h.DeleteTimer)
+}
+
+// StartTimer handles starting a new running timer for an activity.
+func (h *TimerHandler) StartTimer(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid user ID")
+		return
+	}
+	if !authorizeUser(w, r, userID) {
+		return
+	}
+
+	var request startTimerRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeBadRequest(w, "Invalid request body")
+		return
+	}
+	activity, err := findActivity(h.activityRepo, userID, request.ActivityID)
+	if err != nil {
+		writeInternalError(w, err, "Failed to validate timer")
+		return
+	}
+	if err := request.validate(activity != nil); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	timerID, err := h.timerRepo.CreateTimer(model.NewTimer(userID, request.ActivityID, h.now()))
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to start timer")
+		return
+	}
+
+	response := map[string]int64{"timer_id": timerID}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListTimers handles listing a user's running and paused timers.
+func (h *TimerHandler) ListTimers(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid user ID")
+		return
+	}
+	if !authorizeUser(w, r, userID) {
+		return
+	}
+
+	timers, err := h.timerRepo.ListTimers(userID)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to list timers")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newTimerResponses(timers, h.now()))
+}
+
+// GetTimer handles retrieving a timer by ID.
+func (h *TimerHandler) GetTimer(w http.ResponseWriter, r *http.Request) {
+	timer, ok := h.loadTimer(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newTimerResponse(timer, h.now()))
+}
+
+// PauseTimer handles pausing a running timer.
+func (h *TimerHandler) PauseTimer(w http.ResponseWriter, r *http.Request) {
+	h.changeTimer(w, r, (*model.Timer).Pause)
+}
+
+// ResumeTimer handles resuming a paused timer. It fails if the user already
+// has another timer running.
+func (h *TimerHandler) ResumeTimer(w http.ResponseWriter, r *http.Request) {
+	h.changeTimer(w, r, (*model.Timer).Resume)
+}
+
+// changeTimer applies a state change to the timer in the request and saves it.
+// The change is rejected if another request changed the timer in the meantime.
+func (h *TimerHandler) changeTimer(w http.ResponseWriter, r *http.Request, change func(*model.Timer, time.Time) error) {
+	timer, ok := h.loadTimer(w, r)
+	if !ok {
+		return
+	}
+	previous := *timer
+	if err := change(timer, h.now()); err != nil {
+		writeRepositoryError(w, err, "Failed to change timer")
+		return
+	}
+
+	if err := h.timerRepo.UpdateTimer(timer, &previous); err != nil {
+		writeRepositoryError(w, err, "Failed to change timer")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// StopTimer handles stopping a timer. Each of its runs is recorded as a new
+// user activity and the timer is removed.
+func (h *TimerHandler) StopTimer(w http.ResponseWriter, r *http.Request) {
+	timer, ok := h.loadTimer(w, r)
+	if !ok {
+		return
+	}
+
+	var request stopTimerRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeBadRequest(w, "Invalid request body")
+		return
+	}
+	// The attributes are checked against the schema the activity has now
+	activity, err := h.activityRepo.GetActivity(timer.UserID, timer.ActivityID)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to stop timer")
+		return
+	}
+	if err := request.validate(activity.AttributeSchema); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	// The timer is removed together with recording its time, so a repeated
+	// or concurrent stop is reported as not found instead of recording twice
+	userActivities := timer.Finish(h.now())
+	for i := range userActivities {
+		userActivities[i] = request.toModel(userActivities[i])
+	}
+	userActivityIDs, overlap, err := h.timerRepo.StopTimer(timer.UserID, timer.ID, userActivities)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to stop timer")
+		return
+	}
+
+	response := stopTimerResponse{UserActivityIDs: userActivityIDs, Warning: newOverlapWarning(overlap)}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DeleteTimer handles discarding a timer without recording a user activity.
+func (h *TimerHandler) DeleteTimer(w http.ResponseWriter, r *http.Request) {
+	timer, ok := h.loadTimer(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.timerRepo.DeleteTimer(timer.UserID, timer.ID); err != nil {
+		writeRepositoryError(w, err, "Failed to delete timer")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadTimer parses the user and timer IDs in the path and retrieves the timer,
+// writing an error response if it cannot.
+func (h *TimerHandler) loadTimer(w http.ResponseWriter, r *http.Request) (*model.Timer, bool) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid user ID")
+		return nil, false
+	}
+	if !authorizeUser(w, r, userID) {
+		return nil, false
+	}
+	timerID, err := strconv.ParseInt(chi.URLParam(r, "timerID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid timer ID")
+		return nil, false
+	}
+
+	timer, err := h.timerRepo.GetTimer(userID, timerID)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to retrieve timer")
+		return nil, false
+	}
+	return timer, true
+}
@@ -3,8 +3,10 @@ package handler
 import (
 	"activity-tracker/pkg/model"
 	repository "activity-tracker/pkg/respository"
+	"activity-tracker/pkg/validation"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -13,37 +15,54 @@ import (
 
 // UserActivityHandler handles HTTP requests related to user activities.
 type UserActivityHandler struct {
-	userActivityRepo *repository.Repository
+	userActivityRepo repository.UserActivityStore
+	activityRepo     repository.ActivityStore
+	tagRepo          repository.TagStore
 }
 
-// NewUserActivityHandler creates a new UserActivityHandler instance.
-func NewUserActivityHandler(userActivityRepo *repository.Repository) *UserActivityHandler {
-	return &UserActivityHandler{userActivityRepo: userActivityRepo}
+// NewUserActivityHandler creates a new UserActivityHandler instance. The
+// activity and tag stores are used to check that referenced activities exist
+// and that attached tags are the user's.
+func NewUserActivityHandler(userActivityRepo repository.UserActivityStore, activityRepo repository.ActivityStore,
+	tagRepo repository.TagStore) *UserActivityHandler {
+	return &UserActivityHandler{userActivityRepo: userActivityRepo, activityRepo: activityRepo, tagRepo: tagRepo}
 }
 
-// RegisterRoutes registers the user activity routes.
+// RegisterRoutes registers the user activity routes. Every route is scoped to
+// the authenticated user's own activities.
 func (h *UserActivityHandler) RegisterRoutes(router chi.Router) {
 	router.Post("/user-activities", h.CreateUserActivity)
 	router.Get("/user-activities/{userActivityID}", h.GetUserActivity)
 	router.Put("/user-activities/{userActivityID}", h.UpdateUserActivity)
 	router.Delete("/user-activities/{userActivityID}", h.DeleteUserActivity)
+	router.Get("/users/{userID}/activities", h.ListUserActivities)
+}
+
+// userActivityPage is one page of a user's activities.
+type userActivityPage struct {
+	Items      []userActivityResponse `json:"items"`
+	NextCursor string                 `json:"next_cursor,omitempty"`
 }
 
 // CreateUserActivity handles the creation of a new user activity.
 func (h *UserActivityHandler) CreateUserActivity(w http.ResponseWriter, r *http.Request) {
-	var userActivity model.UserActivity
-	if err := json.NewDecoder(r.Body).Decode(&userActivity); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var request userActivityRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeBadRequest(w, "Invalid request body")
 		return
 	}
+	if !h.validate(w, r, request) {
+		return
+	}
+	userActivity := request.toModel(0, authenticatedUserID(r))
 
-	userActivityID, err := h.userActivityRepo.CreateUserActivity(&userActivity)
+	userActivityID, overlap, err := h.userActivityRepo.CreateUserActivity(&userActivity)
 	if err != nil {
-		http.Error(w, "Failed to create user activity", http.StatusInternalServerError)
+		writeRepositoryError(w, err, "Failed to create user activity")
 		return
 	}
 
-	response := map[string]int64{"user_activity_id": userActivityID}
+	response := newUserActivityWriteResponse(userActivityID, overlap)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
@@ -52,58 +71,212 @@ func (h *UserActivityHandler) CreateUserActivity(w http.ResponseWriter, r *http.
 func (h *UserActivityHandler) GetUserActivity(w http.ResponseWriter, r *http.Request) {
 	userActivityID, err := strconv.ParseInt(chi.URLParam(r, "userActivityID"), 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid user activity ID", http.StatusBadRequest)
+		writeBadRequest(w, "Invalid user activity ID")
 		return
 	}
 
-	userActivity, err := h.userActivityRepo.GetUserActivity(userActivityID)
-	if errors.Is(err, repository.ErrUserActivityNotFound) {
-		http.Error(w, "User activity not found", http.StatusNotFound)
-		return
-	} else if err != nil {
-		http.Error(w, "Failed to retrieve user activity", http.StatusInternalServerError)
+	userActivity, err := h.userActivityRepo.GetUserActivity(authenticatedUserID(r), userActivityID)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to retrieve user activity")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(userActivity)
+	json.NewEncoder(w).Encode(newUserActivityResponse(userActivity))
 }
 
 // UpdateUserActivity handles updating a user activity by ID.
 func (h *UserActivityHandler) UpdateUserActivity(w http.ResponseWriter, r *http.Request) {
 	userActivityID, err := strconv.ParseInt(chi.URLParam(r, "userActivityID"), 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid user activity ID", http.StatusBadRequest)
+		writeBadRequest(w, "Invalid user activity ID")
+		return
+	}
+	// Report another user's record as not found before validating against
+	// activities that user may not see
+	existing, err := h.userActivityRepo.GetUserActivity(authenticatedUserID(r), userActivityID)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to update user activity")
 		return
 	}
 
-	var userActivity model.UserActivity
-	if err := json.NewDecoder(r.Body).Decode(&userActivity); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var request userActivityRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeBadRequest(w, "Invalid request body")
 		return
 	}
-	userActivity.ID = userActivityID
+	// The activity of a record is kept, so its attributes are validated
+	// against the schema they are stored under
+	if request.ActivityID == 0 {
+		request.ActivityID = existing.ActivityID
+	}
+	if request.ActivityID != existing.ActivityID {
+		writeValidationError(w, validation.Validate(validation.Field("activity_id", validation.That(false, "cannot be changed"))))
+		return
+	}
+	if !h.validate(w, r, request) {
+		return
+	}
+	userActivity := request.toModel(userActivityID, authenticatedUserID(r))
 
-	if err := h.userActivityRepo.UpdateUserActivity(&userActivity); err != nil {
-		http.Error(w, "Failed to update user activity", http.StatusInternalServerError)
+	overlap, err := h.userActivityRepo.UpdateUserActivity(&userActivity)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to update user activity")
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	// Only describe the update if there is a warning to report
+	if overlap == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newUserActivityWriteResponse(userActivity.ID, overlap))
 }
 
 // DeleteUserActivity handles deleting a user activity by ID.
 func (h *UserActivityHandler) DeleteUserActivity(w http.ResponseWriter, r *http.Request) {
 	userActivityID, err := strconv.ParseInt(chi.URLParam(r, "userActivityID"), 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid user activity ID", http.StatusBadRequest)
+		writeBadRequest(w, "Invalid user activity ID")
 		return
 	}
 
-	if err := h.userActivityRepo.DeleteUserActivity(userActivityID); err != nil {
-		http.Error(w, "Failed to delete user activity", http.StatusInternalServerError)
+	err = h.userActivityRepo.DeleteUserActivity(authenticatedUserID(r), userActivityID)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to delete user activity")
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// validate checks a create or update request against the rules and the
+// attribute schema of the referenced activity, writing a 422 response listing
+// the invalid fields, or a 500 if the activity cannot be looked up.
+func (h *UserActivityHandler) validate(w http.ResponseWriter, r *http.Request, request userActivityRequest) bool {
+	activity, err := findActivity(h.activityRepo, authenticatedUserID(r), request.ActivityID)
+	if err != nil {
+		writeInternalError(w, err, "Failed to validate user activity")
+		return false
+	}
+	tags := make(map[int64]bool)
+	if len(request.TagIDs) > 0 {
+		userTags, err := h.tagRepo.ListTags(authenticatedUserID(r))
+		if err != nil {
+			writeInternalError(w, err, "Failed to validate user activity")
+			return false
+		}
+		for _, tag := range userTags {
+			tags[tag.ID] = true
+		}
+	}
+
+	if err := request.validate(activity, tags); err != nil {
+		writeValidationError(w, err)
+		return false
+	}
+	return true
+}
+
+// findActivity returns the activity that activityID refers to, or nil if there
+// is none in the catalog that is visible to userID.
+func findActivity(activityRepo repository.ActivityStore, userID, activityID int64) (*model.Activity, error) {
+	if activityID <= 0 {
+		return nil, nil
+	}
+	activity, err := activityRepo.GetActivity(userID, activityID)
+	if errors.Is(err, repository.ErrActivityNotFound) {
+		return nil, nil
+	}
+	return activity, err
+}
+
+// ListUserActivities handles listing a user's activities with optional
+// filters, sort order and cursor pagination.
+func (h *UserActivityHandler) ListUserActivities(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid user ID")
+		return
+	}
+	if !authorizeUser(w, r, userID) {
+		return
+	}
+
+	filter, err := parseUserActivityFilter(r)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	filter.UserID = userID
+
+	userActivities, next, err := h.userActivityRepo.ListUserActivities(filter)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to list user activities")
+		return
+	}
+
+	response := userActivityPage{Items: newUserActivityResponses(userActivities)}
+	if next != nil {
+		response.NextCursor = next.Encode()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// parseUserActivityFilter reads the list filters from the query string:
+// activity_id, start_from, start_to, min_mood, max_mood, the attr.* attribute
+// filters, tag_id (repeated to match any, or with tag_match=all every, of
+// several tags), order, limit and cursor.
+func parseUserActivityFilter(r *http.Request) (repository.UserActivityFilter, error) {
+	var filter repository.UserActivityFilter
+	var err error
+
+	if filter.ActivityID, err = queryInt64(r, "activity_id"); err != nil {
+		return filter, err
+	}
+	if filter.StartFrom, err = queryTime(r, "start_from"); err != nil {
+		return filter, err
+	}
+	if filter.StartTo, err = queryTime(r, "start_to"); err != nil {
+		return filter, err
+	}
+	if filter.MinMood, err = queryInt(r, "min_mood"); err != nil {
+		return filter, err
+	}
+	if filter.MaxMood, err = queryInt(r, "max_mood"); err != nil {
+		return filter, err
+	}
+	if filter.Attributes, err = queryAttributeFilters(r); err != nil {
+		return filter, err
+	}
+	for _, raw := range r.URL.Query()["tag_id"] {
+		tagID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || tagID <= 0 {
+			return filter, fmt.Errorf("invalid tag_id: must be a positive integer")
+		}
+		filter.TagIDs = append(filter.TagIDs, tagID)
+	}
+	switch r.URL.Query().Get("tag_match") {
+	case "", "any":
+	case "all":
+		filter.AllTags = true
+	default:
+		return filter, fmt.Errorf("invalid tag_match: must be any or all")
+	}
+	if filter.Descending, err = queryOrder(r, true); err != nil {
+		return filter, err
+	}
+
+	if filter.Limit, err = queryLimit(r); err != nil {
+		return filter, err
+	}
+
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		if filter.After, err = repository.DecodeCursor(cursor); err != nil {
+			return filter, err
+		}
+	}
+	return filter, nil
+}
@@ -1,10 +1,8 @@
 package handler
 
 import (
-	"activity-tracker/pkg/model"
 	repository "activity-tracker/pkg/respository"
 	"encoding/json"
-	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -14,35 +12,45 @@ import (
 
 // UserHandler handles HTTP requests related to users.
 type UserHandler struct {
-	userRepo *repository.Repository
+	userRepo repository.UserStore
 }
 
 // NewUserHandler creates a new UserHandler instance.
-func NewUserHandler(userRepo *repository.Repository) *UserHandler {
+func NewUserHandler(userRepo repository.UserStore) *UserHandler {
 	return &UserHandler{userRepo: userRepo}
 }
 
-// RegisterRoutes registers the user routes.
-func (h *UserHandler) RegisterRoutes(router chi.Router) {
+// RegisterPublicRoutes registers the user routes that do not require
+// authentication, which is just signing up.
+func (h *UserHandler) RegisterPublicRoutes(router chi.Router) {
 	router.Post("/users", h.CreateUser)
+}
+
+// RegisterRoutes registers the user routes. Users may only access their own record.
+func (h *UserHandler) RegisterRoutes(router chi.Router) {
 	router.Get("/users/{userID}", h.GetUser)
 	router.Put("/users/{userID}", h.UpdateUser)
 	router.Delete("/users/{userID}", h.DeleteUser)
+	router.Put("/users/{userID}/admin", h.SetUserAdmin)
 }
 
 // CreateUser handles the creation of a new user.
 func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
-	var user model.User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+	var request userRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		log.Printf("Error decoding request body: %v", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeBadRequest(w, "Invalid request body")
 		return
 	}
+	if err := request.validate(true); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	user := request.toModel(0)
 
 	userID, err := h.userRepo.CreateUser(&user)
 	if err != nil {
-		log.Printf("Error creating user: %v", err)
-		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		writeRepositoryError(w, err, "Failed to create user")
 		return
 	}
 
@@ -56,23 +64,21 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
 	if err != nil {
 		log.Printf("Error parsing user ID: %v", err)
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		writeBadRequest(w, "Invalid user ID")
+		return
+	}
+	if !authorizeUser(w, r, userID) {
 		return
 	}
 
 	user, err := h.userRepo.GetUser(userID)
-	if errors.Is(err, repository.ErrUserNotFound) {
-		log.Printf("User not found: %v", err)
-		http.Error(w, "User not found", http.StatusNotFound)
-		return
-	} else if err != nil {
-		log.Printf("Error retrieving user: %v", err)
-		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+	if err != nil {
+		writeRepositoryError(w, err, "Failed to retrieve user")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	json.NewEncoder(w).Encode(newUserResponse(user))
 }
 
 // UpdateUser handles updating a user by ID.
@@ -80,21 +86,27 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
 	if err != nil {
 		log.Printf("Error parsing user ID: %v", err)
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		writeBadRequest(w, "Invalid user ID")
+		return
+	}
+	if !authorizeUser(w, r, userID) {
 		return
 	}
 
-	var user model.User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+	var request userRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		log.Printf("Error decoding request body: %v", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeBadRequest(w, "Invalid request body")
 		return
 	}
-	user.ID = userID
+	if err := request.validate(false); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	user := request.toModel(userID)
 
 	if err := h.userRepo.UpdateUser(&user); err != nil {
-		log.Printf("Error updating user: %v", err)
-		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		writeRepositoryError(w, err, "Failed to update user")
 		return
 	}
 
@@ -106,13 +118,41 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
 	if err != nil {
 		log.Printf("Error parsing user ID: %v", err)
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		writeBadRequest(w, "Invalid user ID")
+		return
+	}
+	if !authorizeUser(w, r, userID) {
 		return
 	}
 
 	if err := h.userRepo.DeleteUser(userID); err != nil {
-		log.Printf("Error deleting user: %v", err)
-		http.Error(w, "Failed to delete user", http.StatusInternalServerError)
+		writeRepositoryError(w, err, "Failed to delete user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetUserAdmin handles granting or revoking a user's admin rights. Only admins
+// may do so; the first admin is granted in the database.
+func (h *UserHandler) SetUserAdmin(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "Invalid user ID")
+		return
+	}
+	if !authorizeAdmin(w, r, "Only admins may grant admin rights") {
+		return
+	}
+
+	var request adminRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeBadRequest(w, "Invalid request body")
+		return
+	}
+
+	if err := h.userRepo.SetUserAdmin(userID, request.IsAdmin); err != nil {
+		writeRepositoryError(w, err, "Failed to update user")
 		return
 	}
 
@@ -0,0 +1,297 @@
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Each supported database driver has its own directory of migrations. The
+// directories are kept in lockstep so a version means the same change everywhere.
+//
+//go:embed postgres/*.sql sqlite/*.sql
+var migrationFiles embed.FS
+
+// ErrNoMigrationApplied is returned by Down when there is nothing to roll back.
+var ErrNoMigrationApplied = errors.New("no migration has been applied")
+
+// Migration is a single versioned schema change with its up and down scripts.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes whether a migration has been applied to the database.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// migrationLockID identifies the Postgres advisory lock that serializes
+// migrators running against the same database, such as servers starting up
+// together.
+const migrationLockID = 7311460129
+
+// Migrator applies the embedded migrations to a database and records the
+// applied versions in the schema_migrations table.
+type Migrator struct {
+	db         *sql.DB
+	driver     string
+	migrations []Migration
+}
+
+// NewMigrator creates a new Migrator for the embedded migrations of the given
+// driver, either "postgres" or "sqlite".
+func NewMigrator(db *sql.DB, driver string) (*Migrator, error) {
+	if driver != "postgres" && driver != "sqlite" {
+		return nil, fmt.Errorf("no migrations for database driver %q", driver)
+	}
+	migrations, err := loadMigrations(migrationFiles, driver)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, driver: driver, migrations: migrations}, nil
+}
+
+// loadMigrations reads the <version>_<name>.up.sql and <version>_<name>.down.sql
+// files in dir and returns them ordered by version.
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(fileName, "."+direction+".sql")
+		versionPart, name, found := strings.Cut(base, "_")
+		if !found {
+			return nil, fmt.Errorf("invalid migration file name %q", fileName)
+		}
+		version, err := strconv.ParseInt(versionPart, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %q: %w", fileName, err)
+		}
+
+		contents, err := fs.ReadFile(fsys, path.Join(dir, fileName))
+		if err != nil {
+			return nil, fmt.Errorf("could not read migration %q: %w", fileName, err)
+		}
+
+		migration, exists := byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("migration version %d has conflicting names %q and %q", version, migration.Name, name)
+		}
+		if direction == "up" {
+			migration.Up = string(contents)
+		} else {
+			migration.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s is missing its up script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// ensureVersionTable creates the schema_migrations table if it does not exist yet.
+func (m *Migrator) ensureVersionTable() error {
+	query := `CREATE TABLE IF NOT EXISTS schema_migrations (
+				version    BIGINT PRIMARY KEY,
+				name       TEXT NOT NULL,
+				applied_at TIMESTAMP NOT NULL
+			  )`
+	err := m.inTransaction(func(tx *sql.Tx) error {
+		_, err := tx.Exec(query)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// isApplied reports whether version is recorded as applied, as seen by tx.
+func isApplied(tx *sql.Tx, version int64) (bool, error) {
+	var count int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE version = $1`, version).Scan(&count); err != nil {
+		return false, fmt.Errorf("could not read applied migrations: %w", err)
+	}
+	return count > 0, nil
+}
+
+// appliedVersions returns the applied migration versions and when they were applied.
+func (m *Migrator) appliedVersions() (map[int64]time.Time, error) {
+	if err := m.ensureVersionTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("could not read applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("could not read applied migrations: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not read applied migrations: %w", err)
+	}
+	return applied, nil
+}
+
+// Up applies every pending migration in version order and returns the ones applied.
+func (m *Migrator) Up() ([]Migration, error) {
+	applied, err := m.appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		done, err := m.apply(migration)
+		if err != nil {
+			return ran, fmt.Errorf("could not apply migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if done {
+			ran = append(ran, migration)
+		}
+	}
+	return ran, nil
+}
+
+// apply runs the up script of a migration and records it as applied. It
+// reports false without changing anything if another migrator applied it
+// first.
+func (m *Migrator) apply(migration Migration) (bool, error) {
+	done := false
+	err := m.inTransaction(func(tx *sql.Tx) error {
+		applied, err := isApplied(tx, migration.Version)
+		if err != nil || applied {
+			return err
+		}
+		if _, err := tx.Exec(migration.Up); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`,
+			migration.Version, migration.Name, time.Now().UTC())
+		done = err == nil
+		return err
+	})
+	return done, err
+}
+
+// Down rolls back the most recently applied migration and returns it.
+func (m *Migrator) Down() (*Migration, error) {
+	applied, err := m.appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s cannot be rolled back: no down script", migration.Version, migration.Name)
+		}
+		err := m.inTransaction(func(tx *sql.Tx) error {
+			applied, err := isApplied(tx, migration.Version)
+			if err != nil {
+				return err
+			}
+			if !applied {
+				return errors.New("it was rolled back concurrently")
+			}
+			if _, err := tx.Exec(migration.Down); err != nil {
+				return err
+			}
+			_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not roll back migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		return &migration, nil
+	}
+	return nil, ErrNoMigrationApplied
+}
+
+// Status reports every known migration and whether it has been applied.
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		appliedAt, ok := applied[migration.Version]
+		statuses = append(statuses, Status{Migration: migration, Applied: ok, AppliedAt: appliedAt})
+	}
+	return statuses, nil
+}
+
+// inTransaction runs fn in a transaction, committing on success and rolling back on error.
+// On Postgres the transaction first takes the migration lock, which is released
+// when it ends; SQLite serializes writing transactions itself.
+func (m *Migrator) inTransaction(fn func(tx *sql.Tx) error) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	if m.driver == "postgres" {
+		if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("could not lock migrations: %w", err)
+		}
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,273 @@
+package migrations
+
+import (
+	repository "activity-tracker/pkg/respository"
+	"database/sql"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq" // PostgreSQL driver
+	"github.com/stretchr/testify/assert"
+)
+
+// forEachDatabase runs test against a fresh in-memory SQLite database, opened
+// with the SQL functions the schema uses, and, if TEST_DATABASE_URL is set,
+// against that Postgres database. The tests migrate
+// it up and down again, so it must be a database that can be thrown away.
+func forEachDatabase(t *testing.T, test func(t *testing.T, db *sql.DB, driver string)) {
+	t.Run("sqlite", func(t *testing.T) {
+		db, err := sql.Open(repository.SQLiteDriver, "file::memory:?_foreign_keys=on")
+		if err != nil {
+			t.Fatalf("Failed to open the database: %v", err)
+		}
+		db.SetMaxOpenConns(1)
+		defer db.Close()
+		test(t, db, "sqlite")
+	})
+	t.Run("postgres", func(t *testing.T) {
+		url := os.Getenv("TEST_DATABASE_URL")
+		if url == "" {
+			t.Skip("TEST_DATABASE_URL is not set")
+		}
+		db, err := sql.Open("postgres", url)
+		if err != nil {
+			t.Fatalf("Failed to open the database: %v", err)
+		}
+		defer db.Close()
+		test(t, db, "postgres")
+	})
+}
+
+// rollBackAll rolls back every applied migration.
+func rollBackAll(t *testing.T, migrator *Migrator) {
+	t.Helper()
+	for {
+		_, err := migrator.Down()
+		if err == ErrNoMigrationApplied {
+			return
+		}
+		if err != nil {
+			t.Fatalf("Failed to roll back migration: %v", err)
+		}
+	}
+}
+
+// tableExists reports whether the database has a table with the given name.
+func tableExists(t *testing.T, db *sql.DB, driver, name string) bool {
+	t.Helper()
+	query := `SELECT count(*) FROM information_schema.tables WHERE table_name = $1`
+	if driver == "sqlite" {
+		query = `SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = $1`
+	}
+	var tables int
+	if err := db.QueryRow(query, name).Scan(&tables); err != nil {
+		t.Fatalf("Failed to inspect schema: %v", err)
+	}
+	return tables > 0
+}
+
+func TestPostgresAndSQLiteMigrationsMatch(t *testing.T) {
+	postgres, err := loadMigrations(migrationFiles, "postgres")
+	if err != nil {
+		t.Fatalf("Failed to load postgres migrations: %v", err)
+	}
+	sqlite, err := loadMigrations(migrationFiles, "sqlite")
+	if err != nil {
+		t.Fatalf("Failed to load sqlite migrations: %v", err)
+	}
+
+	assert.Equal(t, len(postgres), len(sqlite))
+	for i := range postgres {
+		assert.Equal(t, postgres[i].Version, sqlite[i].Version)
+		assert.Equal(t, postgres[i].Name, sqlite[i].Name)
+	}
+}
+
+func TestMigrateUpDownStatus(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *sql.DB, driver string) {
+		migrator, err := NewMigrator(db, driver)
+		if err != nil {
+			t.Fatalf("Failed to load migrations: %v", err)
+		}
+
+		applied, err := migrator.Up()
+		if err != nil {
+			t.Fatalf("Failed to apply migrations: %v", err)
+		}
+		assert.Len(t, applied, len(migrator.migrations))
+
+		// Running up again is a no-op
+		applied, err = migrator.Up()
+		if err != nil {
+			t.Fatalf("Failed to apply migrations: %v", err)
+		}
+		assert.Empty(t, applied)
+
+		statuses, err := migrator.Status()
+		if err != nil {
+			t.Fatalf("Failed to read migration status: %v", err)
+		}
+		for _, status := range statuses {
+			assert.True(t, status.Applied, "migration %d should be applied", status.Version)
+		}
+
+		// Roll everything back
+		for range migrator.migrations {
+			if _, err := migrator.Down(); err != nil {
+				t.Fatalf("Failed to roll back migration: %v", err)
+			}
+		}
+		_, err = migrator.Down()
+		assert.ErrorIs(t, err, ErrNoMigrationApplied)
+		assert.False(t, tableExists(t, db, driver, "users"))
+	})
+}
+
+func TestConcurrentMigrators(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *sql.DB, driver string) {
+		// Servers starting up together apply every migration exactly once
+		migrators := make([]*Migrator, 4)
+		for i := range migrators {
+			migrator, err := NewMigrator(db, driver)
+			if err != nil {
+				t.Fatalf("Failed to load migrations: %v", err)
+			}
+			migrators[i] = migrator
+		}
+		defer rollBackAll(t, migrators[0])
+
+		var wg sync.WaitGroup
+		applied := make([][]Migration, len(migrators))
+		errs := make([]error, len(migrators))
+		for i, migrator := range migrators {
+			wg.Add(1)
+			go func(i int, migrator *Migrator) {
+				defer wg.Done()
+				applied[i], errs[i] = migrator.Up()
+			}(i, migrator)
+		}
+		wg.Wait()
+
+		total := 0
+		for i := range migrators {
+			assert.NoError(t, errs[i])
+			total += len(applied[i])
+		}
+		assert.Equal(t, len(migrators[0].migrations), total)
+
+		// A migration applied after a migrator looked is skipped
+		done, err := migrators[1].apply(migrators[1].migrations[0])
+		assert.NoError(t, err)
+		assert.False(t, done)
+	})
+}
+
+func TestDurationSecondsMigration(t *testing.T) {
+	db, err := sql.Open(repository.SQLiteDriver, "file::memory:?_foreign_keys=on")
+	if err != nil {
+		t.Fatalf("Failed to open the database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	migrator, err := NewMigrator(db, "sqlite")
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	all := migrator.migrations
+	migrator.migrations = all[:3]
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Failed to apply migrations: %v", err)
+	}
+
+	// One consistent activity, and one that ends before it starts
+	_, err = db.Exec(`INSERT INTO users (id, username, password) VALUES (1, 'alice', 'hash');
+		INSERT INTO activities (id, name) VALUES (1, 'Running');
+		INSERT INTO user_activities (id, user_id, activity_id, start_time, end_time, duration)
+		VALUES (1, 1, 1, '2024-03-01 07:00:00+00:00', '2024-03-01 07:30:00.5+00:00', 1800500000000),
+		       (2, 1, 1, '2024-03-01 09:00:00+00:00', '2024-03-01 08:00:00+00:00', 600000000000)`)
+	if err != nil {
+		t.Fatalf("Failed to insert activities: %v", err)
+	}
+
+	migrator.migrations = all[:4]
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Failed to apply migration: %v", err)
+	}
+
+	var durations []int64
+	rows, err := db.Query(`SELECT duration_seconds FROM user_activities ORDER BY id`)
+	if err != nil {
+		t.Fatalf("Failed to read durations: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var duration int64
+		if err := rows.Scan(&duration); err != nil {
+			t.Fatalf("Failed to read durations: %v", err)
+		}
+		durations = append(durations, duration)
+	}
+	assert.Equal(t, []int64{1800, 600}, durations)
+
+	_, err = db.Exec(`UPDATE user_activities SET end_time = '2024-03-01 06:00:00+00:00' WHERE id = 1`)
+	assert.Error(t, err, "an activity must not end before it starts")
+
+	if _, err := migrator.Down(); err != nil {
+		t.Fatalf("Failed to roll back migration: %v", err)
+	}
+	var duration int64
+	if err := db.QueryRow(`SELECT duration FROM user_activities WHERE id = 2`).Scan(&duration); err != nil {
+		t.Fatalf("Failed to read duration: %v", err)
+	}
+	assert.Equal(t, int64(600000000000), duration)
+}
+
+func TestTimerRunsMigration(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *sql.DB, driver string) {
+		migrator, err := NewMigrator(db, driver)
+		if err != nil {
+			t.Fatalf("Failed to load migrations: %v", err)
+		}
+		defer rollBackAll(t, migrator)
+		all := migrator.migrations
+		migrator.migrations = all[:13]
+		if _, err := migrator.Up(); err != nil {
+			t.Fatalf("Failed to apply migrations: %v", err)
+		}
+
+		// A paused timer, and one that has run without a pause
+		startedAt := time.Date(2024, 7, 1, 6, 0, 0, 0, time.UTC)
+		_, err = db.Exec(`INSERT INTO users (id, username, password) VALUES (1, 'alice', 'hash')`)
+		if err != nil {
+			t.Fatalf("Failed to insert user: %v", err)
+		}
+		_, err = db.Exec(`INSERT INTO activities (id, name) VALUES (1, 'Running')`)
+		if err != nil {
+			t.Fatalf("Failed to insert activity: %v", err)
+		}
+		_, err = db.Exec(`INSERT INTO timers (id, user_id, activity_id, started_at, resumed_at, elapsed_ms)
+			VALUES (1, 1, 1, $1, NULL, 90250), (2, 1, 1, $1, $1, 0)`, startedAt)
+		if err != nil {
+			t.Fatalf("Failed to insert timers: %v", err)
+		}
+
+		migrator.migrations = all[:14]
+		if _, err := migrator.Up(); err != nil {
+			t.Fatalf("Failed to apply migration: %v", err)
+		}
+
+		// The paused timer ran for its elapsed time from its start
+		var timerID int64
+		var start, end time.Time
+		err = db.QueryRow(`SELECT timer_id, started_at, ended_at FROM timer_runs`).Scan(&timerID, &start, &end)
+		if err != nil {
+			t.Fatalf("Failed to read timer runs: %v", err)
+		}
+		assert.Equal(t, int64(1), timerID)
+		assert.True(t, startedAt.Equal(start))
+		assert.True(t, startedAt.Add(90*time.Second+250*time.Millisecond).Equal(end), "ended at %v", end)
+	})
+}
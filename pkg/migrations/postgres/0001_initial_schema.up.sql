@@ -0,0 +1,26 @@
+CREATE TABLE users (
+    id         BIGSERIAL PRIMARY KEY,
+    username   TEXT        NOT NULL UNIQUE,
+    password   TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE activities (
+    id   BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL
+);
+
+CREATE TABLE user_activities (
+    id                    BIGSERIAL PRIMARY KEY,
+    user_id               BIGINT      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    activity_id           BIGINT      NOT NULL REFERENCES activities (id) ON DELETE RESTRICT,
+    start_time            TIMESTAMPTZ NOT NULL,
+    end_time              TIMESTAMPTZ NOT NULL,
+    duration              BIGINT      NOT NULL DEFAULT 0,
+    mood                  INTEGER     NOT NULL DEFAULT 0,
+    additional_attributes JSONB       NOT NULL DEFAULT '{}'::jsonb,
+    recorded_at           TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX user_activities_user_id_idx ON user_activities (user_id);
+CREATE INDEX user_activities_activity_id_idx ON user_activities (activity_id);
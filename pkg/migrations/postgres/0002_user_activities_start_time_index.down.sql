@@ -0,0 +1,2 @@
+CREATE INDEX user_activities_user_id_idx ON user_activities (user_id);
+DROP INDEX user_activities_user_start_time_idx;
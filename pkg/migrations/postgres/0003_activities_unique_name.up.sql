@@ -0,0 +1,3 @@
+-- Activity names are unique regardless of case, so "Running" and "running"
+-- cannot both exist in the catalog. The index also serves name searches.
+CREATE UNIQUE INDEX activities_name_lower_key ON activities (lower(name));
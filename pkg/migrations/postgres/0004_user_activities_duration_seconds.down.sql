@@ -0,0 +1,7 @@
+ALTER TABLE user_activities
+    DROP CONSTRAINT user_activities_duration_seconds_check,
+    DROP CONSTRAINT user_activities_end_time_check;
+
+ALTER TABLE user_activities ADD COLUMN duration BIGINT NOT NULL DEFAULT 0;
+UPDATE user_activities SET duration = duration_seconds * 1000000000;
+ALTER TABLE user_activities DROP COLUMN duration_seconds;
@@ -0,0 +1,15 @@
+-- Durations were stored as Go time.Duration nanoseconds. Store whole seconds
+-- instead, derived from the start and end times, and make sure every activity
+-- ends no earlier than it starts. Activities that ended before they started
+-- keep their recorded duration and have their end time moved to match.
+UPDATE user_activities
+SET end_time = start_time + GREATEST(duration / 1000000000, 0) * INTERVAL '1 second'
+WHERE end_time < start_time;
+
+ALTER TABLE user_activities ADD COLUMN duration_seconds BIGINT NOT NULL DEFAULT 0;
+UPDATE user_activities SET duration_seconds = floor(extract(epoch FROM end_time - start_time));
+ALTER TABLE user_activities DROP COLUMN duration;
+
+ALTER TABLE user_activities
+    ADD CONSTRAINT user_activities_end_time_check CHECK (end_time >= start_time),
+    ADD CONSTRAINT user_activities_duration_seconds_check CHECK (duration_seconds >= 0);
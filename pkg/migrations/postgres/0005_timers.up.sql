@@ -0,0 +1,17 @@
+-- Timers are user activities that are still being recorded. resumed_at is set
+-- while a timer runs and NULL while it is paused; elapsed_ms is the active time
+-- of its earlier runs.
+CREATE TABLE timers (
+    id          BIGSERIAL PRIMARY KEY,
+    user_id     BIGINT      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    activity_id BIGINT      NOT NULL REFERENCES activities (id) ON DELETE RESTRICT,
+    started_at  TIMESTAMPTZ NOT NULL,
+    resumed_at  TIMESTAMPTZ,
+    elapsed_ms  BIGINT      NOT NULL DEFAULT 0 CHECK (elapsed_ms >= 0)
+);
+
+CREATE INDEX timers_user_id_idx ON timers (user_id);
+CREATE INDEX timers_activity_id_idx ON timers (activity_id);
+
+-- A user has at most one running timer, but may have any number paused
+CREATE UNIQUE INDEX timers_user_running_key ON timers (user_id) WHERE resumed_at IS NOT NULL;
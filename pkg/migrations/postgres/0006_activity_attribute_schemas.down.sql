@@ -0,0 +1 @@
+ALTER TABLE activities DROP COLUMN attribute_schema;
@@ -0,0 +1 @@
+DROP INDEX user_activities_additional_attributes_idx;
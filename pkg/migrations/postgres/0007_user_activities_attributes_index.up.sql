@@ -0,0 +1,3 @@
+-- Serves attribute filters on user activity lists: containment (@>) for
+-- equality and key existence (?).
+CREATE INDEX user_activities_additional_attributes_idx ON user_activities USING GIN (additional_attributes);
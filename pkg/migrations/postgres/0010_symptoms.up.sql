@@ -0,0 +1,15 @@
+-- The symptom journal. A symptom may be linked to the user activity it is
+-- thought to come from, and loses the link if that activity is deleted.
+CREATE TABLE symptoms (
+    id               BIGSERIAL PRIMARY KEY,
+    user_id          BIGINT      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    user_activity_id BIGINT      REFERENCES user_activities (id) ON DELETE SET NULL,
+    body_area        TEXT        NOT NULL CHECK (body_area <> ''),
+    severity         INTEGER     NOT NULL CHECK (severity BETWEEN 1 AND 10),
+    notes            TEXT        NOT NULL DEFAULT '',
+    occurred_at      TIMESTAMPTZ NOT NULL,
+    recorded_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX symptoms_user_id_occurred_at_idx ON symptoms (user_id, occurred_at);
+CREATE INDEX symptoms_user_activity_id_idx ON symptoms (user_activity_id);
@@ -0,0 +1,17 @@
+-- Tags are labels that users define for their own activities. A user activity
+-- can have any number of its user's tags.
+CREATE TABLE tags (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name       TEXT        NOT NULL CHECK (name <> ''),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE user_activity_tags (
+    user_activity_id BIGINT NOT NULL REFERENCES user_activities (id) ON DELETE CASCADE,
+    tag_id           BIGINT NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (user_activity_id, tag_id)
+);
+
+CREATE INDEX user_activity_tags_tag_id_idx ON user_activity_tags (tag_id);
@@ -0,0 +1,2 @@
+ALTER TABLE activities DROP COLUMN category_id;
+DROP TABLE categories;
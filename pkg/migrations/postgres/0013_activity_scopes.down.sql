@@ -0,0 +1,8 @@
+-- Private activities that share a name with another activity must be renamed
+-- or deleted first.
+DROP INDEX activities_owner_name_key;
+CREATE UNIQUE INDEX activities_name_lower_key ON activities (lower(name));
+DROP INDEX activities_owner_user_id_idx;
+ALTER TABLE activities DROP COLUMN owner_user_id;
+
+ALTER TABLE users DROP COLUMN is_admin;
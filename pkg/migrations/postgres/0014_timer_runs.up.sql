@@ -0,0 +1,16 @@
+-- The earlier runs of each timer, so that stopping it records the time it
+-- actually ran rather than a block of its active time. Timers paused before
+-- runs were kept get a single run of their elapsed time from their start.
+CREATE TABLE timer_runs (
+    id         BIGSERIAL PRIMARY KEY,
+    timer_id   BIGINT      NOT NULL REFERENCES timers (id) ON DELETE CASCADE,
+    started_at TIMESTAMPTZ NOT NULL,
+    ended_at   TIMESTAMPTZ NOT NULL CHECK (ended_at >= started_at)
+);
+
+CREATE INDEX timer_runs_timer_id_idx ON timer_runs (timer_id);
+
+INSERT INTO timer_runs (timer_id, started_at, ended_at)
+SELECT id, started_at, started_at + elapsed_ms * INTERVAL '1 millisecond'
+FROM timers
+WHERE elapsed_ms > 0 OR resumed_at IS NULL;
@@ -0,0 +1 @@
+-- The up migration changes nothing on Postgres.
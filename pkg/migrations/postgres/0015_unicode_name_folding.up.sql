@@ -0,0 +1,2 @@
+-- Postgres' lower() already handles letters other than ASCII ones, so only the
+-- SQLite indexes on names change.
@@ -0,0 +1,26 @@
+CREATE TABLE users (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    username   TEXT      NOT NULL UNIQUE,
+    password   TEXT      NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE activities (
+    id   INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL
+);
+
+CREATE TABLE user_activities (
+    id                    INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id               INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    activity_id           INTEGER   NOT NULL REFERENCES activities (id) ON DELETE RESTRICT,
+    start_time            TIMESTAMP NOT NULL,
+    end_time              TIMESTAMP NOT NULL,
+    duration              INTEGER   NOT NULL DEFAULT 0,
+    mood                  INTEGER   NOT NULL DEFAULT 0,
+    additional_attributes TEXT      NOT NULL DEFAULT '{}' CHECK (json_valid(additional_attributes)),
+    recorded_at           TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX user_activities_user_id_idx ON user_activities (user_id);
+CREATE INDEX user_activities_activity_id_idx ON user_activities (activity_id);
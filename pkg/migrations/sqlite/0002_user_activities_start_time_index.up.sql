@@ -0,0 +1,3 @@
+-- Supports listing a user's activities ordered and paginated by (start_time, id)
+CREATE INDEX user_activities_user_start_time_idx ON user_activities (user_id, start_time, id);
+DROP INDEX user_activities_user_id_idx;
@@ -0,0 +1,21 @@
+CREATE TABLE user_activities_old (
+    id                    INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id               INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    activity_id           INTEGER   NOT NULL REFERENCES activities (id) ON DELETE RESTRICT,
+    start_time            TIMESTAMP NOT NULL,
+    end_time              TIMESTAMP NOT NULL,
+    duration              INTEGER   NOT NULL DEFAULT 0,
+    mood                  INTEGER   NOT NULL DEFAULT 0,
+    additional_attributes TEXT      NOT NULL DEFAULT '{}' CHECK (json_valid(additional_attributes)),
+    recorded_at           TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO user_activities_old (id, user_id, activity_id, start_time, end_time, duration, mood, additional_attributes, recorded_at)
+SELECT id, user_id, activity_id, start_time, end_time, duration_seconds * 1000000000, mood, additional_attributes, recorded_at
+FROM user_activities;
+
+DROP TABLE user_activities;
+ALTER TABLE user_activities_old RENAME TO user_activities;
+
+CREATE INDEX user_activities_user_start_time_idx ON user_activities (user_id, start_time, id);
+CREATE INDEX user_activities_activity_id_idx ON user_activities (activity_id);
@@ -0,0 +1,33 @@
+-- Durations were stored as Go time.Duration nanoseconds. Store whole seconds
+-- instead, derived from the start and end times, and make sure every activity
+-- ends no earlier than it starts. Activities that ended before they started
+-- keep their recorded duration and have their end time moved to match.
+-- SQLite cannot add CHECK constraints to an existing table, so it is rebuilt.
+UPDATE user_activities
+SET end_time = datetime(start_time, '+' || max(duration / 1000000000, 0) || ' seconds')
+WHERE unixepoch(end_time, 'subsec') < unixepoch(start_time, 'subsec');
+
+CREATE TABLE user_activities_new (
+    id                    INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id               INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    activity_id           INTEGER   NOT NULL REFERENCES activities (id) ON DELETE RESTRICT,
+    start_time            TIMESTAMP NOT NULL,
+    end_time              TIMESTAMP NOT NULL,
+    duration_seconds      INTEGER   NOT NULL DEFAULT 0 CHECK (duration_seconds >= 0),
+    mood                  INTEGER   NOT NULL DEFAULT 0,
+    additional_attributes TEXT      NOT NULL DEFAULT '{}' CHECK (json_valid(additional_attributes)),
+    recorded_at           TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK (unixepoch(end_time, 'subsec') >= unixepoch(start_time, 'subsec'))
+);
+
+INSERT INTO user_activities_new (id, user_id, activity_id, start_time, end_time, duration_seconds, mood, additional_attributes, recorded_at)
+SELECT id, user_id, activity_id, start_time, end_time,
+       CAST(unixepoch(end_time, 'subsec') - unixepoch(start_time, 'subsec') AS INTEGER),
+       mood, additional_attributes, recorded_at
+FROM user_activities;
+
+DROP TABLE user_activities;
+ALTER TABLE user_activities_new RENAME TO user_activities;
+
+CREATE INDEX user_activities_user_start_time_idx ON user_activities (user_id, start_time, id);
+CREATE INDEX user_activities_activity_id_idx ON user_activities (activity_id);
@@ -0,0 +1,17 @@
+-- Timers are user activities that are still being recorded. resumed_at is set
+-- while a timer runs and NULL while it is paused; elapsed_ms is the active time
+-- of its earlier runs.
+CREATE TABLE timers (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id     INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    activity_id INTEGER   NOT NULL REFERENCES activities (id) ON DELETE RESTRICT,
+    started_at  TIMESTAMP NOT NULL,
+    resumed_at  TIMESTAMP,
+    elapsed_ms  INTEGER   NOT NULL DEFAULT 0 CHECK (elapsed_ms >= 0)
+);
+
+CREATE INDEX timers_user_id_idx ON timers (user_id);
+CREATE INDEX timers_activity_id_idx ON timers (activity_id);
+
+-- A user has at most one running timer, but may have any number paused
+CREATE UNIQUE INDEX timers_user_running_key ON timers (user_id) WHERE resumed_at IS NOT NULL;
@@ -0,0 +1,3 @@
+-- Each activity declares the additional attributes recorded with its user
+-- activities. Activities without fields accept free-form attributes.
+ALTER TABLE activities ADD COLUMN attribute_schema TEXT NOT NULL DEFAULT '{"fields": []}' CHECK (json_valid(attribute_schema));
@@ -0,0 +1,3 @@
+-- SQLite has no GIN indexes, and attribute names are not known in advance to
+-- index individual JSON paths. Attribute filters are evaluated on the rows
+-- selected through user_activities_user_start_time_idx instead.
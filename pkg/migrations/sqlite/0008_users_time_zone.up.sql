@@ -0,0 +1,3 @@
+-- The IANA time zone that a user's activities are grouped into days, weeks
+-- and months in.
+ALTER TABLE users ADD COLUMN time_zone TEXT NOT NULL DEFAULT 'UTC';
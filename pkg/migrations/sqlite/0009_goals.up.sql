@@ -0,0 +1,17 @@
+-- Goals are targets that users set for every day, week or month. A goal
+-- without an activity counts all of the user's activities; attribute names
+-- the additional attribute summed by the attribute_sum metric.
+CREATE TABLE goals (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id     INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    activity_id INTEGER   REFERENCES activities (id) ON DELETE RESTRICT,
+    metric      TEXT      NOT NULL CHECK (metric IN ('count', 'duration', 'attribute_sum')),
+    attribute   TEXT      NOT NULL DEFAULT '',
+    period      TEXT      NOT NULL CHECK (period IN ('day', 'week', 'month')),
+    target      REAL      NOT NULL CHECK (target > 0),
+    created_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((metric = 'attribute_sum') = (attribute <> ''))
+);
+
+CREATE INDEX goals_user_id_idx ON goals (user_id);
+CREATE INDEX goals_activity_id_idx ON goals (activity_id);
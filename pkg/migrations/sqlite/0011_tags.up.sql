@@ -0,0 +1,17 @@
+-- Tags are labels that users define for their own activities. A user activity
+-- can have any number of its user's tags.
+CREATE TABLE tags (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id    INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name       TEXT      NOT NULL CHECK (name <> ''),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE user_activity_tags (
+    user_activity_id INTEGER NOT NULL REFERENCES user_activities (id) ON DELETE CASCADE,
+    tag_id           INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (user_activity_id, tag_id)
+);
+
+CREATE INDEX user_activity_tags_tag_id_idx ON user_activity_tags (tag_id);
@@ -0,0 +1,3 @@
+DROP INDEX activities_category_id_idx;
+ALTER TABLE activities DROP COLUMN category_id;
+DROP TABLE categories;
@@ -0,0 +1,14 @@
+-- Categories form a tree, such as Cardio > Running > Trail running, that
+-- activities can be filed under. Sibling names are unique regardless of case.
+-- Categories with children or activities cannot be deleted.
+CREATE TABLE categories (
+    id        INTEGER PRIMARY KEY AUTOINCREMENT,
+    name      TEXT    NOT NULL CHECK (name <> ''),
+    parent_id INTEGER REFERENCES categories (id) ON DELETE RESTRICT
+);
+
+CREATE UNIQUE INDEX categories_parent_name_key ON categories (COALESCE(parent_id, 0), lower(name));
+CREATE INDEX categories_parent_id_idx ON categories (parent_id);
+
+ALTER TABLE activities ADD COLUMN category_id INTEGER REFERENCES categories (id) ON DELETE RESTRICT;
+CREATE INDEX activities_category_id_idx ON activities (category_id);
@@ -0,0 +1,10 @@
+-- Admins manage the global activity catalog that every user sees.
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Activities with an owner are private to that user, the others are global.
+-- Names are unique within the global catalog and within each user's private
+-- activities, regardless of case.
+ALTER TABLE activities ADD COLUMN owner_user_id INTEGER REFERENCES users (id) ON DELETE CASCADE;
+CREATE INDEX activities_owner_user_id_idx ON activities (owner_user_id);
+DROP INDEX activities_name_lower_key;
+CREATE UNIQUE INDEX activities_owner_name_key ON activities (COALESCE(owner_user_id, 0), lower(name));
@@ -0,0 +1,17 @@
+-- The earlier runs of each timer, so that stopping it records the time it
+-- actually ran rather than a block of its active time. Timers paused before
+-- runs were kept get a single run of their elapsed time from their start.
+CREATE TABLE timer_runs (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    timer_id   INTEGER   NOT NULL REFERENCES timers (id) ON DELETE CASCADE,
+    started_at TIMESTAMP NOT NULL,
+    ended_at   TIMESTAMP NOT NULL,
+    CHECK (unixepoch(ended_at, 'subsec') >= unixepoch(started_at, 'subsec'))
+);
+
+CREATE INDEX timer_runs_timer_id_idx ON timer_runs (timer_id);
+
+INSERT INTO timer_runs (timer_id, started_at, ended_at)
+SELECT id, started_at, strftime('%Y-%m-%d %H:%M:%f', started_at, '+' || (elapsed_ms / 1000.0) || ' seconds')
+FROM timers
+WHERE elapsed_ms > 0 OR resumed_at IS NULL;
@@ -0,0 +1,4 @@
+DROP INDEX categories_parent_name_key;
+CREATE UNIQUE INDEX categories_parent_name_key ON categories (COALESCE(parent_id, 0), lower(name));
+DROP INDEX activities_owner_name_key;
+CREATE UNIQUE INDEX activities_owner_name_key ON activities (COALESCE(owner_user_id, 0), lower(name));
@@ -0,0 +1,8 @@
+-- SQLite's lower() only handles ASCII letters, so names that differ in the
+-- case of other letters, like "Übung" and "übung", were not taken as the same.
+-- fold_case() is registered by the repository's SQLite driver. Names that now
+-- collide must be renamed first.
+DROP INDEX activities_owner_name_key;
+CREATE UNIQUE INDEX activities_owner_name_key ON activities (COALESCE(owner_user_id, 0), fold_case(name));
+DROP INDEX categories_parent_name_key;
+CREATE UNIQUE INDEX categories_parent_name_key ON categories (COALESCE(parent_id, 0), fold_case(name));
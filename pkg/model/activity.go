@@ -1,8 +1,33 @@
 package model
 
-// Activity represents the activity data model.
+import "encoding/json"
+
+// Activity represents the activity data model. Activities without an owner
+// are global and visible to every user, the others are private to their owner.
 type Activity struct {
-	ID   int64  `db:"activity_id"`
-	Name string `db:"name"`
-	// Add other fields as needed, e.g., description, category, etc.
+	ID              int64  `db:"id"`
+	Name            string `db:"name"`
+	AttributeSchema AttributeSchema
+	CategoryID      *int64 `db:"category_id"`   // nil if the activity is uncategorized
+	OwnerID         *int64 `db:"owner_user_id"` // nil if the activity is global
+}
+
+// VisibleTo reports whether the user with the given ID may see and record the
+// activity.
+func (a *Activity) VisibleTo(userID int64) bool {
+	return a.OwnerID == nil || *a.OwnerID == userID
+}
+
+// MarshalAttributeSchema marshals AttributeSchema to JSONB format.
+func (a *Activity) MarshalAttributeSchema() ([]byte, error) {
+	schema := a.AttributeSchema
+	if schema.Fields == nil {
+		schema.Fields = []AttributeField{}
+	}
+	return json.Marshal(schema)
+}
+
+// UnmarshalAttributeSchema unmarshals AttributeSchema from JSONB format.
+func (a *Activity) UnmarshalAttributeSchema(data []byte) error {
+	return json.Unmarshal(data, &a.AttributeSchema)
 }
@@ -0,0 +1,71 @@
+package model
+
+import "regexp"
+
+// AttributeType is the kind of value an attribute holds.
+type AttributeType string
+
+// Attribute types. Number values may be limited to a range and enum values to
+// a list; text and boolean values are unrestricted.
+const (
+	AttributeNumber  AttributeType = "number"
+	AttributeEnum    AttributeType = "enum"
+	AttributeText    AttributeType = "text"
+	AttributeBoolean AttributeType = "boolean"
+)
+
+// attributeNamePattern restricts attribute names to characters that are safe
+// to use as JSON keys and paths in queries.
+var attributeNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// ValidAttributeName reports whether name may be used as an attribute name: it
+// must be non-empty and only contain letters, digits and underscores.
+func ValidAttributeName(name string) bool {
+	return attributeNamePattern.MatchString(name)
+}
+
+// AttributeField declares one additional attribute that can be recorded with
+// user activities of an activity.
+type AttributeField struct {
+	Name     string        `json:"name"`
+	Type     AttributeType `json:"type"`
+	Unit     string        `json:"unit,omitempty"`
+	Min      *float64      `json:"min,omitempty"`
+	Max      *float64      `json:"max,omitempty"`
+	Values   []string      `json:"values,omitempty"`
+	Required bool          `json:"required,omitempty"`
+}
+
+// AttributeSchema lists the additional attributes of an activity. An activity
+// without fields accepts free-form attributes.
+type AttributeSchema struct {
+	Fields []AttributeField `json:"fields"`
+}
+
+// Field returns the field with the given name.
+func (s AttributeSchema) Field(name string) (AttributeField, bool) {
+	for _, field := range s.Fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return AttributeField{}, false
+}
+
+// Clone returns a copy of the schema that shares no memory with the original.
+func (s AttributeSchema) Clone() AttributeSchema {
+	fields := make([]AttributeField, len(s.Fields))
+	for i, field := range s.Fields {
+		if field.Min != nil {
+			min := *field.Min
+			field.Min = &min
+		}
+		if field.Max != nil {
+			max := *field.Max
+			field.Max = &max
+		}
+		field.Values = append([]string(nil), field.Values...)
+		fields[i] = field
+	}
+	return AttributeSchema{Fields: fields}
+}
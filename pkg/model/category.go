@@ -0,0 +1,9 @@
+package model
+
+// Category groups activities, such as Cardio > Running > Trail running.
+// Top-level categories have no parent.
+type Category struct {
+	ID       int64  `db:"id"`
+	Name     string `db:"name"`
+	ParentID *int64 `db:"parent_id"`
+}
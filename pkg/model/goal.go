@@ -0,0 +1,48 @@
+package model
+
+import "time"
+
+// GoalMetric is what a goal measures of the user activities in a period.
+type GoalMetric string
+
+// Metrics of goals.
+const (
+	MetricCount        GoalMetric = "count"         // number of user activities
+	MetricDuration     GoalMetric = "duration"      // total duration in seconds
+	MetricAttributeSum GoalMetric = "attribute_sum" // sum of a numeric additional attribute
+)
+
+// GoalPeriod is the calendar period that a goal's target applies to. Weeks
+// start on Monday.
+type GoalPeriod string
+
+// Periods of goals.
+const (
+	GoalDaily   GoalPeriod = "day"
+	GoalWeekly  GoalPeriod = "week"
+	GoalMonthly GoalPeriod = "month"
+)
+
+// Goal is a target that a user sets for every period, such as 150 minutes of
+// running a week. Only user activities of ActivityID count towards it, or all
+// of the user's activities if it is nil. Attribute names the additional
+// attribute that is summed with MetricAttributeSum and is empty otherwise.
+type Goal struct {
+	ID         int64      `db:"id"`
+	UserID     int64      `db:"user_id"`
+	ActivityID *int64     `db:"activity_id"`
+	Metric     GoalMetric `db:"metric"`
+	Attribute  string     `db:"attribute"`
+	Period     GoalPeriod `db:"period"`
+	Target     float64    `db:"target"` // in the metric's unit, greater than zero
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
+// Completion returns the fraction of the goal's target that value reaches,
+// which exceeds 1 once the goal is surpassed.
+func (g *Goal) Completion(value float64) float64 {
+	if g.Target <= 0 {
+		return 0
+	}
+	return value / g.Target
+}
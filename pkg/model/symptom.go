@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// Severity of symptoms is rated on a scale from MinSeverity, barely
+// noticeable, to MaxSeverity, the worst imaginable.
+const (
+	MinSeverity = 1
+	MaxSeverity = 10
+)
+
+// Symptom is an entry in a user's symptom journal, such as pain in the left
+// knee, rated by severity. BodyArea is stored in lower case so entries group
+// together. It may be linked to one of the user's activities that it is
+// thought to come from; the link is removed if that activity is deleted.
+type Symptom struct {
+	ID             int64
+	UserID         int64  `db:"user_id"`
+	UserActivityID *int64 `db:"user_activity_id"`
+	BodyArea       string `db:"body_area"`
+	Severity       int
+	Notes          string
+	OccurredAt     time.Time `db:"occurred_at"`
+	RecordedAt     time.Time `db:"recorded_at"`
+}
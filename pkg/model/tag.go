@@ -0,0 +1,26 @@
+package model
+
+import (
+	"regexp"
+	"time"
+)
+
+// tagNamePattern restricts tag names to short lower-case words such as
+// "race", "indoor" or "with-coach".
+var tagNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ValidTagName reports whether name may be used as a tag name: it must only
+// contain lower-case letters, digits, hyphens and underscores, and start with
+// a letter or digit.
+func ValidTagName(name string) bool {
+	return tagNamePattern.MatchString(name)
+}
+
+// Tag is a label that a user defines to mark their activities, such as
+// "race". Tag names are unique per user.
+type Tag struct {
+	ID        int64
+	UserID    int64 `db:"user_id"`
+	Name      string
+	CreatedAt time.Time `db:"created_at"`
+}
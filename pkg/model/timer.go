@@ -0,0 +1,112 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+// Errors returned when a timer is asked to change to the state it is already in.
+var (
+	ErrTimerNotRunning = errors.New("timer is paused")
+	ErrTimerNotPaused  = errors.New("timer is running")
+)
+
+// Timer is a user activity that is still being recorded. Runs lists its
+// earlier runs, oldest first, and their active time is accumulated in Elapsed.
+// While the timer runs, ResumedAt is when the current run began; while it is
+// paused, ResumedAt is nil.
+type Timer struct {
+	ID         int64         `db:"id"`
+	UserID     int64         `db:"user_id"`
+	ActivityID int64         `db:"activity_id"`
+	StartedAt  time.Time     `db:"started_at"`
+	ResumedAt  *time.Time    `db:"resumed_at"`
+	Elapsed    time.Duration `db:"elapsed_ms"`
+	Runs       []TimerRun
+}
+
+// TimerRun is a period during which a timer was running.
+type TimerRun struct {
+	Start time.Time `db:"started_at"`
+	End   time.Time `db:"ended_at"`
+}
+
+// NewTimer returns a running timer for the activity, started at now.
+func NewTimer(userID, activityID int64, now time.Time) *Timer {
+	return &Timer{UserID: userID, ActivityID: activityID, StartedAt: now, ResumedAt: &now}
+}
+
+// Running reports whether the timer is running rather than paused.
+func (t *Timer) Running() bool {
+	return t.ResumedAt != nil
+}
+
+// ActiveTime returns the time the timer has been running for as of now,
+// excluding pauses.
+func (t *Timer) ActiveTime(now time.Time) time.Duration {
+	if !t.Running() || now.Before(*t.ResumedAt) {
+		return t.Elapsed
+	}
+	return t.Elapsed + now.Sub(*t.ResumedAt)
+}
+
+// Pause stops the timer at now, adding the current run to its elapsed time.
+func (t *Timer) Pause(now time.Time) error {
+	if !t.Running() {
+		return ErrTimerNotRunning
+	}
+	t.Elapsed = t.ActiveTime(now)
+	t.Runs = append(t.Runs, t.currentRun(now))
+	t.ResumedAt = nil
+	return nil
+}
+
+// Resume starts a new run of a paused timer at now.
+func (t *Timer) Resume(now time.Time) error {
+	if t.Running() {
+		return ErrTimerNotPaused
+	}
+	t.ResumedAt = &now
+	return nil
+}
+
+// Finish returns the user activities recorded by the timer if it is stopped at
+// now, one for each of its runs, so that pauses are not recorded as part of
+// the activity. Runs shorter than a second are left out unless there is no
+// longer one.
+func (t *Timer) Finish(now time.Time) []UserActivity {
+	runs := t.Runs[:len(t.Runs):len(t.Runs)]
+	if t.Running() {
+		runs = append(runs, t.currentRun(now))
+	}
+
+	var userActivities []UserActivity
+	for _, run := range runs {
+		if DurationBetween(run.Start, run.End) > 0 {
+			userActivities = append(userActivities, t.record(run))
+		}
+	}
+	if len(userActivities) == 0 && len(runs) > 0 {
+		userActivities = append(userActivities, t.record(runs[len(runs)-1]))
+	}
+	return userActivities
+}
+
+// currentRun returns the run of a running timer as if it ended at now.
+func (t *Timer) currentRun(now time.Time) TimerRun {
+	if now.Before(*t.ResumedAt) {
+		now = *t.ResumedAt
+	}
+	return TimerRun{Start: *t.ResumedAt, End: now}
+}
+
+// record returns the user activity recorded for one run of the timer.
+func (t *Timer) record(run TimerRun) UserActivity {
+	return UserActivity{
+		UserID:     t.UserID,
+		ActivityID: t.ActivityID,
+		StartTime:  run.Start,
+		EndTime:    run.End,
+		Duration:   DurationBetween(run.Start, run.End),
+	}
+}
@@ -1,11 +1,37 @@
 package model
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+// DefaultTimeZone is the time zone of users who have not chosen one.
+const DefaultTimeZone = "UTC"
 
 // User represents the user data model.
 type User struct {
-	ID        int64     `db:"user_id"`
+	ID        int64     `db:"id"`
 	Username  string    `db:"username"`
-	Password  string    `db:"password"` // Store hashed password, not plain text
+	Password  string    `db:"password" json:"-"` // Bcrypt hash, never plain text and never serialized
+	TimeZone  string    `db:"time_zone"`         // IANA name, used to group activities into local days
+	IsAdmin   bool      `db:"is_admin"`          // Admins manage the global activity catalog
 	CreatedAt time.Time `db:"created_at"`
 }
+
+// Location returns the user's time zone, which is UTC if they have none.
+func (u *User) Location() (*time.Location, error) {
+	if u.TimeZone == "" {
+		return time.UTC, nil
+	}
+	return LoadTimeZone(u.TimeZone)
+}
+
+// LoadTimeZone returns the location of an IANA time zone name such as
+// "Europe/Berlin". Unlike time.LoadLocation it rejects "" and "Local", which
+// would depend on the server's configuration.
+func LoadTimeZone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, errors.New("unknown time zone " + name)
+	}
+	return time.LoadLocation(name)
+}
@@ -5,13 +5,21 @@ import (
 	"time"
 )
 
-// AdditionalAttributes represents the structure of the additional attributes in JSONB format.
-type AdditionalAttributes struct {
-	KneeFeeling string `json:"knee_feeling,omitempty"`
-	// Add other fields as needed
-}
+// Mood is rated on a scale from MinMood to MaxMood: 1 is very bad, 2 bad, 3
+// neutral, 4 good and 5 very good.
+const (
+	MinMood = 1
+	MaxMood = 5
+)
+
+// AdditionalAttributes holds the attributes recorded with a user activity, by
+// name. They are stored in JSONB format and checked against the activity's
+// AttributeSchema when written.
+type AdditionalAttributes map[string]interface{}
 
-// UserActivity represents a user's activity record.
+// UserActivity represents a user's activity record. Duration is always the
+// time from StartTime to EndTime in whole seconds; see DurationBetween.
+// TagIDs lists the user's tags attached to it in ascending order.
 type UserActivity struct {
 	ID                   int64
 	UserID               int64 `db:"user_id"`
@@ -21,11 +29,21 @@ type UserActivity struct {
 	Duration             time.Duration
 	Mood                 int
 	AdditionalAttributes AdditionalAttributes
+	TagIDs               []int64
 	RecordedAt           time.Time `db:"recorded_at"`
 }
 
+// DurationBetween returns the time from start to end truncated to whole
+// seconds, which is the precision durations are stored with.
+func DurationBetween(start, end time.Time) time.Duration {
+	return end.Sub(start).Truncate(time.Second)
+}
+
 // MarshalAdditionalAttributes marshals AdditionalAttributes to JSONB format.
 func (ua *UserActivity) MarshalAdditionalAttributes() ([]byte, error) {
+	if ua.AdditionalAttributes == nil {
+		return []byte("{}"), nil
+	}
 	return json.Marshal(ua.AdditionalAttributes)
 }
 
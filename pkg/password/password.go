@@ -0,0 +1,37 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Hash returns the bcrypt hash of a plain text password.
+func Hash(plain string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("could not hash password: %w", err)
+	}
+	return string(hashed), nil
+}
+
+// Verify reports whether plain matches the bcrypt hash.
+func Verify(hash, plain string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(plain))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("could not verify password: %w", err)
+	}
+	return true, nil
+}
+
+// dummyHash is compared against when a user does not exist, so that looking
+// up an unknown username takes as long as checking a wrong password.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// WasteTime performs a bcrypt comparison whose result is ignored.
+func WasteTime(plain string) {
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(plain))
+}
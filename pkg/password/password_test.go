@@ -0,0 +1,26 @@
+package password
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashAndVerify(t *testing.T) {
+	hashed, err := Hash("correct horse")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	assert.NotEqual(t, "correct horse", hashed)
+
+	ok, err := Verify(hashed, "correct horse")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = Verify(hashed, "battery staple")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = Verify("not a bcrypt hash", "correct horse")
+	assert.Error(t, err)
+}
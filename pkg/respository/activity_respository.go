@@ -5,27 +5,76 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 )
 
 // ErrActivityNotFound is returned when the activity is not found in the database.
 var ErrActivityNotFound = errors.New("activity not found")
 
-// CreateActivity creates a new activity in the database.
+// ErrActivityNameTaken is returned when another activity already has the same
+// name, compared case-insensitively.
+var ErrActivityNameTaken = errors.New("an activity with this name already exists")
+
+// ErrActivityInUse is returned when deleting an activity that user activities,
+// timers or goals still reference.
+var ErrActivityInUse = errors.New("activity is still referenced by user activities")
+
+// Name matching modes for ActivityFilter.
+const (
+	MatchPrefix   = "prefix"
+	MatchContains = "contains"
+)
+
+// Activity scopes for ActivityFilter.
+const (
+	ScopeGlobal  = "global"
+	ScopePrivate = "private"
+)
+
+// ActivityFilter selects and paginates the activities returned by
+// ListActivities. Only global activities and the private activities of UserID
+// are listed.
+type ActivityFilter struct {
+	UserID int64
+	Query  string // case-insensitive name search; empty matches every activity
+	Match  string // MatchPrefix (the default) or MatchContains
+	Scope  string // ScopeGlobal or ScopePrivate; empty lists both
+	Limit  int
+	Offset int
+}
+
+// pattern returns the LIKE pattern for the filter's query, lower-cased.
+func (f ActivityFilter) pattern() string {
+	pattern := escapeLike(strings.ToLower(f.Query)) + "%"
+	if f.Match == MatchContains {
+		pattern = "%" + pattern
+	}
+	return pattern
+}
+
+// CreateActivity creates a new activity in the database, private to its owner
+// if it has one.
 func (r *Repository) CreateActivity(activity *model.Activity) (int64, error) {
-	var id int64
-	query := `INSERT INTO activities (name) VALUES ($1) RETURNING activity_id`
-	err := r.db.QueryRow(query, activity.Name).Scan(&id)
+	attributeSchema, err := activity.MarshalAttributeSchema()
 	if err != nil {
-		return 0, fmt.Errorf("could not create activity: %w", err)
+		return 0, fmt.Errorf("could not marshal attribute schema: %w", err)
+	}
+
+	var id int64
+	query := `INSERT INTO activities (name, attribute_schema, category_id, owner_user_id) VALUES ($1, $2, $3, $4) RETURNING id`
+	err = r.db.QueryRow(query, activity.Name, string(attributeSchema), activity.CategoryID, activity.OwnerID).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, ErrActivityNameTaken
+	} else if err != nil {
+		return 0, fmt.Errorf("could not create activity: %w", translateError(err))
 	}
 	return id, nil
 }
 
-// GetActivity retrieves an activity by ID from the database.
-func (r *Repository) GetActivity(activityID int64) (*model.Activity, error) {
-	activity := &model.Activity{}
-	query := `SELECT activity_id, name FROM activities WHERE activity_id = $1`
-	err := r.db.QueryRow(query, activityID).Scan(&activity.ID, &activity.Name)
+// GetActivity retrieves an activity visible to userID by ID from the database.
+func (r *Repository) GetActivity(userID, activityID int64) (*model.Activity, error) {
+	query := `SELECT ` + activityColumns + ` FROM activities WHERE id = $1 AND (owner_user_id IS NULL OR owner_user_id = $2)`
+	activity, err := scanActivity(r.db.QueryRow(query, activityID, userID))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrActivityNotFound
@@ -35,22 +84,101 @@ func (r *Repository) GetActivity(activityID int64) (*model.Activity, error) {
 	return activity, nil
 }
 
-// UpdateActivity updates an existing activity in the database.
+// activityColumns lists the columns read by scanActivity, in order.
+const activityColumns = `id, name, attribute_schema, category_id, owner_user_id`
+
+// scanActivity reads an activity selected with activityColumns.
+func scanActivity(row rowScanner) (*model.Activity, error) {
+	activity := &model.Activity{}
+	var attributeSchema []byte
+	if err := row.Scan(&activity.ID, &activity.Name, &attributeSchema, &activity.CategoryID, &activity.OwnerID); err != nil {
+		return nil, err
+	}
+	if err := activity.UnmarshalAttributeSchema(attributeSchema); err != nil {
+		return nil, fmt.Errorf("could not unmarshal attribute schema: %w", err)
+	}
+	return activity, nil
+}
+
+// ListActivities returns the activities whose name matches the filter, ordered
+// case-insensitively by name and then by ID so pages are stable.
+func (r *Repository) ListActivities(filter ActivityFilter) ([]model.Activity, error) {
+	filter.Limit = normalizeLimit(filter.Limit)
+
+	var args queryArgs
+	var scope string
+	switch filter.Scope {
+	case ScopeGlobal:
+		scope = `owner_user_id IS NULL`
+	case ScopePrivate:
+		scope = `owner_user_id = ` + args.add(filter.UserID)
+	default:
+		scope = `(owner_user_id IS NULL OR owner_user_id = ` + args.add(filter.UserID) + `)`
+	}
+	query := fmt.Sprintf(`SELECT `+activityColumns+` FROM activities WHERE %s AND %s LIKE %s ESCAPE '\'
+			  ORDER BY %s, id LIMIT %s OFFSET %s`,
+		scope, r.lower("name"), args.add(filter.pattern()), r.lower("name"), args.add(filter.Limit), args.add(filter.Offset))
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not list activities: %w", err)
+	}
+	defer rows.Close()
+
+	activities := []model.Activity{}
+	for rows.Next() {
+		activity, err := scanActivity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not list activities: %w", err)
+		}
+		activities = append(activities, *activity)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not list activities: %w", err)
+	}
+	return activities, nil
+}
+
+// UpdateActivity updates an existing activity in the database. Its owner,
+// and so whether it is global, cannot be changed.
 func (r *Repository) UpdateActivity(activity *model.Activity) error {
-	query := `UPDATE activities SET name = $1 WHERE activity_id = $2`
-	_, err := r.db.Exec(query, activity.Name, activity.ID)
+	attributeSchema, err := activity.MarshalAttributeSchema()
 	if err != nil {
-		return fmt.Errorf("could not update activity: %w", err)
+		return fmt.Errorf("could not marshal attribute schema: %w", err)
 	}
-	return nil
+
+	query := `UPDATE activities SET name = $1, attribute_schema = $2, category_id = $3 WHERE id = $4`
+	result, err := r.db.Exec(query, activity.Name, string(attributeSchema), activity.CategoryID, activity.ID)
+	if isUniqueViolation(err) {
+		return ErrActivityNameTaken
+	} else if err != nil {
+		return fmt.Errorf("could not update activity: %w", translateError(err))
+	}
+	return expectAffected(result, ErrActivityNotFound)
 }
 
-// DeleteActivity deletes an activity by ID from the database.
+// DeleteActivity deletes an activity by ID from the database. Activities that
+// are still referenced by user activities cannot be deleted.
 func (r *Repository) DeleteActivity(activityID int64) error {
-	query := `DELETE FROM activities WHERE activity_id = $1`
-	_, err := r.db.Exec(query, activityID)
-	if err != nil {
-		return fmt.Errorf("could not delete activity: %w", err)
+	query := `DELETE FROM activities WHERE id = $1`
+	result, err := r.db.Exec(query, activityID)
+	if isForeignKeyViolation(err) {
+		return ErrActivityInUse
+	} else if err != nil {
+		return fmt.Errorf("could not delete activity: %w", translateError(err))
+	}
+	return expectAffected(result, ErrActivityNotFound)
+}
+
+// checkActivityVisible returns ErrInvalidReference unless the activity exists
+// and is visible to userID.
+func checkActivityVisible(tx *sql.Tx, userID, activityID int64) error {
+	var visible int
+	query := `SELECT COUNT(*) FROM activities WHERE id = $1 AND (owner_user_id IS NULL OR owner_user_id = $2)`
+	if err := tx.QueryRow(query, activityID, userID).Scan(&visible); err != nil {
+		return err
+	}
+	if visible == 0 {
+		return fmt.Errorf("%w: activity %d is not visible to user %d", ErrInvalidReference, activityID, userID)
 	}
 	return nil
 }
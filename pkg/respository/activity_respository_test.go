@@ -0,0 +1,246 @@
+package repository
+
+import (
+	"activity-tracker/pkg/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActivityNamesAreUniqueIgnoringCase(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store testStore) {
+		runningID, err := store.CreateActivity(&model.Activity{Name: "Running"})
+		if err != nil {
+			t.Fatalf("Failed to create activity: %v", err)
+		}
+
+		_, err = store.CreateActivity(&model.Activity{Name: "running"})
+		assert.ErrorIs(t, err, ErrActivityNameTaken)
+
+		yogaID, err := store.CreateActivity(&model.Activity{Name: "Yoga"})
+		if err != nil {
+			t.Fatalf("Failed to create activity: %v", err)
+		}
+		err = store.UpdateActivity(&model.Activity{ID: yogaID, Name: "RUNNING"})
+		assert.ErrorIs(t, err, ErrActivityNameTaken)
+
+		// Renaming an activity to a different case of its own name is fine
+		assert.NoError(t, store.UpdateActivity(&model.Activity{ID: runningID, Name: "running"}))
+	})
+}
+
+func TestActivityNameCaseFoldingOfNonASCIILetters(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store testStore) {
+		if _, err := store.CreateActivity(&model.Activity{Name: "Übung"}); err != nil {
+			t.Fatalf("Failed to create activity: %v", err)
+		}
+
+		_, err := store.CreateActivity(&model.Activity{Name: "übung"})
+		assert.ErrorIs(t, err, ErrActivityNameTaken)
+
+		found, err := store.ListActivities(ActivityFilter{Query: "ÜB"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Übung"}, namesOf(found))
+		found, err = store.ListActivities(ActivityFilter{Query: "bUN", Match: MatchContains})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Übung"}, namesOf(found))
+	})
+}
+
+func TestListActivities(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store testStore) {
+		for _, name := range []string{"Trail running", "Running", "rowing", "Yoga", "100% effort"} {
+			if _, err := store.CreateActivity(&model.Activity{Name: name}); err != nil {
+				t.Fatalf("Failed to create activity: %v", err)
+			}
+		}
+
+		all, err := store.ListActivities(ActivityFilter{})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"100% effort", "rowing", "Running", "Trail running", "Yoga"}, namesOf(all))
+
+		prefix, err := store.ListActivities(ActivityFilter{Query: "R"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"rowing", "Running"}, namesOf(prefix))
+
+		contains, err := store.ListActivities(ActivityFilter{Query: "RUN", Match: MatchContains})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Running", "Trail running"}, namesOf(contains))
+
+		// Wildcards in the query match literally
+		literal, err := store.ListActivities(ActivityFilter{Query: "%", Match: MatchContains})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"100% effort"}, namesOf(literal))
+
+		page, err := store.ListActivities(ActivityFilter{Limit: 2, Offset: 2})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Running", "Trail running"}, namesOf(page))
+	})
+}
+
+func namesOf(activities []model.Activity) []string {
+	names := make([]string, 0, len(activities))
+	for _, activity := range activities {
+		names = append(names, activity.Name)
+	}
+	return names
+}
+
+func TestActivityAttributeSchema(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store testStore) {
+		min, max := 1.0, 10.0
+		schema := model.AttributeSchema{Fields: []model.AttributeField{
+			{Name: "pain", Type: model.AttributeNumber, Unit: "points", Min: &min, Max: &max, Required: true},
+			{Name: "surface", Type: model.AttributeEnum, Values: []string{"road", "trail"}},
+		}}
+		activityID, err := store.CreateActivity(&model.Activity{Name: "Running", AttributeSchema: schema})
+		if err != nil {
+			t.Fatalf("Failed to create activity: %v", err)
+		}
+
+		retrieved, err := store.GetActivity(0, activityID)
+		assert.NoError(t, err)
+		assert.Equal(t, schema, retrieved.AttributeSchema)
+
+		// Changing the returned activity does not change the stored one
+		retrieved.AttributeSchema.Fields[1].Values[0] = "track"
+		again, err := store.GetActivity(0, activityID)
+		assert.NoError(t, err)
+		assert.Equal(t, "road", again.AttributeSchema.Fields[1].Values[0])
+
+		retrieved.AttributeSchema = model.AttributeSchema{}
+		assert.NoError(t, store.UpdateActivity(retrieved))
+		updated, err := store.GetActivity(0, activityID)
+		assert.NoError(t, err)
+		assert.Empty(t, updated.AttributeSchema.Fields)
+	})
+}
+
+func TestActivityScopes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store testStore) {
+		userID, err := store.CreateUser(&model.User{Username: "private", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		otherID, err := store.CreateUser(&model.User{Username: "someone else", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+
+		globalID, err := store.CreateActivity(&model.Activity{Name: "Running"})
+		assert.NoError(t, err)
+		privateID, err := store.CreateActivity(&model.Activity{Name: "Rehab drills", OwnerID: &userID})
+		assert.NoError(t, err)
+		// Names are unique within the global catalog and within each user's activities
+		_, err = store.CreateActivity(&model.Activity{Name: "rehab drills", OwnerID: &userID})
+		assert.ErrorIs(t, err, ErrActivityNameTaken)
+		_, err = store.CreateActivity(&model.Activity{Name: "Rehab drills", OwnerID: &otherID})
+		assert.NoError(t, err)
+		_, err = store.CreateActivity(&model.Activity{Name: "Running", OwnerID: &otherID})
+		assert.NoError(t, err)
+
+		activity, err := store.GetActivity(userID, privateID)
+		assert.NoError(t, err)
+		assert.Equal(t, userID, *activity.OwnerID)
+		_, err = store.GetActivity(otherID, privateID)
+		assert.ErrorIs(t, err, ErrActivityNotFound)
+		activity, err = store.GetActivity(otherID, globalID)
+		assert.NoError(t, err)
+		assert.Nil(t, activity.OwnerID)
+
+		names := func(filter ActivityFilter) []string {
+			t.Helper()
+			activities, err := store.ListActivities(filter)
+			assert.NoError(t, err)
+			names := []string{}
+			for _, activity := range activities {
+				names = append(names, activity.Name)
+			}
+			return names
+		}
+		assert.Equal(t, []string{"Rehab drills", "Running"}, names(ActivityFilter{UserID: userID}))
+		assert.Equal(t, []string{"Running"}, names(ActivityFilter{UserID: userID, Scope: ScopeGlobal}))
+		assert.Equal(t, []string{"Rehab drills"}, names(ActivityFilter{UserID: userID, Scope: ScopePrivate}))
+		assert.Equal(t, []string{"Rehab drills", "Running", "Running"}, names(ActivityFilter{UserID: otherID}))
+
+		// Only the owner can record a private activity
+		start := time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC)
+		record := func(userID, activityID int64) error {
+			_, _, err := store.CreateUserActivity(&model.UserActivity{UserID: userID, ActivityID: activityID, StartTime: start,
+				EndTime: start.Add(time.Hour), Duration: time.Hour, Mood: 3})
+			return err
+		}
+		assert.ErrorIs(t, record(otherID, privateID), ErrInvalidReference)
+		assert.NoError(t, record(userID, privateID))
+
+		// The owner cannot be changed by an update
+		assert.NoError(t, store.UpdateActivity(&model.Activity{ID: privateID, Name: "Knee rehab"}))
+		activity, err = store.GetActivity(userID, privateID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Knee rehab", activity.Name)
+		assert.Equal(t, userID, *activity.OwnerID)
+
+		assert.NoError(t, store.SetUserAdmin(otherID, true))
+		user, err := store.GetUser(otherID)
+		assert.NoError(t, err)
+		assert.True(t, user.IsAdmin)
+		assert.ErrorIs(t, store.SetUserAdmin(999, true), ErrUserNotFound)
+		// There is always an admin left to grant admin rights
+		assert.ErrorIs(t, store.SetUserAdmin(otherID, false), ErrLastAdmin)
+		assert.NoError(t, store.SetUserAdmin(userID, false))
+		assert.NoError(t, store.SetUserAdmin(userID, true))
+		assert.NoError(t, store.SetUserAdmin(otherID, false))
+		user, err = store.GetUser(otherID)
+		assert.NoError(t, err)
+		assert.False(t, user.IsAdmin)
+
+		// Private activities are deleted with their owner, even when recorded
+		assert.NoError(t, store.DeleteUser(userID))
+		_, err = store.GetActivity(userID, privateID)
+		assert.ErrorIs(t, err, ErrActivityNotFound)
+		_, err = store.GetActivity(otherID, globalID)
+		assert.NoError(t, err)
+	})
+}
+
+func TestPrivateActivitiesInTimersAndGoals(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store testStore) {
+		userID, err := store.CreateUser(&model.User{Username: "private", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		otherID, err := store.CreateUser(&model.User{Username: "someone else", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		globalID, err := store.CreateActivity(&model.Activity{Name: "Running"})
+		assert.NoError(t, err)
+		privateID, err := store.CreateActivity(&model.Activity{Name: "Rehab drills", OwnerID: &userID})
+		assert.NoError(t, err)
+		start := time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC)
+
+		// Only the owner can time a private activity
+		_, err = store.CreateTimer(model.NewTimer(otherID, privateID, start))
+		assert.ErrorIs(t, err, ErrInvalidReference)
+		_, err = store.CreateTimer(model.NewTimer(userID, privateID, start))
+		assert.NoError(t, err)
+
+		// or set a goal for it
+		goal := model.Goal{UserID: otherID, ActivityID: &privateID, Metric: model.MetricCount, Period: model.GoalWeekly, Target: 3, CreatedAt: start}
+		_, err = store.CreateGoal(&goal)
+		assert.ErrorIs(t, err, ErrInvalidReference)
+		goal.ActivityID = &globalID
+		goal.ID, err = store.CreateGoal(&goal)
+		assert.NoError(t, err)
+		goal.ActivityID = &privateID
+		assert.ErrorIs(t, store.UpdateGoal(&goal), ErrInvalidReference)
+		stored, err := store.GetGoal(otherID, goal.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, globalID, *stored.ActivityID)
+
+		goal.UserID = userID
+		_, err = store.CreateGoal(&goal)
+		assert.NoError(t, err)
+	})
+}
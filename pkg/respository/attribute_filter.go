@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"activity-tracker/pkg/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidAttributeFilter is returned when an attribute filter names an
+// attribute that cannot exist or compares it to an unsupported value.
+var ErrInvalidAttributeFilter = errors.New("invalid attribute filter")
+
+// AttributeFilter selects user activities by the value of one of their
+// additional attributes. Every condition that is set must hold.
+type AttributeFilter struct {
+	Name   string
+	Equals []interface{} // string, float64 or bool values, any of which matches
+	Min    *float64      // inclusive; only numbers match
+	Max    *float64      // inclusive; only numbers match
+	Exists *bool
+}
+
+// validateAttributeFilters checks that the filters name valid attributes and
+// only compare them to strings, numbers and booleans.
+func validateAttributeFilters(filters []AttributeFilter) error {
+	for _, filter := range filters {
+		if !model.ValidAttributeName(filter.Name) {
+			return fmt.Errorf("%w: %q is not a valid attribute name", ErrInvalidAttributeFilter, filter.Name)
+		}
+		for _, value := range filter.Equals {
+			switch value.(type) {
+			case string, float64, bool:
+			default:
+				return fmt.Errorf("%w: cannot compare %q to %T", ErrInvalidAttributeFilter, filter.Name, value)
+			}
+		}
+	}
+	return nil
+}
+
+// attributeConditions returns the SQL conditions for valid attribute filters,
+// adding their arguments to args. Postgres uses JSONB operators, so that
+// equality and existence can use the GIN index on additional_attributes;
+// SQLite uses its JSON functions.
+func (r *Repository) attributeConditions(args *queryArgs, filters []AttributeFilter) []string {
+	var conditions []string
+	for _, filter := range filters {
+		if r.dialect == Postgres {
+			conditions = append(conditions, postgresAttributeConditions(args, filter)...)
+		} else {
+			conditions = append(conditions, sqliteAttributeConditions(args, filter)...)
+		}
+	}
+	return conditions
+}
+
+// postgresAttributeConditions returns the conditions of one attribute filter
+// for Postgres.
+func postgresAttributeConditions(args *queryArgs, filter AttributeFilter) []string {
+	var conditions []string
+	if len(filter.Equals) > 0 {
+		alternatives := make([]string, 0, len(filter.Equals))
+		for _, value := range filter.Equals {
+			// Scalars always encode
+			contained, _ := json.Marshal(map[string]interface{}{filter.Name: value})
+			alternatives = append(alternatives, "additional_attributes @> "+args.add(string(contained))+"::jsonb")
+		}
+		conditions = append(conditions, "("+strings.Join(alternatives, " OR ")+")")
+	}
+	// Only numbers are compared, so other values never fail the cast
+	number := func() string {
+		return fmt.Sprintf("CASE WHEN jsonb_typeof(additional_attributes -> %s::text) = 'number' THEN (additional_attributes ->> %s::text)::numeric END",
+			args.add(filter.Name), args.add(filter.Name))
+	}
+	if filter.Min != nil {
+		conditions = append(conditions, number()+" >= "+args.add(*filter.Min)+"::numeric")
+	}
+	if filter.Max != nil {
+		conditions = append(conditions, number()+" <= "+args.add(*filter.Max)+"::numeric")
+	}
+	if filter.Exists != nil {
+		exists := "additional_attributes ? " + args.add(filter.Name) + "::text"
+		if !*filter.Exists {
+			exists = "NOT (" + exists + ")"
+		}
+		conditions = append(conditions, exists)
+	}
+	return conditions
+}
+
+// sqliteAttributeConditions returns the conditions of one attribute filter
+// for SQLite. Attribute names are quoted in the JSON path, which is safe as
+// they only contain letters, digits and underscores.
+func sqliteAttributeConditions(args *queryArgs, filter AttributeFilter) []string {
+	path := `$."` + filter.Name + `"`
+	var conditions []string
+	if len(filter.Equals) > 0 {
+		alternatives := make([]string, 0, len(filter.Equals))
+		for _, value := range filter.Equals {
+			var alternative string
+			switch value := value.(type) {
+			case string:
+				alternative = fmt.Sprintf("(json_type(additional_attributes, %s) = 'text' AND json_extract(additional_attributes, %s) = %s)",
+					args.add(path), args.add(path), args.add(value))
+			case float64:
+				alternative = fmt.Sprintf("(json_type(additional_attributes, %s) IN ('integer', 'real') AND json_extract(additional_attributes, %s) = %s)",
+					args.add(path), args.add(path), args.add(value))
+			case bool:
+				alternative = fmt.Sprintf("json_type(additional_attributes, %s) = %s", args.add(path), args.add(fmt.Sprint(value)))
+			}
+			alternatives = append(alternatives, alternative)
+		}
+		conditions = append(conditions, "("+strings.Join(alternatives, " OR ")+")")
+	}
+	number := func() string {
+		return fmt.Sprintf("CASE WHEN json_type(additional_attributes, %s) IN ('integer', 'real') THEN json_extract(additional_attributes, %s) END",
+			args.add(path), args.add(path))
+	}
+	if filter.Min != nil {
+		conditions = append(conditions, number()+" >= "+args.add(*filter.Min))
+	}
+	if filter.Max != nil {
+		conditions = append(conditions, number()+" <= "+args.add(*filter.Max))
+	}
+	if filter.Exists != nil {
+		test := "IS NOT NULL"
+		if !*filter.Exists {
+			test = "IS NULL"
+		}
+		conditions = append(conditions, "json_type(additional_attributes, "+args.add(path)+") "+test)
+	}
+	return conditions
+}
+
+// matches reports whether the attributes of a user activity are selected by
+// the filter.
+func (filter AttributeFilter) matches(attributes model.AdditionalAttributes) bool {
+	value, present := attributes[filter.Name]
+	if filter.Exists != nil && *filter.Exists != present {
+		return false
+	}
+	if len(filter.Equals) > 0 {
+		equal := false
+		for _, candidate := range filter.Equals {
+			equal = equal || value == candidate
+		}
+		if !equal {
+			return false
+		}
+	}
+	number, isNumber := value.(float64)
+	if filter.Min != nil && (!isNumber || number < *filter.Min) {
+		return false
+	}
+	if filter.Max != nil && (!isNumber || number > *filter.Max) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"activity-tracker/pkg/model"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrCategoryNotFound is returned when the category is not found in the database.
+var ErrCategoryNotFound = errors.New("category not found")
+
+// ErrCategoryNameTaken is returned when another category with the same parent
+// already has the same name, compared case-insensitively.
+var ErrCategoryNameTaken = errors.New("a category with this name already exists under the same parent")
+
+// ErrCategoryInUse is returned when deleting a category that still has
+// subcategories or activities.
+var ErrCategoryInUse = errors.New("category still has subcategories or activities")
+
+// ErrCategoryCycle is returned when moving a category under itself or one of
+// its descendants.
+var ErrCategoryCycle = errors.New("a category cannot be moved under itself or its descendants")
+
+// CreateCategory creates a new category in the database.
+func (r *Repository) CreateCategory(category *model.Category) (int64, error) {
+	var id int64
+	query := `INSERT INTO categories (name, parent_id) VALUES ($1, $2) RETURNING id`
+	err := r.db.QueryRow(query, category.Name, category.ParentID).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, ErrCategoryNameTaken
+	} else if err != nil {
+		return 0, fmt.Errorf("could not create category: %w", translateError(err))
+	}
+	return id, nil
+}
+
+// categoryColumns lists the columns read by scanCategory, in order.
+const categoryColumns = `id, name, parent_id`
+
+// scanCategory reads a category selected with categoryColumns.
+func scanCategory(row rowScanner) (*model.Category, error) {
+	category := &model.Category{}
+	if err := row.Scan(&category.ID, &category.Name, &category.ParentID); err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// GetCategory retrieves a category by ID from the database.
+func (r *Repository) GetCategory(categoryID int64) (*model.Category, error) {
+	query := `SELECT ` + categoryColumns + ` FROM categories WHERE id = $1`
+	category, err := scanCategory(r.db.QueryRow(query, categoryID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrCategoryNotFound
+		}
+		return nil, fmt.Errorf("could not get category: %w", err)
+	}
+	return category, nil
+}
+
+// ListCategories returns every category ordered case-insensitively by name
+// and then by ID. Parents are not necessarily listed before their children.
+func (r *Repository) ListCategories() ([]model.Category, error) {
+	query := `SELECT ` + categoryColumns + ` FROM categories ORDER BY ` + r.lower("name") + `, id`
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("could not list categories: %w", err)
+	}
+	defer rows.Close()
+
+	categories := []model.Category{}
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not list categories: %w", err)
+		}
+		categories = append(categories, *category)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not list categories: %w", err)
+	}
+	return categories, nil
+}
+
+// maxCategoryDepth bounds the recursive category queries, so that they end
+// even if the tree were ever to contain a cycle.
+const maxCategoryDepth = 100
+
+// UpdateCategory renames a category or moves it under another parent. It
+// cannot be moved under itself or one of its descendants. On Postgres the
+// categories table is locked against other writes first, so that concurrent
+// moves cannot each pass the check and together create a cycle; SQLite
+// transactions are serialized already.
+func (r *Repository) UpdateCategory(category *model.Category) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not update category: %w", err)
+	}
+	defer tx.Rollback()
+
+	if r.dialect == Postgres {
+		if _, err := tx.Exec(`LOCK TABLE categories IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+			return fmt.Errorf("could not lock categories: %w", err)
+		}
+	}
+	if category.ParentID != nil {
+		query := `WITH RECURSIVE subtree (id, depth) AS (
+				SELECT id, 0 FROM categories WHERE id = $1
+				UNION ALL
+				SELECT categories.id, subtree.depth + 1 FROM categories JOIN subtree ON categories.parent_id = subtree.id
+				WHERE subtree.depth < ` + strconv.Itoa(maxCategoryDepth) + `
+			  )
+			  SELECT COUNT(*) FROM subtree WHERE id = $2`
+		var descendants int
+		if err := tx.QueryRow(query, category.ID, *category.ParentID).Scan(&descendants); err != nil {
+			return fmt.Errorf("could not update category: %w", err)
+		}
+		if descendants > 0 {
+			return ErrCategoryCycle
+		}
+	}
+
+	query := `UPDATE categories SET name = $1, parent_id = $2 WHERE id = $3`
+	result, err := tx.Exec(query, category.Name, category.ParentID, category.ID)
+	if isUniqueViolation(err) {
+		return ErrCategoryNameTaken
+	} else if err != nil {
+		return fmt.Errorf("could not update category: %w", translateError(err))
+	}
+	if err := expectAffected(result, ErrCategoryNotFound); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not update category: %w", err)
+	}
+	return nil
+}
+
+// DeleteCategory deletes a category by ID from the database. Categories that
+// still have subcategories or activities cannot be deleted.
+func (r *Repository) DeleteCategory(categoryID int64) error {
+	query := `DELETE FROM categories WHERE id = $1`
+	result, err := r.db.Exec(query, categoryID)
+	if isForeignKeyViolation(err) {
+		return ErrCategoryInUse
+	} else if err != nil {
+		return fmt.Errorf("could not delete category: %w", translateError(err))
+	}
+	return expectAffected(result, ErrCategoryNotFound)
+}
+
+// categoryRollupSQL returns a recursive common table expression named
+// category_rollup that maps every category below root, or every category if
+// root is nil, to the category its statistics roll up to: the child of root
+// it descends from, or the top-level category if root is nil. root itself
+// rolls up to itself.
+func categoryRollupSQL(args *queryArgs, root *int64) string {
+	// Depth 0 is root itself, whose children start buckets of their own
+	anchor := `SELECT id, id, 1 FROM categories WHERE parent_id IS NULL`
+	if root != nil {
+		anchor = `SELECT id, id, 0 FROM categories WHERE id = ` + args.add(*root)
+	}
+	return `WITH RECURSIVE category_rollup (id, bucket, depth) AS (
+				` + anchor + `
+				UNION ALL
+				SELECT categories.id, CASE WHEN category_rollup.depth = 0 THEN categories.id ELSE category_rollup.bucket END, category_rollup.depth + 1
+				FROM categories JOIN category_rollup ON categories.parent_id = category_rollup.id
+				WHERE category_rollup.depth < ` + strconv.Itoa(maxCategoryDepth) + `
+			  ) `
+}
+
+// rollUpCategory returns the category that statistics of activities in
+// categoryID roll up to, as categoryRollupSQL does, and false if categoryID
+// is not below root. Callers must hold the lock.
+func (r *MemoryRepository) rollUpCategory(categoryID int64, root *int64) (int64, bool) {
+	path := r.categoryPath(categoryID)
+	if root == nil {
+		return path[len(path)-1], true
+	}
+	for i, ancestorID := range path {
+		if ancestorID == *root {
+			if i == 0 {
+				return ancestorID, true
+			}
+			return path[i-1], true
+		}
+	}
+	return 0, false
+}
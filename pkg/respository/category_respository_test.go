@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"activity-tracker/pkg/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCategories(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store testStore) {
+		cardioID, err := store.CreateCategory(&model.Category{Name: "Cardio"})
+		assert.NoError(t, err)
+		runningID, err := store.CreateCategory(&model.Category{Name: "Running", ParentID: &cardioID})
+		assert.NoError(t, err)
+		trailID, err := store.CreateCategory(&model.Category{Name: "Trail running", ParentID: &runningID})
+		assert.NoError(t, err)
+		strengthID, err := store.CreateCategory(&model.Category{Name: "Strength"})
+		assert.NoError(t, err)
+
+		// Names are unique among siblings regardless of case
+		_, err = store.CreateCategory(&model.Category{Name: "cardio"})
+		assert.ErrorIs(t, err, ErrCategoryNameTaken)
+		_, err = store.CreateCategory(&model.Category{Name: "Running", ParentID: &strengthID})
+		assert.NoError(t, err)
+		missingID := int64(999)
+		_, err = store.CreateCategory(&model.Category{Name: "Swimming", ParentID: &missingID})
+		assert.ErrorIs(t, err, ErrInvalidReference)
+
+		category, err := store.GetCategory(trailID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Trail running", category.Name)
+		assert.Equal(t, runningID, *category.ParentID)
+		_, err = store.GetCategory(missingID)
+		assert.ErrorIs(t, err, ErrCategoryNotFound)
+
+		// A category cannot be moved under itself or its descendants
+		assert.ErrorIs(t, store.UpdateCategory(&model.Category{ID: cardioID, Name: "Cardio", ParentID: &cardioID}), ErrCategoryCycle)
+		assert.ErrorIs(t, store.UpdateCategory(&model.Category{ID: cardioID, Name: "Cardio", ParentID: &trailID}), ErrCategoryCycle)
+		assert.ErrorIs(t, store.UpdateCategory(&model.Category{ID: missingID, Name: "Swimming"}), ErrCategoryNotFound)
+		assert.ErrorIs(t, store.UpdateCategory(&model.Category{ID: strengthID, Name: "CARDIO"}), ErrCategoryNameTaken)
+		assert.NoError(t, store.UpdateCategory(&model.Category{ID: trailID, Name: "Trail running", ParentID: &cardioID}))
+
+		categories, err := store.ListCategories()
+		assert.NoError(t, err)
+		if assert.Len(t, categories, 5) {
+			assert.Equal(t, "Cardio", categories[0].Name)
+			assert.Nil(t, categories[0].ParentID)
+			assert.Equal(t, "Trail running", categories[4].Name)
+			assert.Equal(t, cardioID, *categories[4].ParentID)
+		}
+
+		// Categories with subcategories or activities cannot be deleted
+		_, err = store.CreateActivity(&model.Activity{Name: "Trail run", CategoryID: &trailID})
+		assert.NoError(t, err)
+		_, err = store.CreateActivity(&model.Activity{Name: "Swim", CategoryID: &missingID})
+		assert.ErrorIs(t, err, ErrInvalidReference)
+		assert.ErrorIs(t, store.DeleteCategory(cardioID), ErrCategoryInUse)
+		assert.ErrorIs(t, store.DeleteCategory(trailID), ErrCategoryInUse)
+		assert.ErrorIs(t, store.DeleteCategory(missingID), ErrCategoryNotFound)
+		assert.NoError(t, store.DeleteCategory(runningID))
+		_, err = store.GetCategory(runningID)
+		assert.ErrorIs(t, err, ErrCategoryNotFound)
+	})
+}
+
+func TestUserActivityStatsByCategory(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store testStore) {
+		userID, err := store.CreateUser(&model.User{Username: "roller", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		createCategory := func(name string, parentID *int64) int64 {
+			t.Helper()
+			id, err := store.CreateCategory(&model.Category{Name: name, ParentID: parentID})
+			if err != nil {
+				t.Fatalf("Failed to create category: %v", err)
+			}
+			return id
+		}
+		cardioID := createCategory("Cardio", nil)
+		runningID := createCategory("Running", &cardioID)
+		trailID := createCategory("Trail running", &runningID)
+		cyclingID := createCategory("Cycling", &cardioID)
+		strengthID := createCategory("Strength", nil)
+
+		createActivity := func(name string, categoryID *int64) int64 {
+			t.Helper()
+			id, err := store.CreateActivity(&model.Activity{Name: name, CategoryID: categoryID})
+			if err != nil {
+				t.Fatalf("Failed to create activity: %v", err)
+			}
+			return id
+		}
+		record := func(activityID int64, day, minutes int) {
+			t.Helper()
+			start := time.Date(2024, 4, day, 7, 0, 0, 0, time.UTC)
+			duration := time.Duration(minutes) * time.Minute
+			_, _, err := store.CreateUserActivity(&model.UserActivity{
+				UserID: userID, ActivityID: activityID, StartTime: start, EndTime: start.Add(duration), Duration: duration, Mood: 3,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create user activity: %v", err)
+			}
+		}
+		record(createActivity("Jogging", &cardioID), 1, 10)
+		record(createActivity("Road run", &runningID), 2, 20)
+		record(createActivity("Trail run", &trailID), 3, 40)
+		record(createActivity("Commute", &cyclingID), 4, 30)
+		record(createActivity("Deadlifts", &strengthID), 5, 50)
+		record(createActivity("Walking", nil), 6, 60)
+
+		filter := StatsFilter{
+			UserID: userID,
+			From:   time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+			To:     time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+			Period: PeriodMonth,
+		}
+		durations := func(filter StatsFilter) map[int64]time.Duration {
+			t.Helper()
+			buckets, err := store.UserActivityStats(filter)
+			assert.NoError(t, err)
+			result := make(map[int64]time.Duration)
+			for _, bucket := range buckets {
+				result[bucket.CategoryID] = bucket.TotalDuration
+			}
+			return result
+		}
+
+		// Top-level categories, leaving out uncategorized activities
+		filter.ByCategory = true
+		assert.Equal(t, map[int64]time.Duration{cardioID: 100 * time.Minute, strengthID: 50 * time.Minute}, durations(filter))
+		// The children of Cardio, and Cardio itself
+		filter.CategoryID = &cardioID
+		assert.Equal(t, map[int64]time.Duration{
+			cardioID: 10 * time.Minute, runningID: 60 * time.Minute, cyclingID: 30 * time.Minute,
+		}, durations(filter))
+		filter.CategoryID = &trailID
+		assert.Equal(t, map[int64]time.Duration{trailID: 40 * time.Minute}, durations(filter))
+		// Only the activities below Running, not grouped
+		filter.CategoryID, filter.ByCategory = &runningID, false
+		assert.Equal(t, map[int64]time.Duration{0: 60 * time.Minute}, durations(filter))
+		filter.CategoryID = nil
+		assert.Equal(t, map[int64]time.Duration{0: 210 * time.Minute}, durations(filter))
+	})
+}
@@ -0,0 +1,327 @@
+package repository
+
+import (
+	"activity-tracker/pkg/model"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrGoalNotFound is returned when the goal is not found in the database.
+var ErrGoalNotFound = errors.New("goal not found")
+
+// CreateGoal creates a new goal in the database. Its CreatedAt is stored as
+// given, since progress is only tracked from the period it falls in. Its
+// activity, if it has one, must be global or private to the user.
+func (r *Repository) CreateGoal(goal *model.Goal) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("could not create goal: %w", err)
+	}
+	defer tx.Rollback()
+
+	if goal.ActivityID != nil {
+		if err := checkActivityVisible(tx, goal.UserID, *goal.ActivityID); err != nil {
+			return 0, fmt.Errorf("could not create goal: %w", err)
+		}
+	}
+	var id int64
+	query := `INSERT INTO goals (user_id, activity_id, metric, attribute, period, target, created_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+	err = tx.QueryRow(query, goal.UserID, goal.ActivityID, string(goal.Metric), goal.Attribute, string(goal.Period),
+		goal.Target, goal.CreatedAt.UTC()).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("could not create goal: %w", translateError(err))
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("could not create goal: %w", err)
+	}
+	return id, nil
+}
+
+// goalColumns lists the columns read by scanGoal, in order.
+const goalColumns = `id, user_id, activity_id, metric, attribute, period, target, created_at`
+
+// scanGoal reads a goal selected with goalColumns.
+func scanGoal(row rowScanner) (*model.Goal, error) {
+	goal := &model.Goal{}
+	err := row.Scan(&goal.ID, &goal.UserID, &goal.ActivityID, &goal.Metric, &goal.Attribute, &goal.Period,
+		&goal.Target, &goal.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return goal, nil
+}
+
+// GetGoal retrieves a goal by ID from the database. Only a goal owned by
+// userID is returned.
+func (r *Repository) GetGoal(userID, goalID int64) (*model.Goal, error) {
+	query := `SELECT ` + goalColumns + ` FROM goals WHERE id = $1 AND user_id = $2`
+	goal, err := scanGoal(r.db.QueryRow(query, goalID, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrGoalNotFound
+		}
+		return nil, fmt.Errorf("could not get goal: %w", err)
+	}
+	return goal, nil
+}
+
+// ListGoals returns all of a user's goals, oldest first.
+func (r *Repository) ListGoals(userID int64) ([]model.Goal, error) {
+	query := `SELECT ` + goalColumns + ` FROM goals WHERE user_id = $1 ORDER BY id`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("could not list goals: %w", err)
+	}
+	defer rows.Close()
+
+	goals := []model.Goal{}
+	for rows.Next() {
+		goal, err := scanGoal(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not list goals: %w", err)
+		}
+		goals = append(goals, *goal)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not list goals: %w", err)
+	}
+	return goals, nil
+}
+
+// UpdateGoal saves the activity, metric, period and target of a goal owned by
+// goal.UserID. Its creation time does not change. The activity is checked as
+// CreateGoal does.
+func (r *Repository) UpdateGoal(goal *model.Goal) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not update goal: %w", err)
+	}
+	defer tx.Rollback()
+
+	if goal.ActivityID != nil {
+		if err := checkActivityVisible(tx, goal.UserID, *goal.ActivityID); err != nil {
+			return fmt.Errorf("could not update goal: %w", err)
+		}
+	}
+	query := `UPDATE goals SET activity_id = $1, metric = $2, attribute = $3, period = $4, target = $5
+			  WHERE id = $6 AND user_id = $7`
+	result, err := tx.Exec(query, goal.ActivityID, string(goal.Metric), goal.Attribute, string(goal.Period),
+		goal.Target, goal.ID, goal.UserID)
+	if err != nil {
+		return fmt.Errorf("could not update goal: %w", translateError(err))
+	}
+	if err := expectAffected(result, ErrGoalNotFound); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not update goal: %w", err)
+	}
+	return nil
+}
+
+// DeleteGoal deletes a goal owned by userID from the database.
+func (r *Repository) DeleteGoal(userID, goalID int64) error {
+	query := `DELETE FROM goals WHERE id = $1 AND user_id = $2`
+	result, err := r.db.Exec(query, goalID, userID)
+	if err != nil {
+		return fmt.Errorf("could not delete goal: %w", err)
+	}
+	return expectAffected(result, ErrGoalNotFound)
+}
+
+// GoalProgressFilter selects the periods that a goal's progress is computed
+// for: the one containing Now and up to History periods before it, but none
+// before the period the goal was created in. Periods are calendar periods in
+// Location, or in UTC if it is nil.
+type GoalProgressFilter struct {
+	Goal     model.Goal
+	Now      time.Time
+	History  int
+	Location *time.Location
+}
+
+// location returns the time zone that the filter's periods are in.
+func (f GoalProgressFilter) location() *time.Location {
+	if f.Location == nil {
+		return time.UTC
+	}
+	return f.Location
+}
+
+// periods returns the starts of the filter's periods, oldest first, and the
+// end of the last one.
+func (f GoalProgressFilter) periods() ([]time.Time, time.Time, error) {
+	period := StatsPeriod(f.Goal.Period)
+	current, err := periodStartOf(f.Now, period, f.location())
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	created, err := periodStartOf(f.Goal.CreatedAt, period, f.location())
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	starts := []time.Time{current}
+	for len(starts) <= f.History {
+		previous := addPeriods(starts[0], period, -1)
+		if previous.Before(created) {
+			break
+		}
+		starts = append([]time.Time{previous}, starts...)
+	}
+	return starts, addPeriods(current, period, 1), nil
+}
+
+// addPeriods moves a local midnight period start n periods on. Calendar
+// arithmetic keeps it at midnight across daylight saving time changes.
+func addPeriods(start time.Time, period StatsPeriod, n int) time.Time {
+	switch period {
+	case PeriodWeek:
+		return start.AddDate(0, 0, 7*n)
+	case PeriodMonth:
+		return start.AddDate(0, n, 0)
+	}
+	return start.AddDate(0, 0, n)
+}
+
+// GoalProgress is what a goal's metric measured in one period.
+type GoalProgress struct {
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+	Value       float64
+}
+
+// newGoalProgress returns the progress of every period of the filter, oldest
+// first, taking the values of periods with activities from values by their
+// start formatted as periodStartFormat.
+func newGoalProgress(starts []time.Time, end time.Time, values map[string]float64) []GoalProgress {
+	progress := make([]GoalProgress, 0, len(starts))
+	for i, start := range starts {
+		periodEnd := end
+		if i+1 < len(starts) {
+			periodEnd = starts[i+1]
+		}
+		progress = append(progress, GoalProgress{PeriodStart: start, PeriodEnd: periodEnd, Value: values[start.Format(periodStartFormat)]})
+	}
+	return progress
+}
+
+// goalMetricSQL returns the SQL aggregate for a goal's metric, adding the
+// attribute it sums to args. Attributes that are missing or not numbers add
+// nothing.
+func (r *Repository) goalMetricSQL(args *queryArgs, goal model.Goal) (string, error) {
+	switch goal.Metric {
+	case model.MetricCount:
+		return `COUNT(*)`, nil
+	case model.MetricDuration:
+		return `SUM(duration_seconds)`, nil
+	case model.MetricAttributeSum:
+		if !model.ValidAttributeName(goal.Attribute) {
+			return "", fmt.Errorf("goal attribute %q is not a valid attribute name", goal.Attribute)
+		}
+		if r.dialect == Postgres {
+			return fmt.Sprintf(`SUM(CASE WHEN jsonb_typeof(additional_attributes -> %s::text) = 'number' THEN (additional_attributes ->> %s::text)::numeric ELSE 0 END)`,
+				args.add(goal.Attribute), args.add(goal.Attribute)), nil
+		}
+		path := `$."` + goal.Attribute + `"`
+		return fmt.Sprintf(`SUM(CASE WHEN json_type(additional_attributes, %s) IN ('integer', 'real') THEN json_extract(additional_attributes, %s) ELSE 0 END)`,
+			args.add(path), args.add(path)), nil
+	}
+	return "", fmt.Errorf("unknown goal metric %q", goal.Metric)
+}
+
+// GoalProgress returns what the goal's metric measured in each of the
+// filter's periods, oldest first, ending with the current period.
+func (r *Repository) GoalProgress(filter GoalProgressFilter) ([]GoalProgress, error) {
+	starts, end, err := filter.periods()
+	if err != nil {
+		return nil, err
+	}
+
+	var args queryArgs
+	periodStart, err := r.periodStartSQL(&args, StatsPeriod(filter.Goal.Period), filter.location())
+	if err != nil {
+		return nil, err
+	}
+	metric, err := r.goalMetricSQL(&args, filter.Goal)
+	if err != nil {
+		return nil, err
+	}
+	conditions := fmt.Sprintf(`user_id = %s AND start_time >= %s AND start_time < %s`,
+		args.add(filter.Goal.UserID), args.add(starts[0].UTC()), args.add(end.UTC()))
+	if filter.Goal.ActivityID != nil {
+		conditions += fmt.Sprintf(` AND activity_id = %s`, args.add(*filter.Goal.ActivityID))
+	}
+
+	query := fmt.Sprintf(`SELECT %s AS period_start, %s FROM user_activities WHERE %s GROUP BY 1`, periodStart, metric, conditions)
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not compute goal progress: %w", err)
+	}
+	defer rows.Close()
+
+	values := make(map[string]float64)
+	for rows.Next() {
+		var periodStart string
+		var value float64
+		if err := rows.Scan(&periodStart, &value); err != nil {
+			return nil, fmt.Errorf("could not compute goal progress: %w", err)
+		}
+		values[periodStart] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not compute goal progress: %w", err)
+	}
+	return newGoalProgress(starts, end, values), nil
+}
+
+// GoalProgress returns what the goal's metric measured in each period as
+// Repository does.
+func (r *MemoryRepository) GoalProgress(filter GoalProgressFilter) ([]GoalProgress, error) {
+	starts, end, err := filter.periods()
+	if err != nil {
+		return nil, err
+	}
+	goal := filter.Goal
+	switch goal.Metric {
+	case model.MetricCount, model.MetricDuration:
+	case model.MetricAttributeSum:
+		if !model.ValidAttributeName(goal.Attribute) {
+			return nil, fmt.Errorf("goal attribute %q is not a valid attribute name", goal.Attribute)
+		}
+	default:
+		return nil, fmt.Errorf("unknown goal metric %q", goal.Metric)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	values := make(map[string]float64)
+	for _, userActivity := range r.userActivities {
+		if userActivity.UserID != goal.UserID || userActivity.StartTime.Before(starts[0]) || !userActivity.StartTime.Before(end) {
+			continue
+		}
+		if goal.ActivityID != nil && userActivity.ActivityID != *goal.ActivityID {
+			continue
+		}
+		periodStart, err := periodStartOf(userActivity.StartTime, StatsPeriod(goal.Period), filter.location())
+		if err != nil {
+			return nil, err
+		}
+		key := periodStart.Format(periodStartFormat)
+		switch goal.Metric {
+		case model.MetricCount:
+			values[key]++
+		case model.MetricDuration:
+			values[key] += userActivity.Duration.Seconds()
+		case model.MetricAttributeSum:
+			// Stored numbers are always float64
+			number, _ := userActivity.AdditionalAttributes[goal.Attribute].(float64)
+			values[key] += number
+		}
+	}
+	return newGoalProgress(starts, end, values), nil
+}
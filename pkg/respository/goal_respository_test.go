@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"activity-tracker/pkg/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoals(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store testStore) {
+		userID, err := store.CreateUser(&model.User{Username: "achiever", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		otherID, err := store.CreateUser(&model.User{Username: "someone else", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		runningID, err := store.CreateActivity(&model.Activity{Name: "Running"})
+		if err != nil {
+			t.Fatalf("Failed to create activity: %v", err)
+		}
+
+		created := time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC)
+		goal := model.Goal{UserID: userID, ActivityID: &runningID, Metric: model.MetricDuration, Period: model.GoalWeekly, Target: 9000, CreatedAt: created}
+		goalID, err := store.CreateGoal(&goal)
+		assert.NoError(t, err)
+		goal.ID = goalID
+
+		stored, err := store.GetGoal(userID, goalID)
+		assert.NoError(t, err)
+		assert.Equal(t, runningID, *stored.ActivityID)
+		assert.Equal(t, model.MetricDuration, stored.Metric)
+		assert.Equal(t, model.GoalWeekly, stored.Period)
+		assert.Equal(t, 9000.0, stored.Target)
+		assert.True(t, created.Equal(stored.CreatedAt))
+
+		_, err = store.GetGoal(otherID, goalID)
+		assert.ErrorIs(t, err, ErrGoalNotFound)
+		missing := int64(9999)
+		_, err = store.CreateGoal(&model.Goal{UserID: userID, ActivityID: &missing, Metric: model.MetricCount, Period: model.GoalDaily, Target: 1, CreatedAt: created})
+		assert.ErrorIs(t, err, ErrInvalidReference)
+
+		// Goals keep their activity from being deleted
+		assert.ErrorIs(t, store.DeleteActivity(runningID), ErrActivityInUse)
+
+		goal.Target = 7200
+		assert.NoError(t, store.UpdateGoal(&goal))
+		goal.UserID = otherID
+		assert.ErrorIs(t, store.UpdateGoal(&goal), ErrGoalNotFound)
+		goal.UserID = userID
+
+		anyID, err := store.CreateGoal(&model.Goal{UserID: userID, Metric: model.MetricCount, Period: model.GoalDaily, Target: 2, CreatedAt: created})
+		assert.NoError(t, err)
+		goals, err := store.ListGoals(userID)
+		assert.NoError(t, err)
+		if assert.Len(t, goals, 2) {
+			assert.Equal(t, 7200.0, goals[0].Target)
+			assert.Nil(t, goals[1].ActivityID)
+		}
+		goals, err = store.ListGoals(otherID)
+		assert.NoError(t, err)
+		assert.Empty(t, goals)
+
+		assert.ErrorIs(t, store.DeleteGoal(otherID, anyID), ErrGoalNotFound)
+		assert.NoError(t, store.DeleteGoal(userID, anyID))
+		_, err = store.GetGoal(userID, anyID)
+		assert.ErrorIs(t, err, ErrGoalNotFound)
+	})
+}
+
+func TestGoalProgress(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store testStore) {
+		userID, err := store.CreateUser(&model.User{Username: "achiever", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		runningID, err := store.CreateActivity(&model.Activity{Name: "Running"})
+		if err != nil {
+			t.Fatalf("Failed to create activity: %v", err)
+		}
+		yogaID, err := store.CreateActivity(&model.Activity{Name: "Yoga"})
+		if err != nil {
+			t.Fatalf("Failed to create activity: %v", err)
+		}
+
+		record := func(activityID int64, start time.Time, minutes int, attributes model.AdditionalAttributes) {
+			t.Helper()
+			duration := time.Duration(minutes) * time.Minute
+			_, _, err := store.CreateUserActivity(&model.UserActivity{
+				UserID: userID, ActivityID: activityID, StartTime: start, EndTime: start.Add(duration), Duration: duration, Mood: 3,
+				AdditionalAttributes: attributes,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create user activity: %v", err)
+			}
+		}
+		// January 2024 starts on a Monday
+		record(runningID, time.Date(2023, 12, 30, 7, 0, 0, 0, time.UTC), 20, model.AdditionalAttributes{"distance_km": 3.0})
+		record(runningID, time.Date(2024, 1, 2, 7, 0, 0, 0, time.UTC), 30, model.AdditionalAttributes{"distance_km": 5.0})
+		record(runningID, time.Date(2024, 1, 10, 7, 0, 0, 0, time.UTC), 60, model.AdditionalAttributes{"distance_km": 7.5})
+		record(runningID, time.Date(2024, 1, 22, 7, 0, 0, 0, time.UTC), 45, model.AdditionalAttributes{"distance_km": "far"})
+		record(yogaID, time.Date(2024, 1, 22, 18, 0, 0, 0, time.UTC), 60, nil)
+
+		created := time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC)
+		day := func(month time.Month, day int) time.Time { return time.Date(2024, month, day, 0, 0, 0, 0, time.UTC) }
+		values := func(progress []GoalProgress) []float64 {
+			values := make([]float64, 0, len(progress))
+			for _, period := range progress {
+				values = append(values, period.Value)
+			}
+			return values
+		}
+
+		// History stops at the week the goal was created in, which counts
+		// in full
+		weekly := model.Goal{UserID: userID, ActivityID: &runningID, Metric: model.MetricDuration, Period: model.GoalWeekly, Target: 9000, CreatedAt: created}
+		progress, err := store.GoalProgress(GoalProgressFilter{Goal: weekly, Now: time.Date(2024, 1, 24, 9, 0, 0, 0, time.UTC), History: 5})
+		assert.NoError(t, err)
+		assert.Equal(t, []float64{1800, 3600, 0, 2700}, values(progress))
+		assert.Equal(t, day(1, 1), progress[0].PeriodStart)
+		assert.Equal(t, day(1, 8), progress[0].PeriodEnd)
+		assert.Equal(t, day(1, 22), progress[3].PeriodStart)
+		assert.Equal(t, day(1, 29), progress[3].PeriodEnd)
+
+		daily := model.Goal{UserID: userID, Metric: model.MetricCount, Period: model.GoalDaily, Target: 2, CreatedAt: created}
+		progress, err = store.GoalProgress(GoalProgressFilter{Goal: daily, Now: time.Date(2024, 1, 22, 20, 0, 0, 0, time.UTC), History: 2})
+		assert.NoError(t, err)
+		assert.Equal(t, []float64{0, 0, 2}, values(progress))
+		assert.Equal(t, day(1, 20), progress[0].PeriodStart)
+
+		// Attributes that are missing or not numbers add nothing
+		monthly := model.Goal{UserID: userID, ActivityID: &runningID, Metric: model.MetricAttributeSum, Attribute: "distance_km", Period: model.GoalMonthly, Target: 50, CreatedAt: created}
+		progress, err = store.GoalProgress(GoalProgressFilter{Goal: monthly, Now: time.Date(2024, 2, 10, 9, 0, 0, 0, time.UTC), History: 12})
+		assert.NoError(t, err)
+		assert.Equal(t, []float64{12.5, 0}, values(progress))
+		assert.Equal(t, day(2, 1), progress[0].PeriodEnd)
+		assert.Equal(t, day(3, 1), progress[1].PeriodEnd)
+
+		// Periods follow the time zone: the yoga at 18:00 UTC is on the 23rd
+		// in Tokyo
+		tokyo, err := time.LoadLocation("Asia/Tokyo")
+		if err != nil {
+			t.Fatalf("Failed to load time zone: %v", err)
+		}
+		progress, err = store.GoalProgress(GoalProgressFilter{Goal: daily, Now: time.Date(2024, 1, 22, 20, 0, 0, 0, time.UTC), History: 1, Location: tokyo})
+		assert.NoError(t, err)
+		assert.Equal(t, []float64{1, 1}, values(progress))
+		assert.Equal(t, time.Date(2024, 1, 22, 0, 0, 0, 0, tokyo), progress[0].PeriodStart)
+
+		daily.Metric = "calories"
+		_, err = store.GoalProgress(GoalProgressFilter{Goal: daily, Now: created})
+		assert.Error(t, err)
+	})
+}
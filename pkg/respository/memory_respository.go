@@ -0,0 +1,1215 @@
+package repository
+
+import (
+	"activity-tracker/pkg/model"
+	"activity-tracker/pkg/password"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryRepository is a thread-safe, in-memory implementation of the stores.
+// It mirrors the behaviour of Repository and is intended for tests and local
+// development without a database.
+type MemoryRepository struct {
+	mu             sync.RWMutex
+	nextID         int64
+	overlapPolicy  OverlapPolicy
+	users          map[int64]model.User
+	activities     map[int64]model.Activity
+	userActivities map[int64]model.UserActivity
+	timers         map[int64]model.Timer
+	goals          map[int64]model.Goal
+	symptoms       map[int64]model.Symptom
+	tags           map[int64]model.Tag
+	categories     map[int64]model.Category
+}
+
+// NewMemoryRepository creates a new, empty MemoryRepository instance. It
+// rejects overlapping user activities until told otherwise.
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		overlapPolicy:  OverlapReject,
+		users:          make(map[int64]model.User),
+		activities:     make(map[int64]model.Activity),
+		userActivities: make(map[int64]model.UserActivity),
+		timers:         make(map[int64]model.Timer),
+		goals:          make(map[int64]model.Goal),
+		symptoms:       make(map[int64]model.Symptom),
+		tags:           make(map[int64]model.Tag),
+		categories:     make(map[int64]model.Category),
+	}
+}
+
+// SetOverlapPolicy sets how overlapping user activities are handled.
+func (r *MemoryRepository) SetOverlapPolicy(policy OverlapPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.overlapPolicy = policy
+}
+
+// newID returns the next identifier. Callers must hold the write lock.
+func (r *MemoryRepository) newID() int64 {
+	r.nextID++
+	return r.nextID
+}
+
+// CreateUser creates a new user in memory. The user's plain text password is
+// hashed before it is stored.
+func (r *MemoryRepository) CreateUser(user *model.User) (int64, error) {
+	hashed, err := password.Hash(user.Password)
+	if err != nil {
+		return 0, fmt.Errorf("could not create user: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.users {
+		if existing.Username == user.Username {
+			return 0, ErrUsernameTaken
+		}
+	}
+
+	stored := *user
+	stored.ID = r.newID()
+	stored.Password = hashed
+	if stored.TimeZone == "" {
+		stored.TimeZone = model.DefaultTimeZone
+	}
+	stored.IsAdmin = false // granted with SetUserAdmin only
+	stored.CreatedAt = time.Now()
+	r.users[stored.ID] = stored
+	return stored.ID, nil
+}
+
+// GetUser retrieves a user by ID from memory.
+func (r *MemoryRepository) GetUser(userID int64) (*model.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &user, nil
+}
+
+// UpdateUser updates an existing user in memory. The password is only
+// changed, and hashed, when a new one is given.
+func (r *MemoryRepository) UpdateUser(user *model.User) error {
+	var hashed string
+	if user.Password != "" {
+		var err error
+		if hashed, err = password.Hash(user.Password); err != nil {
+			return fmt.Errorf("could not update user: %w", err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[user.ID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	for id, existing := range r.users {
+		if id != user.ID && existing.Username == user.Username {
+			return ErrUsernameTaken
+		}
+	}
+	stored.Username = user.Username
+	if hashed != "" {
+		stored.Password = hashed
+	}
+	if user.TimeZone != "" {
+		stored.TimeZone = user.TimeZone
+	}
+	r.users[user.ID] = stored
+	return nil
+}
+
+// DeleteUser deletes a user by ID from memory, along with their user
+// activities, timers and private activities.
+func (r *MemoryRepository) DeleteUser(userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[userID]; !ok {
+		return ErrUserNotFound
+	}
+	delete(r.users, userID)
+	for id, userActivity := range r.userActivities {
+		if userActivity.UserID == userID {
+			delete(r.userActivities, id)
+		}
+	}
+	for id, timer := range r.timers {
+		if timer.UserID == userID {
+			delete(r.timers, id)
+		}
+	}
+	for id, goal := range r.goals {
+		if goal.UserID == userID {
+			delete(r.goals, id)
+		}
+	}
+	for id, symptom := range r.symptoms {
+		if symptom.UserID == userID {
+			delete(r.symptoms, id)
+		}
+	}
+	for id, tag := range r.tags {
+		if tag.UserID == userID {
+			delete(r.tags, id)
+		}
+	}
+	for id, activity := range r.activities {
+		if activity.OwnerID != nil && *activity.OwnerID == userID {
+			delete(r.activities, id)
+		}
+	}
+	return nil
+}
+
+// SetUserAdmin grants or revokes a user's right to manage the global activity
+// catalog. The rights of the last admin cannot be revoked.
+func (r *MemoryRepository) SetUserAdmin(userID int64, admin bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if !admin && user.IsAdmin && r.adminCount() == 1 {
+		return ErrLastAdmin
+	}
+	user.IsAdmin = admin
+	r.users[userID] = user
+	return nil
+}
+
+// adminCount returns the number of admins. Callers must hold the lock.
+func (r *MemoryRepository) adminCount() int {
+	admins := 0
+	for _, user := range r.users {
+		if user.IsAdmin {
+			admins++
+		}
+	}
+	return admins
+}
+
+// VerifyCredentials returns the user with the given username if the password
+// matches, and ErrInvalidCredentials otherwise.
+func (r *MemoryRepository) VerifyCredentials(username, plain string) (*model.User, error) {
+	user, err := r.getUserByUsername(username)
+	return verifyPassword(user, err, plain)
+}
+
+// getUserByUsername retrieves a user by username from memory.
+func (r *MemoryRepository) getUserByUsername(username string) (*model.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+// CreateActivity creates a new activity in memory, private to its owner if it
+// has one.
+func (r *MemoryRepository) CreateActivity(activity *model.Activity) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if activity.OwnerID != nil {
+		if _, ok := r.users[*activity.OwnerID]; !ok {
+			return 0, fmt.Errorf("could not create activity: %w: user %d", ErrInvalidReference, *activity.OwnerID)
+		}
+	}
+	if r.activityNameTaken(activity.Name, activity.OwnerID, 0) {
+		return 0, ErrActivityNameTaken
+	}
+	if err := r.checkCategory(activity.CategoryID); err != nil {
+		return 0, err
+	}
+
+	stored := copyActivity(*activity)
+	stored.ID = r.newID()
+	r.activities[stored.ID] = stored
+	return stored.ID, nil
+}
+
+// GetActivity retrieves an activity visible to userID by ID from memory.
+func (r *MemoryRepository) GetActivity(userID, activityID int64) (*model.Activity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	activity, ok := r.activities[activityID]
+	if !ok || !activity.VisibleTo(userID) {
+		return nil, ErrActivityNotFound
+	}
+	activity = copyActivity(activity)
+	return &activity, nil
+}
+
+// UpdateActivity updates an existing activity in memory. Its owner cannot be
+// changed.
+func (r *MemoryRepository) UpdateActivity(activity *model.Activity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.activities[activity.ID]
+	if !ok {
+		return ErrActivityNotFound
+	}
+	if r.activityNameTaken(activity.Name, existing.OwnerID, activity.ID) {
+		return ErrActivityNameTaken
+	}
+	if err := r.checkCategory(activity.CategoryID); err != nil {
+		return err
+	}
+	updated := copyActivity(*activity)
+	updated.OwnerID = existing.OwnerID
+	r.activities[activity.ID] = updated
+	return nil
+}
+
+// activityNameTaken reports whether an activity other than exceptID with the
+// same owner, or also global if ownerID is nil, has the same name, compared
+// case-insensitively. Callers must hold the lock.
+func (r *MemoryRepository) activityNameTaken(name string, ownerID *int64, exceptID int64) bool {
+	for id, existing := range r.activities {
+		if id == exceptID || strings.ToLower(existing.Name) != strings.ToLower(name) {
+			continue
+		}
+		if (existing.OwnerID == nil) == (ownerID == nil) && (ownerID == nil || *existing.OwnerID == *ownerID) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListActivities returns the activities whose name matches the filter, ordered
+// case-insensitively by name and then by ID so pages are stable.
+func (r *MemoryRepository) ListActivities(filter ActivityFilter) ([]model.Activity, error) {
+	filter.Limit = normalizeLimit(filter.Limit)
+	query := strings.ToLower(filter.Query)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	activities := []model.Activity{}
+	for _, activity := range r.activities {
+		if !activity.VisibleTo(filter.UserID) ||
+			filter.Scope == ScopeGlobal && activity.OwnerID != nil ||
+			filter.Scope == ScopePrivate && activity.OwnerID == nil {
+			continue
+		}
+		name := strings.ToLower(activity.Name)
+		if filter.Match == MatchContains && strings.Contains(name, query) ||
+			filter.Match != MatchContains && strings.HasPrefix(name, query) {
+			activities = append(activities, copyActivity(activity))
+		}
+	}
+
+	sort.Slice(activities, func(i, j int) bool {
+		left, right := strings.ToLower(activities[i].Name), strings.ToLower(activities[j].Name)
+		if left != right {
+			return left < right
+		}
+		return activities[i].ID < activities[j].ID
+	})
+
+	if filter.Offset >= len(activities) {
+		return []model.Activity{}, nil
+	}
+	activities = activities[filter.Offset:]
+	if len(activities) > filter.Limit {
+		activities = activities[:filter.Limit]
+	}
+	return activities, nil
+}
+
+// DeleteActivity deletes an activity by ID from memory. Activities that are
+// still referenced by user activities or timers cannot be deleted.
+func (r *MemoryRepository) DeleteActivity(activityID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.activities[activityID]; !ok {
+		return ErrActivityNotFound
+	}
+	for _, userActivity := range r.userActivities {
+		if userActivity.ActivityID == activityID {
+			return ErrActivityInUse
+		}
+	}
+	for _, timer := range r.timers {
+		if timer.ActivityID == activityID {
+			return ErrActivityInUse
+		}
+	}
+	for _, goal := range r.goals {
+		if goal.ActivityID != nil && *goal.ActivityID == activityID {
+			return ErrActivityInUse
+		}
+	}
+	delete(r.activities, activityID)
+	return nil
+}
+
+// CreateUserActivity creates a new user activity in memory. Overlaps are
+// handled according to the repository's overlap policy; under OverlapTrim the
+// stored times are written back to userActivity.
+func (r *MemoryRepository) CreateUserActivity(userActivity *model.UserActivity) (int64, *Overlap, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.createUserActivity(userActivity)
+}
+
+// createUserActivity creates a user activity as CreateUserActivity describes.
+// Callers must hold the lock.
+func (r *MemoryRepository) createUserActivity(userActivity *model.UserActivity) (int64, *Overlap, error) {
+	if _, ok := r.users[userActivity.UserID]; !ok {
+		return 0, nil, fmt.Errorf("could not create user activity: %w: user %d", ErrInvalidReference, userActivity.UserID)
+	}
+	if activity, ok := r.activities[userActivity.ActivityID]; !ok || !activity.VisibleTo(userActivity.UserID) {
+		return 0, nil, fmt.Errorf("could not create user activity: %w: activity %d", ErrInvalidReference, userActivity.ActivityID)
+	}
+	overlapping := r.findOverlapping(userActivity.UserID, 0, userActivity.StartTime, userActivity.EndTime)
+	overlap, err := resolveOverlap(r.overlapPolicy, userActivity, overlapping)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := r.checkTags(userActivity.UserID, userActivity.TagIDs); err != nil {
+		return 0, nil, fmt.Errorf("could not create user activity: %w", err)
+	}
+	attributes, err := storedAttributes(userActivity.AdditionalAttributes)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	stored := *userActivity
+	stored.ID = r.newID()
+	stored.AdditionalAttributes = attributes
+	stored.TagIDs = normalizeTagIDs(userActivity.TagIDs)
+	stored.Duration = userActivity.Duration.Truncate(time.Second)
+	stored.RecordedAt = time.Now()
+	r.userActivities[stored.ID] = stored
+	return stored.ID, overlap, nil
+}
+
+// GetUserActivity retrieves a user activity owned by userID from memory.
+func (r *MemoryRepository) GetUserActivity(userID, userActivityID int64) (*model.UserActivity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	userActivity, ok := r.userActivities[userActivityID]
+	if !ok || userActivity.UserID != userID {
+		return nil, ErrUserActivityNotFound
+	}
+	userActivity = copyUserActivity(userActivity)
+	return &userActivity, nil
+}
+
+// ListUserActivities returns one page of a user's activities matching the
+// filter, ordered by (start_time, id), and the cursor of the next page if
+// there is one.
+func (r *MemoryRepository) ListUserActivities(filter UserActivityFilter) ([]model.UserActivity, *Cursor, error) {
+	filter.Limit = normalizeLimit(filter.Limit)
+	if err := validateAttributeFilters(filter.Attributes); err != nil {
+		return nil, nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	userActivities := []model.UserActivity{}
+	for _, userActivity := range r.userActivities {
+		if filter.matches(userActivity) {
+			userActivities = append(userActivities, copyUserActivity(userActivity))
+		}
+	}
+
+	sort.Slice(userActivities, func(i, j int) bool {
+		if filter.Descending {
+			return cursorOf(userActivities[j]).before(cursorOf(userActivities[i]))
+		}
+		return cursorOf(userActivities[i]).before(cursorOf(userActivities[j]))
+	})
+	if len(userActivities) > filter.Limit+1 {
+		userActivities = userActivities[:filter.Limit+1]
+	}
+	return paginate(userActivities, filter.Limit)
+}
+
+// matches reports whether userActivity is selected by the filter, including
+// being past the filter's cursor.
+func (filter UserActivityFilter) matches(userActivity model.UserActivity) bool {
+	switch {
+	case userActivity.UserID != filter.UserID:
+		return false
+	case filter.ActivityID != 0 && userActivity.ActivityID != filter.ActivityID:
+		return false
+	case filter.StartFrom != nil && userActivity.StartTime.Before(*filter.StartFrom):
+		return false
+	case filter.StartTo != nil && !userActivity.StartTime.Before(*filter.StartTo):
+		return false
+	case filter.MinMood != nil && userActivity.Mood < *filter.MinMood:
+		return false
+	case filter.MaxMood != nil && userActivity.Mood > *filter.MaxMood:
+		return false
+	}
+	for _, attributeFilter := range filter.Attributes {
+		if !attributeFilter.matches(userActivity.AdditionalAttributes) {
+			return false
+		}
+	}
+	if len(filter.TagIDs) > 0 && !hasTags(userActivity.TagIDs, filter.TagIDs, filter.AllTags) {
+		return false
+	}
+	if filter.After != nil {
+		if filter.Descending {
+			return cursorOf(userActivity).before(*filter.After)
+		}
+		return filter.After.before(cursorOf(userActivity))
+	}
+	return true
+}
+
+// cursorOf returns the keyset position of a user activity.
+func cursorOf(userActivity model.UserActivity) Cursor {
+	return Cursor{StartTime: userActivity.StartTime, ID: userActivity.ID}
+}
+
+// before reports whether c sorts before other in (start_time, id) order.
+func (c Cursor) before(other Cursor) bool {
+	if !c.StartTime.Equal(other.StartTime) {
+		return c.StartTime.Before(other.StartTime)
+	}
+	return c.ID < other.ID
+}
+
+// UpdateUserActivity updates an existing user activity owned by
+// userActivity.UserID in memory, keeping the activity it records. Overlaps are
+// handled as in CreateUserActivity.
+func (r *MemoryRepository) UpdateUserActivity(userActivity *model.UserActivity) (*Overlap, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.userActivities[userActivity.ID]
+	if !ok || stored.UserID != userActivity.UserID {
+		return nil, ErrUserActivityNotFound
+	}
+	overlapping := r.findOverlapping(userActivity.UserID, userActivity.ID, userActivity.StartTime, userActivity.EndTime)
+	overlap, err := resolveOverlap(r.overlapPolicy, userActivity, overlapping)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkTags(userActivity.UserID, userActivity.TagIDs); err != nil {
+		return nil, fmt.Errorf("could not update user activity: %w", err)
+	}
+	attributes, err := storedAttributes(userActivity.AdditionalAttributes)
+	if err != nil {
+		return nil, err
+	}
+	stored.StartTime = userActivity.StartTime
+	stored.EndTime = userActivity.EndTime
+	stored.Duration = userActivity.Duration.Truncate(time.Second)
+	stored.Mood = userActivity.Mood
+	stored.AdditionalAttributes = attributes
+	stored.TagIDs = normalizeTagIDs(userActivity.TagIDs)
+	r.userActivities[userActivity.ID] = stored
+	return overlap, nil
+}
+
+// DeleteUserActivity deletes a user activity owned by userID from memory.
+func (r *MemoryRepository) DeleteUserActivity(userID, userActivityID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	userActivity, ok := r.userActivities[userActivityID]
+	if !ok || userActivity.UserID != userID {
+		return ErrUserActivityNotFound
+	}
+	delete(r.userActivities, userActivityID)
+	for id, symptom := range r.symptoms {
+		if symptom.UserActivityID != nil && *symptom.UserActivityID == userActivityID {
+			symptom.UserActivityID = nil
+			r.symptoms[id] = symptom
+		}
+	}
+	return nil
+}
+
+// CreateTimer creates a new timer and its earlier runs in memory. Its activity
+// must be global or private to the user.
+func (r *MemoryRepository) CreateTimer(timer *model.Timer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[timer.UserID]; !ok {
+		return 0, fmt.Errorf("could not create timer: %w: user %d", ErrInvalidReference, timer.UserID)
+	}
+	if activity, ok := r.activities[timer.ActivityID]; !ok || !activity.VisibleTo(timer.UserID) {
+		return 0, fmt.Errorf("could not create timer: %w: activity %d", ErrInvalidReference, timer.ActivityID)
+	}
+	if timer.Running() && r.otherTimerRunning(timer.UserID, 0) {
+		return 0, ErrTimerAlreadyRunning
+	}
+
+	stored := copyTimer(*timer)
+	stored.ID = r.newID()
+	stored.Elapsed = timer.Elapsed.Truncate(time.Millisecond)
+	r.timers[stored.ID] = stored
+	return stored.ID, nil
+}
+
+// GetTimer retrieves a timer owned by userID from memory.
+func (r *MemoryRepository) GetTimer(userID, timerID int64) (*model.Timer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	timer, ok := r.timers[timerID]
+	if !ok || timer.UserID != userID {
+		return nil, ErrTimerNotFound
+	}
+	timer = copyTimer(timer)
+	return &timer, nil
+}
+
+// ListTimers returns all of a user's timers from memory, oldest first.
+func (r *MemoryRepository) ListTimers(userID int64) ([]model.Timer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	timers := []model.Timer{}
+	for _, timer := range r.timers {
+		if timer.UserID == userID {
+			timers = append(timers, copyTimer(timer))
+		}
+	}
+	sort.Slice(timers, func(i, j int) bool {
+		if !timers[i].StartedAt.Equal(timers[j].StartedAt) {
+			return timers[i].StartedAt.Before(timers[j].StartedAt)
+		}
+		return timers[i].ID < timers[j].ID
+	})
+	return timers, nil
+}
+
+// UpdateTimer saves the running state, elapsed time and earlier runs of a
+// timer owned by timer.UserID in memory, unless it has changed since it was
+// loaded as previous.
+func (r *MemoryRepository) UpdateTimer(timer, previous *model.Timer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.timers[timer.ID]
+	if !ok || stored.UserID != timer.UserID {
+		return ErrTimerNotFound
+	}
+	if !sameTime(stored.ResumedAt, previous.ResumedAt) || stored.Elapsed != previous.Elapsed.Truncate(time.Millisecond) {
+		return ErrTimerChanged
+	}
+	if timer.Running() && r.otherTimerRunning(timer.UserID, timer.ID) {
+		return ErrTimerAlreadyRunning
+	}
+	updated := copyTimer(*timer)
+	stored.ResumedAt = updated.ResumedAt
+	stored.Elapsed = updated.Elapsed.Truncate(time.Millisecond)
+	stored.Runs = updated.Runs
+	r.timers[timer.ID] = stored
+	return nil
+}
+
+// DeleteTimer deletes a timer owned by userID from memory.
+func (r *MemoryRepository) DeleteTimer(userID, timerID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	timer, ok := r.timers[timerID]
+	if !ok || timer.UserID != userID {
+		return ErrTimerNotFound
+	}
+	delete(r.timers, timerID)
+	return nil
+}
+
+// StopTimer deletes a timer owned by userID from memory and records
+// userActivities, the times it ran, as CreateUserActivity does. Nothing is
+// changed if any of them cannot be recorded.
+func (r *MemoryRepository) StopTimer(userID, timerID int64, userActivities []model.UserActivity) ([]int64, *Overlap, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	timer, ok := r.timers[timerID]
+	if !ok || timer.UserID != userID {
+		return nil, nil, ErrTimerNotFound
+	}
+	ids := make([]int64, 0, len(userActivities))
+	var overlap *Overlap
+	for i := range userActivities {
+		id, runOverlap, err := r.createUserActivity(&userActivities[i])
+		if err != nil {
+			for _, id := range ids {
+				delete(r.userActivities, id)
+			}
+			return nil, nil, err
+		}
+		ids = append(ids, id)
+		overlap = overlap.merge(runOverlap)
+	}
+	delete(r.timers, timerID)
+	return ids, overlap, nil
+}
+
+// CreateGoal creates a new goal in memory.
+func (r *MemoryRepository) CreateGoal(goal *model.Goal) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[goal.UserID]; !ok {
+		return 0, fmt.Errorf("could not create goal: %w: user %d", ErrInvalidReference, goal.UserID)
+	}
+	if goal.ActivityID != nil {
+		if activity, ok := r.activities[*goal.ActivityID]; !ok || !activity.VisibleTo(goal.UserID) {
+			return 0, fmt.Errorf("could not create goal: %w: activity %d", ErrInvalidReference, *goal.ActivityID)
+		}
+	}
+
+	stored := copyGoal(*goal)
+	stored.ID = r.newID()
+	r.goals[stored.ID] = stored
+	return stored.ID, nil
+}
+
+// GetGoal retrieves a goal owned by userID from memory.
+func (r *MemoryRepository) GetGoal(userID, goalID int64) (*model.Goal, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	goal, ok := r.goals[goalID]
+	if !ok || goal.UserID != userID {
+		return nil, ErrGoalNotFound
+	}
+	goal = copyGoal(goal)
+	return &goal, nil
+}
+
+// ListGoals returns all of a user's goals from memory, oldest first.
+func (r *MemoryRepository) ListGoals(userID int64) ([]model.Goal, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	goals := []model.Goal{}
+	for _, goal := range r.goals {
+		if goal.UserID == userID {
+			goals = append(goals, copyGoal(goal))
+		}
+	}
+	sort.Slice(goals, func(i, j int) bool { return goals[i].ID < goals[j].ID })
+	return goals, nil
+}
+
+// UpdateGoal saves the activity, metric, period and target of a goal owned by
+// goal.UserID in memory.
+func (r *MemoryRepository) UpdateGoal(goal *model.Goal) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.goals[goal.ID]
+	if !ok || stored.UserID != goal.UserID {
+		return ErrGoalNotFound
+	}
+	if goal.ActivityID != nil {
+		if activity, ok := r.activities[*goal.ActivityID]; !ok || !activity.VisibleTo(goal.UserID) {
+			return fmt.Errorf("could not update goal: %w: activity %d", ErrInvalidReference, *goal.ActivityID)
+		}
+	}
+	updated := copyGoal(*goal)
+	updated.CreatedAt = stored.CreatedAt
+	r.goals[goal.ID] = updated
+	return nil
+}
+
+// DeleteGoal deletes a goal owned by userID from memory.
+func (r *MemoryRepository) DeleteGoal(userID, goalID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	goal, ok := r.goals[goalID]
+	if !ok || goal.UserID != userID {
+		return ErrGoalNotFound
+	}
+	delete(r.goals, goalID)
+	return nil
+}
+
+// checkLinkedUserActivity returns ErrInvalidReference unless the user activity
+// that a symptom is linked to, if any, belongs to the symptom's user. Callers
+// must hold the lock.
+func (r *MemoryRepository) checkLinkedUserActivity(symptom *model.Symptom) error {
+	if symptom.UserActivityID == nil {
+		return nil
+	}
+	userActivity, ok := r.userActivities[*symptom.UserActivityID]
+	if !ok || userActivity.UserID != symptom.UserID {
+		return fmt.Errorf("%w: user activity %d", ErrInvalidReference, *symptom.UserActivityID)
+	}
+	return nil
+}
+
+// CreateSymptom creates a new symptom in memory.
+func (r *MemoryRepository) CreateSymptom(symptom *model.Symptom) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[symptom.UserID]; !ok {
+		return 0, fmt.Errorf("could not create symptom: %w: user %d", ErrInvalidReference, symptom.UserID)
+	}
+	if err := r.checkLinkedUserActivity(symptom); err != nil {
+		return 0, fmt.Errorf("could not create symptom: %w", err)
+	}
+
+	stored := copySymptom(*symptom)
+	stored.ID = r.newID()
+	stored.RecordedAt = time.Now()
+	r.symptoms[stored.ID] = stored
+	return stored.ID, nil
+}
+
+// GetSymptom retrieves a symptom owned by userID from memory.
+func (r *MemoryRepository) GetSymptom(userID, symptomID int64) (*model.Symptom, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	symptom, ok := r.symptoms[symptomID]
+	if !ok || symptom.UserID != userID {
+		return nil, ErrSymptomNotFound
+	}
+	symptom = copySymptom(symptom)
+	return &symptom, nil
+}
+
+// ListSymptoms returns a user's symptoms that match the filter from memory,
+// in the order they occurred.
+func (r *MemoryRepository) ListSymptoms(filter SymptomFilter) ([]model.Symptom, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.listSymptoms(filter), nil
+}
+
+// listSymptoms returns the symptoms that match the filter. Callers must hold
+// the lock.
+func (r *MemoryRepository) listSymptoms(filter SymptomFilter) []model.Symptom {
+	symptoms := []model.Symptom{}
+	for _, symptom := range r.symptoms {
+		switch {
+		case symptom.UserID != filter.UserID:
+		case filter.BodyArea != "" && symptom.BodyArea != filter.BodyArea:
+		case filter.OccurredFrom != nil && symptom.OccurredAt.Before(*filter.OccurredFrom):
+		case filter.OccurredTo != nil && !symptom.OccurredAt.Before(*filter.OccurredTo):
+		case filter.UserActivityID != 0 && (symptom.UserActivityID == nil || *symptom.UserActivityID != filter.UserActivityID):
+		default:
+			symptoms = append(symptoms, copySymptom(symptom))
+		}
+	}
+	sort.Slice(symptoms, func(i, j int) bool {
+		if !symptoms[i].OccurredAt.Equal(symptoms[j].OccurredAt) {
+			return symptoms[i].OccurredAt.Before(symptoms[j].OccurredAt)
+		}
+		return symptoms[i].ID < symptoms[j].ID
+	})
+	return symptoms
+}
+
+// UpdateSymptom saves a symptom owned by symptom.UserID in memory.
+func (r *MemoryRepository) UpdateSymptom(symptom *model.Symptom) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.symptoms[symptom.ID]
+	if !ok || stored.UserID != symptom.UserID {
+		return ErrSymptomNotFound
+	}
+	if err := r.checkLinkedUserActivity(symptom); err != nil {
+		return fmt.Errorf("could not update symptom: %w", err)
+	}
+	updated := copySymptom(*symptom)
+	updated.RecordedAt = stored.RecordedAt
+	r.symptoms[symptom.ID] = updated
+	return nil
+}
+
+// DeleteSymptom deletes a symptom owned by userID from memory.
+func (r *MemoryRepository) DeleteSymptom(userID, symptomID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	symptom, ok := r.symptoms[symptomID]
+	if !ok || symptom.UserID != userID {
+		return ErrSymptomNotFound
+	}
+	delete(r.symptoms, symptomID)
+	return nil
+}
+
+// otherTimerRunning reports whether the user has a running timer other than
+// exceptID. Callers must hold the lock.
+func (r *MemoryRepository) otherTimerRunning(userID, exceptID int64) bool {
+	for id, timer := range r.timers {
+		if id != exceptID && timer.UserID == userID && timer.Running() {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateCategory creates a new category in memory.
+func (r *MemoryRepository) CreateCategory(category *model.Category) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkCategory(category.ParentID); err != nil {
+		return 0, err
+	}
+	if r.categoryNameTaken(category.Name, category.ParentID, 0) {
+		return 0, ErrCategoryNameTaken
+	}
+
+	stored := copyCategory(*category)
+	stored.ID = r.newID()
+	r.categories[stored.ID] = stored
+	return stored.ID, nil
+}
+
+// GetCategory retrieves a category by ID from memory.
+func (r *MemoryRepository) GetCategory(categoryID int64) (*model.Category, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	category, ok := r.categories[categoryID]
+	if !ok {
+		return nil, ErrCategoryNotFound
+	}
+	category = copyCategory(category)
+	return &category, nil
+}
+
+// ListCategories returns every category ordered case-insensitively by name
+// and then by ID.
+func (r *MemoryRepository) ListCategories() ([]model.Category, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	categories := make([]model.Category, 0, len(r.categories))
+	for _, category := range r.categories {
+		categories = append(categories, copyCategory(category))
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		left, right := strings.ToLower(categories[i].Name), strings.ToLower(categories[j].Name)
+		if left != right {
+			return left < right
+		}
+		return categories[i].ID < categories[j].ID
+	})
+	return categories, nil
+}
+
+// UpdateCategory renames a category or moves it under another parent.
+func (r *MemoryRepository) UpdateCategory(category *model.Category) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.categories[category.ID]; !ok {
+		return ErrCategoryNotFound
+	}
+	if err := r.checkCategory(category.ParentID); err != nil {
+		return err
+	}
+	if category.ParentID != nil {
+		for _, ancestorID := range r.categoryPath(*category.ParentID) {
+			if ancestorID == category.ID {
+				return ErrCategoryCycle
+			}
+		}
+	}
+	if r.categoryNameTaken(category.Name, category.ParentID, category.ID) {
+		return ErrCategoryNameTaken
+	}
+	r.categories[category.ID] = copyCategory(*category)
+	return nil
+}
+
+// DeleteCategory deletes a category by ID from memory. Categories that still
+// have subcategories or activities cannot be deleted.
+func (r *MemoryRepository) DeleteCategory(categoryID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.categories[categoryID]; !ok {
+		return ErrCategoryNotFound
+	}
+	for _, category := range r.categories {
+		if category.ParentID != nil && *category.ParentID == categoryID {
+			return ErrCategoryInUse
+		}
+	}
+	for _, activity := range r.activities {
+		if activity.CategoryID != nil && *activity.CategoryID == categoryID {
+			return ErrCategoryInUse
+		}
+	}
+	delete(r.categories, categoryID)
+	return nil
+}
+
+// checkCategory returns ErrInvalidReference if categoryID is set but there is
+// no such category. Callers must hold the lock.
+func (r *MemoryRepository) checkCategory(categoryID *int64) error {
+	if categoryID == nil {
+		return nil
+	}
+	if _, ok := r.categories[*categoryID]; !ok {
+		return fmt.Errorf("%w: category %d does not exist", ErrInvalidReference, *categoryID)
+	}
+	return nil
+}
+
+// categoryNameTaken reports whether a category other than exceptID has the
+// same parent and name, compared case-insensitively. Callers must hold the
+// lock.
+func (r *MemoryRepository) categoryNameTaken(name string, parentID *int64, exceptID int64) bool {
+	for id, existing := range r.categories {
+		if id == exceptID || strings.ToLower(existing.Name) != strings.ToLower(name) {
+			continue
+		}
+		if (existing.ParentID == nil) == (parentID == nil) && (parentID == nil || *existing.ParentID == *parentID) {
+			return true
+		}
+	}
+	return false
+}
+
+// categoryPath returns the IDs of a category and its ancestors, starting with
+// the category itself and ending with its top-level category. Callers must
+// hold the lock.
+func (r *MemoryRepository) categoryPath(categoryID int64) []int64 {
+	path := []int64{categoryID}
+	for category, ok := r.categories[categoryID]; ok && category.ParentID != nil; category, ok = r.categories[*category.ParentID] {
+		path = append(path, *category.ParentID)
+	}
+	return path
+}
+
+// copyCategory returns a copy of category that does not share its parent ID
+// with the original.
+func copyCategory(category model.Category) model.Category {
+	if category.ParentID != nil {
+		parentID := *category.ParentID
+		category.ParentID = &parentID
+	}
+	return category
+}
+
+// sameTime reports whether two optional times are both unset or equal.
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// copyTimer returns a copy of timer that does not share its ResumedAt or runs
+// with the original, so stored timers cannot be changed through returned ones.
+func copyTimer(timer model.Timer) model.Timer {
+	if timer.ResumedAt != nil {
+		resumedAt := *timer.ResumedAt
+		timer.ResumedAt = &resumedAt
+	}
+	timer.Runs = append([]model.TimerRun(nil), timer.Runs...)
+	return timer
+}
+
+// copyGoal returns a copy of goal that does not share its activity ID with
+// the original.
+func copyGoal(goal model.Goal) model.Goal {
+	if goal.ActivityID != nil {
+		activityID := *goal.ActivityID
+		goal.ActivityID = &activityID
+	}
+	return goal
+}
+
+// CreateTag creates a new tag in memory.
+func (r *MemoryRepository) CreateTag(tag *model.Tag) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[tag.UserID]; !ok {
+		return 0, fmt.Errorf("could not create tag: %w: user %d", ErrInvalidReference, tag.UserID)
+	}
+	if r.tagNameTaken(tag.UserID, tag.Name, 0) {
+		return 0, ErrTagNameTaken
+	}
+
+	stored := *tag
+	stored.ID = r.newID()
+	stored.CreatedAt = time.Now()
+	r.tags[stored.ID] = stored
+	return stored.ID, nil
+}
+
+// GetTag retrieves a tag owned by userID from memory.
+func (r *MemoryRepository) GetTag(userID, tagID int64) (*model.Tag, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tag, ok := r.tags[tagID]
+	if !ok || tag.UserID != userID {
+		return nil, ErrTagNotFound
+	}
+	return &tag, nil
+}
+
+// ListTags returns all of a user's tags from memory, ordered by name.
+func (r *MemoryRepository) ListTags(userID int64) ([]model.Tag, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tags := []model.Tag{}
+	for _, tag := range r.tags {
+		if tag.UserID == userID {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
+// UpdateTag renames a tag owned by tag.UserID in memory.
+func (r *MemoryRepository) UpdateTag(tag *model.Tag) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.tags[tag.ID]
+	if !ok || stored.UserID != tag.UserID {
+		return ErrTagNotFound
+	}
+	if r.tagNameTaken(tag.UserID, tag.Name, tag.ID) {
+		return ErrTagNameTaken
+	}
+	stored.Name = tag.Name
+	r.tags[tag.ID] = stored
+	return nil
+}
+
+// DeleteTag deletes a tag owned by userID from memory, removing it from the
+// user activities it was attached to.
+func (r *MemoryRepository) DeleteTag(userID, tagID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tag, ok := r.tags[tagID]
+	if !ok || tag.UserID != userID {
+		return ErrTagNotFound
+	}
+	delete(r.tags, tagID)
+	for id, userActivity := range r.userActivities {
+		if hasTags(userActivity.TagIDs, []int64{tagID}, false) {
+			remaining := []int64{}
+			for _, other := range userActivity.TagIDs {
+				if other != tagID {
+					remaining = append(remaining, other)
+				}
+			}
+			userActivity.TagIDs = remaining
+			r.userActivities[id] = userActivity
+		}
+	}
+	return nil
+}
+
+// tagNameTaken reports whether a tag of the user other than exceptID has the
+// name. Callers must hold the lock.
+func (r *MemoryRepository) tagNameTaken(userID int64, name string, exceptID int64) bool {
+	for id, tag := range r.tags {
+		if id != exceptID && tag.UserID == userID && tag.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTags returns ErrInvalidReference unless every one of tagIDs is a tag
+// of the user. Callers must hold the lock.
+func (r *MemoryRepository) checkTags(userID int64, tagIDs []int64) error {
+	for _, tagID := range tagIDs {
+		if tag, ok := r.tags[tagID]; !ok || tag.UserID != userID {
+			return fmt.Errorf("%w: tag %d of user %d", ErrInvalidReference, tagID, userID)
+		}
+	}
+	return nil
+}
+
+// copySymptom returns a copy of symptom that does not share its user activity
+// ID with the original.
+func copySymptom(symptom model.Symptom) model.Symptom {
+	if symptom.UserActivityID != nil {
+		userActivityID := *symptom.UserActivityID
+		symptom.UserActivityID = &userActivityID
+	}
+	return symptom
+}
+
+// copyActivity returns a copy of activity that does not share its attribute
+// schema, category or owner with the original.
+func copyActivity(activity model.Activity) model.Activity {
+	activity.AttributeSchema = activity.AttributeSchema.Clone()
+	if activity.CategoryID != nil {
+		categoryID := *activity.CategoryID
+		activity.CategoryID = &categoryID
+	}
+	if activity.OwnerID != nil {
+		ownerID := *activity.OwnerID
+		activity.OwnerID = &ownerID
+	}
+	return activity
+}
+
+// copyUserActivity returns a copy of userActivity that does not share its
+// additional attributes or tags with the original.
+func copyUserActivity(userActivity model.UserActivity) model.UserActivity {
+	attributes := make(model.AdditionalAttributes, len(userActivity.AdditionalAttributes))
+	for name, value := range userActivity.AdditionalAttributes {
+		attributes[name] = value
+	}
+	userActivity.AdditionalAttributes = attributes
+	userActivity.TagIDs = append([]int64{}, userActivity.TagIDs...)
+	return userActivity
+}
+
+// storedAttributes returns additional attributes as Repository reads them back
+// from their JSON column, so that numbers are float64 and none is nil.
+func storedAttributes(attributes model.AdditionalAttributes) (model.AdditionalAttributes, error) {
+	encoded := model.UserActivity{AdditionalAttributes: attributes}
+	data, err := encoded.MarshalAdditionalAttributes()
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal additional attributes: %w", err)
+	}
+	var decoded model.UserActivity
+	if err := decoded.UnmarshalAdditionalAttributes(data); err != nil {
+		return nil, fmt.Errorf("could not unmarshal additional attributes: %w", err)
+	}
+	return decoded.AdditionalAttributes, nil
+}
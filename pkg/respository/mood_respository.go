@@ -0,0 +1,343 @@
+package repository
+
+import (
+	"activity-tracker/pkg/model"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MoodDurationBounds divide user activities into duration buckets for mood
+// analysis: shorter than 15 minutes, 15 to 30 minutes, 30 minutes to an hour,
+// one to two hours and longer.
+var MoodDurationBounds = []time.Duration{15 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour}
+
+// MoodFilter selects the user activities that mood statistics are computed
+// over. Only moods on the scale from model.MinMood to model.MaxMood count.
+// Trend periods and days are calendar periods in Location, or in UTC if it is
+// nil.
+type MoodFilter struct {
+	UserID   int64
+	From     time.Time // inclusive start time
+	To       time.Time // exclusive start time
+	Period   StatsPeriod
+	Location *time.Location
+}
+
+// location returns the time zone that the filter's periods are in.
+func (f MoodFilter) location() *time.Location {
+	if f.Location == nil {
+		return time.UTC
+	}
+	return f.Location
+}
+
+// MoodSummary counts moods and adds them up.
+type MoodSummary struct {
+	Count     int64
+	TotalMood int64
+}
+
+// Average returns the mean mood, or 0 if there is none.
+func (s MoodSummary) Average() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.TotalMood) / float64(s.Count)
+}
+
+// add counts one mood.
+func (s *MoodSummary) add(mood int) {
+	s.Count++
+	s.TotalMood += int64(mood)
+}
+
+// MoodTrendBucket summarizes the moods of the user activities that started in
+// one period.
+type MoodTrendBucket struct {
+	PeriodStart time.Time
+	MoodSummary
+}
+
+// MoodDays summarizes the moods of every user activity on a set of days.
+type MoodDays struct {
+	Days int64
+	MoodSummary
+}
+
+// ActivityMood summarizes the moods recorded with one activity, how often
+// each mood on the scale was, and the moods of all user activities on the
+// days the activity was done and on the other days with activities.
+type ActivityMood struct {
+	ActivityID   int64
+	Distribution map[int]int64 // count by mood, for every mood on the scale
+	DaysWith     MoodDays
+	DaysWithout  MoodDays
+	MoodSummary
+}
+
+// DurationMood summarizes the moods of the user activities lasting from
+// MinDuration up to, but excluding, MaxDuration, which is 0 for the last
+// bucket.
+type DurationMood struct {
+	MinDuration time.Duration
+	MaxDuration time.Duration
+	MoodSummary
+}
+
+// MoodStats holds the mood statistics of a user's activities. Trend is
+// ordered by period and leaves out periods without activities, Activities is
+// ordered by activity and Durations has a bucket for every duration range.
+type MoodStats struct {
+	Trend      []MoodTrendBucket
+	Activities []ActivityMood
+	Durations  []DurationMood
+}
+
+// newMoodStats returns empty statistics with every duration bucket.
+func newMoodStats() *MoodStats {
+	stats := &MoodStats{Trend: []MoodTrendBucket{}, Activities: []ActivityMood{}}
+	var min time.Duration
+	for _, max := range MoodDurationBounds {
+		stats.Durations = append(stats.Durations, DurationMood{MinDuration: min, MaxDuration: max})
+		min = max
+	}
+	stats.Durations = append(stats.Durations, DurationMood{MinDuration: min})
+	return stats
+}
+
+// activity returns the statistics of an activity, adding them if needed.
+func (s *MoodStats) activity(activityID int64) *ActivityMood {
+	for i := range s.Activities {
+		if s.Activities[i].ActivityID == activityID {
+			return &s.Activities[i]
+		}
+	}
+	distribution := make(map[int]int64)
+	for mood := model.MinMood; mood <= model.MaxMood; mood++ {
+		distribution[mood] = 0
+	}
+	s.Activities = append(s.Activities, ActivityMood{ActivityID: activityID, Distribution: distribution})
+	return &s.Activities[len(s.Activities)-1]
+}
+
+// durationBucket returns the index of the duration bucket of d.
+func durationBucket(d time.Duration) int {
+	for i, bound := range MoodDurationBounds {
+		if d < bound {
+			return i
+		}
+	}
+	return len(MoodDurationBounds)
+}
+
+// ratedSQL returns the common table expression of the user activities with
+// a mood on the scale that the filter selects, with their trend period and
+// local day, adding its arguments to args.
+func (r *Repository) ratedSQL(args *queryArgs, filter MoodFilter) (string, error) {
+	periodStart, err := r.periodStartSQL(args, filter.Period, filter.location())
+	if err != nil {
+		return "", err
+	}
+	day, err := r.periodStartSQL(args, PeriodDay, filter.location())
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`WITH rated AS (
+			SELECT activity_id, mood, duration_seconds, %s AS period_start, %s AS day
+			FROM user_activities
+			WHERE user_id = %s AND start_time >= %s AND start_time < %s AND mood BETWEEN %d AND %d
+		)`, periodStart, day, args.add(filter.UserID), args.add(filter.From.UTC()), args.add(filter.To.UTC()),
+		model.MinMood, model.MaxMood), nil
+}
+
+// queryRated runs a query over the rated user activities of the filter and
+// scans every row.
+func (r *Repository) queryRated(filter MoodFilter, query string, scan func(rows *sql.Rows) error) error {
+	var args queryArgs
+	rated, err := r.ratedSQL(&args, filter)
+	if err != nil {
+		return err
+	}
+	rows, err := r.db.Query(rated+"\n"+query, args...)
+	if err != nil {
+		return fmt.Errorf("could not compute mood stats: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return fmt.Errorf("could not compute mood stats: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("could not compute mood stats: %w", err)
+	}
+	return nil
+}
+
+// UserMoodStats returns the mood statistics of a user's activities that
+// started in the filter's range.
+func (r *Repository) UserMoodStats(filter MoodFilter) (*MoodStats, error) {
+	stats := newMoodStats()
+
+	err := r.queryRated(filter, `SELECT period_start, COUNT(*), SUM(mood) FROM rated GROUP BY 1 ORDER BY 1`, func(rows *sql.Rows) error {
+		var bucket MoodTrendBucket
+		var periodStart string
+		if err := rows.Scan(&periodStart, &bucket.Count, &bucket.TotalMood); err != nil {
+			return err
+		}
+		var err error
+		bucket.PeriodStart, err = time.ParseInLocation(periodStartFormat, periodStart, filter.location())
+		stats.Trend = append(stats.Trend, bucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.queryRated(filter, `SELECT activity_id, mood, COUNT(*) FROM rated GROUP BY 1, 2 ORDER BY 1, 2`, func(rows *sql.Rows) error {
+		var activityID, count int64
+		var mood int
+		if err := rows.Scan(&activityID, &mood, &count); err != nil {
+			return err
+		}
+		activity := stats.activity(activityID)
+		activity.Distribution[mood] = count
+		activity.Count += count
+		activity.TotalMood += int64(mood) * count
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Every activity is paired with every day with activities, and the day
+	// counts as with the activity if it was done on it
+	err = r.queryRated(filter, `, day_moods AS (
+			SELECT day, COUNT(*) AS count, SUM(mood) AS total FROM rated GROUP BY day
+		), activity_days AS (
+			SELECT DISTINCT activity_id, day FROM rated
+		)
+		SELECT a.activity_id,
+			SUM(CASE WHEN ad.day IS NULL THEN 0 ELSE 1 END),
+			SUM(CASE WHEN ad.day IS NULL THEN 0 ELSE dm.count END),
+			SUM(CASE WHEN ad.day IS NULL THEN 0 ELSE dm.total END),
+			SUM(CASE WHEN ad.day IS NULL THEN 1 ELSE 0 END),
+			SUM(CASE WHEN ad.day IS NULL THEN dm.count ELSE 0 END),
+			SUM(CASE WHEN ad.day IS NULL THEN dm.total ELSE 0 END)
+		FROM (SELECT DISTINCT activity_id FROM rated) a
+		CROSS JOIN day_moods dm
+		LEFT JOIN activity_days ad ON ad.activity_id = a.activity_id AND ad.day = dm.day
+		GROUP BY a.activity_id ORDER BY a.activity_id`, func(rows *sql.Rows) error {
+		var activityID int64
+		var with, without MoodDays
+		if err := rows.Scan(&activityID, &with.Days, &with.Count, &with.TotalMood, &without.Days, &without.Count, &without.TotalMood); err != nil {
+			return err
+		}
+		activity := stats.activity(activityID)
+		activity.DaysWith, activity.DaysWithout = with, without
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make([]string, 0, len(MoodDurationBounds))
+	for i, bound := range MoodDurationBounds {
+		buckets = append(buckets, fmt.Sprintf("WHEN duration_seconds < %d THEN %d", int64(bound/time.Second), i))
+	}
+	query := fmt.Sprintf(`SELECT CASE %s ELSE %d END, COUNT(*), SUM(mood) FROM rated GROUP BY 1`,
+		strings.Join(buckets, " "), len(MoodDurationBounds))
+	err = r.queryRated(filter, query, func(rows *sql.Rows) error {
+		var bucket int
+		var summary MoodSummary
+		if err := rows.Scan(&bucket, &summary.Count, &summary.TotalMood); err != nil {
+			return err
+		}
+		stats.Durations[bucket].MoodSummary = summary
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// UserMoodStats returns the mood statistics of a user's activities as
+// Repository does.
+func (r *MemoryRepository) UserMoodStats(filter MoodFilter) (*MoodStats, error) {
+	type dayKey struct {
+		activityID int64
+		day        time.Time
+	}
+	trend := make(map[time.Time]*MoodSummary)
+	byActivity := make(map[int64]*MoodSummary)
+	distributions := make(map[int64]map[int]int64)
+	dayMoods := make(map[time.Time]*MoodSummary)
+	activityDays := make(map[dayKey]bool)
+	stats := newMoodStats()
+
+	r.mu.RLock()
+	for _, userActivity := range r.userActivities {
+		if userActivity.UserID != filter.UserID || userActivity.StartTime.Before(filter.From) || !userActivity.StartTime.Before(filter.To) ||
+			userActivity.Mood < model.MinMood || userActivity.Mood > model.MaxMood {
+			continue
+		}
+		periodStart, err := periodStartOf(userActivity.StartTime, filter.Period, filter.location())
+		if err != nil {
+			r.mu.RUnlock()
+			return nil, err
+		}
+		day, _ := periodStartOf(userActivity.StartTime, PeriodDay, filter.location())
+
+		for _, summaries := range []struct {
+			byKey map[time.Time]*MoodSummary
+			key   time.Time
+		}{{trend, periodStart}, {dayMoods, day}} {
+			if summaries.byKey[summaries.key] == nil {
+				summaries.byKey[summaries.key] = &MoodSummary{}
+			}
+			summaries.byKey[summaries.key].add(userActivity.Mood)
+		}
+		if byActivity[userActivity.ActivityID] == nil {
+			byActivity[userActivity.ActivityID] = &MoodSummary{}
+			distributions[userActivity.ActivityID] = make(map[int]int64)
+		}
+		byActivity[userActivity.ActivityID].add(userActivity.Mood)
+		distributions[userActivity.ActivityID][userActivity.Mood]++
+		activityDays[dayKey{activityID: userActivity.ActivityID, day: day}] = true
+		stats.Durations[durationBucket(userActivity.Duration)].add(userActivity.Mood)
+	}
+	r.mu.RUnlock()
+
+	for periodStart, summary := range trend {
+		stats.Trend = append(stats.Trend, MoodTrendBucket{PeriodStart: periodStart, MoodSummary: *summary})
+	}
+	sort.Slice(stats.Trend, func(i, j int) bool { return stats.Trend[i].PeriodStart.Before(stats.Trend[j].PeriodStart) })
+
+	activityIDs := make([]int64, 0, len(byActivity))
+	for activityID := range byActivity {
+		activityIDs = append(activityIDs, activityID)
+	}
+	sort.Slice(activityIDs, func(i, j int) bool { return activityIDs[i] < activityIDs[j] })
+	for _, activityID := range activityIDs {
+		activity := stats.activity(activityID)
+		activity.MoodSummary = *byActivity[activityID]
+		for mood, count := range distributions[activityID] {
+			activity.Distribution[mood] = count
+		}
+		for day, summary := range dayMoods {
+			days := &activity.DaysWithout
+			if activityDays[dayKey{activityID: activityID, day: day}] {
+				days = &activity.DaysWith
+			}
+			days.Days++
+			days.Count += summary.Count
+			days.TotalMood += summary.TotalMood
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"activity-tracker/pkg/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserMoodStats(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store testStore) {
+		userID, err := store.CreateUser(&model.User{Username: "moody", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		otherID, err := store.CreateUser(&model.User{Username: "someone else", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		runningID, err := store.CreateActivity(&model.Activity{Name: "Running"})
+		if err != nil {
+			t.Fatalf("Failed to create activity: %v", err)
+		}
+		yogaID, err := store.CreateActivity(&model.Activity{Name: "Yoga"})
+		if err != nil {
+			t.Fatalf("Failed to create activity: %v", err)
+		}
+
+		record := func(userID, activityID int64, start time.Time, minutes, mood int) {
+			t.Helper()
+			duration := time.Duration(minutes) * time.Minute
+			_, _, err := store.CreateUserActivity(&model.UserActivity{
+				UserID: userID, ActivityID: activityID, StartTime: start, EndTime: start.Add(duration), Duration: duration, Mood: mood,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create user activity: %v", err)
+			}
+		}
+		at := func(day, hour int) time.Time { return time.Date(2024, 1, day, hour, 0, 0, 0, time.UTC) }
+		record(userID, runningID, at(1, 7), 30, 4)
+		record(userID, yogaID, at(1, 18), 60, 5)
+		record(userID, yogaID, at(2, 7), 10, 2)
+		record(userID, runningID, at(3, 7), 90, 3)
+		record(userID, runningID, at(3, 18), 20, 0) // recorded before moods were required
+		record(userID, yogaID, at(9, 7), 150, 1)
+		record(otherID, runningID, at(1, 7), 30, 1)
+
+		stats, err := store.UserMoodStats(MoodFilter{UserID: userID, From: at(1, 0), To: at(31, 0), Period: PeriodWeek})
+		assert.NoError(t, err)
+
+		assert.Equal(t, []MoodTrendBucket{
+			{PeriodStart: at(1, 0), MoodSummary: MoodSummary{Count: 4, TotalMood: 14}},
+			{PeriodStart: at(8, 0), MoodSummary: MoodSummary{Count: 1, TotalMood: 1}},
+		}, stats.Trend)
+
+		// Running was done on the 1st and 3rd, yoga on the 1st, 2nd and 9th
+		assert.Equal(t, []ActivityMood{
+			{
+				ActivityID:   runningID,
+				Distribution: map[int]int64{1: 0, 2: 0, 3: 1, 4: 1, 5: 0},
+				DaysWith:     MoodDays{Days: 2, MoodSummary: MoodSummary{Count: 3, TotalMood: 12}},
+				DaysWithout:  MoodDays{Days: 2, MoodSummary: MoodSummary{Count: 2, TotalMood: 3}},
+				MoodSummary:  MoodSummary{Count: 2, TotalMood: 7},
+			},
+			{
+				ActivityID:   yogaID,
+				Distribution: map[int]int64{1: 1, 2: 1, 3: 0, 4: 0, 5: 1},
+				DaysWith:     MoodDays{Days: 3, MoodSummary: MoodSummary{Count: 4, TotalMood: 12}},
+				DaysWithout:  MoodDays{Days: 1, MoodSummary: MoodSummary{Count: 1, TotalMood: 3}},
+				MoodSummary:  MoodSummary{Count: 3, TotalMood: 8},
+			},
+		}, stats.Activities)
+		assert.Equal(t, 3.5, stats.Activities[0].Average())
+		assert.Equal(t, 4.0, stats.Activities[0].DaysWith.Average())
+		assert.Equal(t, 1.5, stats.Activities[0].DaysWithout.Average())
+
+		assert.Equal(t, []DurationMood{
+			{MinDuration: 0, MaxDuration: 15 * time.Minute, MoodSummary: MoodSummary{Count: 1, TotalMood: 2}},
+			{MinDuration: 15 * time.Minute, MaxDuration: 30 * time.Minute},
+			{MinDuration: 30 * time.Minute, MaxDuration: time.Hour, MoodSummary: MoodSummary{Count: 1, TotalMood: 4}},
+			{MinDuration: time.Hour, MaxDuration: 2 * time.Hour, MoodSummary: MoodSummary{Count: 2, TotalMood: 8}},
+			{MinDuration: 2 * time.Hour, MoodSummary: MoodSummary{Count: 1, TotalMood: 1}},
+		}, stats.Durations)
+
+		// Days are local: in Los Angeles the run at 07:00 UTC on the 1st is
+		// still in December, and the yoga on the 2nd is on the 1st
+		losAngeles, err := time.LoadLocation("America/Los_Angeles")
+		if err != nil {
+			t.Fatalf("Failed to load time zone: %v", err)
+		}
+		stats, err = store.UserMoodStats(MoodFilter{UserID: userID, From: at(1, 0), To: at(31, 0), Period: PeriodMonth, Location: losAngeles})
+		assert.NoError(t, err)
+		assert.Equal(t, []MoodTrendBucket{
+			{PeriodStart: time.Date(2023, 12, 1, 0, 0, 0, 0, losAngeles), MoodSummary: MoodSummary{Count: 1, TotalMood: 4}},
+			{PeriodStart: time.Date(2024, 1, 1, 0, 0, 0, 0, losAngeles), MoodSummary: MoodSummary{Count: 4, TotalMood: 11}},
+		}, stats.Trend)
+		assert.Equal(t, MoodDays{Days: 2, MoodSummary: MoodSummary{Count: 3, TotalMood: 8}}, stats.Activities[1].DaysWith)
+
+		stats, err = store.UserMoodStats(MoodFilter{UserID: otherID, From: at(2, 0), To: at(31, 0), Period: PeriodDay})
+		assert.NoError(t, err)
+		assert.Empty(t, stats.Trend)
+		assert.Empty(t, stats.Activities)
+		assert.Len(t, stats.Durations, len(MoodDurationBounds)+1)
+	})
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"activity-tracker/pkg/model"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+// OverlapPolicy decides what happens when a user activity is written with a
+// time range that overlaps other activities of the same user.
+type OverlapPolicy string
+
+const (
+	// OverlapReject refuses the write with ErrUserActivityOverlaps.
+	OverlapReject OverlapPolicy = "reject"
+	// OverlapWarn allows the write and reports the overlapped activities.
+	OverlapWarn OverlapPolicy = "warn"
+	// OverlapTrim shortens the written activity so it no longer overlaps.
+	OverlapTrim OverlapPolicy = "trim"
+)
+
+// ErrUserActivityOverlaps is returned when a user activity overlaps other
+// activities of the user and the policy does not allow it.
+var ErrUserActivityOverlaps = errors.New("user activity overlaps another activity of the user")
+
+// Overlap reports the other user activities that a written user activity
+// overlapped. Under OverlapTrim the written activity was shortened and no
+// longer overlaps them.
+type Overlap struct {
+	UserActivityIDs []int64
+	Trimmed         bool
+}
+
+// merge returns the overlaps of two writes reported together. Either may be
+// nil if the write did not overlap anything.
+func (o *Overlap) merge(other *Overlap) *Overlap {
+	if o == nil {
+		return other
+	}
+	if other == nil {
+		return o
+	}
+	merged := &Overlap{Trimmed: o.Trimmed || other.Trimmed}
+	merged.UserActivityIDs = append(merged.UserActivityIDs, o.UserActivityIDs...)
+	for _, id := range other.UserActivityIDs {
+		if !slices.Contains(merged.UserActivityIDs, id) {
+			merged.UserActivityIDs = append(merged.UserActivityIDs, id)
+		}
+	}
+	return merged
+}
+
+// resolveOverlap applies the policy to a user activity about to be written
+// and the user's other activities that it overlaps, which must be ordered by
+// start time. Under OverlapTrim the times of userActivity are changed to the
+// first part of its range that is free; if there is none, or under
+// OverlapReject, it returns ErrUserActivityOverlaps.
+func resolveOverlap(policy OverlapPolicy, userActivity *model.UserActivity, overlapping []model.UserActivity) (*Overlap, error) {
+	if len(overlapping) == 0 {
+		return nil, nil
+	}
+	overlap := &Overlap{}
+	for _, other := range overlapping {
+		overlap.UserActivityIDs = append(overlap.UserActivityIDs, other.ID)
+	}
+
+	switch policy {
+	case OverlapWarn:
+		return overlap, nil
+	case OverlapTrim:
+		start, end := userActivity.StartTime, userActivity.EndTime
+		for _, other := range overlapping {
+			if !other.StartTime.After(start) {
+				// The other activity covers the start, so begin after it
+				if other.EndTime.After(start) {
+					start = other.EndTime
+				}
+				continue
+			}
+			if other.StartTime.Before(end) {
+				end = other.StartTime
+			}
+			break
+		}
+		if !start.Before(end) {
+			return nil, fmt.Errorf("%w: it lies entirely within user activities %v", ErrUserActivityOverlaps, overlap.UserActivityIDs)
+		}
+		userActivity.StartTime = start
+		userActivity.EndTime = end
+		userActivity.Duration = model.DurationBetween(start, end)
+		overlap.Trimmed = true
+		return overlap, nil
+	default:
+		return nil, fmt.Errorf("%w: user activities %v", ErrUserActivityOverlaps, overlap.UserActivityIDs)
+	}
+}
+
+// overlaps reports whether two time ranges overlap. Ranges include their start
+// but not their end, so activities that follow on directly do not overlap.
+func overlaps(start, end, otherStart, otherEnd time.Time) bool {
+	return otherStart.Before(end) && otherEnd.After(start)
+}
+
+// findOverlapping returns the user's activities other than exceptID whose
+// time range overlaps the one given, ordered by start time. On Postgres it
+// first locks the user's row, so that concurrent writes for the same user
+// cannot both miss each other; SQLite transactions are serialized already.
+func (r *Repository) findOverlapping(tx *sql.Tx, userID, exceptID int64, start, end time.Time) ([]model.UserActivity, error) {
+	if r.dialect == Postgres {
+		if _, err := tx.Exec(`SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+			return nil, fmt.Errorf("could not lock user: %w", err)
+		}
+	}
+
+	query := `SELECT ` + userActivityColumns + ` FROM user_activities
+			  WHERE user_id = $1 AND id <> $2 AND start_time < $3 AND end_time > $4
+			  ORDER BY start_time, id`
+	rows, err := tx.Query(query, userID, exceptID, end.UTC(), start.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("could not find overlapping user activities: %w", err)
+	}
+	defer rows.Close()
+
+	var overlapping []model.UserActivity
+	for rows.Next() {
+		userActivity, err := scanUserActivity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not find overlapping user activities: %w", err)
+		}
+		overlapping = append(overlapping, *userActivity)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not find overlapping user activities: %w", err)
+	}
+	return overlapping, nil
+}
+
+// findOverlapping returns the user's activities other than exceptID whose
+// time range overlaps the one given, ordered by start time. Callers must hold
+// the lock.
+func (r *MemoryRepository) findOverlapping(userID, exceptID int64, start, end time.Time) []model.UserActivity {
+	var overlapping []model.UserActivity
+	for id, other := range r.userActivities {
+		if id != exceptID && other.UserID == userID && overlaps(start, end, other.StartTime, other.EndTime) {
+			overlapping = append(overlapping, other)
+		}
+	}
+	sort.Slice(overlapping, func(i, j int) bool {
+		return cursorOf(overlapping[i]).before(cursorOf(overlapping[j]))
+	})
+	return overlapping
+}
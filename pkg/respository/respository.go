@@ -1,19 +1,181 @@
 package repository
 
 import (
+	"activity-tracker/pkg/model"
+	"activity-tracker/pkg/password"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Dialect identifies the SQL database a Repository talks to.
+type Dialect int
+
+const (
+	// Postgres is the default dialect.
+	Postgres Dialect = iota
+	// SQLite is used for single-binary deployments and tests.
+	SQLite
 )
 
 // Repository provides methods to interact with the database.
 type Repository struct {
-	db *sql.DB
+	db            *sql.DB
+	dialect       Dialect
+	overlapPolicy OverlapPolicy
 }
 
-// NewRepository creates a new Repository instance.
+// NewRepository creates a new Repository instance backed by Postgres. It
+// rejects overlapping user activities until told otherwise.
 func NewRepository(db *sql.DB) *Repository {
-	return &Repository{db: db}
+	return &Repository{db: db, dialect: Postgres, overlapPolicy: OverlapReject}
+}
+
+// NewSQLiteRepository creates a new Repository instance backed by SQLite.
+// The database must have been opened with foreign keys enabled, and with
+// immediate transactions so that concurrent writers queue up instead of
+// failing.
+func NewSQLiteRepository(db *sql.DB) *Repository {
+	return &Repository{db: db, dialect: SQLite, overlapPolicy: OverlapReject}
+}
+
+// SetOverlapPolicy sets how overlapping user activities are handled.
+func (r *Repository) SetOverlapPolicy(policy OverlapPolicy) {
+	r.overlapPolicy = policy
+}
+
+// Page sizes applied by the list methods.
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 200
+)
+
+// normalizeLimit clamps a requested page size to (0, MaxListLimit].
+func normalizeLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		return MaxListLimit
+	}
+	return limit
+}
+
+// queryArgs collects the arguments of a dynamically built query and hands out
+// their $n placeholders. SQLite numbers parameters in order of appearance, so
+// placeholders must be requested in the order they appear in the query text.
+type queryArgs []interface{}
+
+// add appends value and returns its placeholder.
+func (a *queryArgs) add(value interface{}) string {
+	*a = append(*a, value)
+	return "$" + strconv.Itoa(len(*a))
+}
+
+// expectAffected returns notFound if the statement did not change any row.
+func expectAffected(result sql.Result, notFound error) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not count affected rows: %w", err)
+	}
+	if affected == 0 {
+		return notFound
+	}
+	return nil
 }
 
 // ErrUserNotFound is returned when the user is not found in the database.
 var ErrUserNotFound = errors.New("user not found")
+
+// ErrInvalidCredentials is returned when a username and password do not match a user.
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// verifyPassword checks plain against the password hash of the user returned
+// by a lookup. An unknown user is reported exactly like a wrong password.
+func verifyPassword(user *model.User, lookupErr error, plain string) (*model.User, error) {
+	if errors.Is(lookupErr, ErrUserNotFound) {
+		password.WasteTime(plain)
+		return nil, ErrInvalidCredentials
+	} else if lookupErr != nil {
+		return nil, lookupErr
+	}
+
+	ok, err := password.Verify(user.Password, plain)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// ErrConflict is returned when a write conflicts with an existing record, such
+// as a duplicate value in a unique column.
+var ErrConflict = errors.New("conflicts with an existing record")
+
+// ErrInvalidReference is returned when a write references a record that does
+// not exist, such as an unknown activity ID.
+var ErrInvalidReference = errors.New("references a record that does not exist")
+
+// translateError maps constraint violations reported by the database driver to
+// ErrConflict and ErrInvalidReference, keeping the driver error in the chain.
+func translateError(err error) error {
+	switch {
+	case isUniqueViolation(err):
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	case isForeignKeyViolation(err):
+		return fmt.Errorf("%w: %w", ErrInvalidReference, err)
+	}
+	return err
+}
+
+// isUniqueViolation reports whether err was caused by a unique constraint.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+	return false
+}
+
+// isForeignKeyViolation reports whether err was caused by a foreign key constraint.
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23503"
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		// SQLite enforces ON DELETE RESTRICT with an internal trigger, so
+		// those violations carry the trigger constraint code instead
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey ||
+			sqliteErr.ExtendedCode == sqlite3.ErrConstraintTrigger && strings.Contains(sqliteErr.Error(), "FOREIGN KEY")
+	}
+	return false
+}
+
+// lower returns the SQL expression for the text expression expr in lower case.
+// SQLite's own lower() only handles ASCII letters, so there the fold_case
+// function registered by SQLiteDriver is used instead.
+func (r *Repository) lower(expr string) string {
+	if r.dialect == SQLite {
+		return `fold_case(` + expr + `)`
+	}
+	return `lower(` + expr + `)`
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally when used
+// with ESCAPE '\'.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
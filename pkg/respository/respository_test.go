@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"activity-tracker/pkg/migrations"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+// newTestRepository returns a Repository backed by a fresh, fully migrated
+// in-memory SQLite database.
+func newTestRepository(t *testing.T) *Repository {
+	db, err := sql.Open(SQLiteDriver, "file::memory:?_foreign_keys=on")
+	if err != nil {
+		t.Fatalf("Failed to open the database: %v", err)
+	}
+	// Every connection to :memory: is a separate database, so keep just one
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	migrate(t, db, "sqlite")
+	return NewSQLiteRepository(db)
+}
+
+// testSchemas counts the Postgres schemas created for tests, to name them.
+var testSchemas atomic.Int64
+
+// newPostgresTestRepository returns a Repository backed by a fresh, fully
+// migrated schema in the Postgres database at TEST_DATABASE_URL, which is
+// dropped after the test. The test is skipped if the variable is not set.
+func newPostgresTestRepository(t *testing.T) *Repository {
+	connStr := os.Getenv("TEST_DATABASE_URL")
+	if connStr == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	// The schema is chosen with a connection parameter, so use the key=value form
+	if strings.HasPrefix(connStr, "postgres://") || strings.HasPrefix(connStr, "postgresql://") {
+		var err error
+		if connStr, err = pq.ParseURL(connStr); err != nil {
+			t.Fatalf("Failed to parse TEST_DATABASE_URL: %v", err)
+		}
+	}
+
+	admin, err := sql.Open("postgres", connStr)
+	if err != nil {
+		t.Fatalf("Failed to open the database: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	schema := fmt.Sprintf("test_%d_%d", os.Getpid(), testSchemas.Add(1))
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`); err != nil {
+			t.Errorf("Failed to drop schema: %v", err)
+		}
+	})
+
+	db, err := sql.Open("postgres", connStr+" search_path="+schema)
+	if err != nil {
+		t.Fatalf("Failed to open the database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrate(t, db, "postgres")
+	return NewRepository(db)
+}
+
+// migrate applies every migration of the driver to db.
+func migrate(t *testing.T, db *sql.DB, driver string) {
+	t.Helper()
+	migrator, err := migrations.NewMigrator(db, driver)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Failed to apply migrations: %v", err)
+	}
+}
+
+// testStore is implemented by both the SQL and the in-memory repositories.
+type testStore interface {
+	UserStore
+	ActivityStore
+	CategoryStore
+	UserActivityStore
+	TimerStore
+	StatsStore
+	GoalStore
+	SymptomStore
+	TagStore
+	SetOverlapPolicy(policy OverlapPolicy)
+}
+
+// forEachStore runs test against a fresh SQLite repository, a fresh in-memory
+// repository and, if TEST_DATABASE_URL is set, a fresh Postgres repository, to
+// check that they behave the same.
+func forEachStore(t *testing.T, test func(t *testing.T, store testStore)) {
+	t.Run("sqlite", func(t *testing.T) { test(t, newTestRepository(t)) })
+	t.Run("memory", func(t *testing.T) { test(t, NewMemoryRepository()) })
+	t.Run("postgres", func(t *testing.T) { test(t, newPostgresTestRepository(t)) })
+}
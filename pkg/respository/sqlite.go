@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"activity-tracker/pkg/model"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// SQLiteDriver is the database/sql driver name to open SQLite databases used
+// with NewSQLiteRepository. It is the go-sqlite3 driver with the extra SQL
+// functions that the repository's queries need.
+const SQLiteDriver = "sqlite3_activity_tracker"
+
+func init() {
+	sql.Register(SQLiteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if err := conn.RegisterFunc("local_time", localTime, true); err != nil {
+				return err
+			}
+			return conn.RegisterFunc("fold_case", foldCase, true)
+		},
+	})
+}
+
+// locations caches loaded time zones by name, since local_time is called for
+// every row.
+var locations sync.Map
+
+// localTime implements the SQL function local_time(timestamp, time_zone). It
+// converts a timestamp stored by go-sqlite3 into the wall clock time in an
+// IANA time zone, formatted for SQLite's date functions. SQLite has no time
+// zone database, so this is how daylight saving time is taken into account.
+func localTime(timestamp, timeZone string) (string, error) {
+	cached, ok := locations.Load(timeZone)
+	if !ok {
+		location, err := model.LoadTimeZone(timeZone)
+		if err != nil {
+			return "", err
+		}
+		cached, _ = locations.LoadOrStore(timeZone, location)
+	}
+
+	for _, format := range sqlite3.SQLiteTimestampFormats {
+		if t, err := time.Parse(format, timestamp); err == nil {
+			return t.In(cached.(*time.Location)).Format("2006-01-02 15:04:05"), nil
+		}
+	}
+	return "", fmt.Errorf("could not parse timestamp %q", timestamp)
+}
+
+// foldCase implements the SQL function fold_case(text). It lower-cases every
+// letter, as Postgres' lower() and the memory store do, where SQLite's lower()
+// only handles ASCII letters. The unique indexes on names use it, so databases
+// with this schema must be opened with SQLiteDriver.
+func foldCase(text string) string {
+	return strings.ToLower(text)
+}
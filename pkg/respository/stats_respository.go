@@ -0,0 +1,285 @@
+package repository
+
+import (
+	"activity-tracker/pkg/model"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// StatsPeriod is the length of the periods that statistics are grouped by.
+type StatsPeriod string
+
+// Periods of statistics. Weeks start on Monday.
+const (
+	PeriodDay   StatsPeriod = "day"
+	PeriodWeek  StatsPeriod = "week"
+	PeriodMonth StatsPeriod = "month"
+)
+
+// StatsFilter selects the user activities that statistics are computed over
+// and how they are grouped. Periods are calendar days, weeks or months in
+// Location, or in UTC if it is nil, so they follow daylight saving time.
+// Grouped by tag, a user activity counts towards each of its tags, and those
+// without tags are left out.
+//
+// CategoryID restricts the statistics to activities in that category or
+// below it. Grouped by category, user activities roll up to the children of
+// CategoryID, or to the top-level categories if it is nil, while those of
+// activities directly in CategoryID have a bucket of their own. Activities
+// outside the category, or without one, are left out of both.
+type StatsFilter struct {
+	UserID     int64
+	From       time.Time // inclusive start time
+	To         time.Time // exclusive start time
+	Period     StatsPeriod
+	Location   *time.Location
+	ByActivity bool
+	ByTag      bool
+	CategoryID *int64
+	ByCategory bool
+}
+
+// location returns the time zone that the filter's periods are in.
+func (f StatsFilter) location() *time.Location {
+	if f.Location == nil {
+		return time.UTC
+	}
+	return f.Location
+}
+
+// StatsBucket summarizes the user activities that started in one period and,
+// if grouped by activity, tag or category, were of one activity, had one tag
+// or rolled up to one category. PeriodStart is local midnight at the start of
+// the period.
+type StatsBucket struct {
+	PeriodStart   time.Time
+	ActivityID    int64 // 0 unless grouped by activity
+	TagID         int64 // 0 unless grouped by tag
+	CategoryID    int64 // 0 unless grouped by category
+	Count         int64
+	TotalDuration time.Duration
+	Mood          MoodSummary // of the user activities with a mood on the scale
+}
+
+// AverageDuration returns the mean duration of the bucket's user activities.
+func (b StatsBucket) AverageDuration() time.Duration {
+	if b.Count == 0 {
+		return 0
+	}
+	return b.TotalDuration / time.Duration(b.Count)
+}
+
+// AverageMood returns the mean mood of the bucket's user activities that have
+// one, or 0 if none has.
+func (b StatsBucket) AverageMood() float64 {
+	return b.Mood.Average()
+}
+
+// SumStats adds buckets up into one covering all of them. Buckets grouped by
+// tag can count a user activity more than once.
+func SumStats(buckets []StatsBucket) StatsBucket {
+	var total StatsBucket
+	for _, bucket := range buckets {
+		total.Count += bucket.Count
+		total.TotalDuration += bucket.TotalDuration
+		total.Mood.Count += bucket.Mood.Count
+		total.Mood.TotalMood += bucket.Mood.TotalMood
+	}
+	return total
+}
+
+// periodStartFormat is the layout of the period starts computed in SQL.
+const periodStartFormat = "2006-01-02"
+
+// periodStartSQL returns the SQL expression for the local date that the
+// period start_time falls in begins on, formatted as periodStartFormat, adding
+// the time zone to args.
+func (r *Repository) periodStartSQL(args *queryArgs, period StatsPeriod, location *time.Location) (string, error) {
+	if r.dialect == Postgres {
+		switch period {
+		case PeriodDay, PeriodWeek, PeriodMonth:
+			// date_trunc weeks start on Monday, as ISO weeks do
+			return fmt.Sprintf(`to_char(date_trunc('%s', start_time AT TIME ZONE %s::text), 'YYYY-MM-DD')`,
+				period, args.add(location.String())), nil
+		}
+	} else {
+		// local_time is registered by SQLiteDriver
+		switch period {
+		case PeriodDay:
+			return fmt.Sprintf(`date(local_time(start_time, %s))`, args.add(location.String())), nil
+		case PeriodWeek:
+			// Move to the coming Sunday, unless it is one, and back to Monday
+			return fmt.Sprintf(`date(local_time(start_time, %s), 'weekday 0', '-6 days')`, args.add(location.String())), nil
+		case PeriodMonth:
+			return fmt.Sprintf(`date(local_time(start_time, %s), 'start of month')`, args.add(location.String())), nil
+		}
+	}
+	return "", fmt.Errorf("unknown stats period %q", period)
+}
+
+// UserActivityStats returns the statistics of a user's activities that
+// started in the filter's range, one bucket per period and, if requested,
+// activity, tag and category, ordered by period, activity, tag and category.
+// Periods without activities are left out. Categories are rolled up with a
+// recursive query.
+func (r *Repository) UserActivityStats(filter StatsFilter) ([]StatsBucket, error) {
+	var args queryArgs
+	with := ""
+	if filter.CategoryID != nil || filter.ByCategory {
+		with = categoryRollupSQL(&args, filter.CategoryID)
+	}
+	periodStart, err := r.periodStartSQL(&args, filter.Period, filter.location())
+	if err != nil {
+		return nil, err
+	}
+	activityColumn, tagColumn, categoryColumn, from := "0", "0", "0", "user_activities"
+	if filter.ByActivity {
+		activityColumn = "user_activities.activity_id"
+	}
+	if filter.ByTag {
+		tagColumn = "tag_id"
+		from += " JOIN user_activity_tags ON user_activity_id = user_activities.id"
+	}
+	if with != "" {
+		from += ` JOIN activities ON activities.id = user_activities.activity_id
+			  JOIN category_rollup ON category_rollup.id = activities.category_id`
+	}
+	if filter.ByCategory {
+		categoryColumn = "category_rollup.bucket"
+	}
+
+	// Only moods on the scale count towards the average mood
+	rated := fmt.Sprintf(`mood BETWEEN %d AND %d`, model.MinMood, model.MaxMood)
+	query := fmt.Sprintf(`%sSELECT %s AS period_start, %s AS activity, %s AS tag, %s AS category, COUNT(*), SUM(duration_seconds),
+			  SUM(CASE WHEN %s THEN 1 ELSE 0 END), SUM(CASE WHEN %s THEN mood ELSE 0 END)
+			  FROM %s WHERE user_activities.user_id = %s AND start_time >= %s AND start_time < %s
+			  GROUP BY 1, 2, 3, 4 ORDER BY 1, 2, 3, 4`,
+		with, periodStart, activityColumn, tagColumn, categoryColumn, rated, rated, from,
+		args.add(filter.UserID), args.add(filter.From.UTC()), args.add(filter.To.UTC()))
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not compute user activity stats: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := []StatsBucket{}
+	for rows.Next() {
+		var bucket StatsBucket
+		var periodStart string
+		var durationSeconds int64
+		if err := rows.Scan(&periodStart, &bucket.ActivityID, &bucket.TagID, &bucket.CategoryID, &bucket.Count, &durationSeconds,
+			&bucket.Mood.Count, &bucket.Mood.TotalMood); err != nil {
+			return nil, fmt.Errorf("could not compute user activity stats: %w", err)
+		}
+		if bucket.PeriodStart, err = time.ParseInLocation(periodStartFormat, periodStart, filter.location()); err != nil {
+			return nil, fmt.Errorf("could not compute user activity stats: %w", err)
+		}
+		bucket.TotalDuration = time.Duration(durationSeconds) * time.Second
+		buckets = append(buckets, bucket)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not compute user activity stats: %w", err)
+	}
+	return buckets, nil
+}
+
+// UserActivityStats returns the statistics of a user's activities as
+// Repository does.
+func (r *MemoryRepository) UserActivityStats(filter StatsFilter) ([]StatsBucket, error) {
+	type key struct {
+		periodStart time.Time
+		activityID  int64
+		tagID       int64
+		categoryID  int64
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	byKey := make(map[key]*StatsBucket)
+	for _, userActivity := range r.userActivities {
+		if userActivity.UserID != filter.UserID || userActivity.StartTime.Before(filter.From) || !userActivity.StartTime.Before(filter.To) {
+			continue
+		}
+		periodStart, err := periodStartOf(userActivity.StartTime, filter.Period, filter.location())
+		if err != nil {
+			return nil, err
+		}
+		k := key{periodStart: periodStart}
+		if filter.ByActivity {
+			k.activityID = userActivity.ActivityID
+		}
+		if filter.CategoryID != nil || filter.ByCategory {
+			categoryID := r.activities[userActivity.ActivityID].CategoryID
+			if categoryID == nil {
+				continue
+			}
+			bucket, ok := r.rollUpCategory(*categoryID, filter.CategoryID)
+			if !ok {
+				continue
+			}
+			if filter.ByCategory {
+				k.categoryID = bucket
+			}
+		}
+		tagIDs := []int64{0}
+		if filter.ByTag {
+			tagIDs = userActivity.TagIDs
+		}
+		for _, tagID := range tagIDs {
+			k.tagID = tagID
+			bucket, ok := byKey[k]
+			if !ok {
+				bucket = &StatsBucket{PeriodStart: k.periodStart, ActivityID: k.activityID, TagID: k.tagID, CategoryID: k.categoryID}
+				byKey[k] = bucket
+			}
+			addToBucket(bucket, userActivity)
+		}
+	}
+
+	buckets := make([]StatsBucket, 0, len(byKey))
+	for _, bucket := range byKey {
+		buckets = append(buckets, *bucket)
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		if !buckets[i].PeriodStart.Equal(buckets[j].PeriodStart) {
+			return buckets[i].PeriodStart.Before(buckets[j].PeriodStart)
+		}
+		if buckets[i].ActivityID != buckets[j].ActivityID {
+			return buckets[i].ActivityID < buckets[j].ActivityID
+		}
+		if buckets[i].TagID != buckets[j].TagID {
+			return buckets[i].TagID < buckets[j].TagID
+		}
+		return buckets[i].CategoryID < buckets[j].CategoryID
+	})
+	return buckets, nil
+}
+
+// addToBucket counts a user activity in a bucket.
+func addToBucket(bucket *StatsBucket, userActivity model.UserActivity) {
+	bucket.Count++
+	bucket.TotalDuration += userActivity.Duration
+	if userActivity.Mood >= model.MinMood && userActivity.Mood <= model.MaxMood {
+		bucket.Mood.add(userActivity.Mood)
+	}
+}
+
+// periodStartOf returns local midnight at the start of the period that t
+// falls in, in the given time zone.
+func periodStartOf(t time.Time, period StatsPeriod, location *time.Location) (time.Time, error) {
+	local := t.In(location)
+	year, month, day := local.Date()
+	switch period {
+	case PeriodDay:
+		return time.Date(year, month, day, 0, 0, 0, 0, location), nil
+	case PeriodWeek:
+		// Weekday counts from Sunday, weeks start on Monday
+		daysSinceMonday := (int(local.Weekday()) + 6) % 7
+		return time.Date(year, month, day-daysSinceMonday, 0, 0, 0, 0, location), nil
+	case PeriodMonth:
+		return time.Date(year, month, 1, 0, 0, 0, 0, location), nil
+	}
+	return time.Time{}, fmt.Errorf("unknown stats period %q", period)
+}
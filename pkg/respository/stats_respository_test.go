@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"activity-tracker/pkg/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserActivityStats(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store testStore) {
+		userID, err := store.CreateUser(&model.User{Username: "counter", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		otherID, err := store.CreateUser(&model.User{Username: "someone else", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		runningID, err := store.CreateActivity(&model.Activity{Name: "Running"})
+		if err != nil {
+			t.Fatalf("Failed to create activity: %v", err)
+		}
+		yogaID, err := store.CreateActivity(&model.Activity{Name: "Yoga"})
+		if err != nil {
+			t.Fatalf("Failed to create activity: %v", err)
+		}
+
+		record := func(userID, activityID int64, start time.Time, minutes, mood int) {
+			t.Helper()
+			duration := time.Duration(minutes) * time.Minute
+			_, _, err := store.CreateUserActivity(&model.UserActivity{
+				UserID: userID, ActivityID: activityID, StartTime: start, EndTime: start.Add(duration), Duration: duration, Mood: mood,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create user activity: %v", err)
+			}
+		}
+		// Wednesday 29 May to Monday 3 June 2024, across a month and a week boundary
+		record(userID, runningID, time.Date(2024, 5, 29, 7, 0, 0, 0, time.UTC), 30, 4)
+		record(userID, yogaID, time.Date(2024, 5, 29, 18, 0, 0, 0, time.UTC), 60, 5)
+		record(userID, runningID, time.Date(2024, 6, 2, 23, 30, 0, 0, time.UTC), 20, 2)
+		record(userID, runningID, time.Date(2024, 6, 3, 6, 0, 0, 0, time.UTC), 40, 3)
+		record(userID, runningID, time.Date(2024, 7, 1, 6, 0, 0, 0, time.UTC), 40, 3) // outside the range
+		record(otherID, runningID, time.Date(2024, 5, 29, 7, 0, 0, 0, time.UTC), 30, 1)
+
+		filter := StatsFilter{
+			UserID: userID,
+			From:   time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+			To:     time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC),
+			Period: PeriodDay,
+		}
+		day := func(month time.Month, day int) time.Time { return time.Date(2024, month, day, 0, 0, 0, 0, time.UTC) }
+
+		daily, err := store.UserActivityStats(filter)
+		assert.NoError(t, err)
+		assert.Equal(t, []StatsBucket{
+			{PeriodStart: day(5, 29), Count: 2, TotalDuration: 90 * time.Minute, Mood: MoodSummary{Count: 2, TotalMood: 9}},
+			{PeriodStart: day(6, 2), Count: 1, TotalDuration: 20 * time.Minute, Mood: MoodSummary{Count: 1, TotalMood: 2}},
+			{PeriodStart: day(6, 3), Count: 1, TotalDuration: 40 * time.Minute, Mood: MoodSummary{Count: 1, TotalMood: 3}},
+		}, daily)
+
+		filter.Period = PeriodWeek
+		weekly, err := store.UserActivityStats(filter)
+		assert.NoError(t, err)
+		assert.Equal(t, []StatsBucket{
+			{PeriodStart: day(5, 27), Count: 3, TotalDuration: 110 * time.Minute, Mood: MoodSummary{Count: 3, TotalMood: 11}},
+			{PeriodStart: day(6, 3), Count: 1, TotalDuration: 40 * time.Minute, Mood: MoodSummary{Count: 1, TotalMood: 3}},
+		}, weekly)
+
+		filter.Period = PeriodMonth
+		filter.ByActivity = true
+		monthly, err := store.UserActivityStats(filter)
+		assert.NoError(t, err)
+		assert.Equal(t, []StatsBucket{
+			{PeriodStart: day(5, 1), ActivityID: runningID, Count: 1, TotalDuration: 30 * time.Minute, Mood: MoodSummary{Count: 1, TotalMood: 4}},
+			{PeriodStart: day(5, 1), ActivityID: yogaID, Count: 1, TotalDuration: 60 * time.Minute, Mood: MoodSummary{Count: 1, TotalMood: 5}},
+			{PeriodStart: day(6, 1), ActivityID: runningID, Count: 2, TotalDuration: 60 * time.Minute, Mood: MoodSummary{Count: 2, TotalMood: 5}},
+		}, monthly)
+
+		total := SumStats(monthly)
+		assert.Equal(t, int64(4), total.Count)
+		assert.Equal(t, 150*time.Minute/4, total.AverageDuration())
+		assert.Equal(t, 3.5, total.AverageMood())
+
+		filter.Period = "fortnight"
+		_, err = store.UserActivityStats(filter)
+		assert.Error(t, err)
+	})
+}
+
+func TestUserActivityStatsAverageOnlyRatedMoods(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store testStore) {
+		userID, err := store.CreateUser(&model.User{Username: "unrated", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		activityID, err := store.CreateActivity(&model.Activity{Name: "Walking"})
+		if err != nil {
+			t.Fatalf("Failed to create activity: %v", err)
+		}
+		// Records from before moods were required have a mood of 0
+		start := time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC)
+		for i, mood := range []int{0, 4, 0} {
+			start := start.AddDate(0, 0, i*3)
+			_, _, err := store.CreateUserActivity(&model.UserActivity{
+				UserID: userID, ActivityID: activityID, StartTime: start, EndTime: start.Add(time.Hour), Duration: time.Hour, Mood: mood,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create user activity: %v", err)
+			}
+		}
+
+		buckets, err := store.UserActivityStats(StatsFilter{
+			UserID: userID,
+			From:   time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+			To:     time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+			Period: PeriodWeek,
+		})
+		assert.NoError(t, err)
+		if assert.Len(t, buckets, 2) {
+			assert.Equal(t, MoodSummary{Count: 1, TotalMood: 4}, buckets[0].Mood)
+			assert.Equal(t, 4.0, buckets[0].AverageMood())
+			assert.Equal(t, int64(1), buckets[1].Count)
+			assert.Equal(t, MoodSummary{}, buckets[1].Mood)
+		}
+		assert.Equal(t, 4.0, SumStats(buckets).AverageMood())
+	})
+}
+
+func TestUserActivityStatsInTimeZone(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("Failed to load time zone: %v", err)
+	}
+
+	forEachStore(t, func(t *testing.T, store testStore) {
+		userID, err := store.CreateUser(&model.User{Username: "new yorker", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		activityID, err := store.CreateActivity(&model.Activity{Name: "Running"})
+		if err != nil {
+			t.Fatalf("Failed to create activity: %v", err)
+		}
+		record := func(start time.Time) {
+			t.Helper()
+			_, _, err := store.CreateUserActivity(&model.UserActivity{
+				UserID: userID, ActivityID: activityID, StartTime: start, EndTime: start.Add(time.Hour), Duration: time.Hour, Mood: 3,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create user activity: %v", err)
+			}
+		}
+		// Clocks go forward at 2am on Sunday 10 March 2024, so these late
+		// evenings are on the next day in UTC at different offsets
+		record(time.Date(2024, 3, 9, 23, 30, 0, 0, newYork))  // 04:30 UTC on the 10th
+		record(time.Date(2024, 3, 10, 23, 30, 0, 0, newYork)) // 03:30 UTC on Monday the 11th
+		record(time.Date(2024, 3, 31, 22, 0, 0, 0, newYork))  // 02:00 UTC on 1 April
+
+		filter := StatsFilter{
+			UserID:   userID,
+			From:     time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			To:       time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+			Period:   PeriodDay,
+			Location: newYork,
+		}
+		day := func(month time.Month, day int) time.Time { return time.Date(2024, month, day, 0, 0, 0, 0, newYork) }
+		bucket := func(periodStart time.Time, count int64) StatsBucket {
+			return StatsBucket{PeriodStart: periodStart, Count: count, TotalDuration: time.Duration(count) * time.Hour, Mood: MoodSummary{Count: count, TotalMood: 3 * count}}
+		}
+
+		daily, err := store.UserActivityStats(filter)
+		assert.NoError(t, err)
+		assert.Equal(t, []StatsBucket{bucket(day(3, 9), 1), bucket(day(3, 10), 1), bucket(day(3, 31), 1)}, daily)
+
+		filter.Period = PeriodWeek
+		weekly, err := store.UserActivityStats(filter)
+		assert.NoError(t, err)
+		assert.Equal(t, []StatsBucket{bucket(day(3, 4), 2), bucket(day(3, 25), 1)}, weekly)
+
+		filter.Period = PeriodMonth
+		monthly, err := store.UserActivityStats(filter)
+		assert.NoError(t, err)
+		assert.Equal(t, []StatsBucket{bucket(day(3, 1), 3)}, monthly)
+
+		// The same activities in UTC
+		filter.Location = nil
+		monthly, err = store.UserActivityStats(filter)
+		assert.NoError(t, err)
+		assert.Equal(t, []StatsBucket{
+			{PeriodStart: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), Count: 2, TotalDuration: 2 * time.Hour, Mood: MoodSummary{Count: 2, TotalMood: 6}},
+			{PeriodStart: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), Count: 1, TotalDuration: time.Hour, Mood: MoodSummary{Count: 1, TotalMood: 3}},
+		}, monthly)
+	})
+}
@@ -0,0 +1,121 @@
+package repository
+
+import "activity-tracker/pkg/model"
+
+// UserStore persists users.
+type UserStore interface {
+	CreateUser(user *model.User) (int64, error)
+	GetUser(userID int64) (*model.User, error)
+	UpdateUser(user *model.User) error
+	DeleteUser(userID int64) error
+	SetUserAdmin(userID int64, admin bool) error
+	VerifyCredentials(username, password string) (*model.User, error)
+}
+
+// ActivityStore persists the activity catalog: global activities, and the
+// private activities of each user. Activities that are not visible to the
+// given user are reported as not found.
+type ActivityStore interface {
+	CreateActivity(activity *model.Activity) (int64, error)
+	GetActivity(userID, activityID int64) (*model.Activity, error)
+	ListActivities(filter ActivityFilter) ([]model.Activity, error)
+	UpdateActivity(activity *model.Activity) error
+	DeleteActivity(activityID int64) error
+}
+
+// CategoryStore persists the tree of categories that activities are filed
+// under.
+type CategoryStore interface {
+	CreateCategory(category *model.Category) (int64, error)
+	GetCategory(categoryID int64) (*model.Category, error)
+	ListCategories() ([]model.Category, error)
+	UpdateCategory(category *model.Category) error
+	DeleteCategory(categoryID int64) error
+}
+
+// UserActivityStore persists the activities recorded by users. Every record
+// belongs to a user, and records of other users are reported as not found.
+// Writes report the other activities they overlapped, if the overlap policy
+// allowed them.
+type UserActivityStore interface {
+	CreateUserActivity(userActivity *model.UserActivity) (int64, *Overlap, error)
+	GetUserActivity(userID, userActivityID int64) (*model.UserActivity, error)
+	ListUserActivities(filter UserActivityFilter) ([]model.UserActivity, *Cursor, error)
+	UpdateUserActivity(userActivity *model.UserActivity) (*Overlap, error)
+	DeleteUserActivity(userID, userActivityID int64) error
+}
+
+// TimerStore persists the timers of activities that are still being recorded.
+// A user has at most one running timer, and timers of other users are
+// reported as not found.
+type TimerStore interface {
+	CreateTimer(timer *model.Timer) (int64, error)
+	GetTimer(userID, timerID int64) (*model.Timer, error)
+	ListTimers(userID int64) ([]model.Timer, error)
+	UpdateTimer(timer, previous *model.Timer) error
+	DeleteTimer(userID, timerID int64) error
+	StopTimer(userID, timerID int64, userActivities []model.UserActivity) ([]int64, *Overlap, error)
+}
+
+// GoalStore persists the goals that users set and computes their progress.
+// Goals of other users are reported as not found.
+type GoalStore interface {
+	CreateGoal(goal *model.Goal) (int64, error)
+	GetGoal(userID, goalID int64) (*model.Goal, error)
+	ListGoals(userID int64) ([]model.Goal, error)
+	UpdateGoal(goal *model.Goal) error
+	DeleteGoal(userID, goalID int64) error
+	GoalProgress(filter GoalProgressFilter) ([]GoalProgress, error)
+}
+
+// SymptomStore persists the symptom journals of users and attributes their
+// symptoms to the activities they followed. Symptoms of other users are
+// reported as not found.
+type SymptomStore interface {
+	CreateSymptom(symptom *model.Symptom) (int64, error)
+	GetSymptom(userID, symptomID int64) (*model.Symptom, error)
+	ListSymptoms(filter SymptomFilter) ([]model.Symptom, error)
+	UpdateSymptom(symptom *model.Symptom) error
+	DeleteSymptom(userID, symptomID int64) error
+	AnalyzeSymptoms(filter SymptomAnalysisFilter) (*SymptomAnalysis, error)
+}
+
+// TagStore persists the tags that users define for their activities. Tags of
+// other users are reported as not found.
+type TagStore interface {
+	CreateTag(tag *model.Tag) (int64, error)
+	GetTag(userID, tagID int64) (*model.Tag, error)
+	ListTags(userID int64) ([]model.Tag, error)
+	UpdateTag(tag *model.Tag) error
+	DeleteTag(userID, tagID int64) error
+}
+
+// StatsStore computes statistics, streaks and mood analyses over the
+// activities recorded by users.
+type StatsStore interface {
+	UserActivityStats(filter StatsFilter) ([]StatsBucket, error)
+	UserStreaks(filter StreakFilter) ([]Streak, error)
+	UserMoodStats(filter MoodFilter) (*MoodStats, error)
+}
+
+// Both the SQL and in-memory repositories implement every store.
+var (
+	_ UserStore         = (*Repository)(nil)
+	_ ActivityStore     = (*Repository)(nil)
+	_ CategoryStore     = (*Repository)(nil)
+	_ UserActivityStore = (*Repository)(nil)
+	_ TimerStore        = (*Repository)(nil)
+	_ StatsStore        = (*Repository)(nil)
+	_ GoalStore         = (*Repository)(nil)
+	_ SymptomStore      = (*Repository)(nil)
+	_ TagStore          = (*Repository)(nil)
+	_ UserStore         = (*MemoryRepository)(nil)
+	_ ActivityStore     = (*MemoryRepository)(nil)
+	_ CategoryStore     = (*MemoryRepository)(nil)
+	_ UserActivityStore = (*MemoryRepository)(nil)
+	_ TimerStore        = (*MemoryRepository)(nil)
+	_ StatsStore        = (*MemoryRepository)(nil)
+	_ GoalStore         = (*MemoryRepository)(nil)
+	_ SymptomStore      = (*MemoryRepository)(nil)
+	_ TagStore          = (*MemoryRepository)(nil)
+)
@@ -0,0 +1,251 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StreakCadence is how often a user must do an activity to keep a streak.
+type StreakCadence string
+
+// Cadences of streaks. Weeks start on Monday.
+const (
+	CadenceDaily  StreakCadence = "daily"
+	CadenceWeekly StreakCadence = "weekly"
+)
+
+// StreakFilter selects whose streaks are computed and the rules they follow.
+// A period is a day, or a week with the weekly cadence, in Location, or in
+// UTC if it is nil. It is achieved on any day with an activity, or with the
+// weekly cadence in a week with activities on at least TimesPerWeek days.
+// Up to Tolerance periods in a row may be missed, such as rest days, without
+// breaking a streak.
+type StreakFilter struct {
+	UserID       int64
+	Cadence      StreakCadence
+	TimesPerWeek int
+	Tolerance    int
+	Location     *time.Location
+}
+
+// location returns the time zone that the filter's periods are in.
+func (f StreakFilter) location() *time.Location {
+	if f.Location == nil {
+		return time.UTC
+	}
+	return f.Location
+}
+
+// periodOf returns the number of the period that t falls in, counting from
+// the one containing 1 January 1970.
+func (f StreakFilter) periodOf(t time.Time) int64 {
+	year, month, day := t.In(f.location()).Date()
+	days := time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix() / (24 * 60 * 60)
+	if f.Cadence == CadenceWeekly {
+		// 1 January 1970 was a Thursday, three days into its week
+		return (days + 3) / 7
+	}
+	return days
+}
+
+// periodStart returns local midnight at the start of a numbered period.
+func (f StreakFilter) periodStart(period int64) time.Time {
+	if f.Cadence == CadenceWeekly {
+		return time.Date(1969, 12, 29+7*int(period), 0, 0, 0, 0, f.location())
+	}
+	return time.Date(1970, 1, 1+int(period), 0, 0, 0, 0, f.location())
+}
+
+// Streak is a run of achieved periods, each at most Tolerance missed periods
+// after the previous one.
+type Streak struct {
+	ActivityID int64     // 0 for streaks of any activity
+	Start      time.Time // start of the first achieved period
+	End        time.Time // start of the last achieved period
+	Length     int64     // number of achieved periods
+}
+
+// StreakSummary holds the current and longest streak of one activity, or of
+// any activity. Either is nil if there is none.
+type StreakSummary struct {
+	ActivityID int64
+	Current    *Streak
+	Longest    *Streak
+}
+
+// SummarizeStreaks picks the current and longest streak of every activity
+// from the streaks of filter, in the order of the streaks. A streak is
+// current if no more than the tolerated number of periods were missed since
+// its end, not counting the period containing now, which is not over yet.
+// The longest streak is the earliest one of the greatest length.
+func SummarizeStreaks(filter StreakFilter, streaks []Streak, now time.Time) []StreakSummary {
+	currentPeriod := filter.periodOf(now)
+	summaries := []StreakSummary{}
+	for i := range streaks {
+		streak := &streaks[i]
+		if len(summaries) == 0 || summaries[len(summaries)-1].ActivityID != streak.ActivityID {
+			summaries = append(summaries, StreakSummary{ActivityID: streak.ActivityID})
+		}
+		summary := &summaries[len(summaries)-1]
+		if summary.Longest == nil || streak.Length > summary.Longest.Length {
+			summary.Longest = streak
+		}
+		if currentPeriod-filter.periodOf(streak.End)-1 <= int64(filter.Tolerance) {
+			summary.Current = streak
+		}
+	}
+	return summaries
+}
+
+// validateStreakFilter checks the cadence and its rules.
+func validateStreakFilter(filter StreakFilter) error {
+	switch filter.Cadence {
+	case CadenceDaily:
+	case CadenceWeekly:
+		if filter.TimesPerWeek < 1 || filter.TimesPerWeek > 7 {
+			return fmt.Errorf("weekly streaks need between 1 and 7 times per week, not %d", filter.TimesPerWeek)
+		}
+	default:
+		return fmt.Errorf("unknown streak cadence %q", filter.Cadence)
+	}
+	if filter.Tolerance < 0 {
+		return fmt.Errorf("streak tolerance must not be negative, not %d", filter.Tolerance)
+	}
+	return nil
+}
+
+// UserStreaks returns every streak of a user, both of any activity and of
+// each activity, ordered by activity, with 0 first, and start. It finds the
+// streaks as islands of achieved periods in SQL.
+func (r *Repository) UserStreaks(filter StreakFilter) ([]Streak, error) {
+	if err := validateStreakFilter(filter); err != nil {
+		return nil, err
+	}
+
+	var args queryArgs
+	var localDay, period string
+	if r.dialect == Postgres {
+		localDay = fmt.Sprintf(`(start_time AT TIME ZONE %s::text)::date`, args.add(filter.location().String()))
+		period = `day - DATE '1970-01-01'`
+		if filter.Cadence == CadenceWeekly {
+			period = `(day - DATE '1969-12-29') / 7`
+		}
+	} else {
+		// local_time is registered by SQLiteDriver
+		localDay = fmt.Sprintf(`date(local_time(start_time, %s))`, args.add(filter.location().String()))
+		period = `CAST(julianday(day) - julianday('1970-01-01') AS INTEGER)`
+		if filter.Cadence == CadenceWeekly {
+			period = `CAST(julianday(day) - julianday('1969-12-29') AS INTEGER) / 7`
+		}
+	}
+	// Days with activities of any activity count under activity 0
+	query := []string{fmt.Sprintf(`WITH days AS (
+			SELECT DISTINCT activity_id, %s AS day FROM user_activities WHERE user_id = %s
+		), activity_days AS (
+			SELECT activity_id, day FROM days UNION SELECT 0, day FROM days
+		), periods AS (`, localDay, args.add(filter.UserID))}
+	if filter.Cadence == CadenceWeekly {
+		query = append(query, fmt.Sprintf(`SELECT activity_id, %s AS period FROM activity_days
+			GROUP BY 1, 2 HAVING COUNT(*) >= %s`, period, args.add(filter.TimesPerWeek)))
+	} else {
+		query = append(query, fmt.Sprintf(`SELECT activity_id, %s AS period FROM activity_days`, period))
+	}
+	// A period starts a new island unless it follows the previous achieved
+	// one within the tolerance
+	query = append(query, fmt.Sprintf(`), flagged AS (
+			SELECT activity_id, period,
+				CASE WHEN period - LAG(period) OVER (PARTITION BY activity_id ORDER BY period) <= %s THEN 0 ELSE 1 END AS starts_island
+			FROM periods
+		), islands AS (
+			SELECT activity_id, period, SUM(starts_island) OVER (PARTITION BY activity_id ORDER BY period) AS island
+			FROM flagged
+		)
+		SELECT activity_id, MIN(period), MAX(period), COUNT(*) FROM islands
+		GROUP BY activity_id, island ORDER BY activity_id, 2`, args.add(filter.Tolerance+1)))
+
+	rows, err := r.db.Query(strings.Join(query, "\n"), args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not compute user streaks: %w", err)
+	}
+	defer rows.Close()
+
+	streaks := []Streak{}
+	for rows.Next() {
+		var streak Streak
+		var first, last int64
+		if err := rows.Scan(&streak.ActivityID, &first, &last, &streak.Length); err != nil {
+			return nil, fmt.Errorf("could not compute user streaks: %w", err)
+		}
+		streak.Start, streak.End = filter.periodStart(first), filter.periodStart(last)
+		streaks = append(streaks, streak)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not compute user streaks: %w", err)
+	}
+	return streaks, nil
+}
+
+// UserStreaks returns every streak of a user as Repository does.
+func (r *MemoryRepository) UserStreaks(filter StreakFilter) ([]Streak, error) {
+	if err := validateStreakFilter(filter); err != nil {
+		return nil, err
+	}
+
+	// Distinct local days with activities, by period and activity
+	type key struct {
+		activityID int64
+		period     int64
+	}
+	daily := StreakFilter{Cadence: CadenceDaily, Location: filter.Location}
+	days := make(map[key]map[int64]bool)
+	r.mu.RLock()
+	for _, userActivity := range r.userActivities {
+		if userActivity.UserID != filter.UserID {
+			continue
+		}
+		period := filter.periodOf(userActivity.StartTime)
+		for _, activityID := range []int64{0, userActivity.ActivityID} {
+			k := key{activityID: activityID, period: period}
+			if days[k] == nil {
+				days[k] = make(map[int64]bool)
+			}
+			days[k][daily.periodOf(userActivity.StartTime)] = true
+		}
+	}
+	r.mu.RUnlock()
+
+	achieved := make(map[int64][]int64)
+	for k, periodDays := range days {
+		if filter.Cadence == CadenceWeekly && len(periodDays) < filter.TimesPerWeek {
+			continue
+		}
+		achieved[k.activityID] = append(achieved[k.activityID], k.period)
+	}
+	activityIDs := make([]int64, 0, len(achieved))
+	for activityID := range achieved {
+		activityIDs = append(activityIDs, activityID)
+	}
+	sort.Slice(activityIDs, func(i, j int) bool { return activityIDs[i] < activityIDs[j] })
+
+	streaks := []Streak{}
+	for _, activityID := range activityIDs {
+		periods := achieved[activityID]
+		sort.Slice(periods, func(i, j int) bool { return periods[i] < periods[j] })
+		first := 0
+		for i := range periods {
+			if i+1 < len(periods) && periods[i+1]-periods[i] <= int64(filter.Tolerance+1) {
+				continue
+			}
+			streaks = append(streaks, Streak{
+				ActivityID: activityID,
+				Start:      filter.periodStart(periods[first]),
+				End:        filter.periodStart(periods[i]),
+				Length:     int64(i - first + 1),
+			})
+			first = i + 1
+		}
+	}
+	return streaks, nil
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"activity-tracker/pkg/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserStreaks(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("Failed to load time zone: %v", err)
+	}
+
+	forEachStore(t, func(t *testing.T, store testStore) {
+		userID, err := store.CreateUser(&model.User{Username: "regular", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		otherID, err := store.CreateUser(&model.User{Username: "someone else", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		runningID, err := store.CreateActivity(&model.Activity{Name: "Running"})
+		if err != nil {
+			t.Fatalf("Failed to create activity: %v", err)
+		}
+		yogaID, err := store.CreateActivity(&model.Activity{Name: "Yoga"})
+		if err != nil {
+			t.Fatalf("Failed to create activity: %v", err)
+		}
+
+		record := func(userID, activityID int64, start time.Time) {
+			t.Helper()
+			_, _, err := store.CreateUserActivity(&model.UserActivity{
+				UserID: userID, ActivityID: activityID, StartTime: start, EndTime: start.Add(30 * time.Minute), Duration: 30 * time.Minute, Mood: 3,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create user activity: %v", err)
+			}
+		}
+		// January 2024 starts on a Monday
+		noon := func(day int) time.Time { return time.Date(2024, 1, day, 12, 0, 0, 0, time.UTC) }
+		for _, day := range []int{1, 2, 3, 16, 17} {
+			record(userID, runningID, noon(day))
+		}
+		for _, day := range []int{2, 5, 6} {
+			record(userID, yogaID, noon(day).Add(time.Hour))
+		}
+		record(userID, runningID, time.Date(2024, 1, 29, 3, 0, 0, 0, time.UTC)) // still Sunday the 28th in New York
+		record(otherID, runningID, noon(4))
+
+		day := func(day int) time.Time { return time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC) }
+		streak := func(activityID int64, start, end time.Time, length int64) Streak {
+			return Streak{ActivityID: activityID, Start: start, End: end, Length: length}
+		}
+
+		filter := StreakFilter{UserID: userID, Cadence: CadenceDaily}
+		streaks, err := store.UserStreaks(filter)
+		assert.NoError(t, err)
+		assert.Equal(t, []Streak{
+			streak(0, day(1), day(3), 3), streak(0, day(5), day(6), 2), streak(0, day(16), day(17), 2), streak(0, day(29), day(29), 1),
+			streak(runningID, day(1), day(3), 3), streak(runningID, day(16), day(17), 2), streak(runningID, day(29), day(29), 1),
+			streak(yogaID, day(2), day(2), 1), streak(yogaID, day(5), day(6), 2),
+		}, streaks)
+
+		// A rest day between the 3rd and the 5th does not break the streak
+		filter.Tolerance = 1
+		streaks, err = store.UserStreaks(filter)
+		assert.NoError(t, err)
+		assert.Equal(t, []Streak{
+			streak(0, day(1), day(6), 5), streak(0, day(16), day(17), 2), streak(0, day(29), day(29), 1),
+			streak(runningID, day(1), day(3), 3), streak(runningID, day(16), day(17), 2), streak(runningID, day(29), day(29), 1),
+			streak(yogaID, day(2), day(2), 1), streak(yogaID, day(5), day(6), 2),
+		}, streaks)
+
+		summaries := SummarizeStreaks(filter, streaks, time.Date(2024, 1, 30, 20, 0, 0, 0, time.UTC))
+		assert.Equal(t, []StreakSummary{
+			{ActivityID: 0, Current: &streaks[2], Longest: &streaks[0]},
+			{ActivityID: runningID, Current: &streaks[5], Longest: &streaks[3]},
+			{ActivityID: yogaID, Longest: &streaks[7]},
+		}, summaries)
+
+		// Weeks with activities on two days; the last week has only one
+		filter = StreakFilter{UserID: userID, Cadence: CadenceWeekly, TimesPerWeek: 2}
+		streaks, err = store.UserStreaks(filter)
+		assert.NoError(t, err)
+		assert.Equal(t, []Streak{
+			streak(0, day(1), day(1), 1), streak(0, day(15), day(15), 1),
+			streak(runningID, day(1), day(1), 1), streak(runningID, day(15), day(15), 1),
+			streak(yogaID, day(1), day(1), 1),
+		}, streaks)
+
+		// Local days decide the week
+		local := func(day int) time.Time { return time.Date(2024, 1, day, 0, 0, 0, 0, newYork) }
+		filter = StreakFilter{UserID: userID, Cadence: CadenceWeekly, TimesPerWeek: 1, Location: newYork}
+		streaks, err = store.UserStreaks(filter)
+		assert.NoError(t, err)
+		assert.Equal(t, []Streak{
+			streak(0, local(1), local(1), 1), streak(0, local(15), local(22), 2),
+			streak(runningID, local(1), local(1), 1), streak(runningID, local(15), local(22), 2),
+			streak(yogaID, local(1), local(1), 1),
+		}, streaks)
+
+		for _, invalid := range []StreakFilter{
+			{UserID: userID, Cadence: "hourly"},
+			{UserID: userID, Cadence: CadenceWeekly, TimesPerWeek: 8},
+			{UserID: userID, Cadence: CadenceDaily, Tolerance: -1},
+		} {
+			_, err = store.UserStreaks(invalid)
+			assert.Error(t, err)
+		}
+	})
+}
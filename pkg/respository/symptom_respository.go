@@ -0,0 +1,329 @@
+package repository
+
+import (
+	"activity-tracker/pkg/model"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrSymptomNotFound is returned when the symptom is not found in the database.
+var ErrSymptomNotFound = errors.New("symptom not found")
+
+// SymptomFilter selects the symptoms returned by ListSymptoms. Zero values and
+// nil pointers do not filter.
+type SymptomFilter struct {
+	UserID         int64
+	BodyArea       string
+	OccurredFrom   *time.Time // inclusive
+	OccurredTo     *time.Time // exclusive
+	UserActivityID int64
+}
+
+// checkLinkedUserActivity returns ErrInvalidReference unless the user activity
+// that a symptom is linked to, if any, belongs to the symptom's user.
+func (r *Repository) checkLinkedUserActivity(symptom *model.Symptom) error {
+	if symptom.UserActivityID == nil {
+		return nil
+	}
+	var owner int64
+	err := r.db.QueryRow(`SELECT user_id FROM user_activities WHERE id = $1`, *symptom.UserActivityID).Scan(&owner)
+	if err == sql.ErrNoRows || (err == nil && owner != symptom.UserID) {
+		return fmt.Errorf("%w: user activity %d", ErrInvalidReference, *symptom.UserActivityID)
+	}
+	return err
+}
+
+// CreateSymptom creates a new symptom in the database. A linked user activity
+// must belong to the same user.
+func (r *Repository) CreateSymptom(symptom *model.Symptom) (int64, error) {
+	if err := r.checkLinkedUserActivity(symptom); err != nil {
+		return 0, fmt.Errorf("could not create symptom: %w", err)
+	}
+
+	var id int64
+	query := `INSERT INTO symptoms (user_id, user_activity_id, body_area, severity, notes, occurred_at, recorded_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+	err := r.db.QueryRow(query, symptom.UserID, symptom.UserActivityID, symptom.BodyArea, symptom.Severity, symptom.Notes,
+		symptom.OccurredAt.UTC(), time.Now().UTC()).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("could not create symptom: %w", translateError(err))
+	}
+	return id, nil
+}
+
+// symptomColumns lists the columns read by scanSymptom, in order.
+const symptomColumns = `id, user_id, user_activity_id, body_area, severity, notes, occurred_at, recorded_at`
+
+// scanSymptom reads a symptom selected with symptomColumns.
+func scanSymptom(row rowScanner) (*model.Symptom, error) {
+	symptom := &model.Symptom{}
+	err := row.Scan(&symptom.ID, &symptom.UserID, &symptom.UserActivityID, &symptom.BodyArea, &symptom.Severity,
+		&symptom.Notes, &symptom.OccurredAt, &symptom.RecordedAt)
+	if err != nil {
+		return nil, err
+	}
+	return symptom, nil
+}
+
+// GetSymptom retrieves a symptom by ID from the database. Only a symptom
+// owned by userID is returned.
+func (r *Repository) GetSymptom(userID, symptomID int64) (*model.Symptom, error) {
+	query := `SELECT ` + symptomColumns + ` FROM symptoms WHERE id = $1 AND user_id = $2`
+	symptom, err := scanSymptom(r.db.QueryRow(query, symptomID, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrSymptomNotFound
+		}
+		return nil, fmt.Errorf("could not get symptom: %w", err)
+	}
+	return symptom, nil
+}
+
+// ListSymptoms returns a user's symptoms that match the filter, in the order
+// they occurred.
+func (r *Repository) ListSymptoms(filter SymptomFilter) ([]model.Symptom, error) {
+	var args queryArgs
+	conditions := `user_id = ` + args.add(filter.UserID)
+	if filter.BodyArea != "" {
+		conditions += ` AND body_area = ` + args.add(filter.BodyArea)
+	}
+	if filter.OccurredFrom != nil {
+		conditions += ` AND occurred_at >= ` + args.add(filter.OccurredFrom.UTC())
+	}
+	if filter.OccurredTo != nil {
+		conditions += ` AND occurred_at < ` + args.add(filter.OccurredTo.UTC())
+	}
+	if filter.UserActivityID != 0 {
+		conditions += ` AND user_activity_id = ` + args.add(filter.UserActivityID)
+	}
+
+	query := `SELECT ` + symptomColumns + ` FROM symptoms WHERE ` + conditions + ` ORDER BY occurred_at, id`
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not list symptoms: %w", err)
+	}
+	defer rows.Close()
+
+	symptoms := []model.Symptom{}
+	for rows.Next() {
+		symptom, err := scanSymptom(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not list symptoms: %w", err)
+		}
+		symptoms = append(symptoms, *symptom)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not list symptoms: %w", err)
+	}
+	return symptoms, nil
+}
+
+// UpdateSymptom saves a symptom owned by symptom.UserID. A linked user
+// activity must belong to the same user.
+func (r *Repository) UpdateSymptom(symptom *model.Symptom) error {
+	// Report a missing symptom before any problem with its link
+	if _, err := r.GetSymptom(symptom.UserID, symptom.ID); err != nil {
+		return err
+	}
+	if err := r.checkLinkedUserActivity(symptom); err != nil {
+		return fmt.Errorf("could not update symptom: %w", err)
+	}
+
+	query := `UPDATE symptoms SET user_activity_id = $1, body_area = $2, severity = $3, notes = $4, occurred_at = $5
+			  WHERE id = $6 AND user_id = $7`
+	result, err := r.db.Exec(query, symptom.UserActivityID, symptom.BodyArea, symptom.Severity, symptom.Notes,
+		symptom.OccurredAt.UTC(), symptom.ID, symptom.UserID)
+	if err != nil {
+		return fmt.Errorf("could not update symptom: %w", translateError(err))
+	}
+	return expectAffected(result, ErrSymptomNotFound)
+}
+
+// DeleteSymptom deletes a symptom owned by userID from the database.
+func (r *Repository) DeleteSymptom(userID, symptomID int64) error {
+	query := `DELETE FROM symptoms WHERE id = $1 AND user_id = $2`
+	result, err := r.db.Exec(query, symptomID, userID)
+	if err != nil {
+		return fmt.Errorf("could not delete symptom: %w", err)
+	}
+	return expectAffected(result, ErrSymptomNotFound)
+}
+
+// Default window after the end of a user activity in which symptoms are
+// attributed to it.
+const (
+	DefaultSymptomWindowStart = 24 * time.Hour
+	DefaultSymptomWindowEnd   = 72 * time.Hour
+)
+
+// SymptomAnalysisFilter selects the user activities that started from From up
+// to, but excluding, To, and attributes to each the symptoms of BodyArea, or
+// of any body area if it is empty, that occurred from WindowStart up to, but
+// excluding, WindowEnd after it ended.
+type SymptomAnalysisFilter struct {
+	UserID      int64
+	From        time.Time
+	To          time.Time
+	BodyArea    string
+	WindowStart time.Duration
+	WindowEnd   time.Duration
+}
+
+// SymptomSeverity summarizes the severity of a set of symptoms.
+type SymptomSeverity struct {
+	Count         int64
+	TotalSeverity int64
+	MaxSeverity   int
+}
+
+// Average returns the average severity, or 0 if there are no symptoms.
+func (s SymptomSeverity) Average() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.TotalSeverity) / float64(s.Count)
+}
+
+// add counts a symptom of the given severity.
+func (s *SymptomSeverity) add(severity int) {
+	s.Count++
+	s.TotalSeverity += int64(severity)
+	if severity > s.MaxSeverity {
+		s.MaxSeverity = severity
+	}
+}
+
+// ActivitySymptoms is how an activity was followed by symptoms. Sessions is
+// the number of times it was done and SessionsWithSymptoms how many of those
+// were followed by any. A symptom in the window of several sessions of the
+// activity counts once.
+type ActivitySymptoms struct {
+	ActivityID           int64
+	Sessions             int64
+	SessionsWithSymptoms int64
+	SymptomSeverity
+}
+
+// SymptomAnalysis attributes symptoms to the activities they followed. Overall
+// summarizes every symptom that occurred in the filter's range, as a baseline
+// for the activities, which are ordered by ID.
+type SymptomAnalysis struct {
+	Overall    SymptomSeverity
+	Activities []ActivitySymptoms
+}
+
+// symptomSession is a user activity as far as the symptom analysis is concerned.
+type symptomSession struct {
+	activityID int64
+	endTime    time.Time
+}
+
+// symptomsAfter returns the range that the symptoms attributed to sessions
+// can have occurred in, which includes the filter's own range.
+func symptomsAfter(filter SymptomAnalysisFilter, sessions []symptomSession) (time.Time, time.Time) {
+	to := filter.To
+	for _, session := range sessions {
+		if end := session.endTime.Add(filter.WindowEnd); end.After(to) {
+			to = end
+		}
+	}
+	return filter.From, to
+}
+
+// analyzeSymptoms attributes each symptom to the activities of the sessions
+// that it followed within the filter's window.
+func analyzeSymptoms(filter SymptomAnalysisFilter, sessions []symptomSession, symptoms []model.Symptom) *SymptomAnalysis {
+	analysis := &SymptomAnalysis{Activities: []ActivitySymptoms{}}
+	for _, symptom := range symptoms {
+		if !symptom.OccurredAt.Before(filter.From) && symptom.OccurredAt.Before(filter.To) {
+			analysis.Overall.add(symptom.Severity)
+		}
+	}
+
+	byActivity := make(map[int64]*ActivitySymptoms)
+	counted := make(map[int64]map[int64]bool)
+	for _, session := range sessions {
+		activity, ok := byActivity[session.activityID]
+		if !ok {
+			activity = &ActivitySymptoms{ActivityID: session.activityID}
+			byActivity[session.activityID] = activity
+			counted[session.activityID] = make(map[int64]bool)
+		}
+		activity.Sessions++
+
+		windowStart, windowEnd := session.endTime.Add(filter.WindowStart), session.endTime.Add(filter.WindowEnd)
+		followed := false
+		for _, symptom := range symptoms {
+			if symptom.OccurredAt.Before(windowStart) || !symptom.OccurredAt.Before(windowEnd) {
+				continue
+			}
+			followed = true
+			if !counted[session.activityID][symptom.ID] {
+				counted[session.activityID][symptom.ID] = true
+				activity.add(symptom.Severity)
+			}
+		}
+		if followed {
+			activity.SessionsWithSymptoms++
+		}
+	}
+
+	for _, activity := range byActivity {
+		analysis.Activities = append(analysis.Activities, *activity)
+	}
+	sort.Slice(analysis.Activities, func(i, j int) bool {
+		return analysis.Activities[i].ActivityID < analysis.Activities[j].ActivityID
+	})
+	return analysis
+}
+
+// AnalyzeSymptoms attributes the user's symptoms to the activities they
+// followed, as described by the filter.
+func (r *Repository) AnalyzeSymptoms(filter SymptomAnalysisFilter) (*SymptomAnalysis, error) {
+	query := `SELECT activity_id, end_time FROM user_activities WHERE user_id = $1 AND start_time >= $2 AND start_time < $3`
+	rows, err := r.db.Query(query, filter.UserID, filter.From.UTC(), filter.To.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("could not analyze symptoms: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []symptomSession
+	for rows.Next() {
+		var session symptomSession
+		if err := rows.Scan(&session.activityID, &session.endTime); err != nil {
+			return nil, fmt.Errorf("could not analyze symptoms: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not analyze symptoms: %w", err)
+	}
+
+	from, to := symptomsAfter(filter, sessions)
+	symptoms, err := r.ListSymptoms(SymptomFilter{UserID: filter.UserID, BodyArea: filter.BodyArea, OccurredFrom: &from, OccurredTo: &to})
+	if err != nil {
+		return nil, fmt.Errorf("could not analyze symptoms: %w", err)
+	}
+	return analyzeSymptoms(filter, sessions, symptoms), nil
+}
+
+// AnalyzeSymptoms attributes the user's symptoms to the activities they
+// followed as Repository does.
+func (r *MemoryRepository) AnalyzeSymptoms(filter SymptomAnalysisFilter) (*SymptomAnalysis, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var sessions []symptomSession
+	for _, userActivity := range r.userActivities {
+		if userActivity.UserID != filter.UserID || userActivity.StartTime.Before(filter.From) || !userActivity.StartTime.Before(filter.To) {
+			continue
+		}
+		sessions = append(sessions, symptomSession{activityID: userActivity.ActivityID, endTime: userActivity.EndTime})
+	}
+	from, to := symptomsAfter(filter, sessions)
+	symptoms := r.listSymptoms(SymptomFilter{UserID: filter.UserID, BodyArea: filter.BodyArea, OccurredFrom: &from, OccurredTo: &to})
+	return analyzeSymptoms(filter, sessions, symptoms), nil
+}
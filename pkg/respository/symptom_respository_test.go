@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"activity-tracker/pkg/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSymptoms(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store testStore) {
+		userID, err := store.CreateUser(&model.User{Username: "limper", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		otherID, err := store.CreateUser(&model.User{Username: "someone else", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		runningID, err := store.CreateActivity(&model.Activity{Name: "Running"})
+		if err != nil {
+			t.Fatalf("Failed to create activity: %v", err)
+		}
+		start := time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC)
+		runID, _, err := store.CreateUserActivity(&model.UserActivity{UserID: userID, ActivityID: runningID, StartTime: start,
+			EndTime: start.Add(time.Hour), Duration: time.Hour, Mood: 4})
+		if err != nil {
+			t.Fatalf("Failed to create user activity: %v", err)
+		}
+		otherRunID, _, err := store.CreateUserActivity(&model.UserActivity{UserID: otherID, ActivityID: runningID, StartTime: start,
+			EndTime: start.Add(time.Hour), Duration: time.Hour, Mood: 4})
+		if err != nil {
+			t.Fatalf("Failed to create user activity: %v", err)
+		}
+
+		occurred := start.Add(30 * time.Hour)
+		symptom := model.Symptom{UserID: userID, UserActivityID: &runID, BodyArea: "left knee", Severity: 6, Notes: "stairs hurt", OccurredAt: occurred}
+		symptomID, err := store.CreateSymptom(&symptom)
+		assert.NoError(t, err)
+		symptom.ID = symptomID
+
+		stored, err := store.GetSymptom(userID, symptomID)
+		assert.NoError(t, err)
+		assert.Equal(t, runID, *stored.UserActivityID)
+		assert.Equal(t, "left knee", stored.BodyArea)
+		assert.Equal(t, 6, stored.Severity)
+		assert.Equal(t, "stairs hurt", stored.Notes)
+		assert.True(t, occurred.Equal(stored.OccurredAt))
+		assert.False(t, stored.RecordedAt.IsZero())
+
+		_, err = store.GetSymptom(otherID, symptomID)
+		assert.ErrorIs(t, err, ErrSymptomNotFound)
+		// Symptoms can only be linked to the user's own activities
+		_, err = store.CreateSymptom(&model.Symptom{UserID: userID, UserActivityID: &otherRunID, BodyArea: "back", Severity: 2, OccurredAt: occurred})
+		assert.ErrorIs(t, err, ErrInvalidReference)
+
+		symptom.Severity = 7
+		assert.NoError(t, store.UpdateSymptom(&symptom))
+		symptom.UserID = otherID
+		assert.ErrorIs(t, store.UpdateSymptom(&symptom), ErrSymptomNotFound)
+		symptom.UserID = userID
+
+		_, err = store.CreateSymptom(&model.Symptom{UserID: userID, BodyArea: "back", Severity: 2, OccurredAt: start.Add(-time.Hour)})
+		assert.NoError(t, err)
+		symptoms, err := store.ListSymptoms(SymptomFilter{UserID: userID})
+		assert.NoError(t, err)
+		if assert.Len(t, symptoms, 2) {
+			assert.Equal(t, "back", symptoms[0].BodyArea)
+			assert.Equal(t, 7, symptoms[1].Severity)
+		}
+		symptoms, err = store.ListSymptoms(SymptomFilter{UserID: userID, BodyArea: "left knee", OccurredFrom: &start})
+		assert.NoError(t, err)
+		assert.Len(t, symptoms, 1)
+		symptoms, err = store.ListSymptoms(SymptomFilter{UserID: userID, UserActivityID: runID})
+		assert.NoError(t, err)
+		assert.Len(t, symptoms, 1)
+
+		// Deleting the user activity keeps the symptom but drops the link
+		assert.NoError(t, store.DeleteUserActivity(userID, runID))
+		stored, err = store.GetSymptom(userID, symptomID)
+		assert.NoError(t, err)
+		assert.Nil(t, stored.UserActivityID)
+
+		assert.ErrorIs(t, store.DeleteSymptom(otherID, symptomID), ErrSymptomNotFound)
+		assert.NoError(t, store.DeleteSymptom(userID, symptomID))
+		_, err = store.GetSymptom(userID, symptomID)
+		assert.ErrorIs(t, err, ErrSymptomNotFound)
+	})
+}
+
+func TestAnalyzeSymptoms(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store testStore) {
+		userID, err := store.CreateUser(&model.User{Username: "runner", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		runningID, err := store.CreateActivity(&model.Activity{Name: "Running"})
+		if err != nil {
+			t.Fatalf("Failed to create activity: %v", err)
+		}
+		swimmingID, err := store.CreateActivity(&model.Activity{Name: "Swimming"})
+		if err != nil {
+			t.Fatalf("Failed to create activity: %v", err)
+		}
+
+		day := func(n, hour int) time.Time { return time.Date(2024, 3, n, hour, 0, 0, 0, time.UTC) }
+		// Runs end at 8:00 on the 1st and 2nd, so their windows overlap; the
+		// swim on the 10th is followed by nothing
+		for _, entry := range []struct {
+			activityID int64
+			start      time.Time
+		}{
+			{runningID, day(1, 7)}, {runningID, day(2, 7)}, {swimmingID, day(5, 7)}, {swimmingID, day(10, 7)},
+		} {
+			_, _, err := store.CreateUserActivity(&model.UserActivity{UserID: userID, ActivityID: entry.activityID, StartTime: entry.start,
+				EndTime: entry.start.Add(time.Hour), Duration: time.Hour, Mood: 3})
+			if err != nil {
+				t.Fatalf("Failed to create user activity: %v", err)
+			}
+		}
+		for _, entry := range []struct {
+			bodyArea   string
+			occurredAt time.Time
+			severity   int
+		}{
+			{"left knee", day(1, 20), 2}, // too soon after the first run
+			{"left knee", day(3, 9), 6},  // after both runs
+			{"left knee", day(4, 9), 8},  // after the second run
+			{"back", day(6, 12), 3},      // after the swim on the 5th
+			{"left knee", day(20, 9), 1}, // after nothing
+		} {
+			_, err := store.CreateSymptom(&model.Symptom{UserID: userID, BodyArea: entry.bodyArea, Severity: entry.severity, OccurredAt: entry.occurredAt})
+			if err != nil {
+				t.Fatalf("Failed to create symptom: %v", err)
+			}
+		}
+
+		filter := SymptomAnalysisFilter{UserID: userID, From: day(1, 0), To: day(15, 0),
+			WindowStart: DefaultSymptomWindowStart, WindowEnd: DefaultSymptomWindowEnd}
+		analysis, err := store.AnalyzeSymptoms(filter)
+		assert.NoError(t, err)
+		assert.Equal(t, SymptomSeverity{Count: 4, TotalSeverity: 19, MaxSeverity: 8}, analysis.Overall)
+		if assert.Len(t, analysis.Activities, 2) {
+			running := analysis.Activities[0]
+			assert.Equal(t, runningID, running.ActivityID)
+			assert.Equal(t, int64(2), running.Sessions)
+			assert.Equal(t, int64(2), running.SessionsWithSymptoms)
+			// The symptom on the 3rd counts once although it followed both runs
+			assert.Equal(t, int64(2), running.Count)
+			assert.Equal(t, 7.0, running.Average())
+			assert.Equal(t, 8, running.MaxSeverity)
+			swimming := analysis.Activities[1]
+			assert.Equal(t, int64(2), swimming.Sessions)
+			assert.Equal(t, int64(1), swimming.SessionsWithSymptoms)
+			assert.Equal(t, 3.0, swimming.Average())
+		}
+
+		filter.BodyArea = "back"
+		analysis, err = store.AnalyzeSymptoms(filter)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), analysis.Overall.Count)
+		if assert.Len(t, analysis.Activities, 2) {
+			assert.Equal(t, int64(0), analysis.Activities[0].SessionsWithSymptoms)
+			assert.Equal(t, 0.0, analysis.Activities[0].Average())
+		}
+	})
+}
@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"activity-tracker/pkg/model"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrTagNotFound is returned when the tag is not found in the database.
+var ErrTagNotFound = errors.New("tag not found")
+
+// ErrTagNameTaken is returned when another tag of the same user already has
+// the same name.
+var ErrTagNameTaken = errors.New("a tag with this name already exists")
+
+// CreateTag creates a new tag in the database.
+func (r *Repository) CreateTag(tag *model.Tag) (int64, error) {
+	var id int64
+	query := `INSERT INTO tags (user_id, name) VALUES ($1, $2) RETURNING id`
+	err := r.db.QueryRow(query, tag.UserID, tag.Name).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, ErrTagNameTaken
+	} else if err != nil {
+		return 0, fmt.Errorf("could not create tag: %w", translateError(err))
+	}
+	return id, nil
+}
+
+// tagColumns lists the columns read by scanTag, in order.
+const tagColumns = `id, user_id, name, created_at`
+
+// scanTag reads a tag selected with tagColumns.
+func scanTag(row rowScanner) (*model.Tag, error) {
+	tag := &model.Tag{}
+	if err := row.Scan(&tag.ID, &tag.UserID, &tag.Name, &tag.CreatedAt); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// GetTag retrieves a tag by ID from the database. Only a tag owned by userID
+// is returned.
+func (r *Repository) GetTag(userID, tagID int64) (*model.Tag, error) {
+	query := `SELECT ` + tagColumns + ` FROM tags WHERE id = $1 AND user_id = $2`
+	tag, err := scanTag(r.db.QueryRow(query, tagID, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTagNotFound
+		}
+		return nil, fmt.Errorf("could not get tag: %w", err)
+	}
+	return tag, nil
+}
+
+// ListTags returns all of a user's tags ordered by name.
+func (r *Repository) ListTags(userID int64) ([]model.Tag, error) {
+	query := `SELECT ` + tagColumns + ` FROM tags WHERE user_id = $1 ORDER BY name`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("could not list tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := []model.Tag{}
+	for rows.Next() {
+		tag, err := scanTag(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not list tags: %w", err)
+		}
+		tags = append(tags, *tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not list tags: %w", err)
+	}
+	return tags, nil
+}
+
+// UpdateTag renames a tag owned by tag.UserID.
+func (r *Repository) UpdateTag(tag *model.Tag) error {
+	query := `UPDATE tags SET name = $1 WHERE id = $2 AND user_id = $3`
+	result, err := r.db.Exec(query, tag.Name, tag.ID, tag.UserID)
+	if isUniqueViolation(err) {
+		return ErrTagNameTaken
+	} else if err != nil {
+		return fmt.Errorf("could not update tag: %w", translateError(err))
+	}
+	return expectAffected(result, ErrTagNotFound)
+}
+
+// DeleteTag deletes a tag owned by userID from the database, removing it from
+// the user activities it was attached to.
+func (r *Repository) DeleteTag(userID, tagID int64) error {
+	query := `DELETE FROM tags WHERE id = $1 AND user_id = $2`
+	result, err := r.db.Exec(query, tagID, userID)
+	if err != nil {
+		return fmt.Errorf("could not delete tag: %w", err)
+	}
+	return expectAffected(result, ErrTagNotFound)
+}
+
+// normalizeTagIDs returns tag IDs sorted and without duplicates, as they are
+// stored. It never returns nil.
+func normalizeTagIDs(tagIDs []int64) []int64 {
+	sorted := append([]int64{}, tagIDs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	unique := sorted[:0]
+	for i, tagID := range sorted {
+		if i == 0 || tagID != sorted[i-1] {
+			unique = append(unique, tagID)
+		}
+	}
+	return unique
+}
+
+// inList returns a parenthesized list of placeholders for ids, adding them to
+// args.
+func inList(args *queryArgs, ids []int64) string {
+	placeholders := make([]string, 0, len(ids))
+	for _, id := range ids {
+		placeholders = append(placeholders, args.add(id))
+	}
+	return "(" + strings.Join(placeholders, ", ") + ")"
+}
+
+// setUserActivityTags replaces the tags attached to a user activity of userID
+// with tagIDs, which must all be tags of that user.
+func setUserActivityTags(tx *sql.Tx, userActivityID, userID int64, tagIDs []int64) error {
+	tagIDs = normalizeTagIDs(tagIDs)
+	if len(tagIDs) > 0 {
+		var args queryArgs
+		query := fmt.Sprintf(`SELECT COUNT(*) FROM tags WHERE user_id = %s AND id IN %s`, args.add(userID), inList(&args, tagIDs))
+		var owned int
+		if err := tx.QueryRow(query, args...).Scan(&owned); err != nil {
+			return err
+		}
+		if owned != len(tagIDs) {
+			return fmt.Errorf("%w: tags %v are not all tags of user %d", ErrInvalidReference, tagIDs, userID)
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM user_activity_tags WHERE user_activity_id = $1`, userActivityID); err != nil {
+		return err
+	}
+	for _, tagID := range tagIDs {
+		_, err := tx.Exec(`INSERT INTO user_activity_tags (user_activity_id, tag_id) VALUES ($1, $2)`, userActivityID, tagID)
+		if err != nil {
+			return translateError(err)
+		}
+	}
+	return nil
+}
+
+// loadUserActivityTags fills in the TagIDs of user activities.
+func (r *Repository) loadUserActivityTags(userActivities []model.UserActivity) error {
+	if len(userActivities) == 0 {
+		return nil
+	}
+	byID := make(map[int64]*model.UserActivity, len(userActivities))
+	ids := make([]int64, 0, len(userActivities))
+	for i := range userActivities {
+		userActivities[i].TagIDs = []int64{}
+		byID[userActivities[i].ID] = &userActivities[i]
+		ids = append(ids, userActivities[i].ID)
+	}
+
+	var args queryArgs
+	query := `SELECT user_activity_id, tag_id FROM user_activity_tags WHERE user_activity_id IN ` + inList(&args, ids) + ` ORDER BY tag_id`
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("could not load tags: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userActivityID, tagID int64
+		if err := rows.Scan(&userActivityID, &tagID); err != nil {
+			return fmt.Errorf("could not load tags: %w", err)
+		}
+		userActivity := byID[userActivityID]
+		userActivity.TagIDs = append(userActivity.TagIDs, tagID)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("could not load tags: %w", err)
+	}
+	return nil
+}
+
+// tagCondition returns the SQL condition selecting the user activities that
+// have any, or with all set every, of tagIDs, adding them to args.
+func tagCondition(args *queryArgs, tagIDs []int64, all bool) string {
+	tagIDs = normalizeTagIDs(tagIDs)
+	if all {
+		return fmt.Sprintf(`(SELECT COUNT(*) FROM user_activity_tags WHERE user_activity_id = user_activities.id AND tag_id IN %s) = %s`,
+			inList(args, tagIDs), args.add(len(tagIDs)))
+	}
+	return `id IN (SELECT user_activity_id FROM user_activity_tags WHERE tag_id IN ` + inList(args, tagIDs) + `)`
+}
+
+// hasTags reports whether tagIDs, which are sorted, include any, or with all
+// set every, of wanted.
+func hasTags(tagIDs, wanted []int64, all bool) bool {
+	for _, tagID := range wanted {
+		i := sort.Search(len(tagIDs), func(i int) bool { return tagIDs[i] >= tagID })
+		found := i < len(tagIDs) && tagIDs[i] == tagID
+		if found && !all {
+			return true
+		}
+		if !found && all {
+			return false
+		}
+	}
+	return all
+}
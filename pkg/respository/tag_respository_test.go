@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"activity-tracker/pkg/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTags(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store testStore) {
+		userID, err := store.CreateUser(&model.User{Username: "tagger", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		otherID, err := store.CreateUser(&model.User{Username: "someone else", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+
+		raceID, err := store.CreateTag(&model.Tag{UserID: userID, Name: "race"})
+		assert.NoError(t, err)
+		indoorID, err := store.CreateTag(&model.Tag{UserID: userID, Name: "indoor"})
+		assert.NoError(t, err)
+		_, err = store.CreateTag(&model.Tag{UserID: userID, Name: "race"})
+		assert.ErrorIs(t, err, ErrTagNameTaken)
+		// Names are only unique per user
+		_, err = store.CreateTag(&model.Tag{UserID: otherID, Name: "race"})
+		assert.NoError(t, err)
+
+		tag, err := store.GetTag(userID, raceID)
+		assert.NoError(t, err)
+		assert.Equal(t, "race", tag.Name)
+		assert.False(t, tag.CreatedAt.IsZero())
+		_, err = store.GetTag(otherID, raceID)
+		assert.ErrorIs(t, err, ErrTagNotFound)
+
+		assert.ErrorIs(t, store.UpdateTag(&model.Tag{ID: indoorID, UserID: userID, Name: "race"}), ErrTagNameTaken)
+		assert.ErrorIs(t, store.UpdateTag(&model.Tag{ID: indoorID, UserID: otherID, Name: "treadmill"}), ErrTagNotFound)
+		assert.NoError(t, store.UpdateTag(&model.Tag{ID: indoorID, UserID: userID, Name: "treadmill"}))
+		tags, err := store.ListTags(userID)
+		assert.NoError(t, err)
+		if assert.Len(t, tags, 2) {
+			assert.Equal(t, "race", tags[0].Name)
+			assert.Equal(t, "treadmill", tags[1].Name)
+		}
+		assert.ErrorIs(t, store.DeleteTag(otherID, raceID), ErrTagNotFound)
+		assert.NoError(t, store.DeleteTag(userID, raceID))
+		_, err = store.GetTag(userID, raceID)
+		assert.ErrorIs(t, err, ErrTagNotFound)
+	})
+}
+
+func TestUserActivityTags(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store testStore) {
+		userID, err := store.CreateUser(&model.User{Username: "tagger", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		otherID, err := store.CreateUser(&model.User{Username: "someone else", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		runningID, err := store.CreateActivity(&model.Activity{Name: "Running"})
+		if err != nil {
+			t.Fatalf("Failed to create activity: %v", err)
+		}
+		var tagIDs []int64
+		for _, name := range []string{"race", "indoor", "with-coach"} {
+			tagID, err := store.CreateTag(&model.Tag{UserID: userID, Name: name})
+			if err != nil {
+				t.Fatalf("Failed to create tag: %v", err)
+			}
+			tagIDs = append(tagIDs, tagID)
+		}
+		raceID, indoorID, coachID := tagIDs[0], tagIDs[1], tagIDs[2]
+		otherTagID, err := store.CreateTag(&model.Tag{UserID: otherID, Name: "race"})
+		if err != nil {
+			t.Fatalf("Failed to create tag: %v", err)
+		}
+
+		record := func(day int, tagIDs ...int64) int64 {
+			t.Helper()
+			start := time.Date(2024, 3, day, 7, 0, 0, 0, time.UTC)
+			id, _, err := store.CreateUserActivity(&model.UserActivity{UserID: userID, ActivityID: runningID, StartTime: start,
+				EndTime: start.Add(time.Hour), Duration: time.Hour, Mood: 3, TagIDs: tagIDs})
+			if err != nil {
+				t.Fatalf("Failed to create user activity: %v", err)
+			}
+			return id
+		}
+		// Tags are stored sorted and once each
+		raceRunID := record(1, coachID, raceID, raceID)
+		indoorRunID := record(2, indoorID)
+		record(3)
+
+		stored, err := store.GetUserActivity(userID, raceRunID)
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{raceID, coachID}, stored.TagIDs)
+
+		start := time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC)
+		_, _, err = store.CreateUserActivity(&model.UserActivity{UserID: userID, ActivityID: runningID, StartTime: start,
+			EndTime: start.Add(time.Hour), Duration: time.Hour, Mood: 3, TagIDs: []int64{otherTagID}})
+		assert.ErrorIs(t, err, ErrInvalidReference)
+
+		list := func(all bool, tagIDs ...int64) []int64 {
+			t.Helper()
+			userActivities, _, err := store.ListUserActivities(UserActivityFilter{UserID: userID, TagIDs: tagIDs, AllTags: all})
+			assert.NoError(t, err)
+			var ids []int64
+			for _, userActivity := range userActivities {
+				ids = append(ids, userActivity.ID)
+			}
+			return ids
+		}
+		assert.Equal(t, []int64{raceRunID, indoorRunID}, list(false, raceID, indoorID))
+		assert.Equal(t, []int64{raceRunID}, list(true, raceID, coachID))
+		assert.Empty(t, list(true, raceID, indoorID))
+
+		stored, err = store.GetUserActivity(userID, indoorRunID)
+		assert.NoError(t, err)
+		stored.TagIDs = []int64{indoorID, coachID}
+		_, err = store.UpdateUserActivity(stored)
+		assert.NoError(t, err)
+
+		// Grouped by tag, a user activity counts towards each of its tags and
+		// those without tags are left out
+		stats, err := store.UserActivityStats(StatsFilter{UserID: userID, From: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			To: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), Period: PeriodMonth, ByTag: true})
+		assert.NoError(t, err)
+		month := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+		assert.Equal(t, []StatsBucket{
+			{PeriodStart: month, TagID: raceID, Count: 1, TotalDuration: time.Hour, Mood: MoodSummary{Count: 1, TotalMood: 3}},
+			{PeriodStart: month, TagID: indoorID, Count: 1, TotalDuration: time.Hour, Mood: MoodSummary{Count: 1, TotalMood: 3}},
+			{PeriodStart: month, TagID: coachID, Count: 2, TotalDuration: 2 * time.Hour, Mood: MoodSummary{Count: 2, TotalMood: 6}},
+		}, stats)
+
+		// Deleting a tag removes it from the user activities
+		assert.NoError(t, store.DeleteTag(userID, coachID))
+		stored, err = store.GetUserActivity(userID, raceRunID)
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{raceID}, stored.TagIDs)
+	})
+}
@@ -0,0 +1,261 @@
+package repository
+
+import (
+	"activity-tracker/pkg/model"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrTimerNotFound is returned when the timer is not found in the database.
+	ErrTimerNotFound = errors.New("timer not found")
+	// ErrTimerAlreadyRunning is returned when starting or resuming a timer
+	// while the user already has another one running.
+	ErrTimerAlreadyRunning = errors.New("another timer is already running")
+	// ErrTimerChanged is returned when saving a timer that was paused,
+	// resumed or stopped since it was loaded.
+	ErrTimerChanged = errors.New("timer was changed by another request")
+)
+
+// CreateTimer creates a new timer and its earlier runs in the database. Its
+// activity must be global or private to the user.
+func (r *Repository) CreateTimer(timer *model.Timer) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("could not create timer: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkActivityVisible(tx, timer.UserID, timer.ActivityID); err != nil {
+		return 0, fmt.Errorf("could not create timer: %w", err)
+	}
+	var id int64
+	query := `INSERT INTO timers (user_id, activity_id, started_at, resumed_at, elapsed_ms)
+			  VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	err = tx.QueryRow(query, timer.UserID, timer.ActivityID, timer.StartedAt.UTC(), nullableTime(timer.ResumedAt),
+		timer.Elapsed.Milliseconds()).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, ErrTimerAlreadyRunning
+	} else if err != nil {
+		return 0, fmt.Errorf("could not create timer: %w", translateError(err))
+	}
+	if err := insertTimerRuns(tx, id, timer.Runs); err != nil {
+		return 0, fmt.Errorf("could not create timer: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("could not create timer: %w", err)
+	}
+	return id, nil
+}
+
+// timerColumns lists the columns read by scanTimer, in order.
+const timerColumns = `id, user_id, activity_id, started_at, resumed_at, elapsed_ms`
+
+// scanTimer reads a timer selected with timerColumns.
+func scanTimer(row rowScanner) (*model.Timer, error) {
+	timer := &model.Timer{}
+	var resumedAt sql.NullTime
+	var elapsedMs int64
+	err := row.Scan(&timer.ID, &timer.UserID, &timer.ActivityID, &timer.StartedAt, &resumedAt, &elapsedMs)
+	if err != nil {
+		return nil, err
+	}
+	if resumedAt.Valid {
+		timer.ResumedAt = &resumedAt.Time
+	}
+	timer.Elapsed = time.Duration(elapsedMs) * time.Millisecond
+	return timer, nil
+}
+
+// GetTimer retrieves a timer by ID from the database. Only a timer owned by
+// userID is returned.
+func (r *Repository) GetTimer(userID, timerID int64) (*model.Timer, error) {
+	query := `SELECT ` + timerColumns + ` FROM timers WHERE id = $1 AND user_id = $2`
+	timer, err := scanTimer(r.db.QueryRow(query, timerID, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTimerNotFound
+		}
+		return nil, fmt.Errorf("could not get timer: %w", err)
+	}
+	runs, err := r.timerRuns(userID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get timer: %w", err)
+	}
+	timer.Runs = runs[timer.ID]
+	return timer, nil
+}
+
+// ListTimers returns all of a user's timers, oldest first.
+func (r *Repository) ListTimers(userID int64) ([]model.Timer, error) {
+	query := `SELECT ` + timerColumns + ` FROM timers WHERE user_id = $1 ORDER BY started_at, id`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("could not list timers: %w", err)
+	}
+	defer rows.Close()
+
+	timers := []model.Timer{}
+	for rows.Next() {
+		timer, err := scanTimer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not list timers: %w", err)
+		}
+		timers = append(timers, *timer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not list timers: %w", err)
+	}
+
+	runs, err := r.timerRuns(userID)
+	if err != nil {
+		return nil, fmt.Errorf("could not list timers: %w", err)
+	}
+	for i := range timers {
+		timers[i].Runs = runs[timers[i].ID]
+	}
+	return timers, nil
+}
+
+// timerRuns returns the earlier runs of the user's timers by timer ID, oldest
+// first.
+func (r *Repository) timerRuns(userID int64) (map[int64][]model.TimerRun, error) {
+	query := `SELECT timer_runs.timer_id, timer_runs.started_at, timer_runs.ended_at
+			  FROM timer_runs JOIN timers ON timers.id = timer_runs.timer_id
+			  WHERE timers.user_id = $1
+			  ORDER BY timer_runs.started_at, timer_runs.id`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := make(map[int64][]model.TimerRun)
+	for rows.Next() {
+		var timerID int64
+		var run model.TimerRun
+		if err := rows.Scan(&timerID, &run.Start, &run.End); err != nil {
+			return nil, err
+		}
+		runs[timerID] = append(runs[timerID], run)
+	}
+	return runs, rows.Err()
+}
+
+// insertTimerRuns stores runs as earlier runs of the timer within tx.
+func insertTimerRuns(tx *sql.Tx, timerID int64, runs []model.TimerRun) error {
+	for _, run := range runs {
+		query := `INSERT INTO timer_runs (timer_id, started_at, ended_at) VALUES ($1, $2, $3)`
+		if _, err := tx.Exec(query, timerID, run.Start.UTC(), run.End.UTC()); err != nil {
+			return translateError(err)
+		}
+	}
+	return nil
+}
+
+// UpdateTimer saves the running state, elapsed time and earlier runs of a
+// timer owned by timer.UserID. previous is the timer as it was loaded; if its
+// running state or elapsed time has changed since, nothing is saved and
+// ErrTimerChanged is returned.
+func (r *Repository) UpdateTimer(timer, previous *model.Timer) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not update timer: %w", err)
+	}
+	defer tx.Rollback()
+
+	// SQLite spells IS NOT DISTINCT FROM as IS
+	same := `IS NOT DISTINCT FROM`
+	if r.dialect == SQLite {
+		same = `IS`
+	}
+	query := `UPDATE timers SET resumed_at = $1, elapsed_ms = $2
+			  WHERE id = $3 AND user_id = $4 AND resumed_at ` + same + ` $5 AND elapsed_ms = $6`
+	result, err := tx.Exec(query, nullableTime(timer.ResumedAt), timer.Elapsed.Milliseconds(), timer.ID, timer.UserID,
+		nullableTime(previous.ResumedAt), previous.Elapsed.Milliseconds())
+	if isUniqueViolation(err) {
+		return ErrTimerAlreadyRunning
+	} else if err != nil {
+		return fmt.Errorf("could not update timer: %w", translateError(err))
+	}
+	if err := expectAffected(result, ErrTimerChanged); err != nil {
+		// Tell a timer that is gone apart from one that changed
+		var timers int
+		query := `SELECT count(*) FROM timers WHERE id = $1 AND user_id = $2`
+		if err := tx.QueryRow(query, timer.ID, timer.UserID).Scan(&timers); err != nil {
+			return fmt.Errorf("could not update timer: %w", err)
+		}
+		if timers == 0 {
+			return ErrTimerNotFound
+		}
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM timer_runs WHERE timer_id = $1`, timer.ID); err != nil {
+		return fmt.Errorf("could not update timer: %w", err)
+	}
+	if err := insertTimerRuns(tx, timer.ID, timer.Runs); err != nil {
+		return fmt.Errorf("could not update timer: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not update timer: %w", err)
+	}
+	return nil
+}
+
+// DeleteTimer deletes a timer owned by userID from the database.
+func (r *Repository) DeleteTimer(userID, timerID int64) error {
+	query := `DELETE FROM timers WHERE id = $1 AND user_id = $2`
+	result, err := r.db.Exec(query, timerID, userID)
+	if err != nil {
+		return fmt.Errorf("could not delete timer: %w", err)
+	}
+	return expectAffected(result, ErrTimerNotFound)
+}
+
+// StopTimer deletes a timer owned by userID and records userActivities, the
+// times it ran, in one transaction, so that a timer is only ever stopped once.
+// Each user activity is created as CreateUserActivity describes, and the IDs
+// are returned in the same order. The overlaps of all of them are reported
+// together.
+func (r *Repository) StopTimer(userID, timerID int64, userActivities []model.UserActivity) ([]int64, *Overlap, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not stop timer: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Deleting first locks the timer, so a concurrent stop finds nothing left
+	query := `DELETE FROM timers WHERE id = $1 AND user_id = $2`
+	result, err := tx.Exec(query, timerID, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not stop timer: %w", err)
+	}
+	if err := expectAffected(result, ErrTimerNotFound); err != nil {
+		return nil, nil, err
+	}
+	ids := make([]int64, len(userActivities))
+	var overlap *Overlap
+	for i := range userActivities {
+		id, runOverlap, err := r.insertUserActivity(tx, &userActivities[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		ids[i] = id
+		overlap = overlap.merge(runOverlap)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("could not stop timer: %w", err)
+	}
+	return ids, overlap, nil
+}
+
+// nullableTime converts an optional time into a UTC value for a nullable column.
+func nullableTime(value *time.Time) interface{} {
+	if value == nil {
+		return nil
+	}
+	return value.UTC()
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"activity-tracker/pkg/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimers(t *testing.T) {
+	forEachStore(t, testTimers)
+}
+
+func testTimers(t *testing.T, store testStore) {
+	userID, err := store.CreateUser(&model.User{Username: "timekeeper", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	otherID, err := store.CreateUser(&model.User{Username: "someone else", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	activityID, err := store.CreateActivity(&model.Activity{Name: "Rowing"})
+	if err != nil {
+		t.Fatalf("Failed to create activity: %v", err)
+	}
+
+	start := time.Date(2024, 7, 1, 6, 0, 0, 0, time.UTC)
+	timerID, err := store.CreateTimer(model.NewTimer(userID, activityID, start))
+	if err != nil {
+		t.Fatalf("Failed to create timer: %v", err)
+	}
+
+	// Only one timer may run at a time, but others may be paused
+	_, err = store.CreateTimer(model.NewTimer(userID, activityID, start))
+	assert.ErrorIs(t, err, ErrTimerAlreadyRunning)
+	paused := model.NewTimer(userID, activityID, start.Add(time.Minute))
+	assert.NoError(t, paused.Pause(start.Add(2*time.Minute)))
+	pausedID, err := store.CreateTimer(paused)
+	assert.NoError(t, err)
+	_, err = store.CreateTimer(model.NewTimer(otherID, activityID, start))
+	assert.NoError(t, err, "other users have their own running timer")
+
+	timer, err := store.GetTimer(userID, timerID)
+	if err != nil {
+		t.Fatalf("Failed to retrieve timer: %v", err)
+	}
+	assert.True(t, timer.Running())
+	loaded := *timer
+	stale := *timer
+	assert.NoError(t, timer.Pause(start.Add(90*time.Second+250*time.Millisecond)))
+	assert.NoError(t, store.UpdateTimer(timer, &loaded))
+
+	// A change based on the timer as it was before is not saved
+	assert.NoError(t, stale.Pause(start.Add(2*time.Minute)))
+	assert.ErrorIs(t, store.UpdateTimer(&stale, &loaded), ErrTimerChanged)
+
+	timer, err = store.GetTimer(userID, timerID)
+	if err != nil {
+		t.Fatalf("Failed to retrieve timer: %v", err)
+	}
+	assert.False(t, timer.Running())
+	assert.Equal(t, 90*time.Second+250*time.Millisecond, timer.Elapsed)
+	if assert.Len(t, timer.Runs, 1) {
+		assert.True(t, start.Equal(timer.Runs[0].Start))
+		assert.True(t, start.Add(90*time.Second+250*time.Millisecond).Equal(timer.Runs[0].End))
+	}
+
+	// Resuming the other timer is allowed now that the first one is paused
+	paused, err = store.GetTimer(userID, pausedID)
+	if err != nil {
+		t.Fatalf("Failed to retrieve timer: %v", err)
+	}
+	loaded = *paused
+	assert.NoError(t, paused.Resume(start.Add(3*time.Minute)))
+	assert.NoError(t, store.UpdateTimer(paused, &loaded))
+	loaded = *timer
+	assert.NoError(t, timer.Resume(start.Add(4*time.Minute)))
+	assert.ErrorIs(t, store.UpdateTimer(timer, &loaded), ErrTimerAlreadyRunning)
+
+	timers, err := store.ListTimers(userID)
+	if err != nil {
+		t.Fatalf("Failed to list timers: %v", err)
+	}
+	if assert.Len(t, timers, 2) {
+		assert.Equal(t, timerID, timers[0].ID)
+		assert.True(t, start.Add(3*time.Minute).Equal(*timers[1].ResumedAt))
+	}
+
+	// Timers are scoped to their owner, and keep their activity in use
+	_, err = store.GetTimer(otherID, timerID)
+	assert.ErrorIs(t, err, ErrTimerNotFound)
+	assert.ErrorIs(t, store.DeleteTimer(otherID, timerID), ErrTimerNotFound)
+	assert.ErrorIs(t, store.DeleteActivity(activityID), ErrActivityInUse)
+
+	assert.NoError(t, store.DeleteTimer(userID, timerID))
+	_, err = store.GetTimer(userID, timerID)
+	assert.ErrorIs(t, err, ErrTimerNotFound)
+	assert.ErrorIs(t, store.UpdateTimer(timer, timer), ErrTimerNotFound)
+
+	// Stopping removes the timer and records each of its runs exactly once,
+	// and leaves the timer in place if the time cannot be recorded
+	sessions := paused.Finish(start.Add(5 * time.Minute))
+	invalid := append([]model.UserActivity(nil), sessions...)
+	invalid[1].ActivityID = activityID + 1000
+	_, _, err = store.StopTimer(userID, pausedID, invalid)
+	assert.ErrorIs(t, err, ErrInvalidReference)
+	_, _, err = store.StopTimer(otherID, pausedID, sessions)
+	assert.ErrorIs(t, err, ErrTimerNotFound)
+	userActivityIDs, _, err := store.StopTimer(userID, pausedID, sessions)
+	if err != nil {
+		t.Fatalf("Failed to stop timer: %v", err)
+	}
+	_, _, err = store.StopTimer(userID, pausedID, sessions)
+	assert.ErrorIs(t, err, ErrTimerNotFound)
+	_, err = store.GetTimer(userID, pausedID)
+	assert.ErrorIs(t, err, ErrTimerNotFound)
+	recorded, _, err := store.ListUserActivities(UserActivityFilter{UserID: userID})
+	if err != nil {
+		t.Fatalf("Failed to list user activities: %v", err)
+	}
+	if assert.Len(t, recorded, 2) {
+		assert.Equal(t, userActivityIDs, []int64{recorded[0].ID, recorded[1].ID})
+		assert.True(t, start.Add(time.Minute).Equal(recorded[0].StartTime))
+		assert.Equal(t, time.Minute, recorded[0].Duration)
+		assert.True(t, start.Add(3*time.Minute).Equal(recorded[1].StartTime))
+		assert.Equal(t, 2*time.Minute, recorded[1].Duration)
+	}
+}
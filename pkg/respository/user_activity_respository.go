@@ -3,77 +3,298 @@ package repository
 import (
 	"activity-tracker/pkg/model"
 	"database/sql"
-	"encoding/json"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // ErrUserActivityNotFound is returned when the user activity is not found in the database.
 var ErrUserActivityNotFound = errors.New("user activity not found")
 
-// CreateUserActivity creates a new user activity in the database.
-func (r *Repository) CreateUserActivity(userActivity *model.UserActivity) (int64, error) {
-	var id int64
-	additionalAttributes, err := json.Marshal(userActivity.AdditionalAttributes)
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// UserActivityFilter selects, orders and paginates the user activities
+// returned by ListUserActivities. Zero values and nil pointers do not filter.
+type UserActivityFilter struct {
+	UserID     int64
+	ActivityID int64
+	StartFrom  *time.Time // inclusive
+	StartTo    *time.Time // exclusive
+	MinMood    *int
+	MaxMood    *int
+	Attributes []AttributeFilter
+	TagIDs     []int64
+	AllTags    bool // require every one of TagIDs instead of any
+	Descending bool
+	Limit      int
+	After      *Cursor
+}
+
+// Cursor is a keyset pagination position: the (start_time, id) of the last
+// user activity on the previous page.
+type Cursor struct {
+	StartTime time.Time
+	ID        int64
+}
+
+// Encode returns the opaque string form of the cursor handed to clients.
+func (c Cursor) Encode() string {
+	raw := c.StartTime.UTC().Format(time.RFC3339Nano) + "|" + strconv.FormatInt(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a cursor produced by Cursor.Encode.
+func DecodeCursor(encoded string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	startPart, idPart, found := strings.Cut(string(raw), "|")
+	if !found {
+		return nil, ErrInvalidCursor
+	}
+	startTime, err := time.Parse(time.RFC3339Nano, startPart)
 	if err != nil {
-		return 0, fmt.Errorf("could not marshal additional attributes: %w", err)
+		return nil, ErrInvalidCursor
 	}
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &Cursor{StartTime: startTime, ID: id}, nil
+}
+
+// CreateUserActivity creates a new user activity in the database. Overlaps
+// with the user's other activities are handled according to the repository's
+// overlap policy; under OverlapTrim the stored times are written back to
+// userActivity. The activity must be global or private to the user.
+func (r *Repository) CreateUserActivity(userActivity *model.UserActivity) (int64, *Overlap, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not create user activity: %w", err)
+	}
+	defer tx.Rollback()
 
-	query := `INSERT INTO user_activities (user_id, activity_id, start_time, end_time, duration, mood, additional_attributes, recorded_at)
+	id, overlap, err := r.insertUserActivity(tx, userActivity)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, nil, fmt.Errorf("could not create user activity: %w", err)
+	}
+	return id, overlap, nil
+}
+
+// insertUserActivity creates a user activity within tx as CreateUserActivity
+// describes.
+func (r *Repository) insertUserActivity(tx *sql.Tx, userActivity *model.UserActivity) (int64, *Overlap, error) {
+	additionalAttributes, err := userActivity.MarshalAdditionalAttributes()
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not marshal additional attributes: %w", err)
+	}
+
+	if err := checkActivityVisible(tx, userActivity.UserID, userActivity.ActivityID); err != nil {
+		return 0, nil, fmt.Errorf("could not create user activity: %w", err)
+	}
+	overlapping, err := r.findOverlapping(tx, userActivity.UserID, 0, userActivity.StartTime, userActivity.EndTime)
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not create user activity: %w", err)
+	}
+	overlap, err := resolveOverlap(r.overlapPolicy, userActivity, overlapping)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var id int64
+	query := `INSERT INTO user_activities (user_id, activity_id, start_time, end_time, duration_seconds, mood, additional_attributes, recorded_at)
 			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
-	err = r.db.QueryRow(query, userActivity.UserID, userActivity.ActivityID, userActivity.StartTime, userActivity.EndTime,
-		userActivity.Duration, userActivity.Mood, additionalAttributes, time.Now()).Scan(&id)
+	err = tx.QueryRow(query, userActivity.UserID, userActivity.ActivityID, userActivity.StartTime.UTC(), userActivity.EndTime.UTC(),
+		int64(userActivity.Duration/time.Second), userActivity.Mood, string(additionalAttributes), time.Now().UTC()).Scan(&id)
 	if err != nil {
-		return 0, fmt.Errorf("could not create user activity: %w", err)
+		return 0, nil, fmt.Errorf("could not create user activity: %w", translateError(err))
+	}
+	if err := setUserActivityTags(tx, id, userActivity.UserID, userActivity.TagIDs); err != nil {
+		return 0, nil, fmt.Errorf("could not create user activity: %w", err)
 	}
-	return id, nil
+	return id, overlap, nil
+}
+
+// userActivityColumns lists the columns read by scanUserActivity, in order.
+const userActivityColumns = `id, user_id, activity_id, start_time, end_time, duration_seconds, mood, additional_attributes, recorded_at`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
 }
 
-// GetUserActivity retrieves a user activity by ID from the database.
-func (r *Repository) GetUserActivity(userActivityID int64) (*model.UserActivity, error) {
+// scanUserActivity reads a user activity selected with userActivityColumns.
+func scanUserActivity(row rowScanner) (*model.UserActivity, error) {
 	userActivity := &model.UserActivity{}
+	var durationSeconds int64
 	var additionalAttributes []byte
-	query := `SELECT id, user_id, activity_id, start_time, end_time, duration, mood, additional_attributes, recorded_at
-			  FROM user_activities WHERE id = $1`
-	err := r.db.QueryRow(query, userActivityID).Scan(&userActivity.ID, &userActivity.UserID, &userActivity.ActivityID,
-		&userActivity.StartTime, &userActivity.EndTime, &userActivity.Duration, &userActivity.Mood, &additionalAttributes, &userActivity.RecordedAt)
+	err := row.Scan(&userActivity.ID, &userActivity.UserID, &userActivity.ActivityID, &userActivity.StartTime,
+		&userActivity.EndTime, &durationSeconds, &userActivity.Mood, &additionalAttributes, &userActivity.RecordedAt)
+	if err != nil {
+		return nil, err
+	}
+	userActivity.Duration = time.Duration(durationSeconds) * time.Second
+
+	err = userActivity.UnmarshalAdditionalAttributes(additionalAttributes)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal additional attributes: %w", err)
+	}
+	return userActivity, nil
+}
+
+// GetUserActivity retrieves a user activity by ID from the database. Only
+// activities owned by userID are returned.
+func (r *Repository) GetUserActivity(userID, userActivityID int64) (*model.UserActivity, error) {
+	query := `SELECT ` + userActivityColumns + ` FROM user_activities WHERE id = $1 AND user_id = $2`
+	userActivity, err := scanUserActivity(r.db.QueryRow(query, userActivityID, userID))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrUserActivityNotFound
 		}
 		return nil, fmt.Errorf("could not get user activity: %w", err)
 	}
+	userActivities := []model.UserActivity{*userActivity}
+	if err := r.loadUserActivityTags(userActivities); err != nil {
+		return nil, fmt.Errorf("could not get user activity: %w", err)
+	}
+	return &userActivities[0], nil
+}
+
+// ListUserActivities returns one page of a user's activities matching the
+// filter, ordered by (start_time, id), and the cursor of the next page if
+// there is one.
+func (r *Repository) ListUserActivities(filter UserActivityFilter) ([]model.UserActivity, *Cursor, error) {
+	filter.Limit = normalizeLimit(filter.Limit)
+	if err := validateAttributeFilters(filter.Attributes); err != nil {
+		return nil, nil, err
+	}
+
+	var args queryArgs
+	conditions := []string{"user_id = " + args.add(filter.UserID)}
+	if filter.ActivityID != 0 {
+		conditions = append(conditions, "activity_id = "+args.add(filter.ActivityID))
+	}
+	if filter.StartFrom != nil {
+		conditions = append(conditions, "start_time >= "+args.add(filter.StartFrom.UTC()))
+	}
+	if filter.StartTo != nil {
+		conditions = append(conditions, "start_time < "+args.add(filter.StartTo.UTC()))
+	}
+	if filter.MinMood != nil {
+		conditions = append(conditions, "mood >= "+args.add(*filter.MinMood))
+	}
+	if filter.MaxMood != nil {
+		conditions = append(conditions, "mood <= "+args.add(*filter.MaxMood))
+	}
+	conditions = append(conditions, r.attributeConditions(&args, filter.Attributes)...)
+	if len(filter.TagIDs) > 0 {
+		conditions = append(conditions, tagCondition(&args, filter.TagIDs, filter.AllTags))
+	}
 
-	err = json.Unmarshal(additionalAttributes, &userActivity.AdditionalAttributes)
+	order, comparison := "ASC", ">"
+	if filter.Descending {
+		order, comparison = "DESC", "<"
+	}
+	if filter.After != nil {
+		conditions = append(conditions, fmt.Sprintf("(start_time, id) %s (%s, %s)",
+			comparison, args.add(filter.After.StartTime.UTC()), args.add(filter.After.ID)))
+	}
+
+	// Fetch one extra row to find out whether there is a next page
+	query := fmt.Sprintf(`SELECT %s FROM user_activities WHERE %s ORDER BY start_time %s, id %s LIMIT %s`,
+		userActivityColumns, strings.Join(conditions, " AND "), order, order, args.add(filter.Limit+1))
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("could not unmarshal additional attributes: %w", err)
+		return nil, nil, fmt.Errorf("could not list user activities: %w", err)
 	}
-	return userActivity, nil
+	defer rows.Close()
+
+	userActivities := []model.UserActivity{}
+	for rows.Next() {
+		userActivity, err := scanUserActivity(rows)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not list user activities: %w", err)
+		}
+		userActivities = append(userActivities, *userActivity)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("could not list user activities: %w", err)
+	}
+	if err := r.loadUserActivityTags(userActivities); err != nil {
+		return nil, nil, fmt.Errorf("could not list user activities: %w", err)
+	}
+	return paginate(userActivities, filter.Limit)
 }
 
-// UpdateUserActivity updates an existing user activity in the database.
-func (r *Repository) UpdateUserActivity(userActivity *model.UserActivity) error {
-	additionalAttributes, err := json.Marshal(userActivity.AdditionalAttributes)
+// paginate trims a result fetched with one extra row down to limit and
+// returns the cursor of the next page if the extra row was present.
+func paginate(userActivities []model.UserActivity, limit int) ([]model.UserActivity, *Cursor, error) {
+	if len(userActivities) <= limit {
+		return userActivities, nil, nil
+	}
+	userActivities = userActivities[:limit]
+	last := userActivities[limit-1]
+	return userActivities, &Cursor{StartTime: last.StartTime, ID: last.ID}, nil
+}
+
+// UpdateUserActivity updates an existing user activity in the database. Only
+// an activity owned by userActivity.UserID is updated, and the activity it
+// records is kept. Overlaps are handled as in CreateUserActivity.
+func (r *Repository) UpdateUserActivity(userActivity *model.UserActivity) (*Overlap, error) {
+	additionalAttributes, err := userActivity.MarshalAdditionalAttributes()
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal additional attributes: %w", err)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("could not update user activity: %w", err)
+	}
+	defer tx.Rollback()
+
+	overlapping, err := r.findOverlapping(tx, userActivity.UserID, userActivity.ID, userActivity.StartTime, userActivity.EndTime)
 	if err != nil {
-		return fmt.Errorf("could not marshal additional attributes: %w", err)
+		return nil, fmt.Errorf("could not update user activity: %w", err)
+	}
+	overlap, err := resolveOverlap(r.overlapPolicy, userActivity, overlapping)
+	if err != nil {
+		return nil, err
 	}
 
-	query := `UPDATE user_activities SET start_time = $1, end_time = $2, duration = $3, mood = $4, additional_attributes = $5
-			  WHERE id = $6`
-	_, err = r.db.Exec(query, userActivity.StartTime, userActivity.EndTime, userActivity.Duration, userActivity.Mood, additionalAttributes, userActivity.ID)
+	query := `UPDATE user_activities SET start_time = $1, end_time = $2, duration_seconds = $3, mood = $4, additional_attributes = $5
+			  WHERE id = $6 AND user_id = $7`
+	result, err := tx.Exec(query, userActivity.StartTime.UTC(), userActivity.EndTime.UTC(), int64(userActivity.Duration/time.Second), userActivity.Mood,
+		string(additionalAttributes), userActivity.ID, userActivity.UserID)
 	if err != nil {
-		return fmt.Errorf("could not update user activity: %w", err)
+		return nil, fmt.Errorf("could not update user activity: %w", translateError(err))
+	}
+	if err := expectAffected(result, ErrUserActivityNotFound); err != nil {
+		return nil, err
+	}
+	if err := setUserActivityTags(tx, userActivity.ID, userActivity.UserID, userActivity.TagIDs); err != nil {
+		return nil, fmt.Errorf("could not update user activity: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("could not update user activity: %w", err)
 	}
-	return nil
+	return overlap, nil
 }
 
-// DeleteUserActivity deletes a user activity by ID from the database.
-func (r *Repository) DeleteUserActivity(userActivityID int64) error {
-	query := `DELETE FROM user_activities WHERE id = $1`
-	_, err := r.db.Exec(query, userActivityID)
+// DeleteUserActivity deletes a user activity by ID from the database. Only an
+// activity owned by userID is deleted.
+func (r *Repository) DeleteUserActivity(userID, userActivityID int64) error {
+	query := `DELETE FROM user_activities WHERE id = $1 AND user_id = $2`
+	result, err := r.db.Exec(query, userActivityID, userID)
 	if err != nil {
 		return fmt.Errorf("could not delete user activity: %w", err)
 	}
-	return nil
+	return expectAffected(result, ErrUserActivityNotFound)
 }
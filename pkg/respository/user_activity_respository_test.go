@@ -0,0 +1,353 @@
+package repository
+
+import (
+	"activity-tracker/pkg/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserActivityRoundTrip(t *testing.T) {
+	repo := newTestRepository(t)
+
+	userID, err := repo.CreateUser(&model.User{Username: "runner", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	activityID, err := repo.CreateActivity(&model.Activity{Name: "Running"})
+	if err != nil {
+		t.Fatalf("Failed to create activity: %v", err)
+	}
+
+	start := time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC)
+	userActivity := &model.UserActivity{
+		UserID:               userID,
+		ActivityID:           activityID,
+		StartTime:            start,
+		EndTime:              start.Add(30 * time.Minute),
+		Duration:             30 * time.Minute,
+		Mood:                 4,
+		AdditionalAttributes: model.AdditionalAttributes{"knee_feeling": "sore", "distance": 5},
+	}
+	userActivityID, _, err := repo.CreateUserActivity(userActivity)
+	if err != nil {
+		t.Fatalf("Failed to create user activity: %v", err)
+	}
+	assert.NotZero(t, userActivityID)
+
+	retrieved, err := repo.GetUserActivity(userID, userActivityID)
+	if err != nil {
+		t.Fatalf("Failed to retrieve user activity: %v", err)
+	}
+	assert.True(t, start.Equal(retrieved.StartTime))
+	assert.True(t, userActivity.EndTime.Equal(retrieved.EndTime))
+	assert.Equal(t, 30*time.Minute, retrieved.Duration)
+	// Attributes come back as decoded from JSON, so numbers are float64
+	assert.Equal(t, model.AdditionalAttributes{"knee_feeling": "sore", "distance": 5.0}, retrieved.AdditionalAttributes)
+
+	retrieved.Mood = 2
+	retrieved.AdditionalAttributes["knee_feeling"] = "fine"
+	if _, err := repo.UpdateUserActivity(retrieved); err != nil {
+		t.Fatalf("Failed to update user activity: %v", err)
+	}
+	updated, err := repo.GetUserActivity(userID, userActivityID)
+	if err != nil {
+		t.Fatalf("Failed to retrieve user activity: %v", err)
+	}
+	assert.Equal(t, 2, updated.Mood)
+	assert.Equal(t, "fine", updated.AdditionalAttributes["knee_feeling"])
+
+	// The activity is still referenced, so it cannot be deleted
+	assert.Error(t, repo.DeleteActivity(activityID))
+
+	// Deleting the user cascades to their activities
+	if err := repo.DeleteUser(userID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	_, err = repo.GetUserActivity(userID, userActivityID)
+	assert.ErrorIs(t, err, ErrUserActivityNotFound)
+}
+
+func TestUserActivitiesAreScopedToTheirOwner(t *testing.T) {
+	repo := newTestRepository(t)
+
+	ownerID, err := repo.CreateUser(&model.User{Username: "owner", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	otherID, err := repo.CreateUser(&model.User{Username: "other", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	activityID, err := repo.CreateActivity(&model.Activity{Name: "Swimming"})
+	if err != nil {
+		t.Fatalf("Failed to create activity: %v", err)
+	}
+
+	start := time.Date(2024, 3, 2, 18, 0, 0, 0, time.UTC)
+	userActivityID, _, err := repo.CreateUserActivity(&model.UserActivity{
+		UserID: ownerID, ActivityID: activityID, StartTime: start, EndTime: start.Add(time.Hour), Duration: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user activity: %v", err)
+	}
+
+	_, err = repo.GetUserActivity(otherID, userActivityID)
+	assert.ErrorIs(t, err, ErrUserActivityNotFound)
+
+	_, err = repo.UpdateUserActivity(&model.UserActivity{ID: userActivityID, UserID: otherID, StartTime: start, EndTime: start, Mood: 1})
+	assert.ErrorIs(t, err, ErrUserActivityNotFound)
+
+	err = repo.DeleteUserActivity(otherID, userActivityID)
+	assert.ErrorIs(t, err, ErrUserActivityNotFound)
+
+	// The owner's record is untouched
+	retrieved, err := repo.GetUserActivity(ownerID, userActivityID)
+	if err != nil {
+		t.Fatalf("Failed to retrieve user activity: %v", err)
+	}
+	assert.True(t, start.Add(time.Hour).Equal(retrieved.EndTime))
+	assert.NoError(t, repo.DeleteUserActivity(ownerID, userActivityID))
+}
+
+func TestListUserActivities(t *testing.T) {
+	forEachStore(t, testListUserActivities)
+}
+
+func testListUserActivities(t *testing.T, store testStore) {
+	userID, err := store.CreateUser(&model.User{Username: "lister", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	otherID, err := store.CreateUser(&model.User{Username: "someone else", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	runningID, err := store.CreateActivity(&model.Activity{Name: "Running"})
+	if err != nil {
+		t.Fatalf("Failed to create activity: %v", err)
+	}
+	yogaID, err := store.CreateActivity(&model.Activity{Name: "Yoga"})
+	if err != nil {
+		t.Fatalf("Failed to create activity: %v", err)
+	}
+
+	// Five entries a day apart, the middle two sharing a start time, which
+	// needs overlaps to be allowed
+	store.SetOverlapPolicy(OverlapWarn)
+	base := time.Date(2024, 4, 1, 6, 0, 0, 0, time.UTC)
+	starts := []time.Time{base, base.Add(24 * time.Hour), base.Add(48 * time.Hour), base.Add(48 * time.Hour), base.Add(72 * time.Hour)}
+	var ids []int64
+	for i, start := range starts {
+		activityID := runningID
+		if i%2 == 1 {
+			activityID = yogaID
+		}
+		id, _, err := store.CreateUserActivity(&model.UserActivity{
+			UserID: userID, ActivityID: activityID, StartTime: start, EndTime: start.Add(time.Hour), Duration: time.Hour, Mood: i + 1,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create user activity: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	_, _, err = store.CreateUserActivity(&model.UserActivity{
+		UserID: otherID, ActivityID: runningID, StartTime: base, EndTime: base.Add(time.Hour), Duration: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user activity: %v", err)
+	}
+
+	// Walk every page in ascending order
+	var seen []int64
+	filter := UserActivityFilter{UserID: userID, Limit: 2}
+	for page := 0; ; page++ {
+		items, next, err := store.ListUserActivities(filter)
+		if err != nil {
+			t.Fatalf("Failed to list user activities: %v", err)
+		}
+		for _, item := range items {
+			seen = append(seen, item.ID)
+		}
+		if next == nil {
+			break
+		}
+		decoded, err := DecodeCursor(next.Encode())
+		if err != nil {
+			t.Fatalf("Failed to decode cursor: %v", err)
+		}
+		filter.After = decoded
+		if page > len(ids) {
+			t.Fatal("Pagination did not terminate")
+		}
+	}
+	assert.Equal(t, ids, seen)
+
+	// Descending order
+	items, _, err := store.ListUserActivities(UserActivityFilter{UserID: userID, Descending: true, Limit: 1})
+	if err != nil {
+		t.Fatalf("Failed to list user activities: %v", err)
+	}
+	assert.Equal(t, []int64{ids[4]}, idsOf(items))
+
+	// Filters
+	from, to := base.Add(24*time.Hour), base.Add(72*time.Hour)
+	minMood := 3
+	items, next, err := store.ListUserActivities(UserActivityFilter{
+		UserID: userID, ActivityID: runningID, StartFrom: &from, StartTo: &to, MinMood: &minMood,
+	})
+	if err != nil {
+		t.Fatalf("Failed to list user activities: %v", err)
+	}
+	assert.Nil(t, next)
+	assert.Equal(t, []int64{ids[2]}, idsOf(items))
+}
+
+func idsOf(userActivities []model.UserActivity) []int64 {
+	ids := make([]int64, 0, len(userActivities))
+	for _, userActivity := range userActivities {
+		ids = append(ids, userActivity.ID)
+	}
+	return ids
+}
+
+func TestUserActivityOverlapPolicies(t *testing.T) {
+	forEachStore(t, testUserActivityOverlapPolicies)
+}
+
+func testUserActivityOverlapPolicies(t *testing.T, store testStore) {
+	userID, err := store.CreateUser(&model.User{Username: "overlapper", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	otherID, err := store.CreateUser(&model.User{Username: "someone else", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	activityID, err := store.CreateActivity(&model.Activity{Name: "Cycling"})
+	if err != nil {
+		t.Fatalf("Failed to create activity: %v", err)
+	}
+
+	// An existing entry from 9:00 to 10:00
+	nine := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	entry := func(userID int64, start, end time.Time) *model.UserActivity {
+		return &model.UserActivity{UserID: userID, ActivityID: activityID, StartTime: start, EndTime: end,
+			Duration: model.DurationBetween(start, end), Mood: 3}
+	}
+	existingID, _, err := store.CreateUserActivity(entry(userID, nine, nine.Add(time.Hour)))
+	if err != nil {
+		t.Fatalf("Failed to create user activity: %v", err)
+	}
+
+	// Entries that follow on directly, or belong to other users, do not overlap
+	adjacentID, overlap, err := store.CreateUserActivity(entry(userID, nine.Add(time.Hour), nine.Add(90*time.Minute)))
+	assert.NoError(t, err)
+	assert.Nil(t, overlap)
+	_, overlap, err = store.CreateUserActivity(entry(otherID, nine, nine.Add(time.Hour)))
+	assert.NoError(t, err)
+	assert.Nil(t, overlap)
+
+	// Rejected by default
+	_, _, err = store.CreateUserActivity(entry(userID, nine.Add(-30*time.Minute), nine.Add(30*time.Minute)))
+	assert.ErrorIs(t, err, ErrUserActivityOverlaps)
+	_, err = store.UpdateUserActivity(&model.UserActivity{ID: adjacentID, UserID: userID, StartTime: nine.Add(50 * time.Minute),
+		EndTime: nine.Add(90 * time.Minute), Duration: 40 * time.Minute, Mood: 3})
+	assert.ErrorIs(t, err, ErrUserActivityOverlaps)
+
+	// Allowed with a warning
+	store.SetOverlapPolicy(OverlapWarn)
+	warnedID, overlap, err := store.CreateUserActivity(entry(userID, nine.Add(-30*time.Minute), nine.Add(30*time.Minute)))
+	assert.NoError(t, err)
+	assert.Equal(t, &Overlap{UserActivityIDs: []int64{existingID}}, overlap)
+	assert.NoError(t, store.DeleteUserActivity(userID, warnedID))
+
+	// Trimmed to the free part at the start of the range
+	store.SetOverlapPolicy(OverlapTrim)
+	trimmed := entry(userID, nine.Add(-30*time.Minute), nine.Add(30*time.Minute))
+	trimmedID, overlap, err := store.CreateUserActivity(trimmed)
+	assert.NoError(t, err)
+	assert.Equal(t, &Overlap{UserActivityIDs: []int64{existingID}, Trimmed: true}, overlap)
+	assert.True(t, nine.Equal(trimmed.EndTime))
+	retrieved, err := store.GetUserActivity(userID, trimmedID)
+	if err != nil {
+		t.Fatalf("Failed to retrieve user activity: %v", err)
+	}
+	assert.True(t, nine.Equal(retrieved.EndTime))
+	assert.Equal(t, 30*time.Minute, retrieved.Duration)
+
+	// ...or to the part after the entries covering its start
+	trimmed = entry(userID, nine.Add(30*time.Minute), nine.Add(2*time.Hour))
+	_, _, err = store.CreateUserActivity(trimmed)
+	assert.NoError(t, err)
+	assert.True(t, nine.Add(90*time.Minute).Equal(trimmed.StartTime))
+	assert.Equal(t, 30*time.Minute, trimmed.Duration)
+
+	// An entry with no free time left is still rejected
+	_, _, err = store.CreateUserActivity(entry(userID, nine.Add(10*time.Minute), nine.Add(20*time.Minute)))
+	assert.ErrorIs(t, err, ErrUserActivityOverlaps)
+}
+
+func TestListUserActivitiesByAttributes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store testStore) {
+		userID, err := store.CreateUser(&model.User{Username: "filterer", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		activityID, err := store.CreateActivity(&model.Activity{Name: "Running"})
+		if err != nil {
+			t.Fatalf("Failed to create activity: %v", err)
+		}
+
+		base := time.Date(2024, 5, 1, 6, 0, 0, 0, time.UTC)
+		attributes := []model.AdditionalAttributes{
+			{"knee_feeling": "sore", "pain": 6, "outdoor": true},
+			{"knee_feeling": "fine", "pain": 2.5, "outdoor": false},
+			{"knee_feeling": "sore", "pain": "6"},
+			{},
+		}
+		var ids []int64
+		for i, attribute := range attributes {
+			start := base.Add(time.Duration(i) * 24 * time.Hour)
+			id, _, err := store.CreateUserActivity(&model.UserActivity{
+				UserID: userID, ActivityID: activityID, StartTime: start, EndTime: start.Add(time.Hour), Duration: time.Hour, Mood: 3,
+				AdditionalAttributes: attribute,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create user activity: %v", err)
+			}
+			ids = append(ids, id)
+		}
+
+		list := func(filters ...AttributeFilter) []int64 {
+			t.Helper()
+			items, _, err := store.ListUserActivities(UserActivityFilter{UserID: userID, Attributes: filters})
+			if err != nil {
+				t.Fatalf("Failed to list user activities: %v", err)
+			}
+			return idsOf(items)
+		}
+		min, max := 2.0, 5.0
+		exists, missing := true, false
+
+		assert.Equal(t, []int64{ids[0], ids[2]}, list(AttributeFilter{Name: "knee_feeling", Equals: []interface{}{"sore"}}))
+		assert.Equal(t, []int64{ids[0], ids[1], ids[2]}, list(AttributeFilter{Name: "knee_feeling", Equals: []interface{}{"sore", "fine"}}))
+		// Equality compares types too, so the number 6 does not match the string "6"
+		assert.Equal(t, []int64{ids[0]}, list(AttributeFilter{Name: "pain", Equals: []interface{}{6.0}}))
+		assert.Equal(t, []int64{ids[2]}, list(AttributeFilter{Name: "pain", Equals: []interface{}{"6"}}))
+		assert.Equal(t, []int64{ids[1]}, list(AttributeFilter{Name: "outdoor", Equals: []interface{}{false}}))
+		// Ranges only match numbers
+		assert.Equal(t, []int64{ids[1]}, list(AttributeFilter{Name: "pain", Min: &min, Max: &max}))
+		assert.Equal(t, []int64{ids[0], ids[1]}, list(AttributeFilter{Name: "pain", Min: &min}))
+		assert.Equal(t, []int64{ids[0], ids[1]}, list(AttributeFilter{Name: "outdoor", Exists: &exists}))
+		assert.Equal(t, []int64{ids[2], ids[3]}, list(AttributeFilter{Name: "outdoor", Exists: &missing}))
+		// Filters on different attributes must all hold
+		assert.Equal(t, []int64{ids[0]}, list(
+			AttributeFilter{Name: "knee_feeling", Equals: []interface{}{"sore"}},
+			AttributeFilter{Name: "outdoor", Exists: &exists}))
+
+		_, _, err = store.ListUserActivities(UserActivityFilter{UserID: userID, Attributes: []AttributeFilter{{Name: `x") OR 1=1 --`, Exists: &exists}}})
+		assert.ErrorIs(t, err, ErrInvalidAttributeFilter)
+	})
+}
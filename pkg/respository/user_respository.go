@@ -2,26 +2,50 @@ package repository
 
 import (
 	"activity-tracker/pkg/model"
+	"activity-tracker/pkg/password"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 )
 
-// CreateUser creates a new user in the database.
+// ErrUsernameTaken is returned when another user already has the username.
+var ErrUsernameTaken = errors.New("username is already taken")
+
+// ErrLastAdmin is returned when revoking the admin rights of the only admin,
+// which would leave nobody to grant them again.
+var ErrLastAdmin = errors.New("cannot revoke the admin rights of the last admin")
+
+// CreateUser creates a new user in the database. The user's plain text
+// password is hashed before it is stored. Users without a time zone get
+// model.DefaultTimeZone.
 func (r *Repository) CreateUser(user *model.User) (int64, error) {
-	var id int64
-	query := `INSERT INTO users (username, password) VALUES ($1, $2) RETURNING id`
-	err := r.db.QueryRow(query, user.Username, user.Password).Scan(&id)
+	hashed, err := password.Hash(user.Password)
 	if err != nil {
 		return 0, fmt.Errorf("could not create user: %w", err)
 	}
+
+	timeZone := user.TimeZone
+	if timeZone == "" {
+		timeZone = model.DefaultTimeZone
+	}
+
+	var id int64
+	query := `INSERT INTO users (username, password, time_zone) VALUES ($1, $2, $3) RETURNING id`
+	err = r.db.QueryRow(query, user.Username, hashed, timeZone).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, ErrUsernameTaken
+	} else if err != nil {
+		return 0, fmt.Errorf("could not create user: %w", translateError(err))
+	}
 	return id, nil
 }
 
 // GetUser retrieves a user by ID from the database.
 func (r *Repository) GetUser(userID int64) (*model.User, error) {
 	user := &model.User{}
-	query := `SELECT id, username, password, created_at FROM users WHERE id = $1`
-	err := r.db.QueryRow(query, userID).Scan(&user.ID, &user.Username, &user.Password, &user.CreatedAt)
+	query := `SELECT id, username, password, time_zone, is_admin, created_at FROM users WHERE id = $1`
+	err := r.db.QueryRow(query, userID).Scan(&user.ID, &user.Username, &user.Password, &user.TimeZone, &user.IsAdmin, &user.CreatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrUserNotFound
@@ -31,22 +55,135 @@ func (r *Repository) GetUser(userID int64) (*model.User, error) {
 	return user, nil
 }
 
-// UpdateUser updates an existing user in the database.
-func (r *Repository) UpdateUser(user *model.User) error {
-	query := `UPDATE users SET username = $1, password = $2 WHERE id = $3`
-	_, err := r.db.Exec(query, user.Username, user.Password, user.ID)
+// GetUserByUsername retrieves a user by username from the database.
+func (r *Repository) GetUserByUsername(username string) (*model.User, error) {
+	user := &model.User{}
+	query := `SELECT id, username, password, time_zone, is_admin, created_at FROM users WHERE username = $1`
+	err := r.db.QueryRow(query, username).Scan(&user.ID, &user.Username, &user.Password, &user.TimeZone, &user.IsAdmin, &user.CreatedAt)
 	if err != nil {
-		return fmt.Errorf("could not update user: %w", err)
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("could not get user: %w", err)
 	}
-	return nil
+	return user, nil
 }
 
-// DeleteUser deletes a user by ID from the database.
+// UpdateUser updates an existing user in the database. The password is only
+// changed, and hashed, when a new one is given, and the time zone only when
+// one is given.
+func (r *Repository) UpdateUser(user *model.User) error {
+	var args queryArgs
+	assignments := []string{"username = " + args.add(user.Username)}
+	if user.Password != "" {
+		hashed, err := password.Hash(user.Password)
+		if err != nil {
+			return fmt.Errorf("could not update user: %w", err)
+		}
+		assignments = append(assignments, "password = "+args.add(hashed))
+	}
+	if user.TimeZone != "" {
+		assignments = append(assignments, "time_zone = "+args.add(user.TimeZone))
+	}
+
+	query := `UPDATE users SET ` + strings.Join(assignments, ", ") + ` WHERE id = ` + args.add(user.ID)
+	result, err := r.db.Exec(query, args...)
+	if isUniqueViolation(err) {
+		return ErrUsernameTaken
+	} else if err != nil {
+		return fmt.Errorf("could not update user: %w", translateError(err))
+	}
+	return expectAffected(result, ErrUserNotFound)
+}
+
+// DeleteUser deletes a user by ID from the database, along with their user
+// activities and private activities.
 func (r *Repository) DeleteUser(userID int64) error {
-	query := `DELETE FROM users WHERE id = $1`
-	_, err := r.db.Exec(query, userID)
+	tx, err := r.db.Begin()
 	if err != nil {
 		return fmt.Errorf("could not delete user: %w", err)
 	}
+	defer tx.Rollback()
+
+	// The user's private activities are deleted with them, so the records
+	// that refer to those activities must go first
+	for _, table := range []string{"user_activities", "timers", "goals"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE user_id = $1`, userID); err != nil {
+			return fmt.Errorf("could not delete user: %w", err)
+		}
+	}
+	result, err := tx.Exec(`DELETE FROM users WHERE id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("could not delete user: %w", translateError(err))
+	}
+	if err := expectAffected(result, ErrUserNotFound); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not delete user: %w", err)
+	}
 	return nil
 }
+
+// SetUserAdmin grants or revokes a user's right to manage the global activity
+// catalog. The rights of the last admin cannot be revoked.
+func (r *Repository) SetUserAdmin(userID int64, admin bool) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not update user: %w", err)
+	}
+	defer tx.Rollback()
+
+	if !admin {
+		admins, err := lockAdmins(tx, r.dialect)
+		if err != nil {
+			return fmt.Errorf("could not update user: %w", err)
+		}
+		if len(admins) == 1 && admins[0] == userID {
+			return ErrLastAdmin
+		}
+	}
+	result, err := tx.Exec(`UPDATE users SET is_admin = $1 WHERE id = $2`, admin, userID)
+	if err != nil {
+		return fmt.Errorf("could not update user: %w", err)
+	}
+	if err := expectAffected(result, ErrUserNotFound); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not update user: %w", err)
+	}
+	return nil
+}
+
+// lockAdmins returns the IDs of the admins within tx. On Postgres it locks
+// their rows, so that concurrent revokes cannot each leave the other as the
+// last admin; SQLite transactions are serialized already.
+func lockAdmins(tx *sql.Tx, dialect Dialect) ([]int64, error) {
+	query := `SELECT id FROM users WHERE is_admin`
+	if dialect == Postgres {
+		query += ` FOR UPDATE`
+	}
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var admins []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		admins = append(admins, id)
+	}
+	return admins, rows.Err()
+}
+
+// VerifyCredentials returns the user with the given username if the password
+// matches, and ErrInvalidCredentials otherwise.
+func (r *Repository) VerifyCredentials(username, plain string) (*model.User, error) {
+	user, err := r.GetUserByUsername(username)
+	return verifyPassword(user, err, plain)
+}
@@ -2,36 +2,14 @@ package repository
 
 import (
 	"activity-tracker/pkg/model"
-	"database/sql"
-	"fmt"
 	"testing"
 
-	_ "github.com/lib/pq" // PostgreSQL driver
 	"github.com/stretchr/testify/assert"
 )
 
-// TODO: Change this to use in memory sqlite database
-const (
-	host     = "192.168.1.32"
-	port     = 5432
-	user     = "frankyz"
-	password = "5LQimPMPxjMdB1wlJJBX"
-	dbname   = "mudkip"
-)
-
 func TestCreateUser(t *testing.T) {
-	// Setup test database connection
-	psqlInfo := "host=%s port=%d user=%s password=%s dbname=%s sslmode=disable"
-	psqlInfo = fmt.Sprintf(psqlInfo, host, port, user, password, dbname)
-
-	db, err := sql.Open("postgres", psqlInfo)
-	if err != nil {
-		t.Fatalf("Failed to connect to the database: %v", err)
-	}
-	defer db.Close()
-
 	// Initialize repository
-	repo := NewRepository(db)
+	repo := newTestRepository(t)
 
 	// Define test user
 	testUser := &model.User{
@@ -54,10 +32,74 @@ func TestCreateUser(t *testing.T) {
 		t.Fatalf("Failed to retrieve user: %v", err)
 	}
 	assert.Equal(t, testUser.Username, retrievedUser.Username)
+	assert.False(t, retrievedUser.CreatedAt.IsZero())
 
 	// Cleanup: Delete the test user from the database
 	err = repo.DeleteUser(userID)
 	if err != nil {
 		t.Fatalf("Failed to delete test user: %v", err)
 	}
+
+	_, err = repo.GetUser(userID)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestPasswordsAreHashedAndVerified(t *testing.T) {
+	repo := newTestRepository(t)
+
+	userID, err := repo.CreateUser(&model.User{Username: "hashed", Password: "first password"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	stored, err := repo.GetUser(userID)
+	if err != nil {
+		t.Fatalf("Failed to retrieve user: %v", err)
+	}
+	assert.NotEqual(t, "first password", stored.Password)
+
+	user, err := repo.VerifyCredentials("hashed", "first password")
+	assert.NoError(t, err)
+	assert.Equal(t, userID, user.ID)
+
+	_, err = repo.VerifyCredentials("hashed", "wrong password")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = repo.VerifyCredentials("nobody", "first password")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// Updating without a password keeps the existing one
+	err = repo.UpdateUser(&model.User{ID: userID, Username: "renamed"})
+	assert.NoError(t, err)
+	_, err = repo.VerifyCredentials("renamed", "first password")
+	assert.NoError(t, err)
+
+	err = repo.UpdateUser(&model.User{ID: userID, Username: "renamed", Password: "second password"})
+	assert.NoError(t, err)
+	_, err = repo.VerifyCredentials("renamed", "first password")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = repo.VerifyCredentials("renamed", "second password")
+	assert.NoError(t, err)
+}
+
+func TestUserTimeZone(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store testStore) {
+		userID, err := store.CreateUser(&model.User{Username: "traveller", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		user, err := store.GetUser(userID)
+		assert.NoError(t, err)
+		assert.Equal(t, model.DefaultTimeZone, user.TimeZone)
+
+		// Updating without a time zone keeps the existing one
+		assert.NoError(t, store.UpdateUser(&model.User{ID: userID, Username: "traveller", TimeZone: "Asia/Tokyo"}))
+		assert.NoError(t, store.UpdateUser(&model.User{ID: userID, Username: "traveller"}))
+		user, err = store.GetUser(userID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Asia/Tokyo", user.TimeZone)
+
+		location, err := user.Location()
+		assert.NoError(t, err)
+		assert.Equal(t, "Asia/Tokyo", location.String())
+	})
 }
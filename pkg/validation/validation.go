@@ -0,0 +1,114 @@
+// Package validation checks request values against declarative per-field
+// rules and collects every failure, so clients can fix all of them at once.
+package validation
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// FieldError describes why a single field is invalid.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// Errors is the list of field errors found by Validate.
+type Errors []FieldError
+
+// Error joins the field errors into one message.
+func (errs Errors) Error() string {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Field+": "+err.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Check validates one value. It returns a message describing the problem, or
+// "" if the value is valid.
+type Check func() string
+
+// Rule is the list of checks that apply to a field.
+type Rule struct {
+	Field  string
+	Checks []Check
+}
+
+// Field creates a rule that applies checks, in order, to the named field.
+func Field(name string, checks ...Check) Rule {
+	return Rule{Field: name, Checks: checks}
+}
+
+// Validate applies every rule and returns Errors if any of them fail. Only the
+// first failing check of a rule is reported, so a missing value is not also
+// reported as too short.
+func Validate(rules ...Rule) error {
+	var errs Errors
+	for _, rule := range rules {
+		for _, check := range rule.Checks {
+			if message := check(); message != "" {
+				errs = append(errs, FieldError{Field: rule.Field, Message: message})
+				break
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// That fails with message unless ok is true.
+func That(ok bool, message string) Check {
+	return func() string {
+		if !ok {
+			return message
+		}
+		return ""
+	}
+}
+
+// NotBlank fails if value is empty or only whitespace.
+func NotBlank(value string) Check {
+	return That(strings.TrimSpace(value) != "", "must not be blank")
+}
+
+// MinLength fails if value has fewer than min characters.
+func MinLength(value string, min int) Check {
+	return That(utf8.RuneCountInString(value) >= min, fmt.Sprintf("must be at least %d characters", min))
+}
+
+// MaxLength fails if value has more than max characters.
+func MaxLength(value string, max int) Check {
+	return That(utf8.RuneCountInString(value) <= max, fmt.Sprintf("must be at most %d characters", max))
+}
+
+// MaxBytes fails if value is longer than max bytes.
+func MaxBytes(value string, max int) Check {
+	return That(len(value) <= max, fmt.Sprintf("must be at most %d bytes", max))
+}
+
+// Positive fails unless value is greater than zero.
+func Positive(value int64) Check {
+	return That(value > 0, "must be a positive integer")
+}
+
+// Between fails unless min <= value <= max.
+func Between(value, min, max int) Check {
+	return That(value >= min && value <= max, fmt.Sprintf("must be between %d and %d", min, max))
+}
+
+// NotZeroTime fails if value is the zero time, which is what a missing
+// timestamp decodes to.
+func NotZeroTime(value time.Time) Check {
+	return That(!value.IsZero(), "is required")
+}
+
+// NotBefore fails if value is before other, which is the value of the field
+// named otherField.
+func NotBefore(value, other time.Time, otherField string) Check {
+	return That(!value.Before(other), "must not be before "+otherField)
+}
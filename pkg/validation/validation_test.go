@@ -0,0 +1,39 @@
+package validation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	start := time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC)
+
+	err := Validate(
+		Field("username", NotBlank("alice"), MaxLength("alice", 10)),
+		Field("end_time", NotZeroTime(start.Add(time.Hour)), NotBefore(start.Add(time.Hour), start, "start_time")),
+	)
+	assert.NoError(t, err)
+
+	err = Validate(
+		Field("username", NotBlank(" "), MaxLength(" ", 10)),
+		Field("password", MinLength("short", 8)),
+		Field("mood", Between(7, 1, 5)),
+		Field("activity_id", Positive(0)),
+		Field("end_time", NotBefore(start, start.Add(time.Hour), "start_time")),
+	)
+	assert.Equal(t, Errors{
+		{Field: "username", Message: "must not be blank"},
+		{Field: "password", Message: "must be at least 8 characters"},
+		{Field: "mood", Message: "must be between 1 and 5"},
+		{Field: "activity_id", Message: "must be a positive integer"},
+		{Field: "end_time", Message: "must not be before start_time"},
+	}, err)
+}
+
+func TestValidateReportsFirstFailingCheckPerField(t *testing.T) {
+	err := Validate(Field("name", NotBlank(""), MinLength("", 3)))
+	assert.Equal(t, Errors{{Field: "name", Message: "must not be blank"}}, err)
+	assert.EqualError(t, err, "name: must not be blank")
+}